@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -9,6 +11,36 @@ type Config struct {
 	Port              string `mapstructure:"PORT"`
 	Origin            string `mapstructure:"CLIENT_ORIGIN"`
 	GrpcServerAddress string `mapstructure:"GRPC_SERVER_ADDRESS"`
+	// StorageBackend selects the TodoService implementation, one of "mongo" (default), "postgres", "sqlite" or "memory".
+	StorageBackend string `mapstructure:"STORAGE_BACKEND"`
+	SQLitePath     string `mapstructure:"SQLITE_PATH"`
+	PostgresUri    string `mapstructure:"POSTGRES_URI"`
+	// RpcTimeout bounds every RPC that the client did not give a sooner deadline, e.g. "10s". Zero disables it.
+	RpcTimeout time.Duration `mapstructure:"RPC_TIMEOUT"`
+	// IdempotencyWindow is how long the request id of a CreateItem is remembered, e.g. "24h".
+	IdempotencyWindow time.Duration `mapstructure:"IDEMPOTENCY_WINDOW"`
+	// TrashRetention is how long a deleted todo stays in the trash before it is purged, e.g. "720h". Zero keeps it forever.
+	TrashRetention time.Duration `mapstructure:"TRASH_RETENTION"`
+	// TrashReapInterval is how often the trash is checked for todos past their retention, e.g. "1h".
+	TrashReapInterval time.Duration `mapstructure:"TRASH_REAP_INTERVAL"`
+	// ChecklistAutoComplete marks a todo done once every item of its checklist is done, and pending again otherwise.
+	ChecklistAutoComplete bool `mapstructure:"CHECKLIST_AUTO_COMPLETE"`
+	// ParentCompletion is what marking a todo done does to its open descendants: "ignore" (default), "block" or "cascade".
+	ParentCompletion string `mapstructure:"PARENT_COMPLETION"`
+	// ReminderInterval is how often the reminders due are looked for, e.g. "30s". Zero disables the reminders.
+	ReminderInterval time.Duration `mapstructure:"REMINDER_INTERVAL"`
+	// ReminderLease is how long a replica has to deliver the reminders it claimed before another one takes them over.
+	ReminderLease time.Duration `mapstructure:"REMINDER_LEASE"`
+	// Notifier delivers the reminders, one of "log" (default), "webhook" or "smtp".
+	Notifier   string `mapstructure:"NOTIFIER"`
+	WebhookURL string `mapstructure:"WEBHOOK_URL"`
+	// SMTPAddr is the host:port of the SMTP server. The credentials are optional, unauthenticated when unset.
+	SMTPAddr     string `mapstructure:"SMTP_ADDR"`
+	SMTPUsername string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword string `mapstructure:"SMTP_PASSWORD"`
+	SMTPFrom     string `mapstructure:"SMTP_FROM"`
+	// SMTPRecipientDomain completes the users that are not email addresses, e.g. "example.com".
+	SMTPRecipientDomain string `mapstructure:"SMTP_RECIPIENT_DOMAIN"`
 }
 
 func LoadConfig(path string) (config Config, err error) {
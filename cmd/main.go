@@ -2,14 +2,20 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log"
 	"net"
 	"os"
+	// The Time_zone of GetAll must load on hosts without a time zone database.
+	_ "time/tzdata"
 
 	g "github.com/todo-project/server/grpc"
 
 	"github.com/gin-gonic/gin"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/todo-project/notify"
 	"github.com/todo-project/pb"
 	"github.com/todo-project/services"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -23,6 +29,7 @@ var (
 	server      *gin.Engine
 	ctx         context.Context
 	mongoClient *mongo.Client
+	sqlDB       *sql.DB
 
 	// Creating Todo Variables
 	todoService    services.TodoService
@@ -37,6 +44,43 @@ func init() {
 
 	ctx = context.TODO()
 
+	parentCompletion, err := services.ParseCompletionPolicy(config.ParentCompletion)
+	if err != nil {
+		log.Fatal("Invalid PARENT_COMPLETION: ", err)
+	}
+	opts := services.Options{
+		IdempotencyWindow:     config.IdempotencyWindow,
+		AutoCompleteChecklist: config.ChecklistAutoComplete,
+		ParentCompletion:      parentCompletion,
+	}
+
+	//  Instantiate the Constructors
+	switch config.StorageBackend {
+	case "memory":
+		fmt.Println("Using in-memory storage, todos will be lost on restart")
+		todoService = services.NewInMemoryTodoService(opts)
+	case "postgres":
+		connectPostgres(config)
+		todoService = services.NewPostgresTodoService(sqlDB, opts)
+	case "sqlite":
+		connectSQLite(config)
+		todoService = services.NewSQLiteTodoService(sqlDB, opts)
+	case "", "mongo":
+		connectMongo(config)
+		todoCollection = mongoClient.Database("golang_mongodb").Collection("todos")
+		// The indexes are idempotent, so there is no separate migrate step for mongo.
+		if err := services.MigrateMongo(ctx, todoCollection); err != nil {
+			panic(err)
+		}
+		todoService = services.NewTodoService(todoCollection, opts)
+	default:
+		log.Fatal("Unknown storage backend: ", config.StorageBackend)
+	}
+
+	server = gin.Default()
+}
+
+func connectMongo(config Config) {
 	// Connect to MongoDB
 	// Try to find if mongodb uri is supplied from the env.
 	mongoDBURL := os.Getenv("MONGODB")
@@ -47,8 +91,9 @@ func init() {
 		fmt.Println("got mongodb url from env:", mongoDBURL)
 	}
 	mongoconn := options.Client().ApplyURI(mongoDBURL)
-	mongoClient, err := mongo.Connect(ctx, mongoconn)
 
+	var err error
+	mongoClient, err = mongo.Connect(ctx, mongoconn)
 	if err != nil {
 		panic(err)
 	}
@@ -58,12 +103,35 @@ func init() {
 	}
 
 	fmt.Println("MongoDB successfully connected...")
+}
 
-	//  Instantiate the Constructors
-	todoCollection = mongoClient.Database("golang_mongodb").Collection("todos")
-	todoService = services.NewTodoService(todoCollection, ctx)
+func connectSQLite(config Config) {
+	var err error
+	sqlDB, err = sql.Open("sqlite3", config.SQLitePath+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		panic(err)
+	}
 
-	server = gin.Default()
+	// SQLite is embedded, so there is no separate deployment step to run the migrations from.
+	if err := services.MigrateSQLite(ctx, sqlDB); err != nil {
+		panic(err)
+	}
+
+	fmt.Println("SQLite database ready at", config.SQLitePath)
+}
+
+func connectPostgres(config Config) {
+	var err error
+	sqlDB, err = sql.Open("postgres", config.PostgresUri)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := sqlDB.PingContext(ctx); err != nil {
+		panic(err)
+	}
+
+	fmt.Println("Postgres successfully connected...")
 }
 
 func main() {
@@ -73,11 +141,83 @@ func main() {
 		log.Fatal("Could not load config", err)
 	}
 
-	defer mongoClient.Disconnect(ctx)
+	if mongoClient != nil {
+		defer mongoClient.Disconnect(ctx)
+	}
+	if sqlDB != nil {
+		defer sqlDB.Close()
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrations(config)
+		return
+	}
+
+	if config.StorageBackend == "postgres" {
+		// Postgres migrations are a separate deployment step, see the migrate subcommand.
+		if err := services.CheckPostgresSchema(ctx, sqlDB); err != nil {
+			log.Fatal("Postgres schema is not up to date, run the migrate subcommand: ", err)
+		}
+	}
+
+	if config.TrashRetention > 0 {
+		if config.TrashReapInterval <= 0 {
+			log.Fatal("TRASH_REAP_INTERVAL must be positive when TRASH_RETENTION is set")
+		}
+		go services.RunReaper(ctx, todoService, config.TrashRetention, config.TrashReapInterval)
+	}
+	if config.ReminderInterval > 0 {
+		if config.ReminderLease <= 0 {
+			log.Fatal("REMINDER_LEASE must be positive, the reminders would be delivered more than once")
+		}
+		go services.RunReminders(ctx, todoService, newNotifier(config), config.ReminderInterval, config.ReminderLease)
+	}
 
 	startGrpcServer(config)
 }
 
+// newNotifier returns the Notifier delivering the reminders.
+func newNotifier(config Config) notify.Notifier {
+	switch config.Notifier {
+	case "", "log":
+		return &notify.LogNotifier{}
+	case "webhook":
+		if len(config.WebhookURL) == 0 {
+			log.Fatal("WEBHOOK_URL is required by the webhook notifier")
+		}
+		return &notify.WebhookNotifier{URL: config.WebhookURL}
+	case "smtp":
+		return &notify.SMTPNotifier{
+			Addr:            config.SMTPAddr,
+			From:            config.SMTPFrom,
+			Username:        config.SMTPUsername,
+			Password:        config.SMTPPassword,
+			RecipientDomain: config.SMTPRecipientDomain,
+		}
+	default:
+		log.Fatal("Unknown notifier: ", config.Notifier)
+		return nil
+	}
+}
+
+// runMigrations applies the pending schema migrations of the configured backend.
+func runMigrations(config Config) {
+	var err error
+	switch config.StorageBackend {
+	case "postgres":
+		err = services.MigratePostgres(ctx, sqlDB)
+	case "sqlite":
+		err = services.MigrateSQLite(ctx, sqlDB)
+	default:
+		fmt.Println("Nothing to migrate for storage backend:", config.StorageBackend)
+		return
+	}
+	if err != nil {
+		log.Fatal("cannot migrate database: ", err)
+	}
+	fmt.Println("Database schema is up to date")
+}
+
 func startGrpcServer(config Config) {
 
 	todoServer, err := g.NewGrpcTodoServer(todoCollection, todoService)
@@ -85,7 +225,10 @@ func startGrpcServer(config Config) {
 		log.Fatal("cannot create grpc todoServer: ", err)
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := grpc.NewServer(
+		grpc.UnaryInterceptor(g.TimeoutUnaryInterceptor(config.RpcTimeout)),
+		grpc.StreamInterceptor(g.TimeoutStreamInterceptor(config.RpcTimeout)),
+	)
 
 	// 👇 Register the Todo gRPC service
 	pb.RegisterToDoServiceServer(grpcServer, todoServer)
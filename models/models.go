@@ -1,6 +1,9 @@
 package models
 
 import (
+	"time"
+
+	"github.com/todo-project/pb"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -8,6 +11,21 @@ type CreateTodoRequest struct {
 	Title       string `json:"title" bson:"title" binding:"required"`
 	Description string `json:"description" bson:"description" binding:"required"`
 	User        string `json:"user" bson:"user" binding:"required"`
+	// DueAt is when the Todo is due, the zero time for a Todo without due time.
+	DueAt    time.Time   `json:"due_at,omitempty" bson:"due_at,omitempty"`
+	Priority pb.Priority `json:"priority,omitempty" bson:"priority,omitempty"`
+	Tags     []string    `json:"tags,omitempty" bson:"tags,omitempty"`
+	// ParentId is the hex Id of the parent Todo, empty for a top-level Todo.
+	ParentId string `json:"parent_id,omitempty" bson:"-"`
+	// Recurrence is the RFC 5545 rule of a recurring Todo, empty for a Todo that does not recur.
+	Recurrence string `json:"recurrence,omitempty" bson:"-"`
+	// Reminders are the times to remind the user of the Todo.
+	Reminders []time.Time `json:"reminders,omitempty" bson:"-"`
+	// ListId is the hex Id of a List of the User, empty for a Todo in the Inbox.
+	ListId string `json:"list_id,omitempty" bson:"-"`
+	// RequestId makes the create idempotent, a retry with the same RequestId and User returns the Todo created by
+	// the first attempt. It is optional.
+	RequestId string `json:"-" bson:"-"`
 }
 
 type Todo struct {
@@ -16,11 +34,216 @@ type Todo struct {
 	Description string             `json:"description,omitempty" bson:"description,omitempty"`
 	User        string             `json:"user,omitempty" bson:"user,omitempty"`
 	Done        bool               `json:"done,omitempty" bson:"done,omitempty"`
+	CreatedAt   time.Time          `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	UpdatedAt   time.Time          `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+	// Version starts at 1 and is incremented by every update, it is 0 for Todos stored before it was tracked.
+	Version int64 `json:"version,omitempty" bson:"version,omitempty"`
+	// DeletedAt is set while the Todo is in the trash.
+	DeletedAt time.Time `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+	// DueAt is the zero time for a Todo without due time.
+	DueAt time.Time `json:"due_at,omitempty" bson:"due_at,omitempty"`
+	// Priority is NONE for Todos stored before it was tracked.
+	Priority pb.Priority `json:"priority,omitempty" bson:"priority,omitempty"`
+	// Tags are unique, in the order they were given. A Todo without tags has nil Tags.
+	Tags []string `json:"tags,omitempty" bson:"tags,omitempty"`
+	// Checklist holds the steps of the Todo in order, it is nil for a Todo without checklist.
+	Checklist []ChecklistItem `json:"checklist,omitempty" bson:"checklist,omitempty"`
+	// ParentId is the zero ObjectID for a top-level Todo. The parent may be in the trash, or purged, while the Todo
+	// is not: the Todo is then left out of the subtree queries of its former ancestors.
+	ParentId primitive.ObjectID `json:"parent_id,omitempty" bson:"parent_id,omitempty"`
+	// Recurrence is the RRULE of a recurring Todo, without DTSTART: the next occurrence is computed from the due time
+	// of this one. A COUNT is the number of occurrences left, this one included.
+	Recurrence string `json:"recurrence,omitempty" bson:"recurrence,omitempty"`
+	// NextOccurrenceId is set once the Todo is marked done and the next occurrence of its series is created, it is
+	// the zero ObjectID otherwise.
+	NextOccurrenceId primitive.ObjectID `json:"next_occurrence_id,omitempty" bson:"next_occurrence_id,omitempty"`
+	// Reminders are in chronological order, without duplicates. A Todo without reminders has nil Reminders.
+	Reminders []Reminder `json:"reminders,omitempty" bson:"reminders,omitempty"`
+	// NextReminderAt is the time of the first reminder not sent yet, the zero time when there is none. It is kept
+	// along with Reminders, for the scheduler to find the reminders due.
+	NextReminderAt time.Time `json:"next_reminder_at,omitempty" bson:"next_reminder_at,omitempty"`
+	// ReminderLease is set while a scheduler delivers the reminders of the Todo, the other schedulers leave them
+	// alone until then. ReminderClaim identifies the claim of that scheduler.
+	ReminderLease time.Time `json:"reminder_lease,omitempty" bson:"reminder_lease,omitempty"`
+	ReminderClaim string    `json:"reminder_claim,omitempty" bson:"reminder_claim,omitempty"`
+	// ListId is the List of the Todo, the zero ObjectID for a Todo in the Inbox of its user.
+	ListId primitive.ObjectID `json:"list_id,omitempty" bson:"list_id,omitempty"`
+	// Position ranks the Todo in the manual order of its user, the strings sort in that order. A new Todo takes its
+	// Id as Position, which puts it after the Todos created before it.
+	Position string `json:"position,omitempty" bson:"position,omitempty"`
+	// CommentCount is the number of Comments on the Todo. It is kept along with the Comments, adding or deleting
+	// one does not change the version of the Todo.
+	CommentCount int64 `json:"comment_count,omitempty" bson:"comment_count,omitempty"`
+}
+
+// Reminder is a time to remind the user of a Todo.
+type Reminder struct {
+	At time.Time `json:"at" bson:"at"`
+	// SentAt is set once the reminder is delivered.
+	SentAt time.Time `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+}
+
+// ReminderClaim is a Todo with reminders due, claimed by a scheduler to deliver them.
+type ReminderClaim struct {
+	Todo *Todo
+	// Id tells the claim apart from the ones made before or after it, on the same Todo.
+	Id string
+	// Due are the times of the reminders to deliver, in order.
+	Due []time.Time
+}
+
+// ChecklistItem is a step of a Todo. Its Id is only unique within the checklist of the Todo.
+type ChecklistItem struct {
+	Id   string `json:"id" bson:"id"`
+	Text string `json:"text" bson:"text"`
+	Done bool   `json:"done" bson:"done"`
+}
+
+// TagCount is the number of Todos of a user carrying a tag.
+type TagCount struct {
+	Tag   string
+	Count int64
 }
 
+// Trashed reports whether the Todo is in the trash.
+func (t *Todo) Trashed() bool {
+	return !t.DeletedAt.IsZero()
+}
+
+// ChecklistProgress returns how many items of the checklist are done, out of how many.
+func (t *Todo) ChecklistProgress() (done, total int) {
+	for _, item := range t.Checklist {
+		if item.Done {
+			done++
+		}
+	}
+	return done, len(t.Checklist)
+}
+
+// UpdateTodo is a partial update, the nil fields are left untouched. A non nil field is always applied, even when
+// it points to the zero value, so a Todo can be reopened or have its description cleared.
 type UpdateTodo struct {
-	Title       string `json:"title,omitempty" bson:"title,omitempty"`
-	Description string `json:"description,omitempty" bson:"description,omitempty"`
-	User        string `json:"user,omitempty" bson:"user,omitempty"`
-	Done        bool   `json:"done,omitempty" bson:"done,omitempty"`
+	Title       *string `json:"title,omitempty" bson:"title,omitempty"`
+	Description *string `json:"description,omitempty" bson:"description,omitempty"`
+	User        *string `json:"user,omitempty" bson:"user,omitempty"`
+	Done        *bool   `json:"done,omitempty" bson:"done,omitempty"`
+	// DueAt pointing to the zero time removes the due time. It is not part of the Mongo $set, a removal is an $unset.
+	DueAt    *time.Time   `json:"due_at,omitempty" bson:"-"`
+	Priority *pb.Priority `json:"priority,omitempty" bson:"priority,omitempty"`
+	// Tags replace the current ones when not nil, an empty slice removes them all. Like DueAt it is not part of the
+	// Mongo $set.
+	Tags []string `json:"tags,omitempty" bson:"-"`
+	// ParentId moves the Todo under the Todo with that hex Id, an empty one makes it a top-level Todo. Like DueAt
+	// it is not part of the Mongo $set.
+	ParentId *string `json:"parent_id,omitempty" bson:"-"`
+	// Recurrence replaces the recurrence rule, an empty one ends the series. Like DueAt it is not part of the Mongo
+	// $set.
+	Recurrence *string `json:"recurrence,omitempty" bson:"-"`
+	// Reminders replace the current ones when not nil, an empty slice removes them all. The reminders kept at the
+	// same time are not sent again. Like DueAt it is not part of the Mongo $set.
+	Reminders []time.Time `json:"reminders,omitempty" bson:"-"`
+	// ListId moves the Todo to the List with that hex Id, an empty one moves it to the Inbox. Like DueAt it is not
+	// part of the Mongo $set.
+	ListId *string `json:"list_id,omitempty" bson:"-"`
+	// ExpectedVersion makes the update fail unless the Todo is still at that version, 0 skips the check.
+	ExpectedVersion int64 `json:"-" bson:"-"`
+}
+
+// MoveTodo places a Todo right before or after another Todo of its user, exactly one of BeforeId and AfterId is set.
+type MoveTodo struct {
+	BeforeId string
+	AfterId  string
+	// ExpectedVersion makes the move fail unless the Todo is still at that version, 0 skips the check.
+	ExpectedVersion int64
+}
+
+// BatchUpdateItem is one Todo of a batch update.
+type BatchUpdateItem struct {
+	Id     string
+	Update *UpdateTodo
+}
+
+// BatchDeleteItem is one Todo of a batch delete, ExpectedVersion 0 skips the version check.
+type BatchDeleteItem struct {
+	Id              string
+	ExpectedVersion int64
+}
+
+// TodoQuery selects, orders and pages the Todos returned by GetAllTodos.
+type TodoQuery struct {
+	Status pb.GetItemsRequest_TodoStatus
+	User   string
+	// PageSize of 0 returns every matching Todo.
+	PageSize   int
+	PageToken  string
+	SortBy     pb.GetItemsRequest_SortBy
+	Descending bool
+	// Trashed selects the Todos in the trash instead of the others, they are ordered by deletion time and SortBy
+	// is ignored.
+	Trashed bool
+	// The due time filters leave out the Todos without due time. DueAfter is inclusive and DueBefore exclusive, the
+	// zero time leaves the bound open.
+	DueAfter  time.Time
+	DueBefore time.Time
+	// Overdue selects the pending Todos whose due time has passed.
+	Overdue bool
+	// DueToday, when set, selects the Todos due on the current day in that location.
+	DueToday *time.Location
+	// MinPriority selects the Todos at least that urgent, NONE selects them all.
+	MinPriority pb.Priority
+	// TagsAny selects the Todos with at least one of the tags, TagsAll those with all of them and TagsNone those
+	// with none of them. Empty lists select every Todo.
+	TagsAny  []string
+	TagsAll  []string
+	TagsNone []string
+	// SubtreeOf selects the Todo with that hex Id and its descendants, when set.
+	SubtreeOf string
+	// ListId, when set, selects the Todos of the List with that hex Id, or those of the Inbox when empty.
+	ListId *string
+}
+
+// List groups Todos of a user. Every user also has an Inbox, holding the Todos without List, which is not stored.
+type List struct {
+	// Id is the zero ObjectID for the Inbox.
+	Id        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	User      string             `json:"user,omitempty" bson:"user,omitempty"`
+	Name      string             `json:"name,omitempty" bson:"name,omitempty"`
+	CreatedAt time.Time          `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	UpdatedAt time.Time          `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+	// Version starts at 1 and is incremented by every update.
+	Version int64 `json:"version,omitempty" bson:"version,omitempty"`
+}
+
+// Inbox reports whether the List is the Inbox of its user.
+func (l *List) Inbox() bool {
+	return l.Id.IsZero()
+}
+
+type CreateListRequest struct {
+	User string
+	Name string
+}
+
+// UpdateList is a partial update of a List, the nil fields are left untouched.
+type UpdateList struct {
+	Name *string
+	// ExpectedVersion makes the update fail unless the List is still at that version, 0 skips the check.
+	ExpectedVersion int64
+}
+
+// Comment is a note left on a Todo. Its Body is markdown, stored as written.
+type Comment struct {
+	Id        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
+	TodoId    primitive.ObjectID `json:"todo_id,omitempty" bson:"todo_id,omitempty"`
+	Author    string             `json:"author,omitempty" bson:"author,omitempty"`
+	Body      string             `json:"body,omitempty" bson:"body,omitempty"`
+	CreatedAt time.Time          `json:"created_at,omitempty" bson:"created_at,omitempty"`
+	UpdatedAt time.Time          `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
+	// Version starts at 1 and is incremented by every edit.
+	Version int64 `json:"version,omitempty" bson:"version,omitempty"`
+}
+
+type CreateCommentRequest struct {
+	Author string
+	Body   string
 }
@@ -0,0 +1,58 @@
+// Package notify delivers the reminders of the Todos.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/todo-project/models"
+)
+
+// Reminder is a reminder of a Todo, due at At.
+type Reminder struct {
+	Todo *models.Todo
+	At   time.Time
+}
+
+// Notifier delivers reminders. Notify returns once the reminder is handed over, or the error that prevented it: the
+// reminder is then delivered again later. A reminder may be delivered more than once when a scheduler stops
+// between the delivery and its acknowledgement.
+type Notifier interface {
+	Notify(ctx context.Context, reminder *Reminder) error
+}
+
+// LogNotifier writes the reminders to a logger, for local development.
+type LogNotifier struct {
+	// Logger defaults to the standard logger.
+	Logger *log.Logger
+}
+
+func (n *LogNotifier) Notify(_ context.Context, reminder *Reminder) error {
+	logf := log.Printf
+	if n.Logger != nil {
+		logf = n.Logger.Printf
+	}
+	logf("reminder for todo %s of user %q: %s", reminder.Todo.Id.Hex(), reminder.Todo.User, subject(reminder))
+	return nil
+}
+
+// subject is the one line summary of a reminder.
+func subject(reminder *Reminder) string {
+	return "Reminder: " + reminder.Todo.Title
+}
+
+// body is the plain text description of a reminder.
+func body(reminder *Reminder) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n", reminder.Todo.Title)
+	if !reminder.Todo.DueAt.IsZero() {
+		fmt.Fprintf(&b, "Due at %s\n", reminder.Todo.DueAt.Format(time.RFC1123))
+	}
+	if len(reminder.Todo.Description) != 0 {
+		fmt.Fprintf(&b, "\n%s\n", reminder.Todo.Description)
+	}
+	return b.String()
+}
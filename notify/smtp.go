@@ -0,0 +1,78 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strings"
+	"time"
+)
+
+// ErrNoRecipient is returned when the user of a Todo is not an email address and there is no domain to complete it.
+var ErrNoRecipient = errors.New("no email address for the user")
+
+// SMTPNotifier mails the reminders through an SMTP server. The recipient is the user of the Todo when it is an email
+// address, the user at RecipientDomain otherwise.
+type SMTPNotifier struct {
+	// Addr is the host:port of the server.
+	Addr string
+	From string
+	// Username and Password authenticate with PLAIN auth when set, which net/smtp only allows over TLS or with a
+	// server on localhost.
+	Username string
+	Password string
+	// RecipientDomain completes the users that are not email addresses, they are not mailed when it is empty.
+	RecipientDomain string
+}
+
+func (n *SMTPNotifier) Notify(ctx context.Context, reminder *Reminder) error {
+	to, err := n.recipient(reminder.Todo.User)
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if len(n.Username) != 0 {
+		host, _, err := net.SplitHostPort(n.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", n.Username, n.Password, host)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// net/smtp does not take a context, the delivery is only bounded by the server.
+	return smtp.SendMail(n.Addr, auth, n.From, []string{to}, n.message(to, reminder))
+}
+
+func (n *SMTPNotifier) recipient(user string) (string, error) {
+	if strings.Contains(user, "@") {
+		return user, nil
+	}
+	if len(n.RecipientDomain) == 0 {
+		return "", fmt.Errorf("%w: %q", ErrNoRecipient, user)
+	}
+	return user + "@" + n.RecipientDomain, nil
+}
+
+// message is the RFC 5322 message of a reminder, with CRLF line endings.
+func (n *SMTPNotifier) message(to string, reminder *Reminder) []byte {
+	var b strings.Builder
+	header := func(name, value string) {
+		b.WriteString(name + ": " + value + "\r\n")
+	}
+	header("From", n.From)
+	header("To", to)
+	header("Subject", mime.QEncoding.Encode("utf-8", subject(reminder)))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	header("Content-Type", "text/plain; charset=utf-8")
+	header("Content-Transfer-Encoding", "8bit")
+	b.WriteString("\r\n")
+	text := strings.ReplaceAll(body(reminder), "\r\n", "\n")
+	b.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	return []byte(b.String())
+}
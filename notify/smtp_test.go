@@ -0,0 +1,128 @@
+package notify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"github.com/todo-project/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// fakeSMTPBackend keeps the messages it receives, without authentication.
+type fakeSMTPBackend struct {
+	mu       sync.Mutex
+	messages []fakeMessage
+}
+
+type fakeMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+func (b *fakeSMTPBackend) Login(_ *smtp.ConnectionState, _, _ string) (smtp.Session, error) {
+	return nil, smtp.ErrAuthUnsupported
+}
+
+func (b *fakeSMTPBackend) AnonymousLogin(_ *smtp.ConnectionState) (smtp.Session, error) {
+	return &fakeSMTPSession{backend: b}, nil
+}
+
+type fakeSMTPSession struct {
+	backend *fakeSMTPBackend
+	message fakeMessage
+}
+
+func (s *fakeSMTPSession) Mail(from string, _ smtp.MailOptions) error {
+	s.message.from = from
+	return nil
+}
+
+func (s *fakeSMTPSession) Rcpt(to string) error {
+	s.message.to = append(s.message.to, to)
+	return nil
+}
+
+func (s *fakeSMTPSession) Data(r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.message.data = string(b)
+	s.backend.mu.Lock()
+	defer s.backend.mu.Unlock()
+	s.backend.messages = append(s.backend.messages, s.message)
+	return nil
+}
+
+func (s *fakeSMTPSession) Reset() {
+	s.message = fakeMessage{}
+}
+
+func (s *fakeSMTPSession) Logout() error {
+	return nil
+}
+
+// newFakeSMTPServer starts an SMTP server on localhost, stopped at the end of the test.
+func newFakeSMTPServer(t *testing.T) (string, *fakeSMTPBackend) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("cannot listen: %v", err)
+	}
+	backend := &fakeSMTPBackend{}
+	server := smtp.NewServer(backend)
+	server.Domain = "localhost"
+	go server.Serve(listener)
+	t.Cleanup(func() { server.Close() })
+	return listener.Addr().String(), backend
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, backend := newFakeSMTPServer(t)
+	n := &SMTPNotifier{Addr: addr, From: "todo@example.com", RecipientDomain: "example.com"}
+
+	todo := &models.Todo{
+		Id:          primitive.NewObjectID(),
+		User:        "jane",
+		Title:       "Pay the rent",
+		Description: "before noon\n.\nthe dot line is escaped",
+		DueAt:       time.Date(2030, time.February, 1, 9, 0, 0, 0, time.UTC),
+	}
+	if err := n.Notify(context.TODO(), &Reminder{Todo: todo, At: todo.DueAt.Add(-time.Hour)}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	todo.User = "joe@example.org"
+	if err := n.Notify(context.TODO(), &Reminder{Todo: todo, At: todo.DueAt}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	if len(backend.messages) != 2 {
+		t.Fatalf("server received %d messages, want 2", len(backend.messages))
+	}
+	first := backend.messages[0]
+	if first.from != "todo@example.com" || len(first.to) != 1 || first.to[0] != "jane@example.com" {
+		t.Errorf("first message from %q to %q", first.from, first.to)
+	}
+	for _, want := range []string{"Subject: Reminder: Pay the rent\r\n", "\r\n\r\nPay the rent\r\n", "\r\n.\r\nthe dot line"} {
+		if !strings.Contains(first.data, want) {
+			t.Errorf("first message does not contain %q:\n%s", want, first.data)
+		}
+	}
+	if to := backend.messages[1].to; len(to) != 1 || to[0] != "joe@example.org" {
+		t.Errorf("second message to %q, want the user address", to)
+	}
+
+	n.RecipientDomain = ""
+	todo.User = "jane"
+	if err := n.Notify(context.TODO(), &Reminder{Todo: todo, At: todo.DueAt}); !errors.Is(err, ErrNoRecipient) {
+		t.Errorf("Notify() error = %v, want %v", err, ErrNoRecipient)
+	}
+}
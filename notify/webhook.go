@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WebhookNotifier posts the reminders as JSON to URL. A response out of the 2xx range fails the delivery.
+type WebhookNotifier struct {
+	URL string
+	// Client defaults to a client giving up after 10 seconds.
+	Client *http.Client
+}
+
+var defaultWebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// webhookPayload is the body of the webhook requests.
+type webhookPayload struct {
+	TodoId      string     `json:"todo_id"`
+	User        string     `json:"user"`
+	Title       string     `json:"title"`
+	Description string     `json:"description,omitempty"`
+	DueAt       *time.Time `json:"due_at,omitempty"`
+	RemindAt    time.Time  `json:"remind_at"`
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, reminder *Reminder) error {
+	payload := webhookPayload{
+		TodoId:      reminder.Todo.Id.Hex(),
+		User:        reminder.Todo.User,
+		Title:       reminder.Todo.Title,
+		Description: reminder.Todo.Description,
+		RemindAt:    reminder.At,
+	}
+	if !reminder.Todo.DueAt.IsZero() {
+		payload.DueAt = &reminder.Todo.DueAt
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := n.Client
+	if client == nil {
+		client = defaultWebhookClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("webhook answered %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/todo-project/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var got webhookPayload
+	status := http.StatusNoContent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("decoding the payload: %v", err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	remindAt := time.Date(2030, time.January, 4, 17, 0, 0, 0, time.UTC)
+	todo := &models.Todo{Id: primitive.NewObjectID(), User: "1", Title: "standup", DueAt: remindAt.Add(time.Hour)}
+	n := &WebhookNotifier{URL: server.URL}
+	if err := n.Notify(context.TODO(), &Reminder{Todo: todo, At: remindAt}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if got.TodoId != todo.Id.Hex() || got.Title != "standup" || !got.RemindAt.Equal(remindAt) || got.DueAt == nil ||
+		!got.DueAt.Equal(todo.DueAt) {
+		t.Errorf("Notify() posted %+v", got)
+	}
+
+	status = http.StatusBadGateway
+	if err := n.Notify(context.TODO(), &Reminder{Todo: todo, At: remindAt}); err == nil {
+		t.Errorf("Notify() error = nil, want the failed status")
+	}
+}
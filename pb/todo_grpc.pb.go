@@ -28,10 +28,56 @@ type ToDoServiceClient interface {
 	Get(ctx context.Context, in *GetItemByID, opts ...grpc.CallOption) (*TodoResponse, error)
 	// Update todo Item
 	Update(ctx context.Context, in *UpdateItemRequest, opts ...grpc.CallOption) (*TodoResponse, error)
-	// Delete todo Item
+	// Move todo Item to the trash
 	Delete(ctx context.Context, in *DeleteItemRequest, opts ...grpc.CallOption) (*DeleteItemResponse, error)
 	// Get all todo Items
 	GetAll(ctx context.Context, in *GetItemsRequest, opts ...grpc.CallOption) (ToDoService_GetAllClient, error)
+	// Create many todo Items at once
+	BatchCreate(ctx context.Context, in *BatchCreateRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	// Update many todo Items at once
+	BatchUpdate(ctx context.Context, in *BatchUpdateRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	// Move many todo Items to the trash at once
+	BatchDelete(ctx context.Context, in *BatchDeleteRequest, opts ...grpc.CallOption) (*BatchResponse, error)
+	// Take todo Item out of the trash
+	Restore(ctx context.Context, in *RestoreItemRequest, opts ...grpc.CallOption) (*TodoResponse, error)
+	// Get the todo Items in the trash, most recently deleted first
+	ListTrash(ctx context.Context, in *ListTrashRequest, opts ...grpc.CallOption) (ToDoService_ListTrashClient, error)
+	// Permanently remove todo Item from the trash
+	Purge(ctx context.Context, in *PurgeItemRequest, opts ...grpc.CallOption) (*PurgeItemResponse, error)
+	// Get the tags of a user, with the number of todo Items carrying each
+	ListTags(ctx context.Context, in *ListTagsRequest, opts ...grpc.CallOption) (*ListTagsResponse, error)
+	// Rename a tag on every todo Item of a user
+	RenameTag(ctx context.Context, in *RenameTagRequest, opts ...grpc.CallOption) (*RenameTagResponse, error)
+	// Add an item at the end of the checklist of a todo Item
+	AddChecklistItem(ctx context.Context, in *AddChecklistItemRequest, opts ...grpc.CallOption) (*TodoResponse, error)
+	// Mark a checklist item done or pending
+	ToggleChecklistItem(ctx context.Context, in *ToggleChecklistItemRequest, opts ...grpc.CallOption) (*TodoResponse, error)
+	// Put the items of a checklist in a new order
+	ReorderChecklist(ctx context.Context, in *ReorderChecklistRequest, opts ...grpc.CallOption) (*TodoResponse, error)
+	// Remove an item from the checklist of a todo Item
+	RemoveChecklistItem(ctx context.Context, in *RemoveChecklistItemRequest, opts ...grpc.CallOption) (*TodoResponse, error)
+	// Move a recurring todo Item to the next occurrence of its series, without completing it
+	SkipOccurrence(ctx context.Context, in *SkipOccurrenceRequest, opts ...grpc.CallOption) (*TodoResponse, error)
+	// Place a todo Item right before or after another todo Item of its list, in the POSITION order
+	Move(ctx context.Context, in *MoveItemRequest, opts ...grpc.CallOption) (*TodoResponse, error)
+	// Create a list of todo Items for a user
+	CreateList(ctx context.Context, in *CreateListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// Get a list based on its ID
+	GetList(ctx context.Context, in *GetListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// Rename a list
+	UpdateList(ctx context.Context, in *UpdateListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// Delete a list, its todo Items are moved to the Inbox or to the trash
+	DeleteList(ctx context.Context, in *DeleteListRequest, opts ...grpc.CallOption) (*DeleteListResponse, error)
+	// Get the lists of a user, starting with their Inbox
+	ListLists(ctx context.Context, in *ListListsRequest, opts ...grpc.CallOption) (*ListListsResponse, error)
+	// Add a comment to a todo Item
+	AddComment(ctx context.Context, in *AddCommentRequest, opts ...grpc.CallOption) (*CommentResponse, error)
+	// Edit the body of a comment
+	UpdateComment(ctx context.Context, in *UpdateCommentRequest, opts ...grpc.CallOption) (*CommentResponse, error)
+	// Delete a comment
+	DeleteComment(ctx context.Context, in *DeleteCommentRequest, opts ...grpc.CallOption) (*DeleteCommentResponse, error)
+	// Get the comments of a todo Item, oldest first
+	ListComments(ctx context.Context, in *ListCommentsRequest, opts ...grpc.CallOption) (*ListCommentsResponse, error)
 }
 
 type toDoServiceClient struct {
@@ -110,6 +156,236 @@ func (x *toDoServiceGetAllClient) Recv() (*ToDo, error) {
 	return m, nil
 }
 
+func (c *toDoServiceClient) BatchCreate(ctx context.Context, in *BatchCreateRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/BatchCreate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) BatchUpdate(ctx context.Context, in *BatchUpdateRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/BatchUpdate", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) BatchDelete(ctx context.Context, in *BatchDeleteRequest, opts ...grpc.CallOption) (*BatchResponse, error) {
+	out := new(BatchResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/BatchDelete", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) Restore(ctx context.Context, in *RestoreItemRequest, opts ...grpc.CallOption) (*TodoResponse, error) {
+	out := new(TodoResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/Restore", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) ListTrash(ctx context.Context, in *ListTrashRequest, opts ...grpc.CallOption) (ToDoService_ListTrashClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ToDoService_ServiceDesc.Streams[1], "/pb.ToDoService/ListTrash", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &toDoServiceListTrashClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type ToDoService_ListTrashClient interface {
+	Recv() (*ToDo, error)
+	grpc.ClientStream
+}
+
+type toDoServiceListTrashClient struct {
+	grpc.ClientStream
+}
+
+func (x *toDoServiceListTrashClient) Recv() (*ToDo, error) {
+	m := new(ToDo)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *toDoServiceClient) Purge(ctx context.Context, in *PurgeItemRequest, opts ...grpc.CallOption) (*PurgeItemResponse, error) {
+	out := new(PurgeItemResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/Purge", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) ListTags(ctx context.Context, in *ListTagsRequest, opts ...grpc.CallOption) (*ListTagsResponse, error) {
+	out := new(ListTagsResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/ListTags", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) RenameTag(ctx context.Context, in *RenameTagRequest, opts ...grpc.CallOption) (*RenameTagResponse, error) {
+	out := new(RenameTagResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/RenameTag", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) AddChecklistItem(ctx context.Context, in *AddChecklistItemRequest, opts ...grpc.CallOption) (*TodoResponse, error) {
+	out := new(TodoResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/AddChecklistItem", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) ToggleChecklistItem(ctx context.Context, in *ToggleChecklistItemRequest, opts ...grpc.CallOption) (*TodoResponse, error) {
+	out := new(TodoResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/ToggleChecklistItem", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) ReorderChecklist(ctx context.Context, in *ReorderChecklistRequest, opts ...grpc.CallOption) (*TodoResponse, error) {
+	out := new(TodoResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/ReorderChecklist", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) RemoveChecklistItem(ctx context.Context, in *RemoveChecklistItemRequest, opts ...grpc.CallOption) (*TodoResponse, error) {
+	out := new(TodoResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/RemoveChecklistItem", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) SkipOccurrence(ctx context.Context, in *SkipOccurrenceRequest, opts ...grpc.CallOption) (*TodoResponse, error) {
+	out := new(TodoResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/SkipOccurrence", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) Move(ctx context.Context, in *MoveItemRequest, opts ...grpc.CallOption) (*TodoResponse, error) {
+	out := new(TodoResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/Move", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) CreateList(ctx context.Context, in *CreateListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/CreateList", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) GetList(ctx context.Context, in *GetListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/GetList", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) UpdateList(ctx context.Context, in *UpdateListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/UpdateList", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) DeleteList(ctx context.Context, in *DeleteListRequest, opts ...grpc.CallOption) (*DeleteListResponse, error) {
+	out := new(DeleteListResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/DeleteList", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) ListLists(ctx context.Context, in *ListListsRequest, opts ...grpc.CallOption) (*ListListsResponse, error) {
+	out := new(ListListsResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/ListLists", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) AddComment(ctx context.Context, in *AddCommentRequest, opts ...grpc.CallOption) (*CommentResponse, error) {
+	out := new(CommentResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/AddComment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) UpdateComment(ctx context.Context, in *UpdateCommentRequest, opts ...grpc.CallOption) (*CommentResponse, error) {
+	out := new(CommentResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/UpdateComment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) DeleteComment(ctx context.Context, in *DeleteCommentRequest, opts ...grpc.CallOption) (*DeleteCommentResponse, error) {
+	out := new(DeleteCommentResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/DeleteComment", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *toDoServiceClient) ListComments(ctx context.Context, in *ListCommentsRequest, opts ...grpc.CallOption) (*ListCommentsResponse, error) {
+	out := new(ListCommentsResponse)
+	err := c.cc.Invoke(ctx, "/pb.ToDoService/ListComments", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ToDoServiceServer is the server API for ToDoService service.
 // All implementations must embed UnimplementedToDoServiceServer
 // for forward compatibility
@@ -120,10 +396,56 @@ type ToDoServiceServer interface {
 	Get(context.Context, *GetItemByID) (*TodoResponse, error)
 	// Update todo Item
 	Update(context.Context, *UpdateItemRequest) (*TodoResponse, error)
-	// Delete todo Item
+	// Move todo Item to the trash
 	Delete(context.Context, *DeleteItemRequest) (*DeleteItemResponse, error)
 	// Get all todo Items
 	GetAll(*GetItemsRequest, ToDoService_GetAllServer) error
+	// Create many todo Items at once
+	BatchCreate(context.Context, *BatchCreateRequest) (*BatchResponse, error)
+	// Update many todo Items at once
+	BatchUpdate(context.Context, *BatchUpdateRequest) (*BatchResponse, error)
+	// Move many todo Items to the trash at once
+	BatchDelete(context.Context, *BatchDeleteRequest) (*BatchResponse, error)
+	// Take todo Item out of the trash
+	Restore(context.Context, *RestoreItemRequest) (*TodoResponse, error)
+	// Get the todo Items in the trash, most recently deleted first
+	ListTrash(*ListTrashRequest, ToDoService_ListTrashServer) error
+	// Permanently remove todo Item from the trash
+	Purge(context.Context, *PurgeItemRequest) (*PurgeItemResponse, error)
+	// Get the tags of a user, with the number of todo Items carrying each
+	ListTags(context.Context, *ListTagsRequest) (*ListTagsResponse, error)
+	// Rename a tag on every todo Item of a user
+	RenameTag(context.Context, *RenameTagRequest) (*RenameTagResponse, error)
+	// Add an item at the end of the checklist of a todo Item
+	AddChecklistItem(context.Context, *AddChecklistItemRequest) (*TodoResponse, error)
+	// Mark a checklist item done or pending
+	ToggleChecklistItem(context.Context, *ToggleChecklistItemRequest) (*TodoResponse, error)
+	// Put the items of a checklist in a new order
+	ReorderChecklist(context.Context, *ReorderChecklistRequest) (*TodoResponse, error)
+	// Remove an item from the checklist of a todo Item
+	RemoveChecklistItem(context.Context, *RemoveChecklistItemRequest) (*TodoResponse, error)
+	// Move a recurring todo Item to the next occurrence of its series, without completing it
+	SkipOccurrence(context.Context, *SkipOccurrenceRequest) (*TodoResponse, error)
+	// Place a todo Item right before or after another todo Item of its list, in the POSITION order
+	Move(context.Context, *MoveItemRequest) (*TodoResponse, error)
+	// Create a list of todo Items for a user
+	CreateList(context.Context, *CreateListRequest) (*ListResponse, error)
+	// Get a list based on its ID
+	GetList(context.Context, *GetListRequest) (*ListResponse, error)
+	// Rename a list
+	UpdateList(context.Context, *UpdateListRequest) (*ListResponse, error)
+	// Delete a list, its todo Items are moved to the Inbox or to the trash
+	DeleteList(context.Context, *DeleteListRequest) (*DeleteListResponse, error)
+	// Get the lists of a user, starting with their Inbox
+	ListLists(context.Context, *ListListsRequest) (*ListListsResponse, error)
+	// Add a comment to a todo Item
+	AddComment(context.Context, *AddCommentRequest) (*CommentResponse, error)
+	// Edit the body of a comment
+	UpdateComment(context.Context, *UpdateCommentRequest) (*CommentResponse, error)
+	// Delete a comment
+	DeleteComment(context.Context, *DeleteCommentRequest) (*DeleteCommentResponse, error)
+	// Get the comments of a todo Item, oldest first
+	ListComments(context.Context, *ListCommentsRequest) (*ListCommentsResponse, error)
 	mustEmbedUnimplementedToDoServiceServer()
 }
 
@@ -146,6 +468,75 @@ func (UnimplementedToDoServiceServer) Delete(context.Context, *DeleteItemRequest
 func (UnimplementedToDoServiceServer) GetAll(*GetItemsRequest, ToDoService_GetAllServer) error {
 	return status.Errorf(codes.Unimplemented, "method GetAll not implemented")
 }
+func (UnimplementedToDoServiceServer) BatchCreate(context.Context, *BatchCreateRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchCreate not implemented")
+}
+func (UnimplementedToDoServiceServer) BatchUpdate(context.Context, *BatchUpdateRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchUpdate not implemented")
+}
+func (UnimplementedToDoServiceServer) BatchDelete(context.Context, *BatchDeleteRequest) (*BatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BatchDelete not implemented")
+}
+func (UnimplementedToDoServiceServer) Restore(context.Context, *RestoreItemRequest) (*TodoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Restore not implemented")
+}
+func (UnimplementedToDoServiceServer) ListTrash(*ListTrashRequest, ToDoService_ListTrashServer) error {
+	return status.Errorf(codes.Unimplemented, "method ListTrash not implemented")
+}
+func (UnimplementedToDoServiceServer) Purge(context.Context, *PurgeItemRequest) (*PurgeItemResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Purge not implemented")
+}
+func (UnimplementedToDoServiceServer) ListTags(context.Context, *ListTagsRequest) (*ListTagsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListTags not implemented")
+}
+func (UnimplementedToDoServiceServer) RenameTag(context.Context, *RenameTagRequest) (*RenameTagResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RenameTag not implemented")
+}
+func (UnimplementedToDoServiceServer) AddChecklistItem(context.Context, *AddChecklistItemRequest) (*TodoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddChecklistItem not implemented")
+}
+func (UnimplementedToDoServiceServer) ToggleChecklistItem(context.Context, *ToggleChecklistItemRequest) (*TodoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ToggleChecklistItem not implemented")
+}
+func (UnimplementedToDoServiceServer) ReorderChecklist(context.Context, *ReorderChecklistRequest) (*TodoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ReorderChecklist not implemented")
+}
+func (UnimplementedToDoServiceServer) RemoveChecklistItem(context.Context, *RemoveChecklistItemRequest) (*TodoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveChecklistItem not implemented")
+}
+func (UnimplementedToDoServiceServer) SkipOccurrence(context.Context, *SkipOccurrenceRequest) (*TodoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SkipOccurrence not implemented")
+}
+func (UnimplementedToDoServiceServer) Move(context.Context, *MoveItemRequest) (*TodoResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Move not implemented")
+}
+func (UnimplementedToDoServiceServer) CreateList(context.Context, *CreateListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateList not implemented")
+}
+func (UnimplementedToDoServiceServer) GetList(context.Context, *GetListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetList not implemented")
+}
+func (UnimplementedToDoServiceServer) UpdateList(context.Context, *UpdateListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateList not implemented")
+}
+func (UnimplementedToDoServiceServer) DeleteList(context.Context, *DeleteListRequest) (*DeleteListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteList not implemented")
+}
+func (UnimplementedToDoServiceServer) ListLists(context.Context, *ListListsRequest) (*ListListsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListLists not implemented")
+}
+func (UnimplementedToDoServiceServer) AddComment(context.Context, *AddCommentRequest) (*CommentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AddComment not implemented")
+}
+func (UnimplementedToDoServiceServer) UpdateComment(context.Context, *UpdateCommentRequest) (*CommentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateComment not implemented")
+}
+func (UnimplementedToDoServiceServer) DeleteComment(context.Context, *DeleteCommentRequest) (*DeleteCommentResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteComment not implemented")
+}
+func (UnimplementedToDoServiceServer) ListComments(context.Context, *ListCommentsRequest) (*ListCommentsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListComments not implemented")
+}
 func (UnimplementedToDoServiceServer) mustEmbedUnimplementedToDoServiceServer() {}
 
 // UnsafeToDoServiceServer may be embedded to opt out of forward compatibility for this service.
@@ -252,34 +643,544 @@ func (x *toDoServiceGetAllServer) Send(m *ToDo) error {
 	return x.ServerStream.SendMsg(m)
 }
 
-// ToDoService_ServiceDesc is the grpc.ServiceDesc for ToDoService service.
-// It's only intended for direct use with grpc.RegisterService,
-// and not to be introspected or modified (even as a copy)
-var ToDoService_ServiceDesc = grpc.ServiceDesc{
-	ServiceName: "pb.ToDoService",
-	HandlerType: (*ToDoServiceServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "Create",
-			Handler:    _ToDoService_Create_Handler,
-		},
-		{
-			MethodName: "Get",
-			Handler:    _ToDoService_Get_Handler,
-		},
-		{
-			MethodName: "Update",
-			Handler:    _ToDoService_Update_Handler,
-		},
-		{
-			MethodName: "Delete",
-			Handler:    _ToDoService_Delete_Handler,
-		},
-	},
-	Streams: []grpc.StreamDesc{
-		{
-			StreamName:    "GetAll",
-			Handler:       _ToDoService_GetAll_Handler,
+func _ToDoService_BatchCreate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchCreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).BatchCreate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/BatchCreate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).BatchCreate(ctx, req.(*BatchCreateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_BatchUpdate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchUpdateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).BatchUpdate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/BatchUpdate",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).BatchUpdate(ctx, req.(*BatchUpdateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_BatchDelete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BatchDeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).BatchDelete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/BatchDelete",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).BatchDelete(ctx, req.(*BatchDeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_Restore_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).Restore(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/Restore",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).Restore(ctx, req.(*RestoreItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_ListTrash_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListTrashRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ToDoServiceServer).ListTrash(m, &toDoServiceListTrashServer{stream})
+}
+
+type ToDoService_ListTrashServer interface {
+	Send(*ToDo) error
+	grpc.ServerStream
+}
+
+type toDoServiceListTrashServer struct {
+	grpc.ServerStream
+}
+
+func (x *toDoServiceListTrashServer) Send(m *ToDo) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _ToDoService_Purge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PurgeItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).Purge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/Purge",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).Purge(ctx, req.(*PurgeItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_ListTags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListTagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).ListTags(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/ListTags",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).ListTags(ctx, req.(*ListTagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_RenameTag_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenameTagRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).RenameTag(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/RenameTag",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).RenameTag(ctx, req.(*RenameTagRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_AddChecklistItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddChecklistItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).AddChecklistItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/AddChecklistItem",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).AddChecklistItem(ctx, req.(*AddChecklistItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_ToggleChecklistItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ToggleChecklistItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).ToggleChecklistItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/ToggleChecklistItem",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).ToggleChecklistItem(ctx, req.(*ToggleChecklistItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_ReorderChecklist_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReorderChecklistRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).ReorderChecklist(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/ReorderChecklist",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).ReorderChecklist(ctx, req.(*ReorderChecklistRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_RemoveChecklistItem_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveChecklistItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).RemoveChecklistItem(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/RemoveChecklistItem",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).RemoveChecklistItem(ctx, req.(*RemoveChecklistItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_SkipOccurrence_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SkipOccurrenceRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).SkipOccurrence(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/SkipOccurrence",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).SkipOccurrence(ctx, req.(*SkipOccurrenceRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_Move_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MoveItemRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).Move(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/Move",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).Move(ctx, req.(*MoveItemRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_CreateList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).CreateList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/CreateList",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).CreateList(ctx, req.(*CreateListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_GetList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).GetList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/GetList",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).GetList(ctx, req.(*GetListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_UpdateList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).UpdateList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/UpdateList",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).UpdateList(ctx, req.(*UpdateListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_DeleteList_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).DeleteList(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/DeleteList",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).DeleteList(ctx, req.(*DeleteListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_ListLists_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListListsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).ListLists(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/ListLists",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).ListLists(ctx, req.(*ListListsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_AddComment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AddCommentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).AddComment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/AddComment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).AddComment(ctx, req.(*AddCommentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_UpdateComment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateCommentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).UpdateComment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/UpdateComment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).UpdateComment(ctx, req.(*UpdateCommentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_DeleteComment_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteCommentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).DeleteComment(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/DeleteComment",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).DeleteComment(ctx, req.(*DeleteCommentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ToDoService_ListComments_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListCommentsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ToDoServiceServer).ListComments(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/pb.ToDoService/ListComments",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ToDoServiceServer).ListComments(ctx, req.(*ListCommentsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// ToDoService_ServiceDesc is the grpc.ServiceDesc for ToDoService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ToDoService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "pb.ToDoService",
+	HandlerType: (*ToDoServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Create",
+			Handler:    _ToDoService_Create_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _ToDoService_Get_Handler,
+		},
+		{
+			MethodName: "Update",
+			Handler:    _ToDoService_Update_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _ToDoService_Delete_Handler,
+		},
+		{
+			MethodName: "BatchCreate",
+			Handler:    _ToDoService_BatchCreate_Handler,
+		},
+		{
+			MethodName: "BatchUpdate",
+			Handler:    _ToDoService_BatchUpdate_Handler,
+		},
+		{
+			MethodName: "BatchDelete",
+			Handler:    _ToDoService_BatchDelete_Handler,
+		},
+		{
+			MethodName: "Restore",
+			Handler:    _ToDoService_Restore_Handler,
+		},
+		{
+			MethodName: "Purge",
+			Handler:    _ToDoService_Purge_Handler,
+		},
+		{
+			MethodName: "ListTags",
+			Handler:    _ToDoService_ListTags_Handler,
+		},
+		{
+			MethodName: "RenameTag",
+			Handler:    _ToDoService_RenameTag_Handler,
+		},
+		{
+			MethodName: "AddChecklistItem",
+			Handler:    _ToDoService_AddChecklistItem_Handler,
+		},
+		{
+			MethodName: "ToggleChecklistItem",
+			Handler:    _ToDoService_ToggleChecklistItem_Handler,
+		},
+		{
+			MethodName: "ReorderChecklist",
+			Handler:    _ToDoService_ReorderChecklist_Handler,
+		},
+		{
+			MethodName: "RemoveChecklistItem",
+			Handler:    _ToDoService_RemoveChecklistItem_Handler,
+		},
+		{
+			MethodName: "SkipOccurrence",
+			Handler:    _ToDoService_SkipOccurrence_Handler,
+		},
+		{
+			MethodName: "Move",
+			Handler:    _ToDoService_Move_Handler,
+		},
+		{
+			MethodName: "CreateList",
+			Handler:    _ToDoService_CreateList_Handler,
+		},
+		{
+			MethodName: "GetList",
+			Handler:    _ToDoService_GetList_Handler,
+		},
+		{
+			MethodName: "UpdateList",
+			Handler:    _ToDoService_UpdateList_Handler,
+		},
+		{
+			MethodName: "DeleteList",
+			Handler:    _ToDoService_DeleteList_Handler,
+		},
+		{
+			MethodName: "ListLists",
+			Handler:    _ToDoService_ListLists_Handler,
+		},
+		{
+			MethodName: "AddComment",
+			Handler:    _ToDoService_AddComment_Handler,
+		},
+		{
+			MethodName: "UpdateComment",
+			Handler:    _ToDoService_UpdateComment_Handler,
+		},
+		{
+			MethodName: "DeleteComment",
+			Handler:    _ToDoService_DeleteComment_Handler,
+		},
+		{
+			MethodName: "ListComments",
+			Handler:    _ToDoService_ListComments_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetAll",
+			Handler:       _ToDoService_GetAll_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ListTrash",
+			Handler:       _ToDoService_ListTrash_Handler,
 			ServerStreams: true,
 		},
 	},
@@ -119,6 +119,20 @@ def go_repositories():
         version = "v1.1.1",
     )
 
+    go_repository(
+        name = "com_github_emersion_go_sasl",
+        build_file_proto_mode = "disable_global",
+        importpath = "github.com/emersion/go-sasl",
+        sum = "h1:OJyUGMJTzHTd1XQp98QTaHernxMYzRaOasRir9hUlFQ=",
+        version = "v0.0.0-20200509203442-7bfe0ed36a21",
+    )
+    go_repository(
+        name = "com_github_emersion_go_smtp",
+        build_file_proto_mode = "disable_global",
+        importpath = "github.com/emersion/go-smtp",
+        sum = "h1:3+hMGMGrqP/lqd7qoxZc1hTU8LY8gHV9RFGWlqSDmP8=",
+        version = "v0.15.0",
+    )
     go_repository(
         name = "com_github_envoyproxy_go_control_plane",
         build_file_proto_mode = "disable_global",
@@ -458,6 +472,13 @@ def go_repositories():
         sum = "h1:BqpAaACuzVSgi/VLzGZIobT2z4v53pjosyNd9Yv6n/w=",
         version = "v1.2.1",
     )
+    go_repository(
+        name = "com_github_lib_pq",
+        build_file_proto_mode = "disable_global",
+        importpath = "github.com/lib/pq",
+        sum = "h1:p7ZhMD+KsSRozJr34udlUrhboJwWAgCg34+/ZZNvZZw=",
+        version = "v1.10.7",
+    )
     go_repository(
         name = "com_github_magiconair_properties",
         build_file_proto_mode = "disable_global",
@@ -479,6 +500,13 @@ def go_repositories():
         sum = "h1:bq3VjFmv/sOjHtdEhmkEV4x1AJtvUvOJ2PFAZ5+peKQ=",
         version = "v0.0.16",
     )
+    go_repository(
+        name = "com_github_mattn_go_sqlite3",
+        build_file_proto_mode = "disable_global",
+        importpath = "github.com/mattn/go-sqlite3",
+        sum = "h1:yOQRA0RpS5PFz/oikGwBEqvAWhWg5ufRz4ETLjwpU1Y=",
+        version = "v1.14.16",
+    )
 
     go_repository(
         name = "com_github_mitchellh_go_homedir",
@@ -640,6 +668,13 @@ def go_repositories():
         sum = "h1:jyEFiXpy21Wm81FBN71l9VoMMV8H8jG+qIK3GCpY6Qs=",
         version = "v1.4.1",
     )
+    go_repository(
+        name = "com_github_teambition_rrule_go",
+        build_file_proto_mode = "disable_global",
+        importpath = "github.com/teambition/rrule-go",
+        sum = "h1:lIjpjvWTj9fFUZCmuoVDrKVOtdiyzbzc93qTmRVe/J8=",
+        version = "v1.8.2",
+    )
     go_repository(
         name = "com_github_tidwall_pretty",
         build_file_proto_mode = "disable_global",
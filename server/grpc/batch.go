@@ -0,0 +1,139 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/todo-project/models"
+	"github.com/todo-project/pb"
+	"github.com/todo-project/services"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/status"
+)
+
+func (ts *TodoServer) BatchCreate(ctx context.Context, req *pb.BatchCreateRequest) (*pb.BatchResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	b := newBatch(len(req.GetItems()))
+	var requests []*models.CreateTodoRequest
+	for i, item := range req.GetItems() {
+		if err := validateRequest(item); err != nil {
+			b.fail(i, err)
+			continue
+		}
+		b.add(i, "")
+		requests = append(requests, toCreateTodoRequest(item))
+	}
+	return b.run(ctx, req.GetAtomic(), func() ([]services.BatchResult, error) {
+		return ts.todoService.BatchCreateTodos(ctx, requests, req.GetAtomic())
+	})
+}
+
+func (ts *TodoServer) BatchUpdate(ctx context.Context, req *pb.BatchUpdateRequest) (*pb.BatchResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	b := newBatch(len(req.GetItems()))
+	var items []*models.BatchUpdateItem
+	for i, item := range req.GetItems() {
+		item, err := applyUpdateMask(item)
+		if err == nil {
+			err = validateRequest(item)
+		}
+		if err != nil {
+			b.fail(i, err)
+			continue
+		}
+		b.add(i, item.GetId())
+		items = append(items, &models.BatchUpdateItem{Id: item.GetId(), Update: toUpdateTodo(item)})
+	}
+	return b.run(ctx, req.GetAtomic(), func() ([]services.BatchResult, error) {
+		return ts.todoService.BatchUpdateTodos(ctx, items, req.GetAtomic())
+	})
+}
+
+func (ts *TodoServer) BatchDelete(ctx context.Context, req *pb.BatchDeleteRequest) (*pb.BatchResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	b := newBatch(len(req.GetItems()))
+	var items []*models.BatchDeleteItem
+	for i, item := range req.GetItems() {
+		err := validateRequest(item)
+		if err == nil && item.GetCascade() {
+			err = badRequest("invalid request: Cascade is not supported by BatchDelete", &errdetails.BadRequest_FieldViolation{
+				Field:       "Cascade",
+				Description: "is not supported by BatchDelete, delete the todo on its own",
+			})
+		}
+		if err != nil {
+			b.fail(i, err)
+			continue
+		}
+		b.add(i, item.GetId())
+		items = append(items, &models.BatchDeleteItem{Id: item.GetId(), ExpectedVersion: item.GetExpectedVersion()})
+	}
+	return b.run(ctx, req.GetAtomic(), func() ([]services.BatchResult, error) {
+		return ts.todoService.BatchDeleteTodos(ctx, items, req.GetAtomic())
+	})
+}
+
+// batch collects the results of a batch RPC. The items failing validation never reach the TodoService, the others
+// are passed on in order.
+type batch struct {
+	results []*pb.BatchItemResult
+	// items are the indexes of the items passed on, ids the Todos they are about.
+	items []int
+	ids   []string
+}
+
+func newBatch(n int) *batch {
+	b := &batch{results: make([]*pb.BatchItemResult, n)}
+	for i := range b.results {
+		b.results[i] = &pb.BatchItemResult{}
+	}
+	return b
+}
+
+func (b *batch) add(i int, id string) {
+	b.items = append(b.items, i)
+	b.ids = append(b.ids, id)
+}
+
+func (b *batch) fail(i int, err error) {
+	b.results[i].Error = status.Convert(err).Proto()
+}
+
+// run calls the TodoService with the items passed on. An atomic batch with an invalid item is not run at all, its
+// valid items are reported as rolled back like the TodoService would.
+func (b *batch) run(ctx context.Context, atomic bool, call func() ([]services.BatchResult, error)) (*pb.BatchResponse, error) {
+	res := &pb.BatchResponse{Results: b.results}
+	if atomic && len(b.items) != len(b.results) {
+		for j, i := range b.items {
+			b.fail(i, serviceError(ctx, &services.Error{Kind: services.KindAborted, Id: b.ids[j], Err: services.ErrBatchAborted}))
+		}
+		return res, nil
+	}
+	if len(b.items) == 0 {
+		return res, nil
+	}
+
+	results, err := call()
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+	for j, result := range results {
+		i := b.items[j]
+		if result.Err != nil {
+			b.fail(i, serviceError(ctx, result.Err))
+			continue
+		}
+		if result.Todo != nil {
+			b.results[i].ToDo = toPbTodo(result.Todo)
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,71 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/todo-project/pb"
+)
+
+func (ts *TodoServer) AddChecklistItem(ctx context.Context, req *pb.AddChecklistItemRequest) (*pb.TodoResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	todo, err := ts.todoService.AddChecklistItem(ctx, req.GetId(), req.GetText(), req.GetExpectedVersion())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.TodoResponse{
+		ToDo: toPbTodo(todo),
+	}
+	return res, nil
+}
+
+func (ts *TodoServer) ToggleChecklistItem(ctx context.Context, req *pb.ToggleChecklistItemRequest) (*pb.TodoResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	todo, err := ts.todoService.ToggleChecklistItem(ctx, req.GetId(), req.GetItemId(), req.GetDone(), req.GetExpectedVersion())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.TodoResponse{
+		ToDo: toPbTodo(todo),
+	}
+	return res, nil
+}
+
+func (ts *TodoServer) ReorderChecklist(ctx context.Context, req *pb.ReorderChecklistRequest) (*pb.TodoResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	todo, err := ts.todoService.ReorderChecklist(ctx, req.GetId(), req.GetItemIds(), req.GetExpectedVersion())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.TodoResponse{
+		ToDo: toPbTodo(todo),
+	}
+	return res, nil
+}
+
+func (ts *TodoServer) RemoveChecklistItem(ctx context.Context, req *pb.RemoveChecklistItemRequest) (*pb.TodoResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	todo, err := ts.todoService.RemoveChecklistItem(ctx, req.GetId(), req.GetItemId(), req.GetExpectedVersion())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.TodoResponse{
+		ToDo: toPbTodo(todo),
+	}
+	return res, nil
+}
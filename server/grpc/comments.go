@@ -0,0 +1,85 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/todo-project/models"
+	"github.com/todo-project/pb"
+)
+
+func (ts *TodoServer) AddComment(ctx context.Context, req *pb.AddCommentRequest) (*pb.CommentResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	request := &models.CreateCommentRequest{Author: req.GetAuthor(), Body: req.GetBody()}
+	comment, err := ts.todoService.AddComment(ctx, req.GetTodoId(), request)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.CommentResponse{
+		Comment: toPbComment(comment),
+	}
+	return res, nil
+}
+
+func (ts *TodoServer) UpdateComment(ctx context.Context, req *pb.UpdateCommentRequest) (*pb.CommentResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	comment, err := ts.todoService.UpdateComment(ctx, req.GetId(), req.GetBody(), req.GetExpectedVersion())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.CommentResponse{
+		Comment: toPbComment(comment),
+	}
+	return res, nil
+}
+
+func (ts *TodoServer) DeleteComment(ctx context.Context, req *pb.DeleteCommentRequest) (*pb.DeleteCommentResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := ts.todoService.DeleteComment(ctx, req.GetId(), req.GetExpectedVersion()); err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.DeleteCommentResponse{
+		Deleted: true,
+	}
+	return res, nil
+}
+
+func (ts *TodoServer) ListComments(ctx context.Context, req *pb.ListCommentsRequest) (*pb.ListCommentsResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	comments, err := ts.todoService.ListComments(ctx, req.GetTodoId())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.ListCommentsResponse{}
+	for _, comment := range comments {
+		res.Comments = append(res.Comments, toPbComment(comment))
+	}
+	return res, nil
+}
+
+func toPbComment(comment *models.Comment) *pb.Comment {
+	return &pb.Comment{
+		Id:        comment.Id.Hex(),
+		TodoId:    comment.TodoId.Hex(),
+		Author:    comment.Author,
+		Body:      comment.Body,
+		CreatedAt: toPbTimestamp(comment.CreatedAt),
+		UpdatedAt: toPbTimestamp(comment.UpdatedAt),
+		Version:   comment.Version,
+	}
+}
@@ -0,0 +1,72 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+
+	"github.com/todo-project/services"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the domain of the ErrorInfo detail attached to every error of a known kind.
+const ErrorDomain = "todo-project"
+
+// serviceError maps an error of the TodoService to a status. A request that ran out of time or was cancelled is
+// reported as such, whatever the storage wrapped the context error in.
+//
+// Typed errors carry an ErrorInfo detail whose reason is the services.ErrorKind, so clients can branch on it,
+// along with a BadRequest or ResourceInfo detail describing the offending field, Todo or List.
+func serviceError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+
+	var typedErr *services.Error
+	if !errors.As(err, &typedErr) {
+		return status.Errorf(codes.Internal, err.Error())
+	}
+
+	info := &errdetails.ErrorInfo{Reason: typedErr.Kind.String(), Domain: ErrorDomain}
+	var st *status.Status
+	var detailErr error
+	switch typedErr.Kind {
+	case services.KindInvalidArgument:
+		return badRequest(err.Error(), &errdetails.BadRequest_FieldViolation{Field: typedErr.Field, Description: err.Error()})
+	case services.KindNotFound:
+		st, detailErr = status.New(codes.NotFound, err.Error()).WithDetails(info, resourceInfo(typedErr))
+	case services.KindConflict:
+		st, detailErr = status.New(codes.AlreadyExists, err.Error()).WithDetails(info, resourceInfo(typedErr))
+	case services.KindVersionMismatch, services.KindAborted:
+		st, detailErr = status.New(codes.Aborted, err.Error()).WithDetails(info, resourceInfo(typedErr))
+	case services.KindFailedPrecondition:
+		st, detailErr = status.New(codes.FailedPrecondition, err.Error()).WithDetails(info, resourceInfo(typedErr))
+	case services.KindUnsupported:
+		st, detailErr = status.New(codes.FailedPrecondition, err.Error()).WithDetails(info)
+	default:
+		return status.Errorf(codes.Internal, err.Error())
+	}
+	if detailErr != nil {
+		return status.Errorf(codes.Internal, detailErr.Error())
+	}
+	return st.Err()
+}
+
+func resourceInfo(err *services.Error) *errdetails.ResourceInfo {
+	resourceType := "ToDo"
+	if len(err.Resource) != 0 {
+		resourceType = err.Resource
+	}
+	return &errdetails.ResourceInfo{ResourceType: resourceType, ResourceName: err.Id, Description: err.Error()}
+}
+
+// badRequest is the InvalidArgument status of a request, with one violation per offending field.
+func badRequest(msg string, violations ...*errdetails.BadRequest_FieldViolation) error {
+	info := &errdetails.ErrorInfo{Reason: services.KindInvalidArgument.String(), Domain: ErrorDomain}
+	st, err := status.New(codes.InvalidArgument, msg).WithDetails(info, &errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return status.Errorf(codes.Internal, err.Error())
+	}
+	return st.Err()
+}
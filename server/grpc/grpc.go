@@ -2,15 +2,22 @@ package grpc
 
 import (
 	"context"
+	"time"
 
 	"github.com/todo-project/models"
 	"github.com/todo-project/pb"
 	"github.com/todo-project/services"
 	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// NextPageTokenTrailer is the trailer GetAll sends the token of the next page in, it is only set when there is one.
+const NextPageTokenTrailer = "next-page-token"
+
 type TodoServer struct {
 	pb.UnimplementedToDoServiceServer
 	todoCollection *mongo.Collection
@@ -26,97 +33,156 @@ func NewGrpcTodoServer(todoCollection *mongo.Collection, todoService services.To
 	return todoServer, nil
 }
 
-func (ts *TodoServer) Create(_ context.Context, req *pb.CreateItemRequest) (*pb.TodoResponse, error) {
-	post := &models.CreateTodoRequest{
-		Title:       req.GetTitle(),
-		Description: req.GetDescription(),
-		User:        req.GetUser(),
+func (ts *TodoServer) Create(ctx context.Context, req *pb.CreateItemRequest) (*pb.TodoResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
 	}
 
-	newTodo, err := ts.todoService.CreateTodo(post)
+	newTodo, err := ts.todoService.CreateTodo(ctx, toCreateTodoRequest(req))
 
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, serviceError(ctx, err)
 	}
 
 	res := &pb.TodoResponse{
-		ToDo: &pb.ToDo{
-			Id:          newTodo.Id.Hex(),
-			Title:       newTodo.Title,
-			Description: newTodo.Description,
-			User:        newTodo.User,
-		},
+		ToDo: toPbTodo(newTodo),
 	}
 	return res, nil
 }
 
-func (ts *TodoServer) Update(_ context.Context, req *pb.UpdateItemRequest) (*pb.TodoResponse, error) {
-	todo := &models.UpdateTodo{
-		Title:       req.GetTitle(),
-		Description: req.GetDescription(),
-		Done:        req.GetDone(),
-		User:        req.GetUser(),
+func (ts *TodoServer) Update(ctx context.Context, req *pb.UpdateItemRequest) (*pb.TodoResponse, error) {
+	req, err := applyUpdateMask(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateRequest(req); err != nil {
+		return nil, err
 	}
 
-	updatedTodo, err := ts.todoService.UpdateTodo(req.GetId(), todo)
+	updatedTodo, err := ts.todoService.UpdateTodo(ctx, req.GetId(), toUpdateTodo(req))
 
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, serviceError(ctx, err)
 	}
 
 	res := &pb.TodoResponse{
-		ToDo: &pb.ToDo{
-			Id:          updatedTodo.Id.Hex(),
-			Title:       updatedTodo.Title,
-			Description: updatedTodo.Description,
-			Done:        updatedTodo.Done,
-			User:        updatedTodo.User,
-		},
+		ToDo: toPbTodo(updatedTodo),
 	}
 	return res, nil
 }
 
-func (ts *TodoServer) Get(_ context.Context, req *pb.GetItemByID) (*pb.TodoResponse, error) {
-	todo, err := ts.todoService.GetTodoById(req.GetId())
+func (ts *TodoServer) Get(ctx context.Context, req *pb.GetItemByID) (*pb.TodoResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	todo, err := ts.todoService.GetTodoById(ctx, req.GetId())
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, serviceError(ctx, err)
 	}
 
 	res := &pb.TodoResponse{
-		ToDo: &pb.ToDo{
-			Id:          todo.Id.Hex(),
-			Title:       todo.Title,
-			Description: todo.Description,
-			Done:        todo.Done,
-			User:        todo.User,
-		},
+		ToDo: toPbTodo(todo),
 	}
 	return res, nil
 }
 
 func (ts *TodoServer) GetAll(req *pb.GetItemsRequest, stream pb.ToDoService_GetAllServer) error {
-	todos, err := ts.todoService.GetAllTodos(req.GetStatus(), req.GetUser())
-	if err != nil {
-		return status.Errorf(codes.Internal, err.Error())
-	}
-	for _, todo := range todos {
-		err = stream.Send(&pb.ToDo{
-			Id:          todo.Id.Hex(),
-			Title:       todo.Title,
-			Description: todo.Description,
-			User:        todo.User,
-			Done:        todo.Done,
-		})
+	if err := validateRequest(req); err != nil {
+		return err
+	}
+
+	query := &models.TodoQuery{
+		Status:      req.GetStatus(),
+		User:        req.GetUser(),
+		PageSize:    int(req.GetPageSize()),
+		PageToken:   req.GetPageToken(),
+		SortBy:      req.GetSortBy(),
+		Descending:  req.GetDescending(),
+		DueAfter:    fromPbTimestamp(req.GetDueAfter()),
+		DueBefore:   fromPbTimestamp(req.GetDueBefore()),
+		Overdue:     req.GetOverdue(),
+		MinPriority: req.GetMinPriority(),
+		TagsAny:     req.GetTagsAny(),
+		TagsAll:     req.GetTagsAll(),
+		TagsNone:    req.GetTagsNone(),
+		SubtreeOf:   req.GetSubtreeOf(),
+		ListId:      req.ListId,
+	}
+	if req.Status == nil && req.GetOverdue() {
+		// The default DONE would leave nothing, overdue todos are pending.
+		query.Status = pb.GetItemsRequest_PENDING
+	}
+	if req.GetDueToday() {
+		// The validation already loaded Time_zone, an unset one loads UTC.
+		location, err := time.LoadLocation(req.GetTimeZone())
 		if err != nil {
-			return err
+			return status.Error(codes.Internal, err.Error())
 		}
+		query.DueToday = location
+	}
+	return ts.streamTodos(query, stream)
+}
+
+func (ts *TodoServer) ListTrash(req *pb.ListTrashRequest, stream pb.ToDoService_ListTrashServer) error {
+	if err := validateRequest(req); err != nil {
+		return err
+	}
+
+	query := &models.TodoQuery{
+		Status:     pb.GetItemsRequest_ALL,
+		User:       req.GetUser(),
+		PageSize:   int(req.GetPageSize()),
+		PageToken:  req.GetPageToken(),
+		Descending: true,
+		Trashed:    true,
+	}
+	return ts.streamTodos(query, stream)
+}
+
+// todoStream is implemented by the server streams of every RPC returning a stream of ToDo.
+type todoStream interface {
+	Send(*pb.ToDo) error
+	grpc.ServerStream
+}
+
+// streamTodos sends the Todos matching the query and the token of the next page, if there is one.
+func (ts *TodoServer) streamTodos(query *models.TodoQuery, stream todoStream) error {
+	// Todos are sent as the storage reads them, stop as soon as the client goes away.
+	var streamErr error
+	nextPageToken, err := ts.todoService.GetAllTodos(stream.Context(), query, func(todo *models.Todo) error {
+		if streamErr = stream.Context().Err(); streamErr != nil {
+			return streamErr
+		}
+		streamErr = stream.Send(toPbTodo(todo))
+		return streamErr
+	})
+	if streamErr != nil {
+		if ctxErr := stream.Context().Err(); ctxErr != nil {
+			return status.FromContextError(ctxErr).Err()
+		}
+		return streamErr
+	}
+	if err != nil {
+		return serviceError(stream.Context(), err)
+	}
+	if len(nextPageToken) != 0 {
+		stream.SetTrailer(metadata.Pairs(NextPageTokenTrailer, nextPageToken))
 	}
 	return nil
 }
 
-func (ts *TodoServer) Delete(_ context.Context, req *pb.DeleteItemRequest) (*pb.DeleteItemResponse, error) {
-	if err := ts.todoService.DeleteTodo(req.GetId()); err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+func (ts *TodoServer) Delete(ctx context.Context, req *pb.DeleteItemRequest) (*pb.DeleteItemResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	deleteTodo := ts.todoService.DeleteTodo
+	if req.GetCascade() {
+		deleteTodo = ts.todoService.DeleteTodoTree
+	}
+	if err := deleteTodo(ctx, req.GetId(), req.GetExpectedVersion()); err != nil {
+		return nil, serviceError(ctx, err)
 	}
 
 	res := &pb.DeleteItemResponse{
@@ -124,3 +190,186 @@ func (ts *TodoServer) Delete(_ context.Context, req *pb.DeleteItemRequest) (*pb.
 	}
 	return res, nil
 }
+
+func (ts *TodoServer) Restore(ctx context.Context, req *pb.RestoreItemRequest) (*pb.TodoResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	todo, err := ts.todoService.RestoreTodo(ctx, req.GetId(), req.GetExpectedVersion())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.TodoResponse{
+		ToDo: toPbTodo(todo),
+	}
+	return res, nil
+}
+
+func (ts *TodoServer) Purge(ctx context.Context, req *pb.PurgeItemRequest) (*pb.PurgeItemResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := ts.todoService.PurgeTodo(ctx, req.GetId(), req.GetExpectedVersion()); err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.PurgeItemResponse{
+		Purged: true,
+	}
+	return res, nil
+}
+
+func (ts *TodoServer) ListTags(ctx context.Context, req *pb.ListTagsRequest) (*pb.ListTagsResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	tags, err := ts.todoService.ListTags(ctx, req.GetUser())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.ListTagsResponse{}
+	for _, tag := range tags {
+		res.Tags = append(res.Tags, &pb.TagCount{Tag: tag.Tag, Count: tag.Count})
+	}
+	return res, nil
+}
+
+func (ts *TodoServer) RenameTag(ctx context.Context, req *pb.RenameTagRequest) (*pb.RenameTagResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	renamed, err := ts.todoService.RenameTag(ctx, req.GetUser(), req.GetFrom(), req.GetTo())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.RenameTagResponse{
+		Renamed: renamed,
+	}
+	return res, nil
+}
+
+func toCreateTodoRequest(req *pb.CreateItemRequest) *models.CreateTodoRequest {
+	return &models.CreateTodoRequest{
+		Title:       req.GetTitle(),
+		Description: req.GetDescription(),
+		User:        req.GetUser(),
+		DueAt:       fromPbTimestamp(req.GetDueAt()),
+		Priority:    req.GetPriority(),
+		Tags:        req.GetTags(),
+		ParentId:    req.GetParentId(),
+		Recurrence:  req.GetRecurrence(),
+		Reminders:   fromPbTimestamps(req.GetReminders()),
+		ListId:      req.GetListId(),
+		RequestId:   req.GetRequestId(),
+	}
+}
+
+// toUpdateTodo keeps the presence of the optional fields, unset ones are left untouched.
+func toUpdateTodo(req *pb.UpdateItemRequest) *models.UpdateTodo {
+	update := &models.UpdateTodo{
+		Title:           req.Title,
+		Description:     req.Description,
+		Done:            req.Done,
+		User:            req.User,
+		Priority:        req.Priority,
+		ParentId:        req.ParentId,
+		Recurrence:      req.Recurrence,
+		ListId:          req.ListId,
+		ExpectedVersion: req.GetExpectedVersion(),
+	}
+	if req.DueAt != nil {
+		dueAt := fromPbTimestamp(req.DueAt)
+		update.DueAt = &dueAt
+	}
+	if req.Tags != nil {
+		// A set but empty TagList clears the tags, which a nil slice would leave untouched.
+		update.Tags = append([]string{}, req.GetTags().GetTags()...)
+	}
+	if req.Reminders != nil {
+		// Like the tags, a set but empty ReminderList clears the reminders.
+		update.Reminders = append([]time.Time{}, fromPbTimestamps(req.GetReminders().GetReminders())...)
+	}
+	return update
+}
+
+func toPbTodo(todo *models.Todo) *pb.ToDo {
+	pbTodo := &pb.ToDo{
+		Id:           todo.Id.Hex(),
+		Title:        todo.Title,
+		Description:  todo.Description,
+		User:         todo.User,
+		Done:         todo.Done,
+		CreatedAt:    toPbTimestamp(todo.CreatedAt),
+		UpdatedAt:    toPbTimestamp(todo.UpdatedAt),
+		Version:      todo.Version,
+		DeletedAt:    toPbTimestamp(todo.DeletedAt),
+		DueAt:        toPbTimestamp(todo.DueAt),
+		Priority:     todo.Priority,
+		Tags:         todo.Tags,
+		Checklist:    toPbChecklist(todo.Checklist),
+		Recurrence:   todo.Recurrence,
+		Reminders:    toPbReminders(todo.Reminders),
+		Position:     todo.Position,
+		CommentCount: todo.CommentCount,
+	}
+	if !todo.ParentId.IsZero() {
+		pbTodo.ParentId = todo.ParentId.Hex()
+	}
+	if !todo.NextOccurrenceId.IsZero() {
+		pbTodo.NextOccurrenceId = todo.NextOccurrenceId.Hex()
+	}
+	if !todo.ListId.IsZero() {
+		pbTodo.ListId = todo.ListId.Hex()
+	}
+	if done, total := todo.ChecklistProgress(); total != 0 {
+		pbTodo.ChecklistProgress = &pb.ChecklistProgress{Done: int32(done), Total: int32(total)}
+	}
+	return pbTodo
+}
+
+func toPbChecklist(checklist []models.ChecklistItem) []*pb.ChecklistItem {
+	var items []*pb.ChecklistItem
+	for _, item := range checklist {
+		items = append(items, &pb.ChecklistItem{Id: item.Id, Text: item.Text, Done: item.Done})
+	}
+	return items
+}
+
+func toPbReminders(reminders []models.Reminder) []*pb.Reminder {
+	var pbReminders []*pb.Reminder
+	for _, reminder := range reminders {
+		pbReminders = append(pbReminders, &pb.Reminder{At: toPbTimestamp(reminder.At), SentAt: toPbTimestamp(reminder.SentAt)})
+	}
+	return pbReminders
+}
+
+// toPbTimestamp leaves the field unset for the zero time, e.g. todos stored before timestamps were tracked.
+func toPbTimestamp(t time.Time) *timestamppb.Timestamp {
+	if t.IsZero() {
+		return nil
+	}
+	return timestamppb.New(t)
+}
+
+// fromPbTimestamp reads an unset field, or the Unix epoch, as the zero time: the time left unset by toPbTimestamp.
+func fromPbTimestamp(ts *timestamppb.Timestamp) time.Time {
+	if ts.GetSeconds() == 0 && ts.GetNanos() == 0 {
+		return time.Time{}
+	}
+	return ts.AsTime()
+}
+
+func fromPbTimestamps(timestamps []*timestamppb.Timestamp) []time.Time {
+	var times []time.Time
+	for _, ts := range timestamps {
+		times = append(times, fromPbTimestamp(ts))
+	}
+	return times
+}
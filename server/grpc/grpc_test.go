@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/todo-project/models"
 	"github.com/todo-project/pb"
@@ -13,24 +14,35 @@ import (
 	"github.com/todo-project/utils"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	spb "google.golang.org/genproto/googleapis/rpc/status"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
-type MockTodoServiceImpl struct {
-	todoCollection *mongo.Collection
-	ctx            context.Context
+// failingTodoService fails every call, it is used to test the error paths of the server.
+type failingTodoService struct {
+	services.TodoService
 }
 
-var (
-	id1    = primitive.ObjectID{}
-	id2, _ = primitive.ObjectIDFromHex("update_user")
-	id3, _ = primitive.ObjectIDFromHex("update_title")
-	id4, _ = primitive.ObjectIDFromHex("get_todo_id")
-)
-
 type mockGrpc_TodoServer struct {
 	grpc.ServerStream
 	Results []*pb.ToDo
+	Trailer metadata.MD
+	// Ctx is the context of the stream, context.Background() when nil.
+	Ctx context.Context
+}
+
+func (_m *mockGrpc_TodoServer) Context() context.Context {
+	if _m.Ctx == nil {
+		return context.Background()
+	}
+	return _m.Ctx
 }
 
 func (_m *mockGrpc_TodoServer) Send(todo *pb.ToDo) error {
@@ -38,74 +50,45 @@ func (_m *mockGrpc_TodoServer) Send(todo *pb.ToDo) error {
 	return nil
 }
 
-func (m MockTodoServiceImpl) CreateTodo(request *models.CreateTodoRequest) (*models.Todo, error) {
-	if request.Title == "internal error" {
-		return nil, errors.New("error creating todo")
-	}
-	return &models.Todo{
-		Id:          id1,
-		Title:       request.Title,
-		Description: request.Description,
-		User:        request.User,
-		Done:        false,
-	}, nil
+func (_m *mockGrpc_TodoServer) SetTrailer(md metadata.MD) {
+	_m.Trailer = metadata.Join(_m.Trailer, md)
 }
 
-func (m MockTodoServiceImpl) UpdateTodo(s string, todo *models.UpdateTodo) (*models.Todo, error) {
-	if s == "internal error" {
-		return nil, errors.New("error updating todo")
-	}
-	response := &models.Todo{
-		Title:       todo.Title,
-		Description: todo.Description,
-		User:        todo.User,
-		Done:        todo.Done,
-	}
-	if s == "update_user" {
-		response.Id = id2
-	}
-	if s == "update_title" {
-		response.Id = id3
-	}
-	return response, nil
+func (m failingTodoService) CreateTodo(ctx context.Context, request *models.CreateTodoRequest) (*models.Todo, error) {
+	return nil, errors.New("error creating todo")
 }
 
-func (m MockTodoServiceImpl) GetTodoById(s string) (*models.Todo, error) {
-	if s == "internal error" {
-		return nil, errors.New("error fetching todo")
-	}
-	return &models.Todo{
-		Id:          id3,
-		Title:       "title",
-		Description: "",
-		User:        "1",
-		Done:        true,
-	}, nil
+func (m failingTodoService) GetAllTodos(ctx context.Context, query *models.TodoQuery, fn func(*models.Todo) error) (string, error) {
+	return "", errors.New("error fetching todos")
 }
 
-func (m MockTodoServiceImpl) GetAllTodos(status pb.GetItemsRequest_TodoStatus, user string) ([]*models.Todo, error) {
-	if user == "internal error" {
-		return nil, errors.New("error updating todo")
-	}
-	if user == "1" {
-		return []*models.Todo{
-			{Id: primitive.ObjectID{}, Title: "one", User: "1"},
-		}, nil
-	}
-	return []*models.Todo{
-		{Id: primitive.ObjectID{}},
-		{Id: primitive.ObjectID{}},
-	}, nil
+// blockingTodoService only returns once the request context is done, like a storage that does not answer in time.
+type blockingTodoService struct {
+	services.TodoService
 }
 
-func (m MockTodoServiceImpl) DeleteTodo(s string) error {
-	if s == "internal error" {
-		return errors.New("error deleting todo")
-	}
-	if s == "nothing to delete" {
-		return errors.New("todo does not exist")
+func (m blockingTodoService) GetTodoById(ctx context.Context, id string) (*models.Todo, error) {
+	<-ctx.Done()
+	return nil, fmt.Errorf("storage gave up: %v", ctx.Err())
+}
+
+func (m blockingTodoService) GetAllTodos(ctx context.Context, query *models.TodoQuery, fn func(*models.Todo) error) (string, error) {
+	<-ctx.Done()
+	return "", fmt.Errorf("storage gave up: %v", ctx.Err())
+}
+
+// newSeededTodoService returns an in-memory TodoService holding the given Todos.
+func newSeededTodoService(t *testing.T, todos ...*models.CreateTodoRequest) (services.TodoService, []*models.Todo) {
+	todoService := services.NewInMemoryTodoService(services.Options{})
+	var created []*models.Todo
+	for _, todo := range todos {
+		newTodo, err := todoService.CreateTodo(context.TODO(), todo)
+		if err != nil {
+			t.Fatalf("could not seed todo: %v", err)
+		}
+		created = append(created, newTodo)
 	}
-	return nil
+	return todoService, created
 }
 
 func TestTodoServer_Create(t *testing.T) {
@@ -118,19 +101,22 @@ func TestTodoServer_Create(t *testing.T) {
 		ctx context.Context
 		req *pb.CreateItemRequest
 	}
+	todoService, _ := newSeededTodoService(t)
 	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		want    *pb.TodoResponse
-		wantErr bool
+		name     string
+		fields   fields
+		args     args
+		want     *pb.TodoResponse
+		wantErr  bool
+		wantCode codes.Code
 	}{
 		{
 			name: "create todo success",
 			fields: fields{
-				todoService: MockTodoServiceImpl{},
+				todoService: todoService,
 			},
 			args: args{
+				ctx: context.TODO(),
 				req: &pb.CreateItemRequest{
 					Title:       "this one",
 					Description: "desc 1",
@@ -139,10 +125,10 @@ func TestTodoServer_Create(t *testing.T) {
 			},
 			want: &pb.TodoResponse{
 				ToDo: &pb.ToDo{
-					Id:          id1.Hex(),
 					Title:       "this one",
 					Description: "desc 1",
 					User:        "user 1",
+					Version:     1,
 					Done:        false,
 				},
 			},
@@ -151,13 +137,15 @@ func TestTodoServer_Create(t *testing.T) {
 		{
 			name: "create todo failure",
 			fields: fields{
-				todoService: MockTodoServiceImpl{},
+				todoService: failingTodoService{},
 			},
 			args: args{
-				req: &pb.CreateItemRequest{Title: "internal error"},
+				ctx: context.TODO(),
+				req: &pb.CreateItemRequest{Title: "internal error", User: "user 1"},
 			},
-			want:    nil,
-			wantErr: true,
+			want:     nil,
+			wantErr:  true,
+			wantCode: codes.Internal,
 		},
 	}
 	for _, tt := range tests {
@@ -172,6 +160,22 @@ func TestTodoServer_Create(t *testing.T) {
 				t.Errorf("Create() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if tt.wantErr && status.Code(err) != tt.wantCode {
+				t.Errorf("Create() error code = %v, want %v", status.Code(err), tt.wantCode)
+			}
+			if got != nil {
+				if len(got.ToDo.Id) == 0 || got.ToDo.CreatedAt == nil || got.ToDo.UpdatedAt == nil {
+					t.Errorf("Create() got todo without an Id or timestamps: %v", got)
+				}
+				if got.ToDo.Position != got.ToDo.Id {
+					t.Errorf("Create() got Position = %q, want the Id %q", got.ToDo.Position, got.ToDo.Id)
+				}
+				// The Id, Position and timestamps are generated by the service, so they are not part of the comparison.
+				got.ToDo.Id = ""
+				got.ToDo.Position = ""
+				got.ToDo.CreatedAt = nil
+				got.ToDo.UpdatedAt = nil
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Create() got = %v, want %v", got, tt.want)
 			}
@@ -179,6 +183,29 @@ func TestTodoServer_Create(t *testing.T) {
 	}
 }
 
+func TestTodoServer_CreateReplay(t *testing.T) {
+	todoService, _ := newSeededTodoService(t)
+	ts := &TodoServer{todoService: todoService}
+	req := &pb.CreateItemRequest{Title: "title", User: "1", RequestId: utils.Pointer("req-1")}
+
+	first, err := ts.Create(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	replayed, err := ts.Create(context.TODO(), req)
+	if err != nil {
+		t.Fatalf("Create() replay error = %v", err)
+	}
+	if !proto.Equal(first, replayed) {
+		t.Errorf("Create() replay got = %v, want %v", replayed, first)
+	}
+
+	_, err = ts.Create(context.TODO(), &pb.CreateItemRequest{Title: "other", User: "1", RequestId: utils.Pointer("req-1")})
+	if status.Code(err) != codes.AlreadyExists {
+		t.Errorf("Create() reused request id code = %v, want %v", status.Code(err), codes.AlreadyExists)
+	}
+}
+
 func TestTodoServer_Delete(t *testing.T) {
 	type fields struct {
 		UnimplementedToDoServiceServer pb.UnimplementedToDoServiceServer
@@ -189,6 +216,7 @@ func TestTodoServer_Delete(t *testing.T) {
 		ctx context.Context
 		req *pb.DeleteItemRequest
 	}
+	todoService, todos := newSeededTodoService(t, &models.CreateTodoRequest{Title: "title", User: "1"})
 	tests := []struct {
 		name    string
 		fields  fields
@@ -199,11 +227,12 @@ func TestTodoServer_Delete(t *testing.T) {
 		{
 			name: "delete todo success",
 			fields: fields{
-				todoService: MockTodoServiceImpl{},
+				todoService: todoService,
 			},
 			args: args{
+				ctx: context.TODO(),
 				req: &pb.DeleteItemRequest{
-					Id: "valid_id",
+					Id: todos[0].Id.Hex(),
 				},
 			},
 			want:    &pb.DeleteItemResponse{Deleted: true},
@@ -212,9 +241,10 @@ func TestTodoServer_Delete(t *testing.T) {
 		{
 			name: "delete todo failure",
 			fields: fields{
-				todoService: MockTodoServiceImpl{},
+				todoService: todoService,
 			},
 			args: args{
+				ctx: context.TODO(),
 				req: &pb.DeleteItemRequest{Id: "nothing to delete"},
 			},
 			want:    nil,
@@ -240,6 +270,53 @@ func TestTodoServer_Delete(t *testing.T) {
 	}
 }
 
+func TestTodoServer_Trash(t *testing.T) {
+	todoService, todos := newSeededTodoService(t,
+		&models.CreateTodoRequest{Title: "a", User: "1"},
+		&models.CreateTodoRequest{Title: "b", User: "2"},
+	)
+	ts := &TodoServer{todoService: todoService}
+	for _, todo := range todos {
+		if _, err := ts.Delete(context.TODO(), &pb.DeleteItemRequest{Id: todo.Id.Hex()}); err != nil {
+			t.Fatalf("Delete() error = %v", err)
+		}
+	}
+
+	stream := &mockGrpc_TodoServer{}
+	if err := ts.ListTrash(&pb.ListTrashRequest{User: utils.Pointer("1")}, stream); err != nil {
+		t.Fatalf("ListTrash() error = %v", err)
+	}
+	if len(stream.Results) != 1 || stream.Results[0].GetDeletedAt() == nil {
+		t.Fatalf("ListTrash() got = %v, want the trashed todo of user 1", stream.Results)
+	}
+
+	_, err := ts.Restore(context.TODO(), &pb.RestoreItemRequest{Id: todos[0].Id.Hex(), ExpectedVersion: 1})
+	if status.Code(err) != codes.Aborted {
+		t.Errorf("Restore() stale version code = %v, want %v", status.Code(err), codes.Aborted)
+	}
+	res, err := ts.Restore(context.TODO(), &pb.RestoreItemRequest{Id: todos[0].Id.Hex(), ExpectedVersion: 2})
+	if err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if res.GetToDo().GetDeletedAt() != nil || res.GetToDo().GetVersion() != 3 {
+		t.Errorf("Restore() got = %v, want a live todo at version 3", res.GetToDo())
+	}
+
+	_, err = ts.Purge(context.TODO(), &pb.PurgeItemRequest{Id: todos[0].Id.Hex()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Purge() live todo code = %v, want %v", status.Code(err), codes.NotFound)
+	}
+	purged, err := ts.Purge(context.TODO(), &pb.PurgeItemRequest{Id: todos[1].Id.Hex()})
+	if err != nil || !purged.GetPurged() {
+		t.Errorf("Purge() got = %v, error = %v", purged, err)
+	}
+
+	stream = &mockGrpc_TodoServer{}
+	if err := ts.ListTrash(&pb.ListTrashRequest{}, stream); err != nil || len(stream.Results) != 0 {
+		t.Errorf("ListTrash() after purge got = %v, error = %v", stream.Results, err)
+	}
+}
+
 func TestTodoServer_Get(t *testing.T) {
 	type fields struct {
 		UnimplementedToDoServiceServer pb.UnimplementedToDoServiceServer
@@ -250,6 +327,7 @@ func TestTodoServer_Get(t *testing.T) {
 		ctx context.Context
 		req *pb.GetItemByID
 	}
+	todoService, todos := newSeededTodoService(t, &models.CreateTodoRequest{Title: "title", User: "1"})
 	tests := []struct {
 		name    string
 		fields  fields
@@ -260,26 +338,32 @@ func TestTodoServer_Get(t *testing.T) {
 		{
 			name: "get todo success",
 			fields: fields{
-				todoService: MockTodoServiceImpl{},
+				todoService: todoService,
 			},
 			args: args{
-				req: &pb.GetItemByID{Id: "get_todo_id"},
+				ctx: context.TODO(),
+				req: &pb.GetItemByID{Id: todos[0].Id.Hex()},
 			},
 			want: &pb.TodoResponse{ToDo: &pb.ToDo{
-				Id:          id4.Hex(),
+				Id:          todos[0].Id.Hex(),
 				Title:       "title",
 				Description: "",
 				User:        "1",
-				Done:        true,
+				Done:        false,
+				CreatedAt:   timestamppb.New(todos[0].CreatedAt),
+				Version:     1,
+				UpdatedAt:   timestamppb.New(todos[0].UpdatedAt),
+				Position:    todos[0].Id.Hex(),
 			}},
 			wantErr: false,
 		},
 		{
 			name: "get todo failure",
 			fields: fields{
-				todoService: MockTodoServiceImpl{},
+				todoService: todoService,
 			},
 			args: args{
+				ctx: context.TODO(),
 				req: &pb.GetItemByID{Id: "internal error"},
 			},
 			want:    nil,
@@ -315,21 +399,30 @@ func TestTodoServer_GetAll(t *testing.T) {
 		req    *pb.GetItemsRequest
 		stream pb.ToDoService_GetAllServer
 	}
+	todoService, _ := newSeededTodoService(t,
+		&models.CreateTodoRequest{Title: "one", User: "1"},
+		&models.CreateTodoRequest{Title: "two", User: "2"},
+		&models.CreateTodoRequest{Title: "three", User: "2"},
+	)
+	cancelledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
 	tests := []struct {
-		name    string
-		fields  fields
-		args    args
-		want    int
-		wantErr bool
+		name          string
+		fields        fields
+		args          args
+		want          int
+		wantNextToken bool
+		wantErr       bool
 	}{
 		{
 			name: "get all todo success, stream response has one value",
 			fields: fields{
-				todoService: MockTodoServiceImpl{},
+				todoService: todoService,
 			},
 			args: args{
 				req: &pb.GetItemsRequest{
-					User: utils.Pointer("1"),
+					Status: pb.GetItemsRequest_ALL.Enum(),
+					User:   utils.Pointer("1"),
 				},
 				stream: &mockGrpc_TodoServer{},
 			},
@@ -339,26 +432,73 @@ func TestTodoServer_GetAll(t *testing.T) {
 		{
 			name: "get all todo success, stream response has multiple values",
 			fields: fields{
-				todoService: MockTodoServiceImpl{},
+				todoService: todoService,
 			},
 			args: args{
 				req: &pb.GetItemsRequest{
-					User: utils.Pointer("2"),
+					Status: pb.GetItemsRequest_ALL.Enum(),
+					User:   utils.Pointer("2"),
 				},
 				stream: &mockGrpc_TodoServer{},
 			},
 			want:    2,
 			wantErr: false,
 		},
+		{
+			name: "get all todo success, stream response has the first page",
+			fields: fields{
+				todoService: todoService,
+			},
+			args: args{
+				req: &pb.GetItemsRequest{
+					Status:   pb.GetItemsRequest_ALL.Enum(),
+					User:     utils.Pointer("2"),
+					PageSize: proto.Int32(1),
+				},
+				stream: &mockGrpc_TodoServer{},
+			},
+			want:          1,
+			wantNextToken: true,
+			wantErr:       false,
+		},
+		{
+			name: "get all todo cancelled by the client",
+			fields: fields{
+				todoService: todoService,
+			},
+			args: args{
+				req: &pb.GetItemsRequest{
+					Status: pb.GetItemsRequest_ALL.Enum(),
+				},
+				stream: &mockGrpc_TodoServer{Ctx: cancelledCtx},
+			},
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name: "get all todo invalid page token",
+			fields: fields{
+				todoService: todoService,
+			},
+			args: args{
+				req: &pb.GetItemsRequest{
+					PageToken: utils.Pointer("invalid"),
+				},
+				stream: &mockGrpc_TodoServer{},
+			},
+			want:    0,
+			wantErr: true,
+		},
 		{
 			name: "get all todo failure",
 			fields: fields{
-				todoService: MockTodoServiceImpl{},
+				todoService: failingTodoService{},
 			},
 			args: args{
 				req: &pb.GetItemsRequest{
 					User: utils.Pointer("internal error"),
 				},
+				stream: &mockGrpc_TodoServer{},
 			},
 			want:    0,
 			wantErr: true,
@@ -375,18 +515,525 @@ func TestTodoServer_GetAll(t *testing.T) {
 			if (err != nil) != tt.wantErr {
 				t.Errorf("GetAll() error = %v, wantErr %v", err, tt.wantErr)
 			}
+			if allTodos, ok := tt.args.stream.(*mockGrpc_TodoServer); ok && tt.wantErr && len(allTodos.Results) != 0 {
+				t.Errorf("GetAll() sent %d Todos before failing", len(allTodos.Results))
+			}
 			if !tt.wantErr {
 				if allTodos, ok := tt.args.stream.(*mockGrpc_TodoServer); ok {
 					fmt.Println(len(allTodos.Results))
 					if tt.want != len(allTodos.Results) {
 						t.Errorf("GetAll() wanted = %d, got number of Todos %d", tt.want, len(allTodos.Results))
 					}
+					if nextToken := allTodos.Trailer.Get(NextPageTokenTrailer); tt.wantNextToken != (len(nextToken) != 0) {
+						t.Errorf("GetAll() wanted next page token = %v, got %v", tt.wantNextToken, nextToken)
+					}
 				}
 			}
 		})
 	}
 }
 
+func TestTodoServer_DueTimes(t *testing.T) {
+	todoService, _ := newSeededTodoService(t)
+	ts := &TodoServer{todoService: todoService}
+
+	dueAt := timestamppb.New(time.Now().Add(-time.Hour).Truncate(time.Millisecond))
+	created, err := ts.Create(context.TODO(), &pb.CreateItemRequest{Title: "overdue", User: "1", DueAt: dueAt})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !proto.Equal(created.GetToDo().GetDueAt(), dueAt) {
+		t.Errorf("Create() due at = %v, want %v", created.GetToDo().GetDueAt(), dueAt)
+	}
+	if _, err := ts.Create(context.TODO(), &pb.CreateItemRequest{Title: "no due time", User: "1"}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	// Without a Status, the overdue todos are looked for among the pending ones rather than the done ones.
+	stream := &mockGrpc_TodoServer{}
+	if err := ts.GetAll(&pb.GetItemsRequest{Overdue: proto.Bool(true)}, stream); err != nil {
+		t.Fatalf("GetAll() error = %v", err)
+	}
+	if len(stream.Results) != 1 || stream.Results[0].GetId() != created.GetToDo().GetId() {
+		t.Errorf("GetAll() overdue got = %v, want the overdue todo", stream.Results)
+	}
+
+	stream = &mockGrpc_TodoServer{}
+	req := &pb.GetItemsRequest{Status: pb.GetItemsRequest_ALL.Enum(), DueToday: proto.Bool(true), TimeZone: utils.Pointer("Mars/Olympus_Mons")}
+	if err := ts.GetAll(req, stream); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("GetAll() unknown time zone code = %v, want %v", status.Code(err), codes.InvalidArgument)
+	}
+
+	// A due time in the Update_mask that is left unset removes the due time.
+	updated, err := ts.Update(context.TODO(), &pb.UpdateItemRequest{
+		Id:         created.GetToDo().GetId(),
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"Due_at"}},
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if updated.GetToDo().GetDueAt() != nil {
+		t.Errorf("Update() due at = %v, want unset", updated.GetToDo().GetDueAt())
+	}
+}
+
+func TestTodoServer_Priorities(t *testing.T) {
+	todoService, _ := newSeededTodoService(t)
+	ts := &TodoServer{todoService: todoService}
+
+	var ids []string
+	for _, priority := range []pb.Priority{pb.Priority_LOW, pb.Priority_URGENT, pb.Priority_NONE} {
+		res, err := ts.Create(context.TODO(), &pb.CreateItemRequest{Title: priority.String(), User: "1", Priority: priority})
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		ids = append(ids, res.GetToDo().GetId())
+	}
+
+	stream := &mockGrpc_TodoServer{}
+	req := &pb.GetItemsRequest{
+		Status:      pb.GetItemsRequest_ALL.Enum(),
+		SortBy:      pb.GetItemsRequest_PRIORITY.Enum(),
+		MinPriority: pb.Priority_LOW.Enum(),
+	}
+	if err := ts.GetAll(req, stream); err != nil {
+		t.Fatalf("GetAll() error = %v", err)
+	}
+	var got []pb.Priority
+	for _, todo := range stream.Results {
+		got = append(got, todo.GetPriority())
+	}
+	if want := []pb.Priority{pb.Priority_URGENT, pb.Priority_LOW}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAll() priorities = %v, want %v", got, want)
+	}
+
+	// A Priority in the Update_mask that is left unset goes back to NONE.
+	updated, err := ts.Update(context.TODO(), &pb.UpdateItemRequest{
+		Id:         ids[1],
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"Priority"}},
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if updated.GetToDo().GetPriority() != pb.Priority_NONE {
+		t.Errorf("Update() priority = %v, want NONE", updated.GetToDo().GetPriority())
+	}
+}
+
+func TestTodoServer_Tags(t *testing.T) {
+	todoService, _ := newSeededTodoService(t)
+	ts := &TodoServer{todoService: todoService}
+
+	created, err := ts.Create(context.TODO(), &pb.CreateItemRequest{Title: "title", User: "tagger", Tags: []string{"job", "home"}})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if _, err := ts.Create(context.TODO(), &pb.CreateItemRequest{Title: "other", User: "tagger", Tags: []string{"job"}}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	renamed, err := ts.RenameTag(context.TODO(), &pb.RenameTagRequest{User: "tagger", From: "job", To: "work"})
+	if err != nil {
+		t.Fatalf("RenameTag() error = %v", err)
+	}
+	if renamed.GetRenamed() != 2 {
+		t.Errorf("RenameTag() renamed = %d, want 2", renamed.GetRenamed())
+	}
+
+	stream := &mockGrpc_TodoServer{}
+	req := &pb.GetItemsRequest{Status: pb.GetItemsRequest_ALL.Enum(), TagsAll: []string{"work", "home"}}
+	if err := ts.GetAll(req, stream); err != nil {
+		t.Fatalf("GetAll() error = %v", err)
+	}
+	if len(stream.Results) != 1 || !reflect.DeepEqual(stream.Results[0].GetTags(), []string{"work", "home"}) {
+		t.Errorf("GetAll() = %v, want the created todo tagged [work home]", stream.Results)
+	}
+
+	// Tags in the Update_mask that are left unset are cleared.
+	updated, err := ts.Update(context.TODO(), &pb.UpdateItemRequest{
+		Id:         created.GetToDo().GetId(),
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"Tags"}},
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if len(updated.GetToDo().GetTags()) != 0 {
+		t.Errorf("Update() tags = %v, want none", updated.GetToDo().GetTags())
+	}
+
+	tags, err := ts.ListTags(context.TODO(), &pb.ListTagsRequest{User: "tagger"})
+	if err != nil {
+		t.Fatalf("ListTags() error = %v", err)
+	}
+	want := []*pb.TagCount{{Tag: "work", Count: 1}}
+	if len(tags.GetTags()) != 1 || !proto.Equal(tags.GetTags()[0], want[0]) {
+		t.Errorf("ListTags() = %v, want %v", tags.GetTags(), want)
+	}
+}
+
+func TestTodoServer_Checklist(t *testing.T) {
+	todoService, _ := newSeededTodoService(t)
+	ts := &TodoServer{todoService: todoService}
+
+	created, err := ts.Create(context.TODO(), &pb.CreateItemRequest{Title: "title", User: "1"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	id := created.GetToDo().GetId()
+	if created.GetToDo().GetChecklistProgress() != nil {
+		t.Errorf("Create() progress = %v, want unset", created.GetToDo().GetChecklistProgress())
+	}
+
+	var res *pb.TodoResponse
+	for _, text := range []string{"first", "second"} {
+		if res, err = ts.AddChecklistItem(context.TODO(), &pb.AddChecklistItemRequest{Id: id, Text: text}); err != nil {
+			t.Fatalf("AddChecklistItem() error = %v", err)
+		}
+	}
+	items := res.GetToDo().GetChecklist()
+	res, err = ts.ToggleChecklistItem(context.TODO(), &pb.ToggleChecklistItemRequest{Id: id, ItemId: items[1].GetId(), Done: true})
+	if err != nil {
+		t.Fatalf("ToggleChecklistItem() error = %v", err)
+	}
+	if want := (&pb.ChecklistProgress{Done: 1, Total: 2}); !proto.Equal(res.GetToDo().GetChecklistProgress(), want) {
+		t.Errorf("ToggleChecklistItem() progress = %v, want %v", res.GetToDo().GetChecklistProgress(), want)
+	}
+
+	res, err = ts.ReorderChecklist(context.TODO(), &pb.ReorderChecklistRequest{Id: id, ItemIds: []string{items[1].GetId(), items[0].GetId()}})
+	if err != nil {
+		t.Fatalf("ReorderChecklist() error = %v", err)
+	}
+	if got := res.GetToDo().GetChecklist()[0].GetText(); got != "second" {
+		t.Errorf("ReorderChecklist() first item = %q, want second", got)
+	}
+
+	res, err = ts.RemoveChecklistItem(context.TODO(), &pb.RemoveChecklistItemRequest{Id: id, ItemId: items[1].GetId()})
+	if err != nil {
+		t.Fatalf("RemoveChecklistItem() error = %v", err)
+	}
+	if want := (&pb.ChecklistProgress{Done: 0, Total: 1}); !proto.Equal(res.GetToDo().GetChecklistProgress(), want) {
+		t.Errorf("RemoveChecklistItem() progress = %v, want %v", res.GetToDo().GetChecklistProgress(), want)
+	}
+
+	_, err = ts.RemoveChecklistItem(context.TODO(), &pb.RemoveChecklistItemRequest{Id: id, ItemId: items[1].GetId()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("RemoveChecklistItem() of a removed item code = %v, want %v", status.Code(err), codes.NotFound)
+	}
+}
+
+func TestTodoServer_Subtasks(t *testing.T) {
+	todoService, _ := newSeededTodoService(t)
+	ts := &TodoServer{todoService: todoService}
+
+	parent, err := ts.Create(context.TODO(), &pb.CreateItemRequest{Title: "parent", User: "1"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	parentId := parent.GetToDo().GetId()
+	child, err := ts.Create(context.TODO(), &pb.CreateItemRequest{Title: "child", User: "1", ParentId: &parentId})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if got := child.GetToDo().GetParentId(); got != parentId {
+		t.Errorf("Create() parent = %q, want %q", got, parentId)
+	}
+
+	_, err = ts.Update(context.TODO(), &pb.UpdateItemRequest{Id: parentId, ParentId: proto.String(child.GetToDo().GetId())})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Update() under its child code = %v, want %v", status.Code(err), codes.InvalidArgument)
+	}
+
+	stream := &mockGrpc_TodoServer{}
+	req := &pb.GetItemsRequest{Status: pb.GetItemsRequest_ALL.Enum(), SubtreeOf: &parentId}
+	if err := ts.GetAll(req, stream); err != nil {
+		t.Fatalf("GetAll() error = %v", err)
+	}
+	if len(stream.Results) != 2 {
+		t.Errorf("GetAll() subtree = %v, want the parent and its child", stream.Results)
+	}
+
+	res, err := ts.BatchDelete(context.TODO(), &pb.BatchDeleteRequest{Items: []*pb.DeleteItemRequest{{Id: parentId, Cascade: true}}})
+	if err != nil {
+		t.Fatalf("BatchDelete() error = %v", err)
+	}
+	if got, want := batchCodes(res), []codes.Code{codes.InvalidArgument}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BatchDelete() cascade codes = %v, want %v", got, want)
+	}
+
+	if _, err := ts.Delete(context.TODO(), &pb.DeleteItemRequest{Id: parentId, Cascade: true}); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	_, err = ts.Get(context.TODO(), &pb.GetItemByID{Id: child.GetToDo().GetId()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Get() of a deleted child code = %v, want %v", status.Code(err), codes.NotFound)
+	}
+}
+
+func TestTodoServer_Recurrence(t *testing.T) {
+	todoService, _ := newSeededTodoService(t)
+	ts := &TodoServer{todoService: todoService}
+
+	due := time.Date(2030, time.January, 4, 18, 0, 0, 0, time.UTC)
+	created, err := ts.Create(context.TODO(), &pb.CreateItemRequest{
+		Title:      "standup",
+		User:       "1",
+		DueAt:      timestamppb.New(due),
+		Recurrence: "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR",
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	done, err := ts.Update(context.TODO(), &pb.UpdateItemRequest{Id: created.GetToDo().GetId(), Done: proto.Bool(true)})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	nextId := done.GetToDo().GetNextOccurrenceId()
+	if nextId == "" {
+		t.Fatalf("Update() next occurrence unset")
+	}
+
+	skipped, err := ts.SkipOccurrence(context.TODO(), &pb.SkipOccurrenceRequest{Id: nextId})
+	if err != nil {
+		t.Fatalf("SkipOccurrence() error = %v", err)
+	}
+	// Monday is completed, Tuesday skipped.
+	if got, want := skipped.GetToDo().GetDueAt().AsTime(), due.AddDate(0, 0, 4); !got.Equal(want) {
+		t.Errorf("SkipOccurrence() due at = %v, want %v", got, want)
+	}
+
+	_, err = ts.SkipOccurrence(context.TODO(), &pb.SkipOccurrenceRequest{Id: created.GetToDo().GetId()})
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("SkipOccurrence() of a completed occurrence code = %v, want %v", status.Code(err), codes.FailedPrecondition)
+	}
+
+	_, err = ts.Create(context.TODO(), &pb.CreateItemRequest{Title: "title", User: "1", Recurrence: "FREQ=SOMETIMES"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Create() with an invalid rule code = %v, want %v", status.Code(err), codes.InvalidArgument)
+	}
+}
+
+func TestTodoServer_Reminders(t *testing.T) {
+	todoService, _ := newSeededTodoService(t)
+	ts := &TodoServer{todoService: todoService}
+
+	at := time.Date(2030, time.January, 4, 9, 0, 0, 0, time.UTC)
+	created, err := ts.Create(context.TODO(), &pb.CreateItemRequest{
+		Title:     "title",
+		User:      "1",
+		Reminders: []*timestamppb.Timestamp{timestamppb.New(at.Add(time.Hour)), timestamppb.New(at)},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	want := &pb.ReminderList{Reminders: []*timestamppb.Timestamp{timestamppb.New(at), timestamppb.New(at.Add(time.Hour))}}
+	got := &pb.ReminderList{}
+	for _, reminder := range created.GetToDo().GetReminders() {
+		got.Reminders = append(got.Reminders, reminder.GetAt())
+	}
+	if !proto.Equal(got, want) {
+		t.Errorf("Create() reminders = %v, want %v", got, want)
+	}
+
+	// Without the ReminderList, the reminders are left untouched.
+	updated, err := ts.Update(context.TODO(), &pb.UpdateItemRequest{Id: created.GetToDo().GetId(), Title: proto.String("new title")})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got := len(updated.GetToDo().GetReminders()); got != 2 {
+		t.Errorf("Update() kept %d reminders, want 2", got)
+	}
+
+	updated, err = ts.Update(context.TODO(), &pb.UpdateItemRequest{
+		Id:         created.GetToDo().GetId(),
+		UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"Reminders"}},
+	})
+	if err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got := updated.GetToDo().GetReminders(); len(got) != 0 {
+		t.Errorf("Update() of an empty ReminderList reminders = %v, want none", got)
+	}
+
+	_, err = ts.Create(context.TODO(), &pb.CreateItemRequest{Title: "title", User: "1", Reminders: []*timestamppb.Timestamp{{}}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Create() with an epoch reminder code = %v, want %v", status.Code(err), codes.InvalidArgument)
+	}
+}
+
+func TestTodoServer_Lists(t *testing.T) {
+	todoService, _ := newSeededTodoService(t)
+	ts := &TodoServer{todoService: todoService}
+
+	created, err := ts.CreateList(context.TODO(), &pb.CreateListRequest{User: "1", Name: "work"})
+	if err != nil {
+		t.Fatalf("CreateList() error = %v", err)
+	}
+	list := created.GetList()
+	if list.GetName() != "work" || list.GetVersion() != 1 || list.GetId() == "" {
+		t.Errorf("CreateList() = %v", list)
+	}
+	todo, err := ts.Create(context.TODO(), &pb.CreateItemRequest{Title: "report", User: "1", ListId: proto.String(list.GetId())})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if got := todo.GetToDo().GetListId(); got != list.GetId() {
+		t.Errorf("Create() List_id = %q, want %q", got, list.GetId())
+	}
+	_, err = ts.Create(context.TODO(), &pb.CreateItemRequest{Title: "inbox", User: "1"})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	_, err = ts.Create(context.TODO(), &pb.CreateItemRequest{Title: "misplaced", User: "2", ListId: proto.String(list.GetId())})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Create() in a List of another user code = %v, want %v", status.Code(err), codes.InvalidArgument)
+	}
+
+	renamed, err := ts.UpdateList(context.TODO(), &pb.UpdateListRequest{Id: list.GetId(), Name: proto.String("job"), ExpectedVersion: 1})
+	if err != nil {
+		t.Fatalf("UpdateList() error = %v", err)
+	}
+	if renamed.GetList().GetName() != "job" || renamed.GetList().GetVersion() != 2 {
+		t.Errorf("UpdateList() = %v", renamed.GetList())
+	}
+	got, err := ts.GetList(context.TODO(), &pb.GetListRequest{Id: list.GetId()})
+	if err != nil {
+		t.Fatalf("GetList() error = %v", err)
+	}
+	if !proto.Equal(got.GetList(), renamed.GetList()) {
+		t.Errorf("GetList() = %v, want %v", got.GetList(), renamed.GetList())
+	}
+
+	lists, err := ts.ListLists(context.TODO(), &pb.ListListsRequest{User: "1"})
+	if err != nil {
+		t.Fatalf("ListLists() error = %v", err)
+	}
+	want := []*pb.List{{User: "1", Name: services.InboxName}, renamed.GetList()}
+	if len(lists.GetLists()) != len(want) || !proto.Equal(lists.GetLists()[0], want[0]) || !proto.Equal(lists.GetLists()[1], want[1]) {
+		t.Errorf("ListLists() = %v, want %v", lists.GetLists(), want)
+	}
+
+	for listId, title := range map[string]string{list.GetId(): "report", "": "inbox"} {
+		stream := &mockGrpc_TodoServer{}
+		if err := ts.GetAll(&pb.GetItemsRequest{Status: pb.GetItemsRequest_ALL.Enum(), User: utils.Pointer("1"), ListId: proto.String(listId)}, stream); err != nil {
+			t.Fatalf("GetAll() error = %v", err)
+		}
+		if len(stream.Results) != 1 || stream.Results[0].GetTitle() != title {
+			t.Errorf("GetAll() of List %q = %v, want %q", listId, stream.Results, title)
+		}
+	}
+
+	_, err = ts.DeleteList(context.TODO(), &pb.DeleteListRequest{Id: list.GetId(), ExpectedVersion: 1})
+	if status.Code(err) != codes.Aborted {
+		t.Errorf("DeleteList() of a stale version code = %v, want %v", status.Code(err), codes.Aborted)
+	}
+	deleted, err := ts.DeleteList(context.TODO(), &pb.DeleteListRequest{Id: list.GetId(), Cascade: true})
+	if err != nil || !deleted.GetDeleted() {
+		t.Fatalf("DeleteList() = %v, error = %v", deleted, err)
+	}
+	_, err = ts.Get(context.TODO(), &pb.GetItemByID{Id: todo.GetToDo().GetId()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Get() of a Todo of a deleted List code = %v, want %v", status.Code(err), codes.NotFound)
+	}
+	_, err = ts.GetList(context.TODO(), &pb.GetListRequest{Id: list.GetId()})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("GetList() of a deleted List code = %v, want %v", status.Code(err), codes.NotFound)
+	}
+}
+
+func TestTodoServer_Move(t *testing.T) {
+	todoService, todos := newSeededTodoService(t,
+		&models.CreateTodoRequest{Title: "a", User: "1"},
+		&models.CreateTodoRequest{Title: "b", User: "1"},
+		&models.CreateTodoRequest{Title: "c", User: "1"},
+	)
+	ts := &TodoServer{todoService: todoService}
+
+	moved, err := ts.Move(context.TODO(), &pb.MoveItemRequest{Id: todos[2].Id.Hex(), BeforeId: proto.String(todos[0].Id.Hex())})
+	if err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	if moved.GetToDo().GetVersion() != 2 || moved.GetToDo().GetPosition() >= todos[0].Position {
+		t.Errorf("Move() = %v, want version 2 and a Position before %q", moved.GetToDo(), todos[0].Position)
+	}
+
+	stream := &mockGrpc_TodoServer{}
+	req := &pb.GetItemsRequest{Status: pb.GetItemsRequest_ALL.Enum(), SortBy: pb.GetItemsRequest_POSITION.Enum()}
+	if err := ts.GetAll(req, stream); err != nil {
+		t.Fatalf("GetAll() error = %v", err)
+	}
+	var got []string
+	for _, todo := range stream.Results {
+		got = append(got, todo.GetTitle())
+	}
+	if want := []string{"c", "a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAll() manual order = %v, want %v", got, want)
+	}
+
+	_, err = ts.Move(context.TODO(), &pb.MoveItemRequest{Id: todos[0].Id.Hex()})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Move() without a target code = %v, want %v", status.Code(err), codes.InvalidArgument)
+	}
+	_, err = ts.Move(context.TODO(), &pb.MoveItemRequest{Id: todos[0].Id.Hex(), AfterId: proto.String(todos[1].Id.Hex()), ExpectedVersion: 2})
+	if status.Code(err) != codes.Aborted {
+		t.Errorf("Move() of a stale version code = %v, want %v", status.Code(err), codes.Aborted)
+	}
+}
+
+func TestTodoServer_Comments(t *testing.T) {
+	todoService, todos := newSeededTodoService(t, &models.CreateTodoRequest{Title: "report", User: "1"})
+	ts := &TodoServer{todoService: todoService}
+	todoId := todos[0].Id.Hex()
+
+	added, err := ts.AddComment(context.TODO(), &pb.AddCommentRequest{TodoId: todoId, Author: "2", Body: "*draft* sent"})
+	if err != nil {
+		t.Fatalf("AddComment() error = %v", err)
+	}
+	comment := added.GetComment()
+	if comment.GetTodoId() != todoId || comment.GetAuthor() != "2" || comment.GetVersion() != 1 || comment.GetId() == "" {
+		t.Errorf("AddComment() = %v", comment)
+	}
+	todo, err := ts.Get(context.TODO(), &pb.GetItemByID{Id: todoId})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if todo.GetToDo().GetCommentCount() != 1 || todo.GetToDo().GetVersion() != 1 {
+		t.Errorf("Get() after AddComment() = %v, want Comment_count 1 at version 1", todo.GetToDo())
+	}
+
+	edited, err := ts.UpdateComment(context.TODO(), &pb.UpdateCommentRequest{Id: comment.GetId(), Body: "sent", ExpectedVersion: 1})
+	if err != nil {
+		t.Fatalf("UpdateComment() error = %v", err)
+	}
+	if edited.GetComment().GetBody() != "sent" || edited.GetComment().GetVersion() != 2 {
+		t.Errorf("UpdateComment() = %v", edited.GetComment())
+	}
+	comments, err := ts.ListComments(context.TODO(), &pb.ListCommentsRequest{TodoId: todoId})
+	if err != nil {
+		t.Fatalf("ListComments() error = %v", err)
+	}
+	if len(comments.GetComments()) != 1 || !proto.Equal(comments.GetComments()[0], edited.GetComment()) {
+		t.Errorf("ListComments() = %v, want %v", comments.GetComments(), edited.GetComment())
+	}
+
+	_, err = ts.DeleteComment(context.TODO(), &pb.DeleteCommentRequest{Id: comment.GetId(), ExpectedVersion: 1})
+	if status.Code(err) != codes.Aborted {
+		t.Errorf("DeleteComment() of a stale version code = %v, want %v", status.Code(err), codes.Aborted)
+	}
+	deleted, err := ts.DeleteComment(context.TODO(), &pb.DeleteCommentRequest{Id: comment.GetId()})
+	if err != nil || !deleted.GetDeleted() {
+		t.Fatalf("DeleteComment() = %v, error = %v", deleted, err)
+	}
+	_, err = ts.UpdateComment(context.TODO(), &pb.UpdateCommentRequest{Id: comment.GetId(), Body: "late"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("UpdateComment() of a deleted Comment code = %v, want %v", status.Code(err), codes.NotFound)
+	}
+	_, err = ts.AddComment(context.TODO(), &pb.AddCommentRequest{TodoId: primitive.NewObjectID().Hex(), Author: "1", Body: "note"})
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("AddComment() on an unknown Todo code = %v, want %v", status.Code(err), codes.NotFound)
+	}
+}
+
 func TestTodoServer_Update(t *testing.T) {
 	type fields struct {
 		UnimplementedToDoServiceServer pb.UnimplementedToDoServiceServer
@@ -397,6 +1044,14 @@ func TestTodoServer_Update(t *testing.T) {
 		ctx context.Context
 		req *pb.UpdateItemRequest
 	}
+	todoService, todos := newSeededTodoService(t,
+		&models.CreateTodoRequest{Title: "title", User: "old_user"},
+		&models.CreateTodoRequest{Title: "old_title", User: "1"},
+		&models.CreateTodoRequest{Title: "done", Description: "desc", User: "1"},
+	)
+	if _, err := todoService.UpdateTodo(context.TODO(), todos[2].Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)}); err != nil {
+		t.Fatalf("could not seed todo: %v", err)
+	}
 	tests := []struct {
 		name    string
 		fields  fields
@@ -407,43 +1062,130 @@ func TestTodoServer_Update(t *testing.T) {
 		{
 			name: "update USER in a Todo success",
 			fields: fields{
-				todoService: MockTodoServiceImpl{},
+				todoService: todoService,
 			},
 			args: args{
+				ctx: context.TODO(),
 				req: &pb.UpdateItemRequest{
-					Id:   "update_user",
+					Id:   todos[0].Id.Hex(),
 					User: utils.Pointer("new_user"),
 				},
 			},
 			want: &pb.TodoResponse{ToDo: &pb.ToDo{
-				Id:   id2.Hex(),
-				User: "new_user",
+				Id:        todos[0].Id.Hex(),
+				Title:     "title",
+				User:      "new_user",
+				CreatedAt: timestamppb.New(todos[0].CreatedAt),
+				Version:   2,
+				Position:  todos[0].Id.Hex(),
 			}},
 			wantErr: false,
 		},
 		{
 			name: "update TITLE in a Todo success",
 			fields: fields{
-				todoService: MockTodoServiceImpl{},
+				todoService: todoService,
 			},
 			args: args{
+				ctx: context.TODO(),
 				req: &pb.UpdateItemRequest{
-					Id:    "update_title",
+					Id:    todos[1].Id.Hex(),
 					Title: utils.Pointer("new_title"),
 				},
 			},
 			want: &pb.TodoResponse{ToDo: &pb.ToDo{
-				Id:    id3.Hex(),
-				Title: "new_title",
+				Id:        todos[1].Id.Hex(),
+				Title:     "new_title",
+				User:      "1",
+				CreatedAt: timestamppb.New(todos[1].CreatedAt),
+				Version:   2,
+				Position:  todos[1].Id.Hex(),
+			}},
+			wantErr: false,
+		},
+		{
+			name: "reopen a done Todo success",
+			fields: fields{
+				todoService: todoService,
+			},
+			args: args{
+				ctx: context.TODO(),
+				req: &pb.UpdateItemRequest{
+					Id:   todos[2].Id.Hex(),
+					Done: proto.Bool(false),
+				},
+			},
+			want: &pb.TodoResponse{ToDo: &pb.ToDo{
+				Id:          todos[2].Id.Hex(),
+				Title:       "done",
+				Description: "desc",
+				User:        "1",
+				CreatedAt:   timestamppb.New(todos[2].CreatedAt),
+				Version:     3,
+				Position:    todos[2].Id.Hex(),
 			}},
 			wantErr: false,
 		},
+		{
+			name: "update mask clears DESCRIPTION success",
+			fields: fields{
+				todoService: todoService,
+			},
+			args: args{
+				ctx: context.TODO(),
+				req: &pb.UpdateItemRequest{
+					Id:         todos[2].Id.Hex(),
+					Title:      utils.Pointer("not in the mask"),
+					UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"Description"}},
+				},
+			},
+			want: &pb.TodoResponse{ToDo: &pb.ToDo{
+				Id:        todos[2].Id.Hex(),
+				Title:     "done",
+				User:      "1",
+				CreatedAt: timestamppb.New(todos[2].CreatedAt),
+				Version:   4,
+				Position:  todos[2].Id.Hex(),
+			}},
+			wantErr: false,
+		},
+		{
+			name: "update mask with unknown field failure",
+			fields: fields{
+				todoService: todoService,
+			},
+			args: args{
+				ctx: context.TODO(),
+				req: &pb.UpdateItemRequest{
+					Id:         todos[2].Id.Hex(),
+					UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"Id"}},
+				},
+			},
+			want:    nil,
+			wantErr: true,
+		},
+		{
+			name: "update mask clearing TITLE failure",
+			fields: fields{
+				todoService: todoService,
+			},
+			args: args{
+				ctx: context.TODO(),
+				req: &pb.UpdateItemRequest{
+					Id:         todos[2].Id.Hex(),
+					UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"Title"}},
+				},
+			},
+			want:    nil,
+			wantErr: true,
+		},
 		{
 			name: "update todo failure",
 			fields: fields{
-				todoService: MockTodoServiceImpl{},
+				todoService: todoService,
 			},
 			args: args{
+				ctx: context.TODO(),
 				req: &pb.UpdateItemRequest{Id: "internal error"},
 			},
 			want:    nil,
@@ -462,9 +1204,300 @@ func TestTodoServer_Update(t *testing.T) {
 				t.Errorf("Update() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if got != nil {
+				if got.ToDo.UpdatedAt == nil {
+					t.Errorf("Update() got todo without UpdatedAt: %v", got)
+				}
+				// UpdatedAt is set by the service, so it is not part of the comparison.
+				got.ToDo.UpdatedAt = nil
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("Update() got = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestTodoServer_ContextErrors(t *testing.T) {
+	ts := &TodoServer{todoService: blockingTodoService{}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := ts.Get(ctx, &pb.GetItemByID{Id: primitive.NewObjectID().Hex()})
+	if got := status.Code(err); got != codes.DeadlineExceeded {
+		t.Errorf("Get() code = %v, want %v", got, codes.DeadlineExceeded)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	err = ts.GetAll(&pb.GetItemsRequest{}, &mockGrpc_TodoServer{Ctx: ctx})
+	if got := status.Code(err); got != codes.Canceled {
+		t.Errorf("GetAll() code = %v, want %v", got, codes.Canceled)
+	}
+}
+
+func TestTimeoutInterceptors(t *testing.T) {
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		ctx          context.Context
+		wantDeadline bool
+	}{
+		{name: "default timeout applied", timeout: time.Minute, ctx: context.Background(), wantDeadline: true},
+		{name: "disabled", timeout: 0, ctx: context.Background(), wantDeadline: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unary := TimeoutUnaryInterceptor(tt.timeout)
+			_, _ = unary(tt.ctx, nil, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+				if _, ok := ctx.Deadline(); ok != tt.wantDeadline {
+					t.Errorf("unary deadline set = %v, want %v", ok, tt.wantDeadline)
+				}
+				return nil, nil
+			})
+
+			stream := TimeoutStreamInterceptor(tt.timeout)
+			_ = stream(nil, &mockGrpc_TodoServer{Ctx: tt.ctx}, nil, func(srv interface{}, ss grpc.ServerStream) error {
+				if _, ok := ss.Context().Deadline(); ok != tt.wantDeadline {
+					t.Errorf("stream deadline set = %v, want %v", ok, tt.wantDeadline)
+				}
+				return nil
+			})
+		})
+	}
+
+	// A client deadline sooner than the default is kept.
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	want, _ := ctx.Deadline()
+	_, _ = TimeoutUnaryInterceptor(time.Hour)(ctx, nil, nil, func(ctx context.Context, req interface{}) (interface{}, error) {
+		if got, _ := ctx.Deadline(); !got.Equal(want) {
+			t.Errorf("deadline = %v, want %v", got, want)
+		}
+		return nil, nil
+	})
+}
+
+func TestServiceError(t *testing.T) {
+	todoService, todos := newSeededTodoService(t, &models.CreateTodoRequest{Title: "title", User: "1"})
+	id := primitive.NewObjectID().Hex()
+	_, notFoundErr := todoService.GetTodoById(context.TODO(), id)
+	_, invalidIdErr := todoService.GetTodoById(context.TODO(), "malformed")
+	staleErr := todoService.DeleteTodo(context.TODO(), todos[0].Id.Hex(), 42)
+	_, listNotFoundErr := todoService.GetList(context.TODO(), id)
+	commentNotFoundErr := todoService.DeleteComment(context.TODO(), id, 0)
+
+	tests := []struct {
+		name        string
+		err         error
+		wantCode    codes.Code
+		wantReason  string
+		wantDetails proto.Message
+	}{
+		{
+			name:        "not found",
+			err:         notFoundErr,
+			wantCode:    codes.NotFound,
+			wantReason:  "NOT_FOUND",
+			wantDetails: &errdetails.ResourceInfo{ResourceType: "ToDo", ResourceName: id, Description: notFoundErr.Error()},
+		},
+		{
+			name:        "list not found",
+			err:         listNotFoundErr,
+			wantCode:    codes.NotFound,
+			wantReason:  "NOT_FOUND",
+			wantDetails: &errdetails.ResourceInfo{ResourceType: "List", ResourceName: id, Description: listNotFoundErr.Error()},
+		},
+		{
+			name:        "comment not found",
+			err:         commentNotFoundErr,
+			wantCode:    codes.NotFound,
+			wantReason:  "NOT_FOUND",
+			wantDetails: &errdetails.ResourceInfo{ResourceType: "Comment", ResourceName: id, Description: commentNotFoundErr.Error()},
+		},
+		{
+			name:       "invalid id",
+			err:        invalidIdErr,
+			wantCode:   codes.InvalidArgument,
+			wantReason: "INVALID_ARGUMENT",
+			wantDetails: &errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{
+				{Field: "Id", Description: invalidIdErr.Error()},
+			}},
+		},
+		{
+			name:       "version mismatch",
+			err:        staleErr,
+			wantCode:   codes.Aborted,
+			wantReason: "VERSION_MISMATCH",
+			wantDetails: &errdetails.ResourceInfo{
+				ResourceType: "ToDo",
+				ResourceName: todos[0].Id.Hex(),
+				Description:  staleErr.Error(),
+			},
+		},
+		{
+			name:     "internal",
+			err:      errors.New("storage unreachable"),
+			wantCode: codes.Internal,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(serviceError(context.TODO(), tt.err))
+			if st.Code() != tt.wantCode {
+				t.Errorf("serviceError() code = %v, want %v", st.Code(), tt.wantCode)
+			}
+			if st.Message() != tt.err.Error() {
+				t.Errorf("serviceError() message = %q, want %q", st.Message(), tt.err.Error())
+			}
+			details := st.Details()
+			if tt.wantDetails == nil {
+				if len(details) != 0 {
+					t.Errorf("serviceError() details = %v, want none", details)
+				}
+				return
+			}
+			if len(details) != 2 {
+				t.Fatalf("serviceError() details = %v, want ErrorInfo and %T", details, tt.wantDetails)
+			}
+			wantInfo := &errdetails.ErrorInfo{Reason: tt.wantReason, Domain: ErrorDomain}
+			if info, ok := details[0].(*errdetails.ErrorInfo); !ok || !proto.Equal(info, wantInfo) {
+				t.Errorf("serviceError() ErrorInfo = %v, want %v", details[0], wantInfo)
+			}
+			if got, ok := details[1].(proto.Message); !ok || !proto.Equal(got, tt.wantDetails) {
+				t.Errorf("serviceError() details = %v, want %v", details[1], tt.wantDetails)
+			}
+		})
+	}
+}
+
+// batchCodes returns the code of every result of a batch, OK for the items that succeeded.
+func batchCodes(res *pb.BatchResponse) []codes.Code {
+	var got []codes.Code
+	for _, result := range res.GetResults() {
+		got = append(got, codes.Code(result.GetError().GetCode()))
+	}
+	return got
+}
+
+func TestTodoServer_BatchCreate(t *testing.T) {
+	todoService, _ := newSeededTodoService(t)
+	ts := &TodoServer{todoService: todoService}
+
+	res, err := ts.BatchCreate(context.TODO(), &pb.BatchCreateRequest{Items: []*pb.CreateItemRequest{
+		{Title: "a", User: "1"},
+		{Title: "", User: "1"},
+		{Title: "c", User: "1"},
+	}})
+	if err != nil {
+		t.Fatalf("BatchCreate() error = %v", err)
+	}
+	if got, want := batchCodes(res), []codes.Code{codes.OK, codes.InvalidArgument, codes.OK}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BatchCreate() codes = %v, want %v", got, want)
+	}
+	if res.Results[0].GetToDo().GetTitle() != "a" || res.Results[2].GetToDo().GetTitle() != "c" {
+		t.Errorf("BatchCreate() got = %v", res)
+	}
+
+	// An atomic batch with an invalid item writes nothing.
+	res, err = ts.BatchCreate(context.TODO(), &pb.BatchCreateRequest{Atomic: true, Items: []*pb.CreateItemRequest{
+		{Title: "d", User: "1"},
+		{Title: "", User: "1"},
+	}})
+	if err != nil {
+		t.Fatalf("BatchCreate() atomic error = %v", err)
+	}
+	if got, want := batchCodes(res), []codes.Code{codes.Aborted, codes.InvalidArgument}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BatchCreate() atomic codes = %v, want %v", got, want)
+	}
+	stream := &mockGrpc_TodoServer{}
+	if err := ts.GetAll(&pb.GetItemsRequest{Status: pb.GetItemsRequest_ALL.Enum()}, stream); err != nil {
+		t.Fatalf("GetAll() error = %v", err)
+	}
+	if len(stream.Results) != 2 {
+		t.Errorf("GetAll() got %d todos, want 2", len(stream.Results))
+	}
+
+	_, err = ts.BatchCreate(context.TODO(), &pb.BatchCreateRequest{Items: make([]*pb.CreateItemRequest, 501)})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("BatchCreate() too many items code = %v, want %v", status.Code(err), codes.InvalidArgument)
+	}
+}
+
+func TestTodoServer_BatchUpdate(t *testing.T) {
+	todoService, todos := newSeededTodoService(t,
+		&models.CreateTodoRequest{Title: "a", User: "1"},
+		&models.CreateTodoRequest{Title: "b", User: "1"},
+	)
+	ts := &TodoServer{todoService: todoService}
+	a, b := todos[0].Id.Hex(), todos[1].Id.Hex()
+
+	res, err := ts.BatchUpdate(context.TODO(), &pb.BatchUpdateRequest{Items: []*pb.UpdateItemRequest{
+		{Id: a, Done: proto.Bool(true)},
+		{Id: b, Done: proto.Bool(true), ExpectedVersion: 7},
+		{Id: primitive.NewObjectID().Hex(), Done: proto.Bool(true)},
+		{Id: b, UpdateMask: &fieldmaskpb.FieldMask{Paths: []string{"Unknown"}}},
+	}})
+	if err != nil {
+		t.Fatalf("BatchUpdate() error = %v", err)
+	}
+	want := []codes.Code{codes.OK, codes.Aborted, codes.NotFound, codes.InvalidArgument}
+	if got := batchCodes(res); !reflect.DeepEqual(got, want) {
+		t.Errorf("BatchUpdate() codes = %v, want %v", got, want)
+	}
+	if !res.Results[0].GetToDo().GetDone() {
+		t.Errorf("BatchUpdate() got = %v, want a done todo", res.Results[0])
+	}
+
+	_, err = ts.BatchUpdate(context.TODO(), &pb.BatchUpdateRequest{Items: []*pb.UpdateItemRequest{
+		{Id: a, Title: proto.String("x")},
+		{Id: a, Title: proto.String("y")},
+	}})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("BatchUpdate() duplicate ids code = %v, want %v", status.Code(err), codes.InvalidArgument)
+	}
+}
+
+func TestTodoServer_BatchDelete(t *testing.T) {
+	todoService, todos := newSeededTodoService(t,
+		&models.CreateTodoRequest{Title: "a", User: "1"},
+		&models.CreateTodoRequest{Title: "b", User: "1"},
+	)
+	ts := &TodoServer{todoService: todoService}
+
+	res, err := ts.BatchDelete(context.TODO(), &pb.BatchDeleteRequest{Atomic: true, Items: []*pb.DeleteItemRequest{
+		{Id: todos[0].Id.Hex()},
+		{Id: todos[1].Id.Hex(), ExpectedVersion: 2},
+	}})
+	if err != nil {
+		t.Fatalf("BatchDelete() error = %v", err)
+	}
+	if got, want := batchCodes(res), []codes.Code{codes.Aborted, codes.Aborted}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BatchDelete() atomic codes = %v, want %v", got, want)
+	}
+	if reason := errorReason(t, res.Results[0].GetError()); reason != "ABORTED" {
+		t.Errorf("BatchDelete() rolled back item reason = %q, want ABORTED", reason)
+	}
+
+	res, err = ts.BatchDelete(context.TODO(), &pb.BatchDeleteRequest{Items: []*pb.DeleteItemRequest{
+		{Id: todos[0].Id.Hex()},
+		{Id: todos[1].Id.Hex(), ExpectedVersion: 1},
+	}})
+	if err != nil {
+		t.Fatalf("BatchDelete() error = %v", err)
+	}
+	if got, want := batchCodes(res), []codes.Code{codes.OK, codes.OK}; !reflect.DeepEqual(got, want) {
+		t.Errorf("BatchDelete() codes = %v, want %v", got, want)
+	}
+}
+
+// errorReason returns the reason of the ErrorInfo detail of a batch item error.
+func errorReason(t *testing.T, st *spb.Status) string {
+	for _, detail := range status.FromProto(st).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.GetReason()
+		}
+	}
+	t.Fatalf("no ErrorInfo in %v", st)
+	return ""
+}
@@ -0,0 +1,104 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/todo-project/models"
+	"github.com/todo-project/pb"
+)
+
+func (ts *TodoServer) CreateList(ctx context.Context, req *pb.CreateListRequest) (*pb.ListResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	list, err := ts.todoService.CreateList(ctx, &models.CreateListRequest{User: req.GetUser(), Name: req.GetName()})
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.ListResponse{
+		List: toPbList(list),
+	}
+	return res, nil
+}
+
+func (ts *TodoServer) GetList(ctx context.Context, req *pb.GetListRequest) (*pb.ListResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	list, err := ts.todoService.GetList(ctx, req.GetId())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.ListResponse{
+		List: toPbList(list),
+	}
+	return res, nil
+}
+
+func (ts *TodoServer) UpdateList(ctx context.Context, req *pb.UpdateListRequest) (*pb.ListResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	update := &models.UpdateList{Name: req.Name, ExpectedVersion: req.GetExpectedVersion()}
+	list, err := ts.todoService.UpdateList(ctx, req.GetId(), update)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.ListResponse{
+		List: toPbList(list),
+	}
+	return res, nil
+}
+
+func (ts *TodoServer) DeleteList(ctx context.Context, req *pb.DeleteListRequest) (*pb.DeleteListResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	if err := ts.todoService.DeleteList(ctx, req.GetId(), req.GetExpectedVersion(), req.GetCascade()); err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.DeleteListResponse{
+		Deleted: true,
+	}
+	return res, nil
+}
+
+func (ts *TodoServer) ListLists(ctx context.Context, req *pb.ListListsRequest) (*pb.ListListsResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	lists, err := ts.todoService.ListLists(ctx, req.GetUser())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.ListListsResponse{}
+	for _, list := range lists {
+		res.Lists = append(res.Lists, toPbList(list))
+	}
+	return res, nil
+}
+
+// toPbList maps a List, the Inbox has an empty Id.
+func toPbList(list *models.List) *pb.List {
+	pbList := &pb.List{
+		User:      list.User,
+		Name:      list.Name,
+		CreatedAt: toPbTimestamp(list.CreatedAt),
+		UpdatedAt: toPbTimestamp(list.UpdatedAt),
+		Version:   list.Version,
+	}
+	if !list.Inbox() {
+		pbList.Id = list.Id.Hex()
+	}
+	return pbList
+}
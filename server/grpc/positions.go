@@ -0,0 +1,25 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/todo-project/models"
+	"github.com/todo-project/pb"
+)
+
+func (ts *TodoServer) Move(ctx context.Context, req *pb.MoveItemRequest) (*pb.TodoResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	move := &models.MoveTodo{BeforeId: req.GetBeforeId(), AfterId: req.GetAfterId(), ExpectedVersion: req.GetExpectedVersion()}
+	todo, err := ts.todoService.MoveTodo(ctx, req.GetId(), move)
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.TodoResponse{
+		ToDo: toPbTodo(todo),
+	}
+	return res, nil
+}
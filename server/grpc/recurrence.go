@@ -0,0 +1,23 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/todo-project/pb"
+)
+
+func (ts *TodoServer) SkipOccurrence(ctx context.Context, req *pb.SkipOccurrenceRequest) (*pb.TodoResponse, error) {
+	if err := validateRequest(req); err != nil {
+		return nil, err
+	}
+
+	todo, err := ts.todoService.SkipOccurrence(ctx, req.GetId(), req.GetExpectedVersion())
+	if err != nil {
+		return nil, serviceError(ctx, err)
+	}
+
+	res := &pb.TodoResponse{
+		ToDo: toPbTodo(todo),
+	}
+	return res, nil
+}
@@ -0,0 +1,43 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// TimeoutUnaryInterceptor bounds every unary RPC to timeout. A client deadline that is sooner still wins, a timeout
+// of zero leaves the requests unbounded.
+func TimeoutUnaryInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if timeout <= 0 {
+			return handler(ctx, req)
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
+
+// TimeoutStreamInterceptor is the TimeoutUnaryInterceptor of the streaming RPCs.
+func TimeoutStreamInterceptor(timeout time.Duration) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if timeout <= 0 {
+			return handler(srv, ss)
+		}
+		ctx, cancel := context.WithTimeout(ss.Context(), timeout)
+		defer cancel()
+		return handler(srv, &timeoutServerStream{ss, ctx})
+	}
+}
+
+// timeoutServerStream hands the bounded context to the stream handler.
+type timeoutServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *timeoutServerStream) Context() context.Context {
+	return s.ctx
+}
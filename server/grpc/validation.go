@@ -0,0 +1,398 @@
+package grpc
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/todo-project/pb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// fieldRule declares the checks of a request field with the go-playground validator tags. A field that is
+// optional in the proto is only checked when it is set.
+type fieldRule struct {
+	field protoreflect.Name
+	tags  string
+}
+
+// requestRules declares the validation of the request of every RPC, by message name. Enum fields are also checked
+// to hold one of their declared values, and Timestamp fields to be valid timestamps, whether they have a rule or not.
+// A message field is checked against the rules of its own message, if it has some.
+var requestRules = map[protoreflect.FullName][]fieldRule{
+	"pb.CreateItemRequest": {
+		{"Title", "required,max=200,singleline"},
+		{"Description", "max=2000,text"},
+		{"User", "required,max=64,userid"},
+		{"Request_id", "min=1,max=128,singleline"},
+		{"Tags", tagsRule},
+		{"Parent_id", "objectid"},
+		{"Recurrence", recurrenceRule},
+		{"Reminders", remindersRule},
+		{"List_id", "objectid"},
+	},
+	"pb.GetItemByID": {
+		{"Id", "objectid"},
+	},
+	"pb.UpdateItemRequest": {
+		{"Id", "objectid"},
+		{"Title", "required,max=200,singleline"},
+		{"Description", "max=2000,text"},
+		{"User", "required,max=64,userid"},
+		{"Expected_version", "min=0"},
+		// An empty Parent_id makes the todo a top-level one.
+		{"Parent_id", "omitempty,objectid"},
+		// An empty Recurrence ends the series.
+		{"Recurrence", recurrenceRule},
+		// An empty List_id moves the todo to the Inbox.
+		{"List_id", "omitempty,objectid"},
+	},
+	"pb.DeleteItemRequest": {
+		{"Id", "objectid"},
+		{"Expected_version", "min=0"},
+	},
+	"pb.RestoreItemRequest": {
+		{"Id", "objectid"},
+		{"Expected_version", "min=0"},
+	},
+	"pb.PurgeItemRequest": {
+		{"Id", "objectid"},
+		{"Expected_version", "min=0"},
+	},
+	"pb.ListTrashRequest": {
+		{"User", "max=64,userid"},
+		{"Page_size", "min=0"},
+		{"Page_token", "max=1024"},
+	},
+	// The items of a batch are validated one by one, an invalid item only fails its own result.
+	"pb.BatchCreateRequest": {
+		{"Items", "max=500"},
+	},
+	"pb.BatchUpdateRequest": {
+		{"Items", "max=500"},
+	},
+	"pb.BatchDeleteRequest": {
+		{"Items", "max=500"},
+	},
+	"pb.GetItemsRequest": {
+		// An empty User returns the Todos of every user.
+		{"User", "max=64,userid"},
+		{"Page_size", "min=0"},
+		{"Page_token", "max=1024"},
+		{"Time_zone", "timezone"},
+		{"Tags_any", tagsRule},
+		{"Tags_all", tagsRule},
+		{"Tags_none", tagsRule},
+		{"Subtree_of", "objectid"},
+		// An empty List_id returns the Todos of the Inbox.
+		{"List_id", "omitempty,objectid"},
+	},
+	"pb.TagList": {
+		{"Tags", tagsRule},
+	},
+	"pb.ReminderList": {
+		{"Reminders", remindersRule},
+	},
+	"pb.ListTagsRequest": {
+		{"User", "required,max=64,userid"},
+	},
+	"pb.AddChecklistItemRequest": {
+		{"Id", "objectid"},
+		{"Text", "required,max=200,singleline"},
+		{"Expected_version", "min=0"},
+	},
+	"pb.ToggleChecklistItemRequest": {
+		{"Id", "objectid"},
+		{"Item_id", "objectid"},
+		{"Expected_version", "min=0"},
+	},
+	"pb.ReorderChecklistRequest": {
+		{"Id", "objectid"},
+		{"Item_ids", "max=100,dive,objectid"},
+		{"Expected_version", "min=0"},
+	},
+	"pb.RemoveChecklistItemRequest": {
+		{"Id", "objectid"},
+		{"Item_id", "objectid"},
+		{"Expected_version", "min=0"},
+	},
+	"pb.RenameTagRequest": {
+		{"User", "required,max=64,userid"},
+		{"From", "required,max=64,singleline"},
+		{"To", "required,max=64,singleline"},
+	},
+	"pb.SkipOccurrenceRequest": {
+		{"Id", "objectid"},
+		{"Expected_version", "min=0"},
+	},
+	"pb.MoveItemRequest": {
+		{"Id", "objectid"},
+		{"Before_id", "objectid"},
+		{"After_id", "objectid"},
+		{"Expected_version", "min=0"},
+	},
+	"pb.CreateListRequest": {
+		{"User", "required,max=64,userid"},
+		{"Name", listNameRule},
+	},
+	"pb.GetListRequest": {
+		{"Id", "objectid"},
+	},
+	"pb.UpdateListRequest": {
+		{"Id", "objectid"},
+		{"Name", listNameRule},
+		{"Expected_version", "min=0"},
+	},
+	"pb.DeleteListRequest": {
+		{"Id", "objectid"},
+		{"Expected_version", "min=0"},
+	},
+	"pb.ListListsRequest": {
+		{"User", "required,max=64,userid"},
+	},
+	"pb.AddCommentRequest": {
+		{"Todo_id", "objectid"},
+		{"Author", "required,max=64,userid"},
+		{"Body", commentBodyRule},
+	},
+	"pb.UpdateCommentRequest": {
+		{"Id", "objectid"},
+		{"Body", commentBodyRule},
+		{"Expected_version", "min=0"},
+	},
+	"pb.DeleteCommentRequest": {
+		{"Id", "objectid"},
+		{"Expected_version", "min=0"},
+	},
+	"pb.ListCommentsRequest": {
+		{"Todo_id", "objectid"},
+	},
+}
+
+// tagsRule checks a list of tags, and each of its tags.
+const tagsRule = "max=20,dive,required,max=64,singleline"
+
+// recurrenceRule checks the length of a recurrence rule, the service parses it.
+const recurrenceRule = "max=500,singleline"
+
+// remindersRule checks the number of reminders, the service drops the repeated ones.
+const remindersRule = "max=10"
+
+// listNameRule checks the name of a List.
+const listNameRule = "required,max=100,singleline"
+
+// commentBodyRule checks the markdown body of a Comment, which may span several lines.
+const commentBodyRule = "required,max=5000,text"
+
+// timestampName is the message of the Timestamp fields, which are checked to hold a valid timestamp.
+var timestampName = (&timestamppb.Timestamp{}).ProtoReflect().Descriptor().FullName()
+
+// itemCount is what the rules of a repeated message field check, the number of items it holds. The rules of a
+// repeated string field check the strings themselves.
+type itemCount int
+
+// updatableFields are the UpdateItemRequest fields an Update_mask can name.
+var updatableFields = map[string]func(req, masked *pb.UpdateItemRequest){
+	"Title":       func(req, masked *pb.UpdateItemRequest) { masked.Title = proto.String(req.GetTitle()) },
+	"Description": func(req, masked *pb.UpdateItemRequest) { masked.Description = proto.String(req.GetDescription()) },
+	"User":        func(req, masked *pb.UpdateItemRequest) { masked.User = proto.String(req.GetUser()) },
+	"Done":        func(req, masked *pb.UpdateItemRequest) { masked.Done = proto.Bool(req.GetDone()) },
+	"Priority":    func(req, masked *pb.UpdateItemRequest) { masked.Priority = req.GetPriority().Enum() },
+	"Parent_id":   func(req, masked *pb.UpdateItemRequest) { masked.ParentId = proto.String(req.GetParentId()) },
+	"Recurrence":  func(req, masked *pb.UpdateItemRequest) { masked.Recurrence = proto.String(req.GetRecurrence()) },
+	"List_id":     func(req, masked *pb.UpdateItemRequest) { masked.ListId = proto.String(req.GetListId()) },
+	"Tags": func(req, masked *pb.UpdateItemRequest) {
+		// An empty TagList removes every tag.
+		masked.Tags = &pb.TagList{}
+		if req.Tags != nil {
+			masked.Tags = req.Tags
+		}
+	},
+	"Reminders": func(req, masked *pb.UpdateItemRequest) {
+		// An empty ReminderList removes every reminder.
+		masked.Reminders = &pb.ReminderList{}
+		if req.Reminders != nil {
+			masked.Reminders = req.Reminders
+		}
+	},
+	"Due_at": func(req, masked *pb.UpdateItemRequest) {
+		// The epoch is the zero value of a due time, it removes it.
+		masked.DueAt = &timestamppb.Timestamp{}
+		if req.DueAt != nil {
+			masked.DueAt = req.DueAt
+		}
+	},
+}
+
+var userIdPattern = regexp.MustCompile(`^[\pL\pN ._@-]*$`)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	_ = v.RegisterValidation("objectid", func(fl validator.FieldLevel) bool {
+		return primitive.IsValidObjectID(fl.Field().String())
+	})
+	_ = v.RegisterValidation("singleline", func(fl validator.FieldLevel) bool {
+		return strings.IndexFunc(fl.Field().String(), unicode.IsControl) < 0
+	})
+	_ = v.RegisterValidation("text", func(fl validator.FieldLevel) bool {
+		return strings.IndexFunc(fl.Field().String(), func(r rune) bool {
+			return unicode.IsControl(r) && r != '\n' && r != '\r' && r != '\t'
+		}) < 0
+	})
+	_ = v.RegisterValidation("userid", func(fl validator.FieldLevel) bool {
+		return userIdPattern.MatchString(fl.Field().String())
+	})
+	return v
+}
+
+// validateRequest checks req against its requestRules. Every offending field is reported in the BadRequest detail
+// of the returned InvalidArgument status.
+func validateRequest(req proto.Message) error {
+	violations := fieldViolations(req.ProtoReflect(), "")
+	if len(violations) == 0 {
+		return nil
+	}
+
+	descriptions := make([]string, len(violations))
+	for i, v := range violations {
+		descriptions[i] = v.Field + " " + v.Description
+	}
+	return badRequest("invalid request: "+strings.Join(descriptions, "; "), violations...)
+}
+
+// fieldViolations checks msg against its requestRules, the fields of the violations are prefixed with prefix.
+func fieldViolations(msg protoreflect.Message, prefix string) []*errdetails.BadRequest_FieldViolation {
+	fields := msg.Descriptor().Fields()
+
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, rule := range requestRules[msg.Descriptor().FullName()] {
+		fd := fields.ByName(rule.field)
+		if fd.HasPresence() && !msg.Has(fd) {
+			continue
+		}
+		value := msg.Get(fd).Interface()
+		if fd.IsList() {
+			value = itemCount(msg.Get(fd).List().Len())
+			if fd.Kind() == protoreflect.StringKind {
+				value = stringList(msg.Get(fd).List())
+			}
+		}
+		err := validate.Var(value, rule.tags)
+		if fieldErrs, ok := err.(validator.ValidationErrors); ok {
+			for _, fieldErr := range fieldErrs {
+				// The errors of the strings of a list are named after their index, e.g. [2].
+				violations = append(violations, &errdetails.BadRequest_FieldViolation{
+					Field:       prefix + string(rule.field) + fieldErr.Field(),
+					Description: describeFieldError(fieldErr),
+				})
+			}
+		}
+	}
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if !msg.Has(fd) {
+			continue
+		}
+		switch {
+		case fd.Kind() == protoreflect.EnumKind && fd.Enum().Values().ByNumber(msg.Get(fd).Enum()) == nil:
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       prefix + string(fd.Name()),
+				Description: fmt.Sprintf("must be one of the %s values", fd.Enum().Name()),
+			})
+		case fd.Kind() == protoreflect.MessageKind && fd.Message().FullName() == timestampName && !fd.IsList():
+			if err := msg.Get(fd).Message().Interface().(*timestamppb.Timestamp).CheckValid(); err != nil {
+				violations = append(violations, &errdetails.BadRequest_FieldViolation{
+					Field:       prefix + string(fd.Name()),
+					Description: "must be a timestamp between the years 0001 and 9999",
+				})
+			}
+		case fd.Kind() == protoreflect.MessageKind && fd.Message().FullName() == timestampName:
+			list := msg.Get(fd).List()
+			for j := 0; j < list.Len(); j++ {
+				if err := list.Get(j).Message().Interface().(*timestamppb.Timestamp).CheckValid(); err != nil {
+					violations = append(violations, &errdetails.BadRequest_FieldViolation{
+						Field:       fmt.Sprintf("%s%s[%d]", prefix, fd.Name(), j),
+						Description: "must be a timestamp between the years 0001 and 9999",
+					})
+				}
+			}
+		case fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap():
+			if _, ok := requestRules[fd.Message().FullName()]; ok {
+				violations = append(violations, fieldViolations(msg.Get(fd).Message(), prefix+string(fd.Name())+".")...)
+			}
+		}
+	}
+	return violations
+}
+
+func stringList(list protoreflect.List) []string {
+	values := make([]string, list.Len())
+	for i := range values {
+		values[i] = list.Get(i).String()
+	}
+	return values
+}
+
+// applyUpdateMask returns the request with exactly the fields of its Update_mask set, those of the mask that were
+// left unset are set to their zero value so that they get cleared. A request without a mask is returned as is.
+func applyUpdateMask(req *pb.UpdateItemRequest) (*pb.UpdateItemRequest, error) {
+	if req.GetUpdateMask() == nil {
+		return req, nil
+	}
+
+	masked := &pb.UpdateItemRequest{Id: req.GetId(), ExpectedVersion: req.GetExpectedVersion()}
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, path := range req.GetUpdateMask().GetPaths() {
+		apply, ok := updatableFields[path]
+		if !ok {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       "Update_mask",
+				Description: fmt.Sprintf("%q is not a field that can be updated", path),
+			})
+			continue
+		}
+		apply(req, masked)
+	}
+	if len(violations) != 0 {
+		return nil, badRequest("invalid request: invalid Update_mask", violations...)
+	}
+	return masked, nil
+}
+
+func describeFieldError(err validator.FieldError) string {
+	switch err.Tag() {
+	case "required":
+		return "must not be empty"
+	case "max":
+		if err.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters long", err.Param())
+		}
+		if err.Kind() == reflect.Slice || err.Type() == reflect.TypeOf(itemCount(0)) {
+			return fmt.Sprintf("must hold at most %s items", err.Param())
+		}
+		return "must be at most " + err.Param()
+	case "min":
+		return "must be at least " + err.Param()
+	case "objectid":
+		return "must be an Id, 24 hexadecimal characters"
+	case "singleline":
+		return "must not contain control characters"
+	case "text":
+		return "must not contain control characters other than new lines and tabs"
+	case "timezone":
+		return "must be an IANA time zone, e.g. Europe/Paris"
+	case "userid":
+		return "may only contain letters, digits, spaces and the characters . _ @ -"
+	default:
+		return "failed the " + err.Tag() + " check"
+	}
+}
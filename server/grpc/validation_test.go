@@ -0,0 +1,261 @@
+package grpc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/todo-project/pb"
+	"github.com/todo-project/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestRequestRules(t *testing.T) {
+	methods := pb.File_todo_proto.Services().ByName("ToDoService").Methods()
+	for i := 0; i < methods.Len(); i++ {
+		input := methods.Get(i).Input()
+		if _, ok := requestRules[input.FullName()]; !ok {
+			t.Errorf("no requestRules for %s, the request of %s", input.FullName(), methods.Get(i).Name())
+		}
+	}
+	for name, rules := range requestRules {
+		input := pb.File_todo_proto.Messages().ByName(name.Name())
+		if input == nil || input.FullName() != name {
+			t.Errorf("requestRules declared for unknown message %s", name)
+			continue
+		}
+		for _, rule := range rules {
+			if input.Fields().ByName(rule.field) == nil {
+				t.Errorf("requestRules of %s refer to unknown field %s", name, rule.field)
+			}
+		}
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	id := primitive.NewObjectID().Hex()
+	tests := []struct {
+		name       string
+		req        proto.Message
+		wantFields []string
+	}{
+		{
+			name: "valid create",
+			req:  &pb.CreateItemRequest{Title: "title", Description: "line 1\nline 2", User: "jane.doe@example.com"},
+		},
+		{
+			name:       "empty create",
+			req:        &pb.CreateItemRequest{},
+			wantFields: []string{"Title", "User"},
+		},
+		{
+			name: "too long and bad characters",
+			req: &pb.CreateItemRequest{
+				Title:       strings.Repeat("a", 201),
+				Description: "bell \a",
+				User:        "user/1",
+			},
+			wantFields: []string{"Title", "Description", "User"},
+		},
+		{
+			name:       "empty request id",
+			req:        &pb.CreateItemRequest{Title: "title", User: "1", RequestId: utils.Pointer("")},
+			wantFields: []string{"Request_id"},
+		},
+		{
+			name:       "title on one line",
+			req:        &pb.CreateItemRequest{Title: "line 1\nline 2", User: "1"},
+			wantFields: []string{"Title"},
+		},
+		{
+			name: "valid id",
+			req:  &pb.GetItemByID{Id: id},
+		},
+		{
+			name:       "malformed id",
+			req:        &pb.DeleteItemRequest{Id: "42"},
+			wantFields: []string{"Id"},
+		},
+		{
+			name: "partial update",
+			req:  &pb.UpdateItemRequest{Id: id, Done: proto.Bool(true)},
+		},
+		{
+			name:       "update clearing title",
+			req:        &pb.UpdateItemRequest{Id: id, Title: utils.Pointer("")},
+			wantFields: []string{"Title"},
+		},
+		{
+			name: "valid get all",
+			req:  &pb.GetItemsRequest{User: utils.Pointer(""), PageSize: proto.Int32(10)},
+		},
+		{
+			name: "invalid get all",
+			req: &pb.GetItemsRequest{
+				PageSize: proto.Int32(-1),
+				Status:   pb.GetItemsRequest_TodoStatus(42).Enum(),
+				SortBy:   pb.GetItemsRequest_SortBy(42).Enum(),
+			},
+			wantFields: []string{"Page_size", "Status", "Sort_by"},
+		},
+		{
+			name: "due today in a time zone",
+			req:  &pb.GetItemsRequest{DueToday: proto.Bool(true), TimeZone: utils.Pointer("America/New_York")},
+		},
+		{
+			name:       "invalid due filters",
+			req:        &pb.GetItemsRequest{DueAfter: &timestamppb.Timestamp{Nanos: -1}, TimeZone: utils.Pointer("Local")},
+			wantFields: []string{"Time_zone", "Due_after"},
+		},
+		{
+			name:       "unknown priority",
+			req:        &pb.UpdateItemRequest{Id: id, Priority: pb.Priority(42).Enum()},
+			wantFields: []string{"Priority"},
+		},
+		{
+			name:       "due time out of range",
+			req:        &pb.CreateItemRequest{Title: "title", User: "1", DueAt: &timestamppb.Timestamp{Seconds: -62135596801}},
+			wantFields: []string{"Due_at"},
+		},
+		{
+			name:       "invalid tags",
+			req:        &pb.CreateItemRequest{Title: "title", User: "1", Tags: []string{"work", "", "line\nbreak"}},
+			wantFields: []string{"Tags[1]", "Tags[2]"},
+		},
+		{
+			name:       "too many tags",
+			req:        &pb.CreateItemRequest{Title: "title", User: "1", Tags: make([]string, 21)},
+			wantFields: []string{"Tags"},
+		},
+		{
+			name:       "invalid updated tags",
+			req:        &pb.UpdateItemRequest{Id: id, Tags: &pb.TagList{Tags: []string{strings.Repeat("a", 65)}}},
+			wantFields: []string{"Tags.Tags[0]"},
+		},
+		{
+			name:       "invalid tag filters",
+			req:        &pb.GetItemsRequest{TagsAny: []string{"work"}, TagsNone: []string{""}},
+			wantFields: []string{"Tags_none[0]"},
+		},
+		{
+			name:       "invalid rename",
+			req:        &pb.RenameTagRequest{User: "1", To: "tab\t"},
+			wantFields: []string{"From", "To"},
+		},
+		{
+			name:       "invalid checklist item",
+			req:        &pb.AddChecklistItemRequest{Id: id, Text: "line\nbreak"},
+			wantFields: []string{"Text"},
+		},
+		{
+			name:       "invalid checklist order",
+			req:        &pb.ReorderChecklistRequest{Id: id, ItemIds: []string{id, "malformed id"}},
+			wantFields: []string{"Item_ids[1]"},
+		},
+		{
+			name:       "invalid toggle",
+			req:        &pb.ToggleChecklistItemRequest{Id: id, ExpectedVersion: -1},
+			wantFields: []string{"Item_id", "Expected_version"},
+		},
+		{
+			name:       "invalid parents",
+			req:        &pb.UpdateItemRequest{Id: id, ParentId: proto.String("malformed id")},
+			wantFields: []string{"Parent_id"},
+		},
+		{
+			name:       "invalid recurrence",
+			req:        &pb.CreateItemRequest{Title: "title", User: "1", Recurrence: "DTSTART:20300101T090000Z\nRRULE:FREQ=DAILY"},
+			wantFields: []string{"Recurrence"},
+		},
+		{
+			name: "too many reminders",
+			req: &pb.CreateItemRequest{Title: "title", User: "1", Reminders: []*timestamppb.Timestamp{
+				{Seconds: 1}, {Seconds: 2}, {Seconds: 3}, {Seconds: 4}, {Seconds: 5}, {Seconds: 6},
+				{Seconds: 7}, {Seconds: 8}, {Seconds: 9}, {Seconds: 10}, {Seconds: 11},
+			}},
+			wantFields: []string{"Reminders"},
+		},
+		{
+			name: "invalid reminders",
+			req: &pb.UpdateItemRequest{Id: primitive.NewObjectID().Hex(), Reminders: &pb.ReminderList{
+				Reminders: []*timestamppb.Timestamp{timestamppb.Now(), {Seconds: -62135596801}},
+			}},
+			wantFields: []string{"Reminders.Reminders[1]"},
+		},
+		{
+			name:       "invalid skip",
+			req:        &pb.SkipOccurrenceRequest{Id: "malformed id", ExpectedVersion: -1},
+			wantFields: []string{"Id", "Expected_version"},
+		},
+		{
+			name:       "invalid list ids",
+			req:        &pb.GetItemsRequest{ListId: proto.String("malformed id")},
+			wantFields: []string{"List_id"},
+		},
+		{
+			name:       "empty list",
+			req:        &pb.CreateListRequest{},
+			wantFields: []string{"User", "Name"},
+		},
+		{
+			name:       "invalid list update",
+			req:        &pb.UpdateListRequest{Id: "malformed id", Name: proto.String("two\nlines"), ExpectedVersion: -1},
+			wantFields: []string{"Id", "Name", "Expected_version"},
+		},
+		{
+			name:       "invalid move",
+			req:        &pb.MoveItemRequest{Id: "malformed id", BeforeId: proto.String(""), ExpectedVersion: -1},
+			wantFields: []string{"Id", "Before_id", "Expected_version"},
+		},
+		{
+			name: "valid comment",
+			req:  &pb.AddCommentRequest{TodoId: id, Author: "1", Body: "# Notes\n\n- **sent**"},
+		},
+		{
+			name:       "empty comment",
+			req:        &pb.AddCommentRequest{},
+			wantFields: []string{"Todo_id", "Author", "Body"},
+		},
+		{
+			name:       "invalid comment update",
+			req:        &pb.UpdateCommentRequest{Id: id, Body: strings.Repeat("a", 5001), ExpectedVersion: -1},
+			wantFields: []string{"Body", "Expected_version"},
+		},
+		{
+			name:       "invalid subtree",
+			req:        &pb.GetItemsRequest{SubtreeOf: proto.String("")},
+			wantFields: []string{"Subtree_of"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateRequest(tt.req)
+			if len(tt.wantFields) == 0 {
+				if err != nil {
+					t.Errorf("validateRequest() error = %v", err)
+				}
+				return
+			}
+
+			st := status.Convert(err)
+			if st.Code() != codes.InvalidArgument {
+				t.Fatalf("validateRequest() code = %v, want %v", st.Code(), codes.InvalidArgument)
+			}
+			var fields []string
+			for _, detail := range st.Details() {
+				if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+					for _, violation := range badRequest.GetFieldViolations() {
+						fields = append(fields, violation.GetField())
+					}
+				}
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.wantFields, ",") {
+				t.Errorf("validateRequest() violations = %v, want %v", fields, tt.wantFields)
+			}
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/todo-project/models"
+)
+
+// BatchResult is the outcome of one item of a batch. Todo is nil for a delete and whenever Err is set.
+type BatchResult struct {
+	Todo *models.Todo
+	Err  error
+}
+
+// errRollback is returned inside a transaction to roll back an atomic batch that has a failed item.
+var errRollback = errors.New("rolling back the batch")
+
+// runBatch runs item for every index of the batch in order, ids are the Todos the items are about. See the batch
+// methods of TodoService for how the errors are reported.
+func runBatch(ctx context.Context, ids []string, atomic bool, item func(i int) (*models.Todo, error)) ([]BatchResult, error) {
+	results := make([]BatchResult, len(ids))
+	for i := range ids {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		todo, err := item(i)
+		if err != nil && KindOf(err) == KindInternal {
+			return nil, err
+		}
+		results[i] = BatchResult{Todo: todo, Err: err}
+		if err != nil && atomic {
+			abortBatch(results, ids, i)
+			break
+		}
+	}
+	return results, nil
+}
+
+// abortBatch reports every item but the failed one as rolled back.
+func abortBatch(results []BatchResult, ids []string, failed int) {
+	for i := range results {
+		if i != failed {
+			results[i] = BatchResult{Err: aborted(ids[i])}
+		}
+	}
+}
+
+// batchFailed reports whether an item of the batch failed.
+func batchFailed(results []BatchResult) bool {
+	for _, result := range results {
+		if result.Err != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// createBatchIds returns the ids of a batch create, the Todos have none until they are created.
+func createBatchIds(requests []*models.CreateTodoRequest) []string {
+	return make([]string, len(requests))
+}
+
+func updateBatchIds(items []*models.BatchUpdateItem) ([]string, error) {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.Id
+	}
+	return ids, checkBatchIds(ids)
+}
+
+func deleteBatchIds(items []*models.BatchDeleteItem) ([]string, error) {
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.Id
+	}
+	return ids, checkBatchIds(ids)
+}
+
+// checkBatchIds rejects a batch naming a Todo twice, the outcome of each item would depend on the order they are
+// applied in.
+func checkBatchIds(ids []string) error {
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if seen[id] {
+			return invalidArgument("Items", fmt.Errorf("%w: %q", ErrDuplicateBatchId, id))
+		}
+		seen[id] = true
+	}
+	return nil
+}
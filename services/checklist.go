@@ -0,0 +1,120 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/todo-project/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxChecklistItems is the number of items a checklist can hold.
+const MaxChecklistItems = 100
+
+var (
+	// ErrChecklistItemNotFound is wrapped by the errors returned for an item that is not in the checklist.
+	ErrChecklistItemNotFound = errors.New("no checklist item found for given Id")
+	// ErrChecklistFull is wrapped by the errors returned when adding an item to a full checklist.
+	ErrChecklistFull = fmt.Errorf("a checklist holds at most %d items", MaxChecklistItems)
+	// ErrChecklistOrder is wrapped by the errors returned for a new order that is not the ids of the checklist.
+	ErrChecklistOrder = errors.New("the new order must name every item of the checklist exactly once")
+)
+
+// checklistEdit changes the checklist of a copy of a stored Todo. It fails with an *Error when it does not apply
+// to the Todo, e.g. for an unknown item.
+type checklistEdit func(todo *models.Todo) error
+
+func addChecklistItem(text string) checklistEdit {
+	return func(todo *models.Todo) error {
+		if len(todo.Checklist) >= MaxChecklistItems {
+			return invalidArgument("Text", ErrChecklistFull)
+		}
+		todo.Checklist = append(todo.Checklist, models.ChecklistItem{Id: primitive.NewObjectID().Hex(), Text: text})
+		return nil
+	}
+}
+
+func toggleChecklistItem(itemId string, done bool) checklistEdit {
+	return func(todo *models.Todo) error {
+		i, err := checklistItemIndex(todo, itemId)
+		if err != nil {
+			return err
+		}
+		todo.Checklist[i].Done = done
+		return nil
+	}
+}
+
+func reorderChecklist(itemIds []string) checklistEdit {
+	return func(todo *models.Todo) error {
+		if len(itemIds) != len(todo.Checklist) {
+			return invalidArgument("Item_ids", ErrChecklistOrder)
+		}
+		reordered := make([]models.ChecklistItem, 0, len(itemIds))
+		seen := make(map[string]bool, len(itemIds))
+		for _, itemId := range itemIds {
+			i, err := checklistItemIndex(todo, itemId)
+			if err != nil || seen[itemId] {
+				return invalidArgument("Item_ids", ErrChecklistOrder)
+			}
+			seen[itemId] = true
+			reordered = append(reordered, todo.Checklist[i])
+		}
+		todo.Checklist = reordered
+		return nil
+	}
+}
+
+func removeChecklistItem(itemId string) checklistEdit {
+	return func(todo *models.Todo) error {
+		i, err := checklistItemIndex(todo, itemId)
+		if err != nil {
+			return err
+		}
+		todo.Checklist = append(todo.Checklist[:i:i], todo.Checklist[i+1:]...)
+		if len(todo.Checklist) == 0 {
+			todo.Checklist = nil
+		}
+		return nil
+	}
+}
+
+func checklistItemIndex(todo *models.Todo, itemId string) (int, error) {
+	for i, item := range todo.Checklist {
+		if item.Id == itemId {
+			return i, nil
+		}
+	}
+	return 0, &Error{Kind: KindNotFound, Id: todo.Id.Hex(), Err: fmt.Errorf("%w: %q", ErrChecklistItemNotFound, itemId)}
+}
+
+// editChecklist returns the todoEdit applying edit, along with the auto-completion and the new version. When the
+// auto-completion marks a pending Todo done, complete is called on the edited Todo: marking the last item done
+// completes the Todo like an update setting Done, under the same ParentCompletion policy and recurrence.
+func (o Options) editChecklist(expectedVersion int64, edit checklistEdit, complete todoEdit) todoEdit {
+	return func(todo *models.Todo) error {
+		if err := checkVersion(todo, expectedVersion); err != nil {
+			return err
+		}
+		wasDone := todo.Done
+		if err := edit(todo); err != nil {
+			return err
+		}
+		if o.AutoCompleteChecklist && len(todo.Checklist) != 0 {
+			done, total := todo.ChecklistProgress()
+			todo.Done = done == total
+		}
+		todo.UpdatedAt = now()
+		todo.Version++
+		if todo.Done && !wasDone {
+			return complete(todo)
+		}
+		return nil
+	}
+}
+
+// completion is the update the auto-completion of a checklist amounts to.
+func completion() *models.UpdateTodo {
+	done := true
+	return &models.UpdateTodo{Done: &done}
+}
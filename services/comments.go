@@ -0,0 +1,104 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/todo-project/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// commentsCollectionName is the Mongo collection, and SQL table, holding the Comments.
+const commentsCollectionName = "comments"
+
+// CommentResource is the Resource of the errors about a Comment.
+const CommentResource = "Comment"
+
+var (
+	// ErrCommentNotFound is wrapped by the errors returned for a Comment Id naming no Comment, or a Comment on a
+	// Todo in the trash.
+	ErrCommentNotFound = errors.New("no Comment found for given Id")
+	// ErrCommentVersionMismatch is wrapped by the errors returned when a Comment is not at the version the caller
+	// expected.
+	ErrCommentVersionMismatch = errors.New("the Comment was modified since the expected version")
+	// ErrEmptyComment is wrapped by the errors returned for a Comment without body.
+	ErrEmptyComment = errors.New("a Comment needs a body")
+)
+
+func commentNotFound(id string) error {
+	return &Error{Kind: KindNotFound, Id: id, Resource: CommentResource, Err: ErrCommentNotFound}
+}
+
+// checkCommentVersion fails with a KindVersionMismatch error when expected is set and differs from the version of
+// comment.
+func checkCommentVersion(comment *models.Comment, expected int64) error {
+	if expected != 0 && comment.Version != expected {
+		return &Error{
+			Kind:     KindVersionMismatch,
+			Id:       comment.Id.Hex(),
+			Resource: CommentResource,
+			Err:      fmt.Errorf("%w: expected version %d, current version %d", ErrCommentVersionMismatch, expected, comment.Version),
+		}
+	}
+	return nil
+}
+
+// parseCommentTodoId parses the Id of the Todo of a Comment, it fails on the Todo_id field.
+func parseCommentTodoId(id string) (primitive.ObjectID, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, invalidArgument("Todo_id", fmt.Errorf("%w: %q", ErrInvalidId, id))
+	}
+	return objectId, nil
+}
+
+func checkCommentBody(body string) error {
+	if len(strings.TrimSpace(body)) == 0 {
+		return invalidArgument("Body", ErrEmptyComment)
+	}
+	return nil
+}
+
+// newComment returns the Comment to store on the Todo todoId for a create request.
+func newComment(todoId primitive.ObjectID, request *models.CreateCommentRequest) (*models.Comment, error) {
+	if err := checkCommentBody(request.Body); err != nil {
+		return nil, err
+	}
+	createdAt := now()
+	return &models.Comment{
+		Id:        primitive.NewObjectID(),
+		TodoId:    todoId,
+		Author:    request.Author,
+		Body:      request.Body,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Version:   1,
+	}, nil
+}
+
+// editComment checks the version of comment and replaces its body.
+func editComment(comment *models.Comment, body string, expectedVersion int64) error {
+	if err := checkCommentVersion(comment, expectedVersion); err != nil {
+		return err
+	}
+	if err := checkCommentBody(body); err != nil {
+		return err
+	}
+	comment.Body = body
+	comment.UpdatedAt = now()
+	comment.Version++
+	return nil
+}
+
+// sortComments orders the Comments by creation time, then Id.
+func sortComments(comments []*models.Comment) []*models.Comment {
+	sort.Slice(comments, func(i, j int) bool {
+		if !comments[i].CreatedAt.Equal(comments[j].CreatedAt) {
+			return comments[i].CreatedAt.Before(comments[j].CreatedAt)
+		}
+		return comments[i].Id.Hex() < comments[j].Id.Hex()
+	})
+	return comments
+}
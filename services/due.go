@@ -0,0 +1,59 @@
+package services
+
+import (
+	"time"
+
+	"github.com/todo-project/models"
+)
+
+// dueTime normalizes a due time the way the Todo timestamps are, so that it reads back the same from every backend.
+func dueTime(t time.Time) time.Time {
+	if t.IsZero() {
+		return t
+	}
+	return t.UTC().Truncate(time.Millisecond)
+}
+
+// dueRange resolves the due time filters of a query into the range [after, before) of due times it selects, a
+// zero bound is left open. ok is false when the query does not filter on the due time. The range may be empty,
+// e.g. for the overdue Todos due after now.
+func dueRange(query *models.TodoQuery) (after, before time.Time, ok bool) {
+	after, before = dueTime(query.DueAfter), dueTime(query.DueBefore)
+	if query.Overdue || query.DueToday != nil {
+		current := now()
+		if query.Overdue {
+			before = earliest(before, current)
+		}
+		if query.DueToday != nil {
+			local := current.In(query.DueToday)
+			start := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, query.DueToday)
+			// AddDate keeps the day boundaries right across a daylight saving change.
+			after, before = latest(after, start.UTC()), earliest(before, start.AddDate(0, 0, 1).UTC())
+		}
+	}
+	return after, before, !after.IsZero() || !before.IsZero()
+}
+
+// inDueRange reports whether a due time is within the range returned by dueRange.
+func inDueRange(due, after, before time.Time) bool {
+	if due.IsZero() {
+		return false
+	}
+	return (after.IsZero() || !due.Before(after)) && (before.IsZero() || due.Before(before))
+}
+
+// earliest returns the earliest of two bounds, the zero time being no bound.
+func earliest(a, b time.Time) time.Time {
+	if a.IsZero() || (!b.IsZero() && b.Before(a)) {
+		return b
+	}
+	return a
+}
+
+// latest returns the latest of two bounds, the zero time being no bound.
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/todo-project/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrorKind classifies the errors of the TodoService so that callers can branch on them without matching messages.
+type ErrorKind int
+
+const (
+	// KindInternal is the kind of every error that is not an *Error, e.g. the storage being unreachable.
+	KindInternal ErrorKind = iota
+	KindNotFound
+	KindInvalidArgument
+	KindConflict
+	// KindVersionMismatch is returned when a Todo changed since the version the caller expected.
+	KindVersionMismatch
+	// KindAborted is the kind of the items of an atomic batch that were rolled back because another item failed.
+	KindAborted
+	// KindUnsupported is returned when the storage cannot do what was asked, e.g. transactions on a standalone mongod.
+	KindUnsupported
+	// KindFailedPrecondition is returned when the Todo is not in a state that allows the change, e.g. marking done
+	// a Todo with open children when that is blocked.
+	KindFailedPrecondition
+)
+
+func (k ErrorKind) String() string {
+	switch k {
+	case KindNotFound:
+		return "NOT_FOUND"
+	case KindInvalidArgument:
+		return "INVALID_ARGUMENT"
+	case KindConflict:
+		return "CONFLICT"
+	case KindVersionMismatch:
+		return "VERSION_MISMATCH"
+	case KindAborted:
+		return "ABORTED"
+	case KindUnsupported:
+		return "UNSUPPORTED"
+	case KindFailedPrecondition:
+		return "FAILED_PRECONDITION"
+	default:
+		return "INTERNAL"
+	}
+}
+
+var (
+	// ErrInvalidId is wrapped by the errors returned for an Id that is not an ObjectID hex string.
+	ErrInvalidId = errors.New("invalid Id")
+	// ErrTodoExists is wrapped by the errors returned when a Todo with the same Id is already stored.
+	ErrTodoExists = errors.New("a Todo with the given Id already exists")
+	// ErrVersionMismatch is wrapped by the errors returned when a Todo is not at the version the caller expected.
+	ErrVersionMismatch = errors.New("the Todo was modified since the expected version")
+	// ErrBatchAborted is wrapped by the errors of the items rolled back with an atomic batch.
+	ErrBatchAborted = errors.New("the batch was rolled back because another item failed")
+	// ErrDuplicateBatchId is wrapped by the errors returned for a batch naming the same Todo more than once.
+	ErrDuplicateBatchId = errors.New("the batch names the same Todo more than once")
+	// ErrTransactionsUnsupported is wrapped by the errors returned for an atomic batch the storage cannot run.
+	ErrTransactionsUnsupported = errors.New("the storage does not support transactions")
+)
+
+// Error is the typed error returned by every TodoService implementation. The sentinel errors of the package are
+// wrapped in it, so errors.Is(err, ErrTodoNotFound) keeps working.
+type Error struct {
+	Kind ErrorKind
+	// Field is the request field a KindInvalidArgument error is about.
+	Field string
+	// Id is the Todo a KindNotFound, KindConflict, KindVersionMismatch, KindAborted or KindFailedPrecondition error
+	// is about, it is empty when unknown.
+	Id string
+	// Resource is what Id names, ListResource or CommentResource, it is empty for a Todo.
+	Resource string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the kind of err, KindInternal when it is not an *Error.
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return KindInternal
+}
+
+func notFound(id string) error {
+	return &Error{Kind: KindNotFound, Id: id, Err: ErrTodoNotFound}
+}
+
+func invalidArgument(field string, err error) error {
+	return &Error{Kind: KindInvalidArgument, Field: field, Err: err}
+}
+
+func conflict(id string, err error) error {
+	return &Error{Kind: KindConflict, Id: id, Err: err}
+}
+
+func versionMismatch(id string, expected, current int64) error {
+	return &Error{
+		Kind: KindVersionMismatch,
+		Id:   id,
+		Err:  fmt.Errorf("%w: expected version %d, current version %d", ErrVersionMismatch, expected, current),
+	}
+}
+
+func aborted(id string) error {
+	return &Error{Kind: KindAborted, Id: id, Err: ErrBatchAborted}
+}
+
+func failedPrecondition(id string, err error) error {
+	return &Error{Kind: KindFailedPrecondition, Id: id, Err: err}
+}
+
+func unsupported(err error) error {
+	return &Error{Kind: KindUnsupported, Err: err}
+}
+
+// checkVersion fails with a KindVersionMismatch error when expected is set and differs from the version of todo.
+func checkVersion(todo *models.Todo, expected int64) error {
+	if expected != 0 && todo.Version != expected {
+		return versionMismatch(todo.Id.Hex(), expected, todo.Version)
+	}
+	return nil
+}
+
+// parseId parses a Todo Id, it fails with a KindInvalidArgument error instead of silently using the zero ObjectID.
+func parseId(id string) (primitive.ObjectID, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, invalidArgument("Id", fmt.Errorf("%w: %q", ErrInvalidId, id))
+	}
+	return objectId, nil
+}
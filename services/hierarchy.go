@@ -0,0 +1,117 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/todo-project/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrParentNotFound is wrapped by the errors returned for a parent Id naming no Todo out of the trash.
+	ErrParentNotFound = errors.New("no Todo found for given parent Id")
+	// ErrParentCycle is wrapped by the errors returned when a Todo would become its own ancestor.
+	ErrParentCycle = errors.New("a Todo cannot be moved under itself or one of its descendants")
+	// ErrOpenChildren is wrapped by the errors returned when marking done a Todo with open descendants is blocked.
+	ErrOpenChildren = errors.New("the Todo has open descendants")
+)
+
+// CompletionPolicy tells what happens to the open descendants of a Todo marked done.
+type CompletionPolicy int
+
+const (
+	// CompletionIgnore leaves the descendants as they are.
+	CompletionIgnore CompletionPolicy = iota
+	// CompletionBlock refuses to mark the Todo done, with a KindFailedPrecondition error.
+	CompletionBlock
+	// CompletionCascade marks the open descendants done along with the Todo.
+	CompletionCascade
+)
+
+// ParseCompletionPolicy parses "ignore", "block" or "cascade". The empty string is CompletionIgnore.
+func ParseCompletionPolicy(s string) (CompletionPolicy, error) {
+	switch s {
+	case "", "ignore":
+		return CompletionIgnore, nil
+	case "block":
+		return CompletionBlock, nil
+	case "cascade":
+		return CompletionCascade, nil
+	default:
+		return CompletionIgnore, fmt.Errorf("unknown completion policy %q, want ignore, block or cascade", s)
+	}
+}
+
+// completesDescendants reports whether the update marks the Todo done with a policy that looks at its descendants.
+func (o Options) completesDescendants(data *models.UpdateTodo) bool {
+	return o.ParentCompletion != CompletionIgnore && data.Done != nil && *data.Done
+}
+
+// checkCompletion applies the CompletionBlock policy to the Todo id, which has open open descendants.
+func (o Options) checkCompletion(id string, open int) error {
+	if o.ParentCompletion == CompletionBlock && open != 0 {
+		return failedPrecondition(id, fmt.Errorf("%w: %d of them", ErrOpenChildren, open))
+	}
+	return nil
+}
+
+// parseParentId parses the Id of a parent Todo, the empty string is the zero ObjectID of a top-level Todo.
+func parseParentId(id string) (primitive.ObjectID, error) {
+	if len(id) == 0 {
+		return primitive.NilObjectID, nil
+	}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, invalidArgument("Parent_id", fmt.Errorf("%w: %q", ErrInvalidId, id))
+	}
+	return objectId, nil
+}
+
+// parseSubtreeOf parses the root of a subtree query.
+func parseSubtreeOf(id string) (primitive.ObjectID, error) {
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, invalidArgument("Subtree_of", fmt.Errorf("%w: %q", ErrInvalidId, id))
+	}
+	return objectId, nil
+}
+
+// todoLink is what the hierarchy checks read of a stored Todo.
+type todoLink struct {
+	parentId primitive.ObjectID
+	trashed  bool
+}
+
+// checkParent checks that parentId can be the parent of the Todo id, the zero ObjectID for a Todo being created:
+// the parent must be out of the trash, and neither the Todo nor one of its descendants. read reads a stored Todo,
+// trashed or not, it returns nil when there is none.
+func checkParent(id, parentId primitive.ObjectID, read func(id primitive.ObjectID) (*todoLink, error)) error {
+	if parentId.IsZero() {
+		return nil
+	}
+	link, err := read(parentId)
+	if err != nil {
+		return err
+	}
+	if link == nil || link.trashed {
+		return invalidArgument("Parent_id", fmt.Errorf("%w: %q", ErrParentNotFound, parentId.Hex()))
+	}
+
+	// The ancestors in the trash are walked as well, a cycle through them would show up once they are restored.
+	seen := map[primitive.ObjectID]bool{}
+	for ancestor := parentId; link != nil; {
+		if ancestor == id {
+			return invalidArgument("Parent_id", ErrParentCycle)
+		}
+		seen[ancestor] = true
+		ancestor = link.parentId
+		if ancestor.IsZero() || seen[ancestor] {
+			break
+		}
+		if link, err = read(ancestor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/todo-project/models"
+	"github.com/todo-project/pb"
+)
+
+// DefaultIdempotencyWindow is how long the request id of a CreateTodo is remembered when Options leave it unset.
+const DefaultIdempotencyWindow = 24 * time.Hour
+
+// idempotencyCollectionName is the Mongo collection, and SQL table, holding the request ids.
+const idempotencyCollectionName = "idempotency_keys"
+
+// ErrRequestIdReused is wrapped by the errors returned when a request id is replayed with a different Todo.
+var ErrRequestIdReused = errors.New("the request id was already used to create a different Todo")
+
+// Options tune the behaviour shared by every TodoService implementation, the zero value is the default.
+type Options struct {
+	// IdempotencyWindow is how long a CreateTodo request id is remembered, a replay within the window returns the
+	// Todo that was created the first time instead of creating a new one.
+	IdempotencyWindow time.Duration
+	// AutoCompleteChecklist makes a Todo with a checklist follow it: the Todo is done once every item is done,
+	// and pending again when an item is added or marked pending. Completing it this way goes through the
+	// ParentCompletion policy and continues its series, like an update setting Done.
+	AutoCompleteChecklist bool
+	// ParentCompletion is what happens to the open descendants of a Todo marked done.
+	ParentCompletion CompletionPolicy
+}
+
+func (o Options) idempotencyWindow() time.Duration {
+	if o.IdempotencyWindow <= 0 {
+		return DefaultIdempotencyWindow
+	}
+	return o.IdempotencyWindow
+}
+
+// requestFingerprint identifies the content of a create request, so that a request id reused for another Todo
+// is told apart from a genuine retry.
+func requestFingerprint(request *models.CreateTodoRequest) string {
+	h := sha256.New()
+	fields := []string{request.Title, request.Description, request.User}
+	// Only added when set, so that the fingerprints remembered before these fields existed still match.
+	if !request.DueAt.IsZero() {
+		fields = append(fields, "due:"+dueTime(request.DueAt).Format(time.RFC3339Nano))
+	}
+	if request.Priority != pb.Priority_NONE {
+		fields = append(fields, "priority:"+request.Priority.String())
+	}
+	if tags := normalizeTags(request.Tags); len(tags) != 0 {
+		fields = append(fields, "tags:"+strings.Join(tags, "\x1f"))
+	}
+	if len(request.ParentId) != 0 {
+		fields = append(fields, "parent:"+request.ParentId)
+	}
+	if len(request.Recurrence) != 0 {
+		fields = append(fields, "recurrence:"+request.Recurrence)
+	}
+	if len(request.ListId) != 0 {
+		fields = append(fields, "list:"+request.ListId)
+	}
+	if len(request.Reminders) != 0 {
+		var reminders []string
+		for _, at := range request.Reminders {
+			reminders = append(reminders, dueTime(at).Format(time.RFC3339Nano))
+		}
+		fields = append(fields, "reminders:"+strings.Join(reminders, ","))
+	}
+	for _, field := range fields {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// replay returns the Todo remembered for a request id, provided it was created by the same request.
+func replay(request *models.CreateTodoRequest, fingerprint string, todo *models.Todo) (*models.Todo, error) {
+	if fingerprint != requestFingerprint(request) {
+		return nil, conflict(todo.Id.Hex(), ErrRequestIdReused)
+	}
+	return todo, nil
+}
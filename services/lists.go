@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/todo-project/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InboxName is the name of the Inbox, the List of the Todos of a user that are in no other List.
+const InboxName = "Inbox"
+
+// listsCollectionName is the Mongo collection, and SQL table, holding the Lists.
+const listsCollectionName = "lists"
+
+// ListResource is the Resource of the errors about a List.
+const ListResource = "List"
+
+var (
+	// ErrListNotFound is wrapped by the errors returned for a List Id naming no List, or a List of another user.
+	ErrListNotFound = errors.New("no List found for given Id")
+	// ErrListVersionMismatch is wrapped by the errors returned when a List is not at the version the caller expected.
+	ErrListVersionMismatch = errors.New("the List was modified since the expected version")
+	// ErrInvalidListName is wrapped by the errors returned for a List without name.
+	ErrInvalidListName = errors.New("a List needs a name")
+)
+
+func listNotFound(id string) error {
+	return &Error{Kind: KindNotFound, Id: id, Resource: ListResource, Err: ErrListNotFound}
+}
+
+// checkListVersion fails with a KindVersionMismatch error when expected is set and differs from the version of list.
+func checkListVersion(list *models.List, expected int64) error {
+	if expected != 0 && list.Version != expected {
+		return &Error{
+			Kind:     KindVersionMismatch,
+			Id:       list.Id.Hex(),
+			Resource: ListResource,
+			Err:      fmt.Errorf("%w: expected version %d, current version %d", ErrListVersionMismatch, expected, list.Version),
+		}
+	}
+	return nil
+}
+
+// parseListId parses the List Id of a Todo, the empty string is the zero ObjectID of the Inbox.
+func parseListId(id string) (primitive.ObjectID, error) {
+	if len(id) == 0 {
+		return primitive.NilObjectID, nil
+	}
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return primitive.NilObjectID, invalidArgument("List_id", fmt.Errorf("%w: %q", ErrInvalidId, id))
+	}
+	return objectId, nil
+}
+
+func checkListName(name string) error {
+	if len(strings.TrimSpace(name)) == 0 {
+		return invalidArgument("Name", ErrInvalidListName)
+	}
+	return nil
+}
+
+// newList returns the List to store for a create request.
+func newList(request *models.CreateListRequest) (*models.List, error) {
+	if err := checkListName(request.Name); err != nil {
+		return nil, err
+	}
+	createdAt := now()
+	return &models.List{
+		Id:        primitive.NewObjectID(),
+		User:      request.User,
+		Name:      request.Name,
+		CreatedAt: createdAt,
+		UpdatedAt: createdAt,
+		Version:   1,
+	}, nil
+}
+
+// updateList applies data to list, it returns false when data has nothing to update.
+func updateList(list *models.List, data *models.UpdateList) (bool, error) {
+	if data.Name == nil {
+		return false, nil
+	}
+	if err := checkListName(*data.Name); err != nil {
+		return false, err
+	}
+	list.Name = *data.Name
+	list.UpdatedAt = now()
+	list.Version++
+	return true, nil
+}
+
+// withInbox returns the Lists of user preceded by the Inbox, ordered by name then Id.
+func withInbox(user string, lists []*models.List) []*models.List {
+	sort.Slice(lists, func(i, j int) bool {
+		if lists[i].Name != lists[j].Name {
+			return lists[i].Name < lists[j].Name
+		}
+		return lists[i].Id.Hex() < lists[j].Id.Hex()
+	})
+	return append([]*models.List{{User: user, Name: InboxName}}, lists...)
+}
+
+// checkList checks that listId, the zero ObjectID for the Inbox, is a List of user. read reads a stored List, it
+// returns nil when there is none.
+func checkList(user string, listId primitive.ObjectID, read func(id primitive.ObjectID) (*models.List, error)) error {
+	if listId.IsZero() {
+		return nil
+	}
+	list, err := read(listId)
+	if err != nil {
+		return err
+	}
+	if list == nil || list.User != user {
+		return invalidArgument("List_id", fmt.Errorf("%w: %q", ErrListNotFound, listId.Hex()))
+	}
+	return nil
+}
+
+// movesList reports whether an update may leave the Todo in a List of another user: it moves the Todo to another
+// List, or gives it to another user.
+func movesList(data *models.UpdateTodo) bool {
+	return data.ListId != nil || data.User != nil
+}
+
+// checkUpdatedList checks that the List of stored, once data is applied to it, is a List of its user.
+func checkUpdatedList(stored *models.Todo, data *models.UpdateTodo, read func(id primitive.ObjectID) (*models.List, error)) error {
+	user, listId := stored.User, stored.ListId
+	if data.User != nil {
+		user = *data.User
+	}
+	if data.ListId != nil {
+		var err error
+		if listId, err = parseListId(*data.ListId); err != nil {
+			return err
+		}
+	}
+	return checkList(user, listId, read)
+}
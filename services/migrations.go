@@ -0,0 +1,496 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migration is a single, numbered schema change. Migrations are applied in order and never edited once released,
+// new schema changes always get a new version.
+type migration struct {
+	version     int
+	description string
+	statements  []string
+}
+
+var sqliteMigrations = []migration{
+	{
+		version:     1,
+		description: "create todos table",
+		statements: []string{
+			`CREATE TABLE todos (
+				id          TEXT PRIMARY KEY,
+				title       TEXT NOT NULL DEFAULT '',
+				description TEXT NOT NULL DEFAULT '',
+				user_id     TEXT NOT NULL DEFAULT '',
+				done        BOOLEAN NOT NULL DEFAULT FALSE
+			)`,
+			`CREATE INDEX todos_user_id_done_idx ON todos (user_id, done)`,
+		},
+	},
+	{
+		version:     2,
+		description: "add todo timestamps",
+		statements: []string{
+			// Timestamps are unix milliseconds, SQLite has no native timestamp type that sorts correctly.
+			`ALTER TABLE todos ADD COLUMN created_at INTEGER NOT NULL DEFAULT 0`,
+			`ALTER TABLE todos ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+	{
+		version:     3,
+		description: "add indexes for sorted pages",
+		statements: []string{
+			`CREATE INDEX todos_user_id_created_at_idx ON todos (user_id, created_at, id)`,
+			`CREATE INDEX todos_user_id_updated_at_idx ON todos (user_id, updated_at, id)`,
+			`CREATE INDEX todos_user_id_title_idx ON todos (user_id, title, id)`,
+		},
+	},
+	{
+		version:     4,
+		description: "add todo version",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN version INTEGER NOT NULL DEFAULT 1`,
+		},
+	},
+	{
+		version:     5,
+		description: "create idempotency keys table",
+		statements: []string{
+			`CREATE TABLE idempotency_keys (
+				user_id     TEXT NOT NULL,
+				request_id  TEXT NOT NULL,
+				fingerprint TEXT NOT NULL,
+				todo        TEXT NOT NULL,
+				expires_at  INTEGER NOT NULL,
+				PRIMARY KEY (user_id, request_id)
+			)`,
+			`CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at)`,
+		},
+	},
+	{
+		version:     6,
+		description: "add todo trash",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN deleted_at INTEGER`,
+			`CREATE INDEX todos_deleted_at_idx ON todos (deleted_at)`,
+		},
+	},
+	{
+		version:     7,
+		description: "add todo due time",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN due_at INTEGER`,
+			`CREATE INDEX todos_user_id_due_at_idx ON todos (user_id, due_at)`,
+		},
+	},
+	{
+		version:     8,
+		description: "add todo priority",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN priority INTEGER NOT NULL DEFAULT 0`,
+			`CREATE INDEX todos_user_id_priority_idx ON todos (user_id, priority, due_at)`,
+		},
+	},
+	{
+		version:     9,
+		description: "create todo tags table",
+		statements: []string{
+			`CREATE TABLE todo_tags (
+				todo_id  TEXT NOT NULL,
+				tag      TEXT NOT NULL,
+				position INTEGER NOT NULL,
+				PRIMARY KEY (todo_id, tag)
+			)`,
+			`CREATE INDEX todo_tags_tag_idx ON todo_tags (tag, todo_id)`,
+		},
+	},
+	{
+		version:     10,
+		description: "add todo checklist",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN checklist TEXT`,
+		},
+	},
+	{
+		version:     11,
+		description: "add todo parent",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN parent_id TEXT`,
+			`CREATE INDEX todos_parent_id_idx ON todos (parent_id)`,
+		},
+	},
+	{
+		version:     12,
+		description: "add todo recurrence",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN recurrence TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE todos ADD COLUMN next_occurrence_id TEXT`,
+		},
+	},
+	{
+		version:     13,
+		description: "add todo reminders",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN reminders TEXT`,
+			`ALTER TABLE todos ADD COLUMN next_reminder_at INTEGER`,
+			`ALTER TABLE todos ADD COLUMN reminder_lease INTEGER`,
+			`ALTER TABLE todos ADD COLUMN reminder_claim TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX todos_next_reminder_at_idx ON todos (next_reminder_at)`,
+		},
+	},
+	{
+		version:     14,
+		description: "add todo lists",
+		statements: []string{
+			`CREATE TABLE lists (
+				id         TEXT PRIMARY KEY,
+				user_id    TEXT NOT NULL,
+				name       TEXT NOT NULL,
+				created_at INTEGER NOT NULL,
+				updated_at INTEGER NOT NULL,
+				version    INTEGER NOT NULL DEFAULT 1
+			)`,
+			`CREATE INDEX lists_user_id_idx ON lists (user_id)`,
+			`ALTER TABLE todos ADD COLUMN list_id TEXT`,
+			`CREATE INDEX todos_list_id_user_id_idx ON todos (list_id, user_id)`,
+		},
+	},
+	{
+		version:     15,
+		description: "add todo positions",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN position TEXT NOT NULL DEFAULT ''`,
+			// The Todos stored before positions existed keep their creation order, like the new ones.
+			`UPDATE todos SET position = id`,
+			`CREATE INDEX todos_user_id_position_idx ON todos (user_id, position)`,
+			`CREATE INDEX todos_user_id_list_id_position_idx ON todos (user_id, list_id, position)`,
+		},
+	},
+	{
+		version:     16,
+		description: "add todo comments",
+		statements: []string{
+			`CREATE TABLE comments (
+				id         TEXT PRIMARY KEY,
+				todo_id    TEXT NOT NULL,
+				author     TEXT NOT NULL,
+				body       TEXT NOT NULL,
+				created_at INTEGER NOT NULL,
+				updated_at INTEGER NOT NULL,
+				version    INTEGER NOT NULL DEFAULT 1
+			)`,
+			`CREATE INDEX comments_todo_id_created_at_idx ON comments (todo_id, created_at)`,
+			`ALTER TABLE todos ADD COLUMN comment_count INTEGER NOT NULL DEFAULT 0`,
+		},
+	},
+}
+
+var postgresMigrations = []migration{
+	{
+		version:     1,
+		description: "create todos table",
+		statements: []string{
+			`CREATE TABLE todos (
+				id          TEXT PRIMARY KEY,
+				title       TEXT NOT NULL DEFAULT '',
+				description TEXT NOT NULL DEFAULT '',
+				user_id     TEXT NOT NULL DEFAULT '',
+				done        BOOLEAN NOT NULL DEFAULT FALSE
+			)`,
+			`CREATE INDEX todos_user_id_done_idx ON todos (user_id, done)`,
+			`CREATE INDEX todos_done_idx ON todos (done)`,
+		},
+	},
+	{
+		version:     2,
+		description: "add todo timestamps",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+			`ALTER TABLE todos ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now()`,
+		},
+	},
+	{
+		version:     3,
+		description: "add indexes for sorted pages",
+		statements: []string{
+			`CREATE INDEX todos_user_id_created_at_idx ON todos (user_id, created_at, id)`,
+			`CREATE INDEX todos_user_id_updated_at_idx ON todos (user_id, updated_at, id)`,
+			`CREATE INDEX todos_user_id_title_idx ON todos (user_id, title, id)`,
+		},
+	},
+	{
+		version:     4,
+		description: "add todo version",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN version BIGINT NOT NULL DEFAULT 1`,
+		},
+	},
+	{
+		version:     5,
+		description: "create idempotency keys table",
+		statements: []string{
+			`CREATE TABLE idempotency_keys (
+				user_id     TEXT NOT NULL,
+				request_id  TEXT NOT NULL,
+				fingerprint TEXT NOT NULL,
+				todo        JSONB NOT NULL,
+				expires_at  TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (user_id, request_id)
+			)`,
+			`CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at)`,
+		},
+	},
+	{
+		version:     6,
+		description: "add todo trash",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN deleted_at TIMESTAMPTZ`,
+			`CREATE INDEX todos_deleted_at_idx ON todos (deleted_at)`,
+		},
+	},
+	{
+		version:     7,
+		description: "add todo due time",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN due_at TIMESTAMPTZ`,
+			`CREATE INDEX todos_user_id_due_at_idx ON todos (user_id, due_at)`,
+		},
+	},
+	{
+		version:     8,
+		description: "add todo priority",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN priority SMALLINT NOT NULL DEFAULT 0`,
+			`CREATE INDEX todos_user_id_priority_idx ON todos (user_id, priority, due_at)`,
+		},
+	},
+	{
+		version:     9,
+		description: "create todo tags table",
+		statements: []string{
+			`CREATE TABLE todo_tags (
+				todo_id  TEXT NOT NULL,
+				tag      TEXT NOT NULL,
+				position INTEGER NOT NULL,
+				PRIMARY KEY (todo_id, tag)
+			)`,
+			`CREATE INDEX todo_tags_tag_idx ON todo_tags (tag, todo_id)`,
+		},
+	},
+	{
+		version:     10,
+		description: "add todo checklist",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN checklist JSONB`,
+		},
+	},
+	{
+		version:     11,
+		description: "add todo parent",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN parent_id TEXT`,
+			`CREATE INDEX todos_parent_id_idx ON todos (parent_id)`,
+		},
+	},
+	{
+		version:     12,
+		description: "add todo recurrence",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN recurrence TEXT NOT NULL DEFAULT ''`,
+			`ALTER TABLE todos ADD COLUMN next_occurrence_id TEXT`,
+		},
+	},
+	{
+		version:     13,
+		description: "add todo reminders",
+		statements: []string{
+			`ALTER TABLE todos ADD COLUMN reminders JSONB`,
+			`ALTER TABLE todos ADD COLUMN next_reminder_at TIMESTAMPTZ`,
+			`ALTER TABLE todos ADD COLUMN reminder_lease TIMESTAMPTZ`,
+			`ALTER TABLE todos ADD COLUMN reminder_claim TEXT NOT NULL DEFAULT ''`,
+			`CREATE INDEX todos_next_reminder_at_idx ON todos (next_reminder_at)`,
+		},
+	},
+	{
+		version:     14,
+		description: "add todo lists",
+		statements: []string{
+			`CREATE TABLE lists (
+				id         TEXT PRIMARY KEY,
+				user_id    TEXT NOT NULL,
+				name       TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL,
+				version    BIGINT NOT NULL DEFAULT 1
+			)`,
+			`CREATE INDEX lists_user_id_idx ON lists (user_id)`,
+			`ALTER TABLE todos ADD COLUMN list_id TEXT`,
+			`CREATE INDEX todos_list_id_user_id_idx ON todos (list_id, user_id)`,
+		},
+	},
+	{
+		version:     15,
+		description: "add todo positions",
+		statements: []string{
+			// Positions sort by byte, whatever the collation of the database.
+			`ALTER TABLE todos ADD COLUMN position TEXT COLLATE "C" NOT NULL DEFAULT ''`,
+			// The Todos stored before positions existed keep their creation order, like the new ones.
+			`UPDATE todos SET position = id`,
+			`CREATE INDEX todos_user_id_position_idx ON todos (user_id, position)`,
+			`CREATE INDEX todos_user_id_list_id_position_idx ON todos (user_id, list_id, position)`,
+		},
+	},
+	{
+		version:     16,
+		description: "add todo comments",
+		statements: []string{
+			`CREATE TABLE comments (
+				id         TEXT PRIMARY KEY,
+				todo_id    TEXT NOT NULL,
+				author     TEXT NOT NULL,
+				body       TEXT NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ NOT NULL,
+				version    BIGINT NOT NULL DEFAULT 1
+			)`,
+			`CREATE INDEX comments_todo_id_created_at_idx ON comments (todo_id, created_at)`,
+			`ALTER TABLE todos ADD COLUMN comment_count BIGINT NOT NULL DEFAULT 0`,
+		},
+	},
+}
+
+// MigrateSQLite brings the schema of the given SQLite database up to date.
+func MigrateSQLite(ctx context.Context, db *sql.DB) error {
+	return runMigrations(ctx, db, sqliteDialect)
+}
+
+// MigrateMongo creates the indexes the Mongo TodoService relies on and fills in the fields older Todos lack, it is
+// safe to run on every start.
+func MigrateMongo(ctx context.Context, todoCollection *mongo.Collection) error {
+	// Request ids are dropped by the TTL monitor once expires_at is in the past.
+	_, err := todoCollection.Database().Collection(idempotencyCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = todoCollection.Database().Collection(listsCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "user", Value: 1}, {Key: "name", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = todoCollection.Database().Collection(commentsCollectionName).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "todo_id", Value: 1}, {Key: "created_at", Value: 1}},
+	})
+	if err != nil {
+		return err
+	}
+	// The Todos stored before positions existed keep their creation order, like the new ones.
+	_, err = todoCollection.UpdateMany(ctx, bson.M{"position": bson.M{"$exists": false}}, mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"position": bson.M{"$toString": "$_id"}}}},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = todoCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		// The trash is listed and purged by deletion time, only the trashed Todos have one.
+		{
+			Keys:    bson.D{{Key: "deleted_at", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		// For the due time, priority and tag filters. The tags index is a multikey one, on every tag of the array.
+		{Keys: bson.D{{Key: "user", Value: 1}, {Key: "due_at", Value: 1}}},
+		{Keys: bson.D{{Key: "user", Value: 1}, {Key: "priority", Value: 1}}},
+		{Keys: bson.D{{Key: "user", Value: 1}, {Key: "tags", Value: 1}}},
+		// For the POSITION order, and the neighbours of the Todos moved in their List.
+		{Keys: bson.D{{Key: "user", Value: 1}, {Key: "position", Value: 1}}},
+		{Keys: bson.D{{Key: "user", Value: 1}, {Key: "list_id", Value: 1}, {Key: "position", Value: 1}}},
+		// For the List filter, and the Todos moved out of a deleted List.
+		{Keys: bson.D{{Key: "list_id", Value: 1}, {Key: "user", Value: 1}}},
+		// The children of a Todo are looked up level by level, only the Todos with a parent have one.
+		{
+			Keys:    bson.D{{Key: "parent_id", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+		// The schedulers claim the reminders due, only the Todos with a reminder left to send have a next one.
+		{
+			Keys:    bson.D{{Key: "next_reminder_at", Value: 1}},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	return err
+}
+
+// MigratePostgres brings the schema of the given Postgres database up to date.
+func MigratePostgres(ctx context.Context, db *sql.DB) error {
+	return runMigrations(ctx, db, postgresDialect)
+}
+
+// CheckPostgresSchema returns an error if the given Postgres database has migrations left to apply.
+func CheckPostgresSchema(ctx context.Context, db *sql.DB) error {
+	current, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+	if latest := postgresMigrations[len(postgresMigrations)-1].version; current < latest {
+		return fmt.Errorf("database schema is at version %d, expected %d", current, latest)
+	}
+	return nil
+}
+
+func runMigrations(ctx context.Context, db *sql.DB, dialect sqlDialect) error {
+	current, err := schemaVersion(ctx, db)
+	if err != nil {
+		return err
+	}
+
+	for _, m := range dialect.migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(ctx, db, dialect, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.description, err)
+		}
+	}
+	return nil
+}
+
+func schemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	_, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version     INTEGER PRIMARY KEY,
+		description TEXT NOT NULL
+	)`)
+	if err != nil {
+		return 0, err
+	}
+
+	var current int
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	return current, err
+}
+
+func applyMigration(ctx context.Context, db *sql.DB, dialect sqlDialect, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range m.statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, dialect.rebind(`INSERT INTO schema_migrations (version, description) VALUES (?, ?)`), m.version, m.description); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
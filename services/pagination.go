@@ -0,0 +1,193 @@
+package services
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/todo-project/models"
+	"github.com/todo-project/pb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxPageSize caps the page size a client can ask for.
+const MaxPageSize = 1000
+
+var ErrInvalidPageToken = errors.New("invalid page token")
+
+// pageToken is the position of the last Todo of a page. Pages are keyset based, the next page starts right after
+// the (sort key, id) of that Todo, so writes happening between two calls never shift the following pages.
+type pageToken struct {
+	SortBy     pb.GetItemsRequest_SortBy `json:"s"`
+	Descending bool                      `json:"d"`
+	Trashed    bool                      `json:"x,omitempty"`
+	Title      string                    `json:"t,omitempty"`
+	Position   string                    `json:"r,omitempty"`
+	Priority   pb.Priority               `json:"p,omitempty"`
+	Time       int64                     `json:"ts,omitempty"`
+	Id         primitive.ObjectID        `json:"i"`
+}
+
+// pageSize returns the number of Todos to read for a page, 0 means no limit.
+func pageSize(query *models.TodoQuery) int {
+	if query.PageSize <= 0 {
+		return 0
+	}
+	if query.PageSize > MaxPageSize {
+		return MaxPageSize
+	}
+	return query.PageSize
+}
+
+func encodePageToken(query *models.TodoQuery, last *models.Todo) string {
+	token := pageToken{SortBy: query.SortBy, Descending: query.Descending, Trashed: query.Trashed, Id: last.Id}
+	switch sortKey(query) {
+	case pb.GetItemsRequest_TITLE:
+		token.Title = last.Title
+	case pb.GetItemsRequest_POSITION:
+		token.Position = last.Position
+	case pb.GetItemsRequest_PRIORITY:
+		token.Priority = last.Priority
+		token.Time = sortTime(query, last).UnixMilli()
+	default:
+		token.Time = sortTime(query, last).UnixMilli()
+	}
+	data, _ := json.Marshal(token)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodePageToken returns nil when the query starts from the first page.
+func decodePageToken(query *models.TodoQuery) (*pageToken, error) {
+	if len(query.PageToken) == 0 {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(query.PageToken)
+	if err != nil {
+		return nil, invalidArgument("Page_token", ErrInvalidPageToken)
+	}
+	token := &pageToken{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, invalidArgument("Page_token", ErrInvalidPageToken)
+	}
+	// A token only makes sense for the order it was created with.
+	if token.SortBy != query.SortBy || token.Descending != query.Descending || token.Trashed != query.Trashed {
+		return nil, invalidArgument("Page_token", ErrInvalidPageToken)
+	}
+	return token, nil
+}
+
+// sortKey returns the order of the query, the trash is always ordered by deletion time which has no SortBy value
+// and is reported as CREATED_AT, the other time ordering.
+func sortKey(query *models.TodoQuery) pb.GetItemsRequest_SortBy {
+	if query.Trashed {
+		return pb.GetItemsRequest_CREATED_AT
+	}
+	return query.SortBy
+}
+
+// noDueSortTime stands for the due time of the Todos without one in the PRIORITY and DUE_AT orders, putting them
+// after the others. Due times are never later, the API only takes years up to 9999.
+var noDueSortTime = time.Date(9999, time.December, 31, 23, 59, 59, 999000000, time.UTC)
+
+func sortTime(query *models.TodoQuery, todo *models.Todo) time.Time {
+	switch {
+	case query.Trashed:
+		return todo.DeletedAt
+	case query.SortBy == pb.GetItemsRequest_UPDATED_AT:
+		return todo.UpdatedAt
+	case query.SortBy == pb.GetItemsRequest_PRIORITY, query.SortBy == pb.GetItemsRequest_DUE_AT:
+		if todo.DueAt.IsZero() {
+			return noDueSortTime
+		}
+		return todo.DueAt
+	}
+	return todo.CreatedAt
+}
+
+// compareTodos orders two Todos by the sort key of the query, then by id. PRIORITY orders the most urgent first,
+// then by due time.
+func compareTodos(query *models.TodoQuery, a, b *models.Todo) int {
+	c := 0
+	timed := true
+	switch sortKey(query) {
+	case pb.GetItemsRequest_TITLE:
+		c = strings.Compare(a.Title, b.Title)
+		timed = false
+	case pb.GetItemsRequest_POSITION:
+		c = strings.Compare(a.Position, b.Position)
+		timed = false
+	case pb.GetItemsRequest_PRIORITY:
+		if a.Priority > b.Priority {
+			c = -1
+		} else if a.Priority < b.Priority {
+			c = 1
+		}
+	}
+	if c == 0 && timed {
+		ta, tb := sortTime(query, a), sortTime(query, b)
+		if ta.Before(tb) {
+			c = -1
+		} else if ta.After(tb) {
+			c = 1
+		}
+	}
+	if c == 0 {
+		c = strings.Compare(a.Id.Hex(), b.Id.Hex())
+	}
+	if query.Descending {
+		return -c
+	}
+	return c
+}
+
+// afterToken reports if the Todo comes after the position of the token.
+func afterToken(query *models.TodoQuery, token *pageToken, todo *models.Todo) bool {
+	last := &models.Todo{Id: token.Id, Title: token.Title, Position: token.Position, Priority: token.Priority}
+	last.CreatedAt = time.UnixMilli(token.Time).UTC()
+	last.UpdatedAt = last.CreatedAt
+	last.DeletedAt = last.CreatedAt
+	last.DueAt = last.CreatedAt
+	return compareTodos(query, last, todo) < 0
+}
+
+// errPageFull stops the iteration over the query results once a page is complete.
+var errPageFull = errors.New("page full")
+
+// pageWriter passes the Todos of a page to fn as they are read. The backends read one Todo past the page size,
+// seeing it means there is a next page.
+type pageWriter struct {
+	query         *models.TodoQuery
+	size          int
+	fn            func(*models.Todo) error
+	written       int
+	last          *models.Todo
+	nextPageToken string
+}
+
+func newPageWriter(query *models.TodoQuery, fn func(*models.Todo) error) *pageWriter {
+	return &pageWriter{query: query, size: pageSize(query), fn: fn}
+}
+
+// write returns errPageFull when the Todo belongs to the next page, the caller must stop reading.
+func (p *pageWriter) write(todo *models.Todo) error {
+	if p.size != 0 && p.written == p.size {
+		p.nextPageToken = encodePageToken(p.query, p.last)
+		return errPageFull
+	}
+	if err := p.fn(todo); err != nil {
+		return err
+	}
+	p.written++
+	p.last = todo
+	return nil
+}
+
+// limit returns the number of Todos the backends have to read, 0 means no limit.
+func (p *pageWriter) limit() int {
+	if p.size == 0 {
+		return 0
+	}
+	return p.size + 1
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/todo-project/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInvalidMove is wrapped by the errors returned for a move that does not name exactly one Todo to place the
+	// Todo next to.
+	ErrInvalidMove = errors.New("a move needs exactly one of Before_id and After_id")
+	// ErrMoveToSelf is wrapped by the errors returned for a move placing a Todo next to itself.
+	ErrMoveToSelf = errors.New("a Todo cannot be placed next to itself")
+	// ErrMoveAcrossLists is wrapped by the errors returned for a move placing a Todo next to a Todo of another List.
+	ErrMoveAcrossLists = errors.New("a Todo can only be placed next to a Todo of its List")
+)
+
+// positionDigits are the digits of the positions, in ascending order. The hex Ids the new Todos take as Position
+// are made of the same digits.
+const positionDigits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// positionBetween returns a position sorting after low and before high. An empty low is before every position and
+// an empty high after every position. The positions it returns never end with the lowest digit, so there is always
+// room for another one between two of them.
+func positionBetween(low, high string) (string, error) {
+	position := midPosition(low, high)
+	if position <= low || (len(high) != 0 && position >= high) {
+		return "", fmt.Errorf("no position between %q and %q", low, high)
+	}
+	return position, nil
+}
+
+// midPosition returns the shortest position close to the middle of low and high, the missing digits of low
+// standing for the lowest one.
+func midPosition(low, high string) string {
+	if len(high) != 0 {
+		n := 0
+		for n < len(high) && digitAt(low, n) == high[n] {
+			n++
+		}
+		if n > 0 {
+			return high[:n] + midPosition(suffix(low, n), high[n:])
+		}
+	}
+	lowDigit, highDigit := 0, len(positionDigits)
+	if len(low) != 0 {
+		lowDigit = strings.IndexByte(positionDigits, low[0])
+	}
+	if len(high) != 0 {
+		highDigit = strings.IndexByte(positionDigits, high[0])
+	}
+	if highDigit-lowDigit > 1 {
+		return positionDigits[(lowDigit+highDigit)/2 : (lowDigit+highDigit)/2+1]
+	}
+	// The first digits are consecutive: the first digit of high alone sorts before high, when there is more to it,
+	// otherwise the position starts like low and sorts after the rest of it.
+	if len(high) > 1 {
+		return high[:1]
+	}
+	return positionDigits[lowDigit:lowDigit+1] + midPosition(suffix(low, 1), "")
+}
+
+func digitAt(position string, i int) byte {
+	if i < len(position) {
+		return position[i]
+	}
+	return positionDigits[0]
+}
+
+func suffix(position string, i int) string {
+	if i < len(position) {
+		return position[i:]
+	}
+	return ""
+}
+
+// moveField returns the request field naming the Todo a move places the Todo next to.
+func moveField(move *models.MoveTodo) string {
+	if len(move.AfterId) != 0 {
+		return "After_id"
+	}
+	return "Before_id"
+}
+
+// moveTarget returns the Todo a move places the Todo next to. read reads a Todo out of the trash, it fails with a
+// KindNotFound error when there is none.
+func moveTarget(move *models.MoveTodo, read func(id string) (*models.Todo, error)) (*models.Todo, error) {
+	if (len(move.BeforeId) == 0) == (len(move.AfterId) == 0) {
+		return nil, invalidArgument("Before_id", ErrInvalidMove)
+	}
+	field, id := moveField(move), move.BeforeId+move.AfterId
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, invalidArgument(field, fmt.Errorf("%w: %q", ErrInvalidId, id))
+	}
+	target, err := read(id)
+	if KindOf(err) == KindNotFound {
+		return nil, invalidArgument(field, fmt.Errorf("%w: %q", ErrTodoNotFound, id))
+	}
+	return target, err
+}
+
+// placeTodo places the Todo right before or after target. neighbour returns the position closest to the one of
+// target on the side the Todo goes, among the Todos of the List of the Todo other than itself, the trashed ones
+// included so that they get their place back when restored. It returns the empty string when there is none.
+//
+// The Todos sharing the Position of target, like the occurrences of a series, stay together: the Todo goes before
+// or after all of them.
+func placeTodo(move *models.MoveTodo, target *models.Todo, neighbour func(todo *models.Todo, before bool) (string, error)) todoEdit {
+	before := len(move.BeforeId) != 0
+	return func(todo *models.Todo) error {
+		if err := checkVersion(todo, move.ExpectedVersion); err != nil {
+			return err
+		}
+		if todo.Id == target.Id {
+			return invalidArgument(moveField(move), ErrMoveToSelf)
+		}
+		if todo.User != target.User {
+			return invalidArgument(moveField(move), fmt.Errorf("%w: %q", ErrTodoNotFound, target.Id.Hex()))
+		}
+		if todo.ListId != target.ListId {
+			return invalidArgument(moveField(move), fmt.Errorf("%w: %q", ErrMoveAcrossLists, target.Id.Hex()))
+		}
+		next, err := neighbour(todo, before)
+		if err != nil {
+			return err
+		}
+		low, high := next, target.Position
+		if !before {
+			low, high = target.Position, next
+			// Placed after the last Todo, it stays before the Todos created later.
+			if created := primitive.NewObjectID().Hex(); len(high) == 0 && created > low {
+				high = created
+			}
+		}
+		if todo.Position, err = positionBetween(low, high); err != nil {
+			return err
+		}
+		todo.UpdatedAt = now()
+		todo.Version++
+		return nil
+	}
+}
@@ -0,0 +1,28 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// RunReaper permanently removes, every interval, the Todos that have been in the trash for longer than retention.
+// It returns once ctx is done.
+func RunReaper(ctx context.Context, todoService TodoService, retention, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		purged, err := todoService.PurgeTrash(ctx, now().Add(-retention))
+		if err != nil && ctx.Err() == nil {
+			log.Printf("could not purge the trash: %v", err)
+		} else if purged != 0 {
+			log.Printf("purged %d todos from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/teambition/rrule-go"
+	"github.com/todo-project/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInvalidRecurrence is wrapped by the errors returned for a recurrence rule that does not parse.
+	ErrInvalidRecurrence = errors.New("invalid recurrence rule")
+	// ErrNotRecurring is wrapped by the errors returned when skipping an occurrence of a Todo that is not the
+	// current occurrence of a series.
+	ErrNotRecurring = errors.New("the Todo is not the current occurrence of a series")
+	// ErrSeriesEnded is wrapped by the errors returned when skipping the last occurrence of a series.
+	ErrSeriesEnded = errors.New("the series has no occurrence after this one")
+)
+
+// todoEdit changes a copy of a stored Todo, checks its version and increments it. It fails with an *Error when it
+// does not apply to the Todo.
+type todoEdit func(todo *models.Todo) error
+
+// normalizeRecurrence parses an RFC 5545 RRULE, with or without its "RRULE:" prefix, and returns it in its
+// canonical form. The empty string is a Todo that does not recur. DTSTART is rejected: the series follows the
+// due time of the Todos.
+func normalizeRecurrence(rule string) (string, error) {
+	rule = strings.TrimPrefix(strings.TrimSpace(rule), "RRULE:")
+	if len(rule) == 0 {
+		return "", nil
+	}
+	if strings.ContainsAny(rule, "\r\n") || strings.Contains(rule, "DTSTART") {
+		return "", invalidArgument("Recurrence", fmt.Errorf("%w: DTSTART is not supported", ErrInvalidRecurrence))
+	}
+	option, err := rrule.StrToROption(rule)
+	if err == nil {
+		_, err = rrule.NewRRule(*option)
+	}
+	if err != nil {
+		return "", invalidArgument("Recurrence", fmt.Errorf("%w: %v", ErrInvalidRecurrence, err))
+	}
+	return option.RRuleString(), nil
+}
+
+// nextDue returns the first occurrence of the rule after from, along with the rule of the occurrences left after
+// it. The occurrence at from counts as one of the COUNT of the rule. It returns the zero time when the series is
+// over. Rules are evaluated in UTC.
+func nextDue(rule string, from time.Time) (time.Time, string, error) {
+	option, err := rrule.StrToROption(rule)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	count := option.Count
+	if count == 1 {
+		return time.Time{}, "", nil
+	}
+	// The COUNT is kept track of by the rules of the occurrences, every one of them starts a new iteration.
+	option.Count = 0
+	option.Dtstart = from.UTC().Truncate(time.Second)
+	r, err := rrule.NewRRule(*option)
+	if err != nil {
+		return time.Time{}, "", err
+	}
+	next := r.After(option.Dtstart, false)
+	if next.IsZero() {
+		return time.Time{}, "", nil
+	}
+	if count != 0 {
+		option.Count = count - 1
+	}
+	option.Dtstart = time.Time{}
+	return next, option.RRuleString(), nil
+}
+
+// recurrenceStart is the time the next occurrence of a Todo is computed from: its due time, or when it was
+// completed or skipped for a Todo without due time.
+func recurrenceStart(todo *models.Todo, at time.Time) time.Time {
+	if todo.DueAt.IsZero() {
+		return at
+	}
+	return todo.DueAt
+}
+
+// continuesSeries reports whether the update, applied to todo, marks done a recurring Todo whose next occurrence
+// has not been created yet.
+func continuesSeries(todo *models.Todo, data *models.UpdateTodo) bool {
+	return data.Done != nil && *data.Done && todo.Done && len(todo.Recurrence) != 0 && todo.NextOccurrenceId.IsZero()
+}
+
+// nextOccurrence returns the occurrence following todo, which the update marked done at doneAt. It returns nil when
+// the update does not continue the series, or when the series is over. The occurrence is a copy of todo, pending,
+// with its checklist unchecked, the next due time and its reminders moved along.
+func nextOccurrence(todo *models.Todo, data *models.UpdateTodo, doneAt time.Time) (*models.Todo, error) {
+	if !continuesSeries(todo, data) {
+		return nil, nil
+	}
+	start := recurrenceStart(todo, doneAt)
+	due, rule, err := nextDue(todo.Recurrence, start)
+	if err != nil || due.IsZero() {
+		return nil, err
+	}
+	var checklist []models.ChecklistItem
+	for _, item := range todo.Checklist {
+		item.Done = false
+		checklist = append(checklist, item)
+	}
+	// The next occurrence takes the Position of this one, it comes right after it in the manual order since its Id
+	// is greater.
+	occurrence := &models.Todo{
+		Id:          primitive.NewObjectID(),
+		Title:       todo.Title,
+		Description: todo.Description,
+		User:        todo.User,
+		DueAt:       due,
+		Priority:    todo.Priority,
+		Tags:        append([]string(nil), todo.Tags...),
+		Checklist:   checklist,
+		ParentId:    todo.ParentId,
+		ListId:      todo.ListId,
+		Position:    todo.Position,
+		Recurrence:  rule,
+		CreatedAt:   doneAt,
+		UpdatedAt:   doneAt,
+		Version:     1,
+	}
+	setReminders(occurrence, shiftReminders(todo.Reminders, due.Sub(start)))
+	return occurrence, nil
+}
+
+// skipOccurrence moves a recurring Todo, and its reminders, to the next occurrence of its series.
+func skipOccurrence(expectedVersion int64) todoEdit {
+	return func(todo *models.Todo) error {
+		if err := checkVersion(todo, expectedVersion); err != nil {
+			return err
+		}
+		if len(todo.Recurrence) == 0 || !todo.NextOccurrenceId.IsZero() {
+			return failedPrecondition(todo.Id.Hex(), ErrNotRecurring)
+		}
+		updatedAt := now()
+		start := recurrenceStart(todo, updatedAt)
+		due, rule, err := nextDue(todo.Recurrence, start)
+		if err != nil {
+			return err
+		}
+		if due.IsZero() {
+			return failedPrecondition(todo.Id.Hex(), ErrSeriesEnded)
+		}
+		setReminders(todo, shiftReminders(todo.Reminders, due.Sub(start)))
+		todo.DueAt = due
+		todo.Recurrence = rule
+		todo.UpdatedAt = updatedAt
+		todo.Version++
+		return nil
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/todo-project/models"
+	"github.com/todo-project/notify"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxReminders is the number of reminders a Todo can hold.
+const MaxReminders = 10
+
+var (
+	// ErrTooManyReminders is wrapped by the errors returned for more than MaxReminders reminders.
+	ErrTooManyReminders = fmt.Errorf("a Todo holds at most %d reminders", MaxReminders)
+	// ErrInvalidReminder is wrapped by the errors returned for a reminder without time.
+	ErrInvalidReminder = errors.New("a reminder needs a time")
+)
+
+// normalizeReminders returns the reminders at times, in chronological order and without duplicates. The reminders of
+// previous at the same times are kept as they are, so that the ones already sent are not sent again.
+func normalizeReminders(times []time.Time, previous []models.Reminder) ([]models.Reminder, error) {
+	if len(times) == 0 {
+		return nil, nil
+	}
+	sorted := make([]time.Time, 0, len(times))
+	for _, at := range times {
+		if at.IsZero() {
+			return nil, invalidArgument("Reminders", ErrInvalidReminder)
+		}
+		sorted = append(sorted, dueTime(at))
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	var reminders []models.Reminder
+	for i, at := range sorted {
+		if i != 0 && at.Equal(sorted[i-1]) {
+			continue
+		}
+		reminder := models.Reminder{At: at}
+		for _, kept := range previous {
+			if kept.At.Equal(at) {
+				reminder = kept
+				break
+			}
+		}
+		reminders = append(reminders, reminder)
+	}
+	if len(reminders) > MaxReminders {
+		return nil, invalidArgument("Reminders", ErrTooManyReminders)
+	}
+	return reminders, nil
+}
+
+// setReminders sets the reminders of todo, along with its NextReminderAt.
+func setReminders(todo *models.Todo, reminders []models.Reminder) {
+	todo.Reminders = reminders
+	todo.NextReminderAt = time.Time{}
+	for _, reminder := range reminders {
+		if reminder.SentAt.IsZero() {
+			todo.NextReminderAt = reminder.At
+			break
+		}
+	}
+}
+
+// shiftReminders returns the reminders moved by d, none of them sent, for the next occurrence of a series.
+func shiftReminders(reminders []models.Reminder, d time.Duration) []models.Reminder {
+	var shifted []models.Reminder
+	for _, reminder := range reminders {
+		shifted = append(shifted, models.Reminder{At: reminder.At.Add(d)})
+	}
+	return shifted
+}
+
+// reminderClaimable reports whether todo has reminders due at now that no scheduler is delivering. The reminders
+// of the Todos done or in the trash are not delivered.
+func reminderClaimable(todo *models.Todo, now time.Time) bool {
+	return !todo.Done && !todo.Trashed() && !todo.NextReminderAt.IsZero() && !todo.NextReminderAt.After(now) &&
+		!todo.ReminderLease.After(now)
+}
+
+// newReminderClaim returns the claim of todo, whose ReminderClaim and ReminderLease are already set, for the
+// reminders due at now.
+func newReminderClaim(todo *models.Todo, now time.Time) *models.ReminderClaim {
+	claim := &models.ReminderClaim{Todo: todo, Id: todo.ReminderClaim}
+	for _, reminder := range todo.Reminders {
+		if reminder.SentAt.IsZero() && !reminder.At.After(now) {
+			claim.Due = append(claim.Due, reminder.At)
+		}
+	}
+	return claim
+}
+
+// newReminderClaimId returns the Id of a new claim.
+func newReminderClaimId() string {
+	return primitive.NewObjectID().Hex()
+}
+
+// completeReminders marks the reminders sent at sentAt, and releases the claim of todo when every reminder of claim
+// was sent. The reminders removed since the claim are left aside.
+func completeReminders(todo *models.Todo, claim *models.ReminderClaim, sent []time.Time, sentAt time.Time) {
+	reminders := append([]models.Reminder(nil), todo.Reminders...)
+	for i := range reminders {
+		for _, at := range sent {
+			if reminders[i].At.Equal(at) && reminders[i].SentAt.IsZero() {
+				reminders[i].SentAt = sentAt
+			}
+		}
+	}
+	setReminders(todo, reminders)
+	if len(sent) == len(claim.Due) {
+		todo.ReminderLease = time.Time{}
+		todo.ReminderClaim = ""
+	}
+}
+
+// reminderBatchSize is how many Todos a scheduler claims at once.
+const reminderBatchSize = 100
+
+// RunReminders delivers the reminders due through notifier, looking for them every interval. It returns once ctx is
+// done.
+//
+// The Todos are claimed for lease while their reminders are delivered, so that the schedulers of several replicas
+// sharing the storage do not deliver them twice. The reminders that could not be delivered, or whose scheduler
+// stopped before acknowledging them, are delivered again once the lease is over.
+func RunReminders(ctx context.Context, todoService TodoService, notifier notify.Notifier, interval, lease time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		deliverReminders(ctx, todoService, notifier, lease)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverReminders delivers the reminders due now, one batch of Todos after the other.
+func deliverReminders(ctx context.Context, todoService TodoService, notifier notify.Notifier, lease time.Duration) {
+	for {
+		claims, err := todoService.ClaimReminders(ctx, now(), lease, reminderBatchSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				log.Printf("could not claim the reminders due: %v", err)
+			}
+			return
+		}
+		for _, claim := range claims {
+			var sent []time.Time
+			for _, at := range claim.Due {
+				if err := notifier.Notify(ctx, &notify.Reminder{Todo: claim.Todo, At: at}); err != nil {
+					log.Printf("could not deliver the reminder of todo %s at %s: %v", claim.Todo.Id.Hex(), at.Format(time.RFC3339), err)
+					continue
+				}
+				sent = append(sent, at)
+			}
+			if err := todoService.CompleteReminders(ctx, claim, sent); err != nil && ctx.Err() == nil {
+				log.Printf("could not acknowledge the reminders of todo %s: %v", claim.Todo.Id.Hex(), err)
+			}
+		}
+		if len(claims) < reminderBatchSize {
+			return
+		}
+	}
+}
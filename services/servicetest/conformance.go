@@ -0,0 +1,2642 @@
+// Package servicetest provides a conformance suite that every services.TodoService implementation must pass.
+package servicetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/todo-project/models"
+	"github.com/todo-project/notify"
+	"github.com/todo-project/pb"
+	"github.com/todo-project/services"
+	"github.com/todo-project/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Factory returns an empty TodoService configured with opts, it is called once per test case.
+type Factory func(t *testing.T, opts services.Options) services.TodoService
+
+// Run runs the conformance suite against the TodoService returned by newService.
+func Run(t *testing.T, newService Factory) {
+	tests := []struct {
+		name string
+		opts services.Options
+		test func(t *testing.T, todoService services.TodoService)
+	}{
+		{"CreateAndGet", services.Options{}, testCreateAndGet},
+		{"UpdatePartial", services.Options{}, testUpdatePartial},
+		{"UpdateNothing", services.Options{}, testUpdateNothing},
+		{"UpdateZeroValues", services.Options{}, testUpdateZeroValues},
+		{"Timestamps", services.Options{}, testTimestamps},
+		{"DueTimes", services.Options{}, testDueTimes},
+		{"Priorities", services.Options{}, testPriorities},
+		{"Tags", services.Options{}, testTags},
+		{"ListTags", services.Options{}, testListTags},
+		{"RenameTag", services.Options{}, testRenameTag},
+		{"Checklist", services.Options{}, testChecklist},
+		{"ChecklistErrors", services.Options{}, testChecklistErrors},
+		{"ChecklistAutoComplete", services.Options{AutoCompleteChecklist: true}, testChecklistAutoComplete},
+		{"ChecklistAutoCompleteBlock", services.Options{AutoCompleteChecklist: true, ParentCompletion: services.CompletionBlock}, testChecklistAutoCompleteBlock},
+		{"ChecklistAutoCompleteCascade", services.Options{AutoCompleteChecklist: true, ParentCompletion: services.CompletionCascade}, testChecklistAutoCompleteCascade},
+		{"ChecklistAutoCompleteRecurrence", services.Options{AutoCompleteChecklist: true}, testChecklistAutoCompleteRecurrence},
+		{"Parents", services.Options{}, testParents},
+		{"ParentCycles", services.Options{}, testParentCycles},
+		{"DeleteTodoTree", services.Options{}, testDeleteTodoTree},
+		{"CompletionIgnore", services.Options{}, testCompletionIgnore},
+		{"CompletionBlock", services.Options{ParentCompletion: services.CompletionBlock}, testCompletionBlock},
+		{"CompletionCascade", services.Options{ParentCompletion: services.CompletionCascade}, testCompletionCascade},
+		{"Recurrence", services.Options{}, testRecurrence},
+		{"RecurrenceWithoutDue", services.Options{}, testRecurrenceWithoutDue},
+		{"RecurrenceErrors", services.Options{}, testRecurrenceErrors},
+		{"SkipOccurrence", services.Options{}, testSkipOccurrence},
+		{"EndSeries", services.Options{}, testEndSeries},
+		{"Reminders", services.Options{}, testReminders},
+		{"RemindersErrors", services.Options{}, testRemindersErrors},
+		{"ClaimReminders", services.Options{}, testClaimReminders},
+		{"RecurringReminders", services.Options{}, testRecurringReminders},
+		{"ReminderScheduler", services.Options{}, testReminderScheduler},
+		{"Lists", services.Options{}, testLists},
+		{"ListTodos", services.Options{}, testListTodos},
+		{"DeleteList", services.Options{}, testDeleteList},
+		{"DeleteListCascade", services.Options{}, testDeleteListCascade},
+		{"MoveTodo", services.Options{}, testMoveTodo},
+		{"MoveTodoErrors", services.Options{}, testMoveTodoErrors},
+		{"MoveTodoPages", services.Options{}, testMoveTodoPages},
+		{"MoveTodoLists", services.Options{}, testMoveTodoLists},
+		{"Comments", services.Options{}, testComments},
+		{"CommentErrors", services.Options{}, testCommentErrors},
+		{"CommentsOfTrashedTodos", services.Options{}, testCommentsOfTrashedTodos},
+		{"Versions", services.Options{}, testVersions},
+		{"ConcurrentVersionedWriters", services.Options{}, testConcurrentVersionedWriters},
+		{"IdempotentCreate", services.Options{}, testIdempotentCreate},
+		{"IdempotentCreateExpires", services.Options{IdempotencyWindow: 50 * time.Millisecond}, testIdempotentCreateExpires},
+		{"Delete", services.Options{}, testDelete},
+		{"Trash", services.Options{}, testTrash},
+		{"TrashVersions", services.Options{}, testTrashVersions},
+		{"Purge", services.Options{}, testPurge},
+		{"PurgeTrash", services.Options{}, testPurgeTrash},
+		{"BatchCreate", services.Options{}, testBatchCreate},
+		{"BatchUpdate", services.Options{}, testBatchUpdate},
+		{"BatchDelete", services.Options{}, testBatchDelete},
+		{"BatchAtomic", services.Options{}, testBatchAtomic},
+		{"BatchDuplicateIds", services.Options{}, testBatchDuplicateIds},
+		{"NotFound", services.Options{}, testNotFound},
+		{"InvalidId", services.Options{}, testInvalidId},
+		{"GetAllFilters", services.Options{}, testGetAllFilters},
+		{"GetAllDueFilters", services.Options{}, testGetAllDueFilters},
+		{"GetAllMinPriority", services.Options{}, testGetAllMinPriority},
+		{"GetAllTagFilters", services.Options{}, testGetAllTagFilters},
+		{"GetAllSubtree", services.Options{}, testGetAllSubtree},
+		{"GetAllSorting", services.Options{}, testGetAllSorting},
+		{"GetAllPriorityOrder", services.Options{}, testGetAllPriorityOrder},
+		{"GetAllDueOrder", services.Options{}, testGetAllDueOrder},
+		{"GetAllPages", services.Options{}, testGetAllPages},
+		{"GetAllStopsEarly", services.Options{}, testGetAllStopsEarly},
+		{"GetAllCancelled", services.Options{}, testGetAllCancelled},
+		{"ConcurrentWriters", services.Options{}, testConcurrentWriters},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newService(t, tt.opts))
+		})
+	}
+}
+
+func mustCreate(t *testing.T, todoService services.TodoService, title, user string) *models.Todo {
+	todo, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title:       title,
+		Description: title + " description",
+		User:        user,
+	})
+	if err != nil {
+		t.Fatalf("CreateTodo() error = %v", err)
+	}
+	return todo
+}
+
+func testCreateAndGet(t *testing.T, todoService services.TodoService) {
+	created, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title:       "title",
+		Description: "desc",
+		User:        "1",
+	})
+	assert.Nil(t, err)
+	assert.False(t, created.Id.IsZero())
+	assert.Equal(t, "title", created.Title)
+	assert.Equal(t, "desc", created.Description)
+	assert.Equal(t, "1", created.User)
+	assert.False(t, created.Done)
+
+	todo, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, created, todo)
+
+	other := mustCreate(t, todoService, "other", "1")
+	assert.NotEqual(t, created.Id, other.Id)
+}
+
+func testUpdatePartial(t *testing.T, todoService services.TodoService) {
+	created := mustCreate(t, todoService, "title", "1")
+
+	updated, err := todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{Title: utils.Pointer("new title")})
+	assert.Nil(t, err)
+	assert.Equal(t, &models.Todo{
+		Id:          created.Id,
+		Title:       "new title",
+		Description: created.Description,
+		User:        "1",
+		CreatedAt:   created.CreatedAt,
+		UpdatedAt:   updated.UpdatedAt,
+		Version:     2,
+		Position:    created.Position,
+	}, updated)
+
+	updated, err = todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{User: utils.Pointer("2"), Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	assert.Equal(t, &models.Todo{
+		Id:          created.Id,
+		Title:       "new title",
+		Description: created.Description,
+		User:        "2",
+		Done:        true,
+		CreatedAt:   created.CreatedAt,
+		UpdatedAt:   updated.UpdatedAt,
+		Version:     3,
+		Position:    created.Position,
+	}, updated)
+
+	todo, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, updated, todo)
+}
+
+func testUpdateNothing(t *testing.T, todoService services.TodoService) {
+	created := mustCreate(t, todoService, "title", "1")
+
+	updated, err := todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{})
+	assert.Nil(t, err)
+	assert.Equal(t, created, updated)
+}
+
+func testUpdateZeroValues(t *testing.T, todoService services.TodoService) {
+	created, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "title", Description: "desc", User: "1"})
+	if err != nil {
+		t.Fatalf("CreateTodo() error = %v", err)
+	}
+	_, err = todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+
+	// A set field is applied even when it holds the zero value.
+	updated, err := todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{
+		Description: utils.Pointer(""),
+		Done:        utils.BoolPointer(false),
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "title", updated.Title)
+	assert.Equal(t, "", updated.Description)
+	assert.False(t, updated.Done)
+
+	todo, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, updated, todo)
+
+	// The reopened Todo is pending again.
+	todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_PENDING})
+	assert.Equal(t, []*models.Todo{updated}, todos)
+	todos, _ = getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_DONE})
+	assert.Empty(t, todos)
+}
+
+func testTimestamps(t *testing.T, todoService services.TodoService) {
+	before := time.Now().Add(-time.Second)
+	created := mustCreate(t, todoService, "title", "1")
+	assert.True(t, created.CreatedAt.After(before), "CreatedAt = %v", created.CreatedAt)
+	assert.Equal(t, created.CreatedAt, created.UpdatedAt)
+
+	// Timestamps have millisecond precision, make sure the update happens later.
+	time.Sleep(5 * time.Millisecond)
+	updated, err := todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	assert.Equal(t, created.CreatedAt, updated.CreatedAt)
+	assert.True(t, updated.UpdatedAt.After(created.UpdatedAt), "UpdatedAt = %v", updated.UpdatedAt)
+
+	todo, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, updated.CreatedAt, todo.CreatedAt)
+	assert.Equal(t, updated.UpdatedAt, todo.UpdatedAt)
+}
+
+func testDueTimes(t *testing.T, todoService services.TodoService) {
+	dueAt := time.Date(2030, time.January, 2, 3, 4, 5, 678901234, time.FixedZone("UTC+1", 60*60))
+	created, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "title", User: "1", DueAt: dueAt})
+	assert.Nil(t, err)
+	// Stored in UTC, with the millisecond precision of the other timestamps.
+	assert.Equal(t, time.Date(2030, time.January, 2, 2, 4, 5, 678000000, time.UTC), created.DueAt)
+	todo, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, created, todo)
+
+	later := dueAt.AddDate(0, 0, 1)
+	updated, err := todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{DueAt: &later})
+	assert.Nil(t, err)
+	assert.Equal(t, created.DueAt.AddDate(0, 0, 1), updated.DueAt)
+	assert.Equal(t, int64(2), updated.Version)
+
+	// Left untouched by the updates of other fields.
+	updated, err = todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{Title: utils.Pointer("new title")})
+	assert.Nil(t, err)
+	assert.Equal(t, created.DueAt.AddDate(0, 0, 1), updated.DueAt)
+
+	updated, err = todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{DueAt: &time.Time{}})
+	assert.Nil(t, err)
+	assert.True(t, updated.DueAt.IsZero())
+	todo, err = todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, updated, todo)
+
+	assert.True(t, mustCreate(t, todoService, "no due time", "1").DueAt.IsZero())
+}
+
+func testPriorities(t *testing.T, todoService services.TodoService) {
+	created, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "title", User: "1", Priority: pb.Priority_HIGH})
+	assert.Nil(t, err)
+	assert.Equal(t, pb.Priority_HIGH, created.Priority)
+	todo, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, created, todo)
+
+	updated, err := todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{Priority: pb.Priority_URGENT.Enum()})
+	assert.Nil(t, err)
+	assert.Equal(t, pb.Priority_URGENT, updated.Priority)
+	assert.Equal(t, int64(2), updated.Version)
+
+	updated, err = todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{Priority: pb.Priority_NONE.Enum()})
+	assert.Nil(t, err)
+	assert.Equal(t, pb.Priority_NONE, updated.Priority)
+	todo, err = todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, updated, todo)
+
+	assert.Equal(t, pb.Priority_NONE, mustCreate(t, todoService, "no priority", "1").Priority)
+}
+
+func createTagged(t *testing.T, todoService services.TodoService, title, user string, tags ...string) *models.Todo {
+	todo, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: title, User: user, Tags: tags})
+	if err != nil {
+		t.Fatalf("CreateTodo() error = %v", err)
+	}
+	return todo
+}
+
+func testTags(t *testing.T, todoService services.TodoService) {
+	// Tags keep their order, duplicates are dropped.
+	created := createTagged(t, todoService, "title", "1", "work", "urgent", "work", "home")
+	assert.Equal(t, []string{"work", "urgent", "home"}, created.Tags)
+	todo, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, created, todo)
+
+	// Updates without tags leave them untouched.
+	updated, err := todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{Title: utils.Pointer("new title")})
+	assert.Nil(t, err)
+	assert.Equal(t, created.Tags, updated.Tags)
+
+	updated, err = todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{Tags: []string{"home", "garden", "home"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"home", "garden"}, updated.Tags)
+	assert.Equal(t, int64(3), updated.Version)
+	todo, err = todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, updated, todo)
+
+	// An empty list clears them.
+	updated, err = todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{Tags: []string{}})
+	assert.Nil(t, err)
+	assert.Nil(t, updated.Tags)
+	todo, err = todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, updated, todo)
+
+	assert.Nil(t, mustCreate(t, todoService, "no tags", "1").Tags)
+}
+
+func testListTags(t *testing.T, todoService services.TodoService) {
+	tags, err := todoService.ListTags(context.TODO(), "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.TagCount{}, tags)
+
+	createTagged(t, todoService, "a", "1", "work", "home")
+	createTagged(t, todoService, "b", "1", "work")
+	createTagged(t, todoService, "c", "2", "work", "garden")
+	trashed := createTagged(t, todoService, "d", "1", "work", "trashed")
+	if err := todoService.DeleteTodo(context.TODO(), trashed.Id.Hex(), 0); err != nil {
+		t.Fatalf("DeleteTodo() error = %v", err)
+	}
+
+	// Trashed Todos are not counted, the tags are sorted.
+	tags, err = todoService.ListTags(context.TODO(), "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.TagCount{{Tag: "home", Count: 1}, {Tag: "work", Count: 2}}, tags)
+}
+
+func testRenameTag(t *testing.T, todoService services.TodoService) {
+	renamed := createTagged(t, todoService, "renamed", "1", "job", "urgent")
+	merged := createTagged(t, todoService, "merged", "1", "work", "job")
+	untagged := createTagged(t, todoService, "untagged", "1", "home")
+	otherUser := createTagged(t, todoService, "other user", "2", "job")
+
+	n, err := todoService.RenameTag(context.TODO(), "1", "job", "work")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), n)
+
+	// The tag keeps its position, it is dropped where the new tag is already present.
+	tests := []struct {
+		todo    *models.Todo
+		tags    []string
+		version int64
+	}{
+		{renamed, []string{"work", "urgent"}, 2},
+		{merged, []string{"work"}, 2},
+		{untagged, []string{"home"}, 1},
+		{otherUser, []string{"job"}, 1},
+	}
+	for _, tt := range tests {
+		todo, err := todoService.GetTodoById(context.TODO(), tt.todo.Id.Hex())
+		assert.Nil(t, err)
+		assert.Equal(t, tt.tags, todo.Tags, tt.todo.Title)
+		assert.Equal(t, tt.version, todo.Version, tt.todo.Title)
+	}
+
+	n, err = todoService.RenameTag(context.TODO(), "1", "job", "work")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+	n, err = todoService.RenameTag(context.TODO(), "1", "work", "work")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), n)
+}
+
+func checklistIds(todo *models.Todo) []string {
+	var ids []string
+	for _, item := range todo.Checklist {
+		ids = append(ids, item.Id)
+	}
+	return ids
+}
+
+func testChecklist(t *testing.T, todoService services.TodoService) {
+	created := mustCreate(t, todoService, "title", "1")
+	id := created.Id.Hex()
+	assert.Nil(t, created.Checklist)
+
+	var todo *models.Todo
+	var err error
+	for _, text := range []string{"first", "second", "third"} {
+		todo, err = todoService.AddChecklistItem(context.TODO(), id, text, 0)
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, int64(4), todo.Version)
+	ids := checklistIds(todo)
+	assert.Len(t, ids, 3)
+	assert.NotEqual(t, ids[0], ids[1])
+
+	todo, err = todoService.ToggleChecklistItem(context.TODO(), id, ids[1], true, 4)
+	assert.Nil(t, err)
+	todo, err = todoService.ReorderChecklist(context.TODO(), id, []string{ids[2], ids[0], ids[1]}, 0)
+	assert.Nil(t, err)
+	want := []models.ChecklistItem{{Id: ids[2], Text: "third"}, {Id: ids[0], Text: "first"}, {Id: ids[1], Text: "second", Done: true}}
+	assert.Equal(t, want, todo.Checklist)
+	done, total := todo.ChecklistProgress()
+	assert.Equal(t, []int{1, 3}, []int{done, total})
+	// Without auto-completion the Todo keeps its own status.
+	assert.False(t, todo.Done)
+
+	stored, err := todoService.GetTodoById(context.TODO(), id)
+	assert.Nil(t, err)
+	assert.Equal(t, todo, stored)
+
+	// Regular updates leave the checklist alone.
+	updated, err := todoService.UpdateTodo(context.TODO(), id, &models.UpdateTodo{Title: utils.Pointer("new title")})
+	assert.Nil(t, err)
+	assert.Equal(t, want, updated.Checklist)
+
+	for _, itemId := range ids {
+		todo, err = todoService.RemoveChecklistItem(context.TODO(), id, itemId, 0)
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, todo.Checklist)
+	assert.Equal(t, int64(10), todo.Version)
+	stored, err = todoService.GetTodoById(context.TODO(), id)
+	assert.Nil(t, err)
+	assert.Equal(t, todo, stored)
+}
+
+func testChecklistErrors(t *testing.T, todoService services.TodoService) {
+	todo := mustCreate(t, todoService, "title", "1")
+	id := todo.Id.Hex()
+	todo, err := todoService.AddChecklistItem(context.TODO(), id, "item", 0)
+	assert.Nil(t, err)
+	itemId := todo.Checklist[0].Id
+	unknownId := primitive.NewObjectID().Hex()
+
+	_, err = todoService.ToggleChecklistItem(context.TODO(), id, unknownId, true, 0)
+	assert.True(t, errors.Is(err, services.ErrChecklistItemNotFound), "ToggleChecklistItem() got %v", err)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	_, err = todoService.RemoveChecklistItem(context.TODO(), id, unknownId, 0)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+
+	for _, itemIds := range [][]string{nil, {itemId, itemId}, {unknownId}} {
+		_, err = todoService.ReorderChecklist(context.TODO(), id, itemIds, 0)
+		assert.True(t, errors.Is(err, services.ErrChecklistOrder), "ReorderChecklist(%v) got %v", itemIds, err)
+		assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+	}
+
+	_, err = todoService.ToggleChecklistItem(context.TODO(), id, itemId, true, 1)
+	assert.Equal(t, services.KindVersionMismatch, services.KindOf(err))
+	_, err = todoService.AddChecklistItem(context.TODO(), primitive.NewObjectID().Hex(), "item", 0)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	_, err = todoService.AddChecklistItem(context.TODO(), "malformed id", "item", 0)
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+
+	for i := 1; i < services.MaxChecklistItems; i++ {
+		if _, err := todoService.AddChecklistItem(context.TODO(), id, fmt.Sprintf("item %d", i), 0); err != nil {
+			t.Fatalf("AddChecklistItem() error = %v", err)
+		}
+	}
+	_, err = todoService.AddChecklistItem(context.TODO(), id, "one too many", 0)
+	assert.True(t, errors.Is(err, services.ErrChecklistFull), "AddChecklistItem() got %v", err)
+
+	// The failed edits changed nothing.
+	todo, err = todoService.GetTodoById(context.TODO(), id)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(services.MaxChecklistItems+1), todo.Version)
+	assert.False(t, todo.Checklist[0].Done)
+}
+
+func testChecklistAutoComplete(t *testing.T, todoService services.TodoService) {
+	id := mustCreate(t, todoService, "title", "1").Id.Hex()
+	todo, err := todoService.AddChecklistItem(context.TODO(), id, "first", 0)
+	assert.Nil(t, err)
+	todo, err = todoService.AddChecklistItem(context.TODO(), id, "second", 0)
+	assert.Nil(t, err)
+	ids := checklistIds(todo)
+
+	todo, err = todoService.ToggleChecklistItem(context.TODO(), id, ids[0], true, 0)
+	assert.Nil(t, err)
+	assert.False(t, todo.Done)
+	todo, err = todoService.ToggleChecklistItem(context.TODO(), id, ids[1], true, 0)
+	assert.Nil(t, err)
+	assert.True(t, todo.Done)
+	stored, err := todoService.GetTodoById(context.TODO(), id)
+	assert.Nil(t, err)
+	assert.Equal(t, todo, stored)
+
+	// A new pending item reopens the Todo, removing it completes the Todo again.
+	todo, err = todoService.AddChecklistItem(context.TODO(), id, "third", 0)
+	assert.Nil(t, err)
+	assert.False(t, todo.Done)
+	todo, err = todoService.RemoveChecklistItem(context.TODO(), id, todo.Checklist[2].Id, 0)
+	assert.Nil(t, err)
+	assert.True(t, todo.Done)
+
+	todo, err = todoService.ToggleChecklistItem(context.TODO(), id, ids[0], false, 0)
+	assert.Nil(t, err)
+	assert.False(t, todo.Done)
+}
+
+// withChecklistItem adds a pending checklist item to the Todo and returns the Todo along with the item id.
+func withChecklistItem(t *testing.T, todoService services.TodoService, todo *models.Todo) (*models.Todo, string) {
+	todo, err := todoService.AddChecklistItem(context.TODO(), todo.Id.Hex(), "item", 0)
+	if err != nil {
+		t.Fatalf("AddChecklistItem() error = %v", err)
+	}
+	return todo, todo.Checklist[len(todo.Checklist)-1].Id
+}
+
+func testChecklistAutoCompleteBlock(t *testing.T, todoService services.TodoService) {
+	parent, itemId := withChecklistItem(t, todoService, mustCreate(t, todoService, "parent", "1"))
+	child := createChild(t, todoService, "child", parent)
+
+	// Checking the last item completes the Todo like an update would, which the open child blocks.
+	_, err := todoService.ToggleChecklistItem(context.TODO(), parent.Id.Hex(), itemId, true, 0)
+	assert.True(t, errors.Is(err, services.ErrOpenChildren), "ToggleChecklistItem() got %v", err)
+	assert.Equal(t, services.KindFailedPrecondition, services.KindOf(err))
+	stored, err := todoService.GetTodoById(context.TODO(), parent.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, parent, stored)
+
+	_, err = todoService.UpdateTodo(context.TODO(), child.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	todo, err := todoService.ToggleChecklistItem(context.TODO(), parent.Id.Hex(), itemId, true, 0)
+	assert.Nil(t, err)
+	assert.True(t, todo.Done)
+}
+
+func testChecklistAutoCompleteCascade(t *testing.T, todoService services.TodoService) {
+	parent, itemId := withChecklistItem(t, todoService, mustCreate(t, todoService, "parent", "1"))
+	child := createChild(t, todoService, "child", parent)
+	grandchild := createChild(t, todoService, "grandchild", child)
+
+	todo, err := todoService.ToggleChecklistItem(context.TODO(), parent.Id.Hex(), itemId, true, 0)
+	assert.Nil(t, err)
+	assert.True(t, todo.Done)
+	for _, descendant := range []*models.Todo{child, grandchild} {
+		stored, err := todoService.GetTodoById(context.TODO(), descendant.Id.Hex())
+		assert.Nil(t, err)
+		assert.True(t, stored.Done, descendant.Title)
+		assert.Equal(t, int64(2), stored.Version, descendant.Title)
+		assert.Equal(t, todo.UpdatedAt, stored.UpdatedAt, descendant.Title)
+	}
+}
+
+func testChecklistAutoCompleteRecurrence(t *testing.T, todoService services.TodoService) {
+	due := time.Date(2030, time.January, 31, 9, 0, 0, 0, time.UTC)
+	first, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "rent", User: "1", DueAt: due, Recurrence: "FREQ=DAILY"})
+	if err != nil {
+		t.Fatalf("CreateTodo() error = %v", err)
+	}
+	first, itemId := withChecklistItem(t, todoService, first)
+
+	// Completing an occurrence through its checklist continues the series.
+	done, err := todoService.ToggleChecklistItem(context.TODO(), first.Id.Hex(), itemId, true, 0)
+	assert.Nil(t, err)
+	assert.True(t, done.Done)
+	if assert.False(t, done.NextOccurrenceId.IsZero()) {
+		next, err := todoService.GetTodoById(context.TODO(), done.NextOccurrenceId.Hex())
+		assert.Nil(t, err)
+		assert.False(t, next.Done)
+		assert.True(t, next.DueAt.Equal(due.AddDate(0, 0, 1)), "due at %v", next.DueAt)
+		assert.Equal(t, []models.ChecklistItem{{Id: itemId, Text: "item"}}, next.Checklist)
+	}
+	stored, err := todoService.GetTodoById(context.TODO(), first.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, done, stored)
+}
+
+func createChild(t *testing.T, todoService services.TodoService, title string, parent *models.Todo) *models.Todo {
+	todo, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: title, User: "1", ParentId: parent.Id.Hex()})
+	if err != nil {
+		t.Fatalf("CreateTodo() error = %v", err)
+	}
+	return todo
+}
+
+func testParents(t *testing.T, todoService services.TodoService) {
+	parent := mustCreate(t, todoService, "parent", "1")
+	child := createChild(t, todoService, "child", parent)
+	assert.Equal(t, parent.Id, child.ParentId)
+	todo, err := todoService.GetTodoById(context.TODO(), child.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, child, todo)
+	assert.True(t, parent.ParentId.IsZero())
+
+	// The parent must exist out of the trash.
+	trashed := mustCreate(t, todoService, "trashed", "1")
+	if err := todoService.DeleteTodo(context.TODO(), trashed.Id.Hex(), 0); err != nil {
+		t.Fatalf("DeleteTodo() error = %v", err)
+	}
+	for _, parentId := range []string{primitive.NewObjectID().Hex(), trashed.Id.Hex()} {
+		_, err = todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "orphan", User: "1", ParentId: parentId})
+		assert.True(t, errors.Is(err, services.ErrParentNotFound), "CreateTodo() got %v", err)
+		assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+		_, err = todoService.UpdateTodo(context.TODO(), child.Id.Hex(), &models.UpdateTodo{ParentId: utils.Pointer(parentId)})
+		assert.True(t, errors.Is(err, services.ErrParentNotFound), "UpdateTodo() got %v", err)
+	}
+	_, err = todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "orphan", User: "1", ParentId: "malformed id"})
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+
+	other := mustCreate(t, todoService, "other parent", "1")
+	updated, err := todoService.UpdateTodo(context.TODO(), child.Id.Hex(), &models.UpdateTodo{ParentId: utils.Pointer(other.Id.Hex())})
+	assert.Nil(t, err)
+	assert.Equal(t, other.Id, updated.ParentId)
+	assert.Equal(t, int64(2), updated.Version)
+
+	// An empty parent Id makes it a top-level Todo.
+	updated, err = todoService.UpdateTodo(context.TODO(), child.Id.Hex(), &models.UpdateTodo{ParentId: utils.Pointer("")})
+	assert.Nil(t, err)
+	assert.True(t, updated.ParentId.IsZero())
+	todo, err = todoService.GetTodoById(context.TODO(), child.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, updated, todo)
+}
+
+func testParentCycles(t *testing.T, todoService services.TodoService) {
+	root := mustCreate(t, todoService, "root", "1")
+	child := createChild(t, todoService, "child", root)
+	grandchild := createChild(t, todoService, "grandchild", child)
+
+	for _, parent := range []*models.Todo{root, child, grandchild} {
+		_, err := todoService.UpdateTodo(context.TODO(), root.Id.Hex(), &models.UpdateTodo{ParentId: utils.Pointer(parent.Id.Hex())})
+		assert.True(t, errors.Is(err, services.ErrParentCycle), "UpdateTodo(%s) got %v", parent.Title, err)
+		assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+	}
+
+	// A trashed ancestor still counts, the cycle would show up once it is restored.
+	if err := todoService.DeleteTodo(context.TODO(), child.Id.Hex(), 0); err != nil {
+		t.Fatalf("DeleteTodo() error = %v", err)
+	}
+	_, err := todoService.UpdateTodo(context.TODO(), root.Id.Hex(), &models.UpdateTodo{ParentId: utils.Pointer(grandchild.Id.Hex())})
+	assert.True(t, errors.Is(err, services.ErrParentCycle), "UpdateTodo() got %v", err)
+
+	// Moving a Todo within its own subtree is fine.
+	updated, err := todoService.UpdateTodo(context.TODO(), grandchild.Id.Hex(), &models.UpdateTodo{ParentId: utils.Pointer(root.Id.Hex())})
+	assert.Nil(t, err)
+	assert.Equal(t, root.Id, updated.ParentId)
+}
+
+func testDeleteTodoTree(t *testing.T, todoService services.TodoService) {
+	root := mustCreate(t, todoService, "root", "1")
+	child := createChild(t, todoService, "child", root)
+	grandchild := createChild(t, todoService, "grandchild", child)
+	sibling := mustCreate(t, todoService, "sibling", "1")
+
+	err := todoService.DeleteTodoTree(context.TODO(), child.Id.Hex(), 2)
+	assert.Equal(t, services.KindVersionMismatch, services.KindOf(err))
+	assert.Nil(t, todoService.DeleteTodoTree(context.TODO(), child.Id.Hex(), 1))
+
+	trashed := trash(t, todoService, "1")
+	assert.ElementsMatch(t, []string{"child", "grandchild"}, []string{trashed[0].Title, trashed[1].Title})
+	assert.Equal(t, trashed[0].DeletedAt, trashed[1].DeletedAt)
+	for _, todo := range trashed {
+		assert.Equal(t, int64(2), todo.Version)
+	}
+	for _, todo := range []*models.Todo{root, sibling} {
+		_, err := todoService.GetTodoById(context.TODO(), todo.Id.Hex())
+		assert.Nil(t, err)
+	}
+
+	// A plain delete leaves the descendants out of the trash, and out of the subtree of the former ancestors.
+	restored, err := todoService.RestoreTodo(context.TODO(), grandchild.Id.Hex(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, child.Id, restored.ParentId)
+	assert.Nil(t, todoService.DeleteTodo(context.TODO(), root.Id.Hex(), 0))
+	_, err = todoService.GetTodoById(context.TODO(), grandchild.Id.Hex())
+	assert.Nil(t, err)
+	err = todoService.DeleteTodoTree(context.TODO(), root.Id.Hex(), 0)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+}
+
+func testCompletionIgnore(t *testing.T, todoService services.TodoService) {
+	parent := mustCreate(t, todoService, "parent", "1")
+	child := createChild(t, todoService, "child", parent)
+
+	_, err := todoService.UpdateTodo(context.TODO(), parent.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	todo, err := todoService.GetTodoById(context.TODO(), child.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, child, todo)
+}
+
+func testCompletionBlock(t *testing.T, todoService services.TodoService) {
+	parent := mustCreate(t, todoService, "parent", "1")
+	child := createChild(t, todoService, "child", parent)
+	grandchild := createChild(t, todoService, "grandchild", child)
+
+	for _, todo := range []*models.Todo{parent, child} {
+		_, err := todoService.UpdateTodo(context.TODO(), todo.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+		assert.True(t, errors.Is(err, services.ErrOpenChildren), "UpdateTodo(%s) got %v", todo.Title, err)
+		assert.Equal(t, services.KindFailedPrecondition, services.KindOf(err))
+	}
+	results, err := todoService.BatchUpdateTodos(context.TODO(), []*models.BatchUpdateItem{
+		{Id: parent.Id.Hex(), Update: &models.UpdateTodo{Done: utils.BoolPointer(true)}},
+	}, false)
+	assert.Nil(t, err)
+	assert.Equal(t, services.KindFailedPrecondition, services.KindOf(results[0].Err))
+
+	// Other updates, and reopening, are not blocked.
+	_, err = todoService.UpdateTodo(context.TODO(), parent.Id.Hex(), &models.UpdateTodo{Title: utils.Pointer("new title"), Done: utils.BoolPointer(false)})
+	assert.Nil(t, err)
+
+	// Once the descendants are done, or in the trash, the parent can be.
+	_, err = todoService.UpdateTodo(context.TODO(), grandchild.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	_, err = todoService.UpdateTodo(context.TODO(), child.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	trashedChild := createChild(t, todoService, "trashed child", parent)
+	assert.Nil(t, todoService.DeleteTodo(context.TODO(), trashedChild.Id.Hex(), 0))
+	updated, err := todoService.UpdateTodo(context.TODO(), parent.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	assert.True(t, updated.Done)
+}
+
+func testCompletionCascade(t *testing.T, todoService services.TodoService) {
+	parent := mustCreate(t, todoService, "parent", "1")
+	child := createChild(t, todoService, "child", parent)
+	grandchild := createChild(t, todoService, "grandchild", child)
+	doneChild := createChild(t, todoService, "done child", parent)
+	doneChild, err := todoService.UpdateTodo(context.TODO(), doneChild.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	unrelated := mustCreate(t, todoService, "unrelated", "1")
+
+	updated, err := todoService.UpdateTodo(context.TODO(), parent.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	assert.True(t, updated.Done)
+	for _, todo := range []*models.Todo{child, grandchild} {
+		stored, err := todoService.GetTodoById(context.TODO(), todo.Id.Hex())
+		assert.Nil(t, err)
+		assert.True(t, stored.Done, todo.Title)
+		assert.Equal(t, int64(2), stored.Version, todo.Title)
+		assert.Equal(t, updated.UpdatedAt, stored.UpdatedAt, todo.Title)
+	}
+	for _, todo := range []*models.Todo{doneChild, unrelated} {
+		stored, err := todoService.GetTodoById(context.TODO(), todo.Id.Hex())
+		assert.Nil(t, err)
+		assert.Equal(t, todo, stored)
+	}
+}
+
+// completeOccurrence marks a recurring Todo done and returns it along with its next occurrence, nil when there is
+// none.
+func completeOccurrence(t *testing.T, todoService services.TodoService, todo *models.Todo) (*models.Todo, *models.Todo) {
+	done, err := todoService.UpdateTodo(context.TODO(), todo.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	if err != nil {
+		t.Fatalf("UpdateTodo() error = %v", err)
+	}
+	if done.NextOccurrenceId.IsZero() {
+		return done, nil
+	}
+	next, err := todoService.GetTodoById(context.TODO(), done.NextOccurrenceId.Hex())
+	if err != nil {
+		t.Fatalf("GetTodoById() error = %v", err)
+	}
+	return done, next
+}
+
+func testRecurrence(t *testing.T, todoService services.TodoService) {
+	due := time.Date(2030, time.January, 31, 9, 0, 0, 0, time.UTC)
+	first, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title:      "rent",
+		User:       "1",
+		DueAt:      due,
+		Priority:   pb.Priority_HIGH,
+		Tags:       []string{"home"},
+		Recurrence: "RRULE:FREQ=MONTHLY;BYMONTHDAY=1;COUNT=3",
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, "FREQ=MONTHLY;COUNT=3;BYMONTHDAY=1", first.Recurrence)
+	first, err = todoService.AddChecklistItem(context.TODO(), first.Id.Hex(), "transfer", 0)
+	assert.Nil(t, err)
+	first, err = todoService.ToggleChecklistItem(context.TODO(), first.Id.Hex(), first.Checklist[0].Id, true, 0)
+	assert.Nil(t, err)
+
+	done, second := completeOccurrence(t, todoService, first)
+	assert.True(t, done.Done)
+	assert.Equal(t, first.Version+1, done.Version)
+	if assert.NotNil(t, second) {
+		assert.Equal(t, second.Id, done.NextOccurrenceId)
+		assert.Equal(t, "rent", second.Title)
+		assert.True(t, second.DueAt.Equal(time.Date(2030, time.February, 1, 9, 0, 0, 0, time.UTC)), "due at %v", second.DueAt)
+		assert.Equal(t, "FREQ=MONTHLY;COUNT=2;BYMONTHDAY=1", second.Recurrence)
+		assert.False(t, second.Done)
+		assert.Equal(t, pb.Priority_HIGH, second.Priority)
+		assert.Equal(t, []string{"home"}, second.Tags)
+		assert.Equal(t, []models.ChecklistItem{{Id: first.Checklist[0].Id, Text: "transfer"}}, second.Checklist)
+		assert.Equal(t, int64(1), second.Version)
+		assert.True(t, second.NextOccurrenceId.IsZero())
+	}
+
+	// Reopening and completing the Todo again does not continue the series twice.
+	_, err = todoService.UpdateTodo(context.TODO(), first.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(false)})
+	assert.Nil(t, err)
+	again, _ := completeOccurrence(t, todoService, first)
+	assert.Equal(t, done.NextOccurrenceId, again.NextOccurrenceId)
+
+	_, third := completeOccurrence(t, todoService, second)
+	if assert.NotNil(t, third) {
+		assert.True(t, third.DueAt.Equal(time.Date(2030, time.March, 1, 9, 0, 0, 0, time.UTC)), "due at %v", third.DueAt)
+		assert.Equal(t, "FREQ=MONTHLY;COUNT=1;BYMONTHDAY=1", third.Recurrence)
+		last, next := completeOccurrence(t, todoService, third)
+		assert.Nil(t, next)
+		assert.True(t, last.NextOccurrenceId.IsZero())
+	}
+
+	todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL, User: "1"})
+	assert.Len(t, todos, 3)
+}
+
+func testRecurrenceWithoutDue(t *testing.T, todoService services.TodoService) {
+	created, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "water plants", User: "1", Recurrence: "FREQ=DAILY;INTERVAL=2"})
+	assert.Nil(t, err)
+
+	// The series follows the completion time of the Todos without due time.
+	before := time.Now()
+	_, next := completeOccurrence(t, todoService, created)
+	if assert.NotNil(t, next) {
+		assert.False(t, next.DueAt.Before(before.Add(48*time.Hour-time.Second)), "due at %v", next.DueAt)
+		assert.False(t, next.DueAt.After(time.Now().Add(48*time.Hour)), "due at %v", next.DueAt)
+		assert.Equal(t, "FREQ=DAILY;INTERVAL=2", next.Recurrence)
+	}
+}
+
+func testRecurrenceErrors(t *testing.T, todoService services.TodoService) {
+	for _, rule := range []string{"FREQ=SOMETIMES", "BYDAY=MO", "DTSTART:20300101T090000Z\nRRULE:FREQ=DAILY"} {
+		_, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "title", User: "1", Recurrence: rule})
+		assert.True(t, errors.Is(err, services.ErrInvalidRecurrence), "CreateTodo(%q) got %v", rule, err)
+		assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+	}
+
+	created := mustCreate(t, todoService, "title", "1")
+	_, err := todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{
+		Title:      utils.Pointer("new title"),
+		Recurrence: utils.Pointer("FREQ=DAILY;INTERVAL=x"),
+	})
+	assert.True(t, errors.Is(err, services.ErrInvalidRecurrence), "UpdateTodo() got %v", err)
+	todo, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, created, todo)
+}
+
+func testSkipOccurrence(t *testing.T, todoService services.TodoService) {
+	friday := time.Date(2030, time.January, 4, 18, 0, 0, 0, time.UTC)
+	created, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title:      "standup",
+		User:       "1",
+		DueAt:      friday,
+		Recurrence: "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR;COUNT=2",
+	})
+	assert.Nil(t, err)
+
+	_, err = todoService.SkipOccurrence(context.TODO(), created.Id.Hex(), 2)
+	assert.Equal(t, services.KindVersionMismatch, services.KindOf(err))
+
+	skipped, err := todoService.SkipOccurrence(context.TODO(), created.Id.Hex(), 1)
+	assert.Nil(t, err)
+	assert.Equal(t, created.Id, skipped.Id)
+	assert.True(t, skipped.DueAt.Equal(time.Date(2030, time.January, 7, 18, 0, 0, 0, time.UTC)), "due at %v", skipped.DueAt)
+	assert.Equal(t, "FREQ=WEEKLY;COUNT=1;BYDAY=MO,TU,WE,TH,FR", skipped.Recurrence)
+	assert.Equal(t, int64(2), skipped.Version)
+	assert.False(t, skipped.Done)
+	todo, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, skipped, todo)
+
+	_, err = todoService.SkipOccurrence(context.TODO(), created.Id.Hex(), 0)
+	assert.True(t, errors.Is(err, services.ErrSeriesEnded), "SkipOccurrence() got %v", err)
+	assert.Equal(t, services.KindFailedPrecondition, services.KindOf(err))
+
+	plain := mustCreate(t, todoService, "plain", "1")
+	_, err = todoService.SkipOccurrence(context.TODO(), plain.Id.Hex(), 0)
+	assert.True(t, errors.Is(err, services.ErrNotRecurring), "SkipOccurrence() got %v", err)
+	assert.Equal(t, services.KindFailedPrecondition, services.KindOf(err))
+
+	_, err = todoService.SkipOccurrence(context.TODO(), primitive.NewObjectID().Hex(), 0)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+}
+
+func testEndSeries(t *testing.T, todoService services.TodoService) {
+	created, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title:      "title",
+		User:       "1",
+		DueAt:      time.Date(2030, time.January, 4, 18, 0, 0, 0, time.UTC),
+		Recurrence: "FREQ=DAILY",
+	})
+	assert.Nil(t, err)
+
+	// Clearing the rule along with marking the Todo done ends the series there.
+	updated, err := todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{
+		Done:       utils.BoolPointer(true),
+		Recurrence: utils.Pointer(""),
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, updated.Recurrence)
+	assert.True(t, updated.NextOccurrenceId.IsZero())
+	todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL, User: "1"})
+	assert.Len(t, todos, 1)
+}
+
+func testReminders(t *testing.T, todoService services.TodoService) {
+	at := time.Date(2030, time.January, 4, 9, 0, 0, 0, time.UTC)
+	created, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title:     "title",
+		User:      "1",
+		Reminders: []time.Time{at.Add(time.Hour), at, at.Add(time.Hour).In(time.FixedZone("CET", 3600))},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Reminder{{At: at}, {At: at.Add(time.Hour)}}, created.Reminders)
+	assert.True(t, created.NextReminderAt.Equal(at), "next reminder at %v", created.NextReminderAt)
+	todo, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, created, todo)
+
+	updated, err := todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{
+		Reminders:       []time.Time{at.Add(2 * time.Hour), at.Add(time.Hour)},
+		ExpectedVersion: created.Version,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Reminder{{At: at.Add(time.Hour)}, {At: at.Add(2 * time.Hour)}}, updated.Reminders)
+	assert.True(t, updated.NextReminderAt.Equal(at.Add(time.Hour)), "next reminder at %v", updated.NextReminderAt)
+	assert.Equal(t, created.Version+1, updated.Version)
+
+	// Leaving the reminders out of an update keeps them.
+	updated, err = todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{Title: utils.Pointer("new title")})
+	assert.Nil(t, err)
+	assert.Len(t, updated.Reminders, 2)
+
+	updated, err = todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{Reminders: []time.Time{}})
+	assert.Nil(t, err)
+	assert.Nil(t, updated.Reminders)
+	assert.True(t, updated.NextReminderAt.IsZero())
+	todo, err = todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, updated, todo)
+}
+
+func testRemindersErrors(t *testing.T, todoService services.TodoService) {
+	at := time.Date(2030, time.January, 4, 9, 0, 0, 0, time.UTC)
+	tooMany := make([]time.Time, services.MaxReminders+1)
+	for i := range tooMany {
+		tooMany[i] = at.Add(time.Duration(i) * time.Minute)
+	}
+	_, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "title", User: "1", Reminders: tooMany})
+	assert.True(t, errors.Is(err, services.ErrTooManyReminders), "CreateTodo() got %v", err)
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+
+	// Repeated reminders only count once.
+	_, err = todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "title", User: "1", Reminders: append(tooMany[1:], at.Add(time.Minute))})
+	assert.Nil(t, err)
+
+	created := mustCreate(t, todoService, "title", "1")
+	_, err = todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{
+		Title:     utils.Pointer("new title"),
+		Reminders: []time.Time{at, {}},
+	})
+	assert.True(t, errors.Is(err, services.ErrInvalidReminder), "UpdateTodo() got %v", err)
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+	todo, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, created, todo)
+}
+
+// claimReminders claims the reminders due at now, for a minute.
+func claimReminders(t *testing.T, todoService services.TodoService, now time.Time) []*models.ReminderClaim {
+	claims, err := todoService.ClaimReminders(context.TODO(), now, time.Minute, 10)
+	if err != nil {
+		t.Fatalf("ClaimReminders() error = %v", err)
+	}
+	return claims
+}
+
+func testClaimReminders(t *testing.T, todoService services.TodoService) {
+	now := time.Date(2030, time.January, 4, 9, 0, 0, 0, time.UTC)
+	first, second, later := now.Add(-2*time.Hour), now.Add(-time.Hour), now.Add(time.Hour)
+	created, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title:     "title",
+		User:      "1",
+		Reminders: []time.Time{first, second, later},
+	})
+	assert.Nil(t, err)
+	// The reminders of the Todos done or in the trash are not delivered.
+	done, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "done", User: "1", Reminders: []time.Time{first}})
+	assert.Nil(t, err)
+	_, err = todoService.UpdateTodo(context.TODO(), done.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	trashed, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "trashed", User: "1", Reminders: []time.Time{first}})
+	assert.Nil(t, err)
+	assert.Nil(t, todoService.DeleteTodo(context.TODO(), trashed.Id.Hex(), 0))
+	_, err = todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "later", User: "1", Reminders: []time.Time{later}})
+	assert.Nil(t, err)
+
+	claims := claimReminders(t, todoService, now)
+	if !assert.Len(t, claims, 1) {
+		return
+	}
+	claim := claims[0]
+	assert.Equal(t, created.Id, claim.Todo.Id)
+	assert.Equal(t, []time.Time{first, second}, claim.Due)
+	assert.NotEmpty(t, claim.Id)
+	// A claimed Todo is not claimed again until its lease is over.
+	assert.Empty(t, claimReminders(t, todoService, now))
+
+	// The reminders not sent are kept claimed, and claimed again once the lease is over.
+	assert.Nil(t, todoService.CompleteReminders(context.TODO(), claim, []time.Time{first}))
+	assert.Empty(t, claimReminders(t, todoService, now.Add(30*time.Second)))
+	todo, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.False(t, todo.Reminders[0].SentAt.IsZero())
+	assert.True(t, todo.Reminders[1].SentAt.IsZero())
+	assert.True(t, todo.NextReminderAt.Equal(second), "next reminder at %v", todo.NextReminderAt)
+	assert.Equal(t, created.Version, todo.Version)
+
+	expired := now.Add(2 * time.Minute)
+	claims = claimReminders(t, todoService, expired)
+	if !assert.Len(t, claims, 1) {
+		return
+	}
+	assert.Equal(t, []time.Time{second}, claims[0].Due)
+	assert.NotEqual(t, claim.Id, claims[0].Id)
+
+	// The claim that expired is lost.
+	assert.Nil(t, todoService.CompleteReminders(context.TODO(), claim, []time.Time{second}))
+	todo, err = todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.True(t, todo.Reminders[1].SentAt.IsZero())
+
+	assert.Nil(t, todoService.CompleteReminders(context.TODO(), claims[0], []time.Time{second}))
+	todo, err = todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.False(t, todo.Reminders[1].SentAt.IsZero())
+	assert.True(t, todo.NextReminderAt.Equal(later), "next reminder at %v", todo.NextReminderAt)
+	assert.Equal(t, created.Version, todo.Version)
+	assert.Empty(t, claimReminders(t, todoService, expired))
+
+	// The reminders kept by an update stay sent.
+	updated, err := todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{Reminders: []time.Time{first, now}})
+	assert.Nil(t, err)
+	if assert.Len(t, updated.Reminders, 2) {
+		assert.Equal(t, todo.Reminders[0], updated.Reminders[0])
+		assert.Equal(t, models.Reminder{At: now}, updated.Reminders[1])
+	}
+	claims = claimReminders(t, todoService, expired)
+	if assert.Len(t, claims, 1) {
+		assert.Equal(t, []time.Time{now}, claims[0].Due)
+	}
+}
+
+func testRecurringReminders(t *testing.T, todoService services.TodoService) {
+	due := time.Date(2030, time.January, 4, 18, 0, 0, 0, time.UTC)
+	created, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title:      "standup",
+		User:       "1",
+		DueAt:      due,
+		Recurrence: "FREQ=DAILY",
+		Reminders:  []time.Time{due.Add(-time.Hour), due.Add(-10 * time.Minute)},
+	})
+	assert.Nil(t, err)
+	claims := claimReminders(t, todoService, due)
+	if assert.Len(t, claims, 1) {
+		assert.Nil(t, todoService.CompleteReminders(context.TODO(), claims[0], claims[0].Due))
+	}
+
+	// The reminders move along with the due time, none of them sent.
+	skipped, err := todoService.SkipOccurrence(context.TODO(), created.Id.Hex(), 0)
+	assert.Nil(t, err)
+	nextDue := due.Add(24 * time.Hour)
+	assert.Equal(t, []models.Reminder{{At: nextDue.Add(-time.Hour)}, {At: nextDue.Add(-10 * time.Minute)}}, skipped.Reminders)
+	assert.True(t, skipped.NextReminderAt.Equal(nextDue.Add(-time.Hour)), "next reminder at %v", skipped.NextReminderAt)
+
+	done, next := completeOccurrence(t, todoService, skipped)
+	assert.Equal(t, skipped.Reminders, done.Reminders)
+	if assert.NotNil(t, next) {
+		nextDue = nextDue.Add(24 * time.Hour)
+		assert.Equal(t, []models.Reminder{{At: nextDue.Add(-time.Hour)}, {At: nextDue.Add(-10 * time.Minute)}}, next.Reminders)
+		claims = claimReminders(t, todoService, nextDue)
+		if assert.Len(t, claims, 1) {
+			assert.Equal(t, next.Id, claims[0].Todo.Id)
+		}
+	}
+}
+
+// recordingNotifier records the reminders it delivers. It fails the first delivery of the Todos in failOnce.
+type recordingNotifier struct {
+	mu        sync.Mutex
+	delivered map[string]int
+	failOnce  map[primitive.ObjectID]bool
+}
+
+func (n *recordingNotifier) Notify(_ context.Context, reminder *notify.Reminder) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.failOnce[reminder.Todo.Id] {
+		delete(n.failOnce, reminder.Todo.Id)
+		return errors.New("delivery failed")
+	}
+	n.delivered[reminder.Todo.Id.Hex()+" "+reminder.At.Format(time.RFC3339)]++
+	return nil
+}
+
+func (n *recordingNotifier) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.delivered)
+}
+
+func testReminderScheduler(t *testing.T, todoService services.TodoService) {
+	past := time.Now().UTC().Truncate(time.Second).Add(-time.Minute)
+	notifier := &recordingNotifier{delivered: map[string]int{}, failOnce: map[primitive.ObjectID]bool{}}
+	var want []string
+	for i := 0; i < 20; i++ {
+		todo, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+			Title:     fmt.Sprintf("todo %d", i),
+			User:      "1",
+			Reminders: []time.Time{past, past.Add(time.Second)},
+		})
+		assert.Nil(t, err)
+		for _, reminder := range todo.Reminders {
+			want = append(want, todo.Id.Hex()+" "+reminder.At.Format(time.RFC3339))
+		}
+		if i%5 == 0 {
+			notifier.failOnce[todo.Id] = true
+		}
+	}
+
+	// Replicas sharing the storage deliver every reminder once, the failed ones once their lease is over.
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			services.RunReminders(ctx, todoService, notifier, 10*time.Millisecond, 200*time.Millisecond)
+		}()
+	}
+	for deadline := time.Now().Add(5 * time.Second); notifier.count() < len(want) && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	// Long enough for a reminder delivered twice to show up.
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	wg.Wait()
+
+	assert.Len(t, notifier.delivered, len(want))
+	for _, reminder := range want {
+		assert.Equal(t, 1, notifier.delivered[reminder], "deliveries of %s", reminder)
+	}
+	claims, err := todoService.ClaimReminders(context.TODO(), time.Now().Add(time.Hour), time.Minute, 100)
+	assert.Nil(t, err)
+	assert.Empty(t, claims)
+}
+
+func mustCreateList(t *testing.T, todoService services.TodoService, name, user string) *models.List {
+	list, err := todoService.CreateList(context.TODO(), &models.CreateListRequest{Name: name, User: user})
+	if err != nil {
+		t.Fatalf("CreateList() error = %v", err)
+	}
+	return list
+}
+
+func createInList(t *testing.T, todoService services.TodoService, title string, list *models.List) *models.Todo {
+	todo, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: title, User: list.User, ListId: list.Id.Hex()})
+	if err != nil {
+		t.Fatalf("CreateTodo() error = %v", err)
+	}
+	return todo
+}
+
+func testLists(t *testing.T, todoService services.TodoService) {
+	work := mustCreateList(t, todoService, "work", "1")
+	home := mustCreateList(t, todoService, "home", "1")
+	mustCreateList(t, todoService, "other", "2")
+	assert.Equal(t, "work", work.Name)
+	assert.Equal(t, int64(1), work.Version)
+	assert.False(t, work.CreatedAt.IsZero())
+	list, err := todoService.GetList(context.TODO(), work.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, work, list)
+
+	// The Inbox comes first, then the Lists by name.
+	lists, err := todoService.ListLists(context.TODO(), "1")
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.List{{User: "1", Name: services.InboxName}, home, work}, lists)
+	assert.True(t, lists[0].Inbox())
+	lists, err = todoService.ListLists(context.TODO(), "3")
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.List{{User: "3", Name: services.InboxName}}, lists)
+
+	time.Sleep(2 * time.Millisecond)
+	renamed, err := todoService.UpdateList(context.TODO(), work.Id.Hex(), &models.UpdateList{Name: utils.Pointer("job"), ExpectedVersion: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, "job", renamed.Name)
+	assert.Equal(t, int64(2), renamed.Version)
+	assert.True(t, renamed.UpdatedAt.After(work.UpdatedAt))
+	assert.Equal(t, work.CreatedAt, renamed.CreatedAt)
+	list, err = todoService.GetList(context.TODO(), work.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, renamed, list)
+	unchanged, err := todoService.UpdateList(context.TODO(), work.Id.Hex(), &models.UpdateList{})
+	assert.Nil(t, err)
+	assert.Equal(t, renamed, unchanged)
+
+	_, err = todoService.UpdateList(context.TODO(), work.Id.Hex(), &models.UpdateList{Name: utils.Pointer("late"), ExpectedVersion: 1})
+	assert.True(t, errors.Is(err, services.ErrListVersionMismatch), "UpdateList() got %v", err)
+	assert.Equal(t, services.KindVersionMismatch, services.KindOf(err))
+	_, err = todoService.UpdateList(context.TODO(), work.Id.Hex(), &models.UpdateList{Name: utils.Pointer(" ")})
+	assert.True(t, errors.Is(err, services.ErrInvalidListName), "UpdateList() got %v", err)
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+	_, err = todoService.CreateList(context.TODO(), &models.CreateListRequest{User: "1"})
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+
+	unknown := primitive.NewObjectID().Hex()
+	_, err = todoService.GetList(context.TODO(), unknown)
+	assert.True(t, errors.Is(err, services.ErrListNotFound), "GetList() got %v", err)
+	var typedErr *services.Error
+	if assert.True(t, errors.As(err, &typedErr)) {
+		assert.Equal(t, services.KindNotFound, typedErr.Kind)
+		assert.Equal(t, unknown, typedErr.Id)
+		assert.Equal(t, services.ListResource, typedErr.Resource)
+	}
+	_, err = todoService.UpdateList(context.TODO(), unknown, &models.UpdateList{Name: utils.Pointer("name")})
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	_, err = todoService.GetList(context.TODO(), "malformed id")
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+}
+
+func testListTodos(t *testing.T, todoService services.TodoService) {
+	work := mustCreateList(t, todoService, "work", "1")
+	home := mustCreateList(t, todoService, "home", "1")
+	otherUser := mustCreateList(t, todoService, "other", "2")
+	report := createInList(t, todoService, "report", work)
+	assert.Equal(t, work.Id, report.ListId)
+	todo, err := todoService.GetTodoById(context.TODO(), report.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, report, todo)
+	inbox := mustCreate(t, todoService, "inbox", "1")
+	assert.True(t, inbox.ListId.IsZero())
+
+	// The List must be one of the user of the Todo.
+	for _, listId := range []string{otherUser.Id.Hex(), primitive.NewObjectID().Hex()} {
+		_, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "misplaced", User: "1", ListId: listId})
+		assert.True(t, errors.Is(err, services.ErrListNotFound), "CreateTodo() got %v", err)
+		assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+		_, err = todoService.UpdateTodo(context.TODO(), inbox.Id.Hex(), &models.UpdateTodo{ListId: utils.Pointer(listId)})
+		assert.True(t, errors.Is(err, services.ErrListNotFound), "UpdateTodo() got %v", err)
+	}
+	_, err = todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "misplaced", User: "1", ListId: "malformed id"})
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+
+	moved, err := todoService.UpdateTodo(context.TODO(), report.Id.Hex(), &models.UpdateTodo{ListId: utils.Pointer(home.Id.Hex())})
+	assert.Nil(t, err)
+	assert.Equal(t, home.Id, moved.ListId)
+	assert.Equal(t, int64(2), moved.Version)
+	moved, err = todoService.UpdateTodo(context.TODO(), report.Id.Hex(), &models.UpdateTodo{ListId: utils.Pointer(""), ExpectedVersion: 2})
+	assert.Nil(t, err)
+	assert.True(t, moved.ListId.IsZero())
+	todo, err = todoService.GetTodoById(context.TODO(), report.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, moved, todo)
+
+	// A Todo given to another user is moved along, it cannot stay in its List.
+	_, err = todoService.UpdateTodo(context.TODO(), report.Id.Hex(), &models.UpdateTodo{User: utils.Pointer("2"), ListId: utils.Pointer(work.Id.Hex())})
+	assert.True(t, errors.Is(err, services.ErrListNotFound), "UpdateTodo() got %v", err)
+	listed := createInList(t, todoService, "listed", work)
+	_, err = todoService.UpdateTodo(context.TODO(), listed.Id.Hex(), &models.UpdateTodo{User: utils.Pointer("2")})
+	assert.True(t, errors.Is(err, services.ErrListNotFound), "UpdateTodo() got %v", err)
+	updated, err := todoService.UpdateTodo(context.TODO(), listed.Id.Hex(), &models.UpdateTodo{User: utils.Pointer("1"), Title: utils.Pointer("kept")})
+	assert.Nil(t, err)
+	assert.Equal(t, work.Id, updated.ListId)
+	updated, err = todoService.UpdateTodo(context.TODO(), listed.Id.Hex(), &models.UpdateTodo{User: utils.Pointer("2"), ListId: utils.Pointer(otherUser.Id.Hex())})
+	assert.Nil(t, err)
+	assert.Equal(t, otherUser.Id, updated.ListId)
+	updated, err = todoService.UpdateTodo(context.TODO(), inbox.Id.Hex(), &models.UpdateTodo{User: utils.Pointer("2")})
+	assert.Nil(t, err)
+	assert.True(t, updated.ListId.IsZero())
+
+	// The batches check the Lists like the single calls.
+	created, err := todoService.BatchCreateTodos(context.TODO(), []*models.CreateTodoRequest{
+		{Title: "batched", User: "1", ListId: work.Id.Hex()},
+		{Title: "misplaced", User: "1", ListId: otherUser.Id.Hex()},
+	}, false)
+	assert.Nil(t, err)
+	assert.Nil(t, created[0].Err)
+	assert.Equal(t, work.Id, created[0].Todo.ListId)
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(created[1].Err))
+	batched, err := todoService.BatchUpdateTodos(context.TODO(), []*models.BatchUpdateItem{
+		{Id: created[0].Todo.Id.Hex(), Update: &models.UpdateTodo{ListId: utils.Pointer(home.Id.Hex())}},
+		{Id: report.Id.Hex(), Update: &models.UpdateTodo{ListId: utils.Pointer(otherUser.Id.Hex())}},
+	}, false)
+	assert.Nil(t, err)
+	assert.Nil(t, batched[0].Err)
+	assert.Equal(t, home.Id, batched[0].Todo.ListId)
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(batched[1].Err))
+
+	// The next occurrence of a recurring Todo stays in its List.
+	recurring, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title: "standup", User: "1", ListId: work.Id.Hex(), DueAt: time.Now().Add(time.Hour), Recurrence: "FREQ=DAILY",
+	})
+	assert.Nil(t, err)
+	_, next := completeOccurrence(t, todoService, recurring)
+	assert.Equal(t, work.Id, next.ListId)
+
+	tests := []struct {
+		name   string
+		listId string
+		want   []string
+	}{
+		{"work", work.Id.Hex(), []string{"standup", "standup"}},
+		{"home", home.Id.Hex(), []string{"batched"}},
+		{"inbox", "", []string{"report"}},
+		{"unknown", primitive.NewObjectID().Hex(), nil},
+	}
+	for _, tt := range tests {
+		todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL, User: "1", ListId: utils.Pointer(tt.listId)})
+		var titles []string
+		for _, todo := range todos {
+			titles = append(titles, todo.Title)
+		}
+		assert.ElementsMatch(t, tt.want, titles, tt.name)
+	}
+	todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL, User: "1"})
+	assert.Len(t, todos, 4)
+	_, _, err = collect(todoService, &models.TodoQuery{ListId: utils.Pointer("malformed id")})
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+}
+
+func testDeleteList(t *testing.T, todoService services.TodoService) {
+	list := mustCreateList(t, todoService, "list", "1")
+	other := mustCreateList(t, todoService, "other", "1")
+	pending := createInList(t, todoService, "pending", list)
+	trashed := createInList(t, todoService, "trashed", list)
+	if err := todoService.DeleteTodo(context.TODO(), trashed.Id.Hex(), 0); err != nil {
+		t.Fatalf("DeleteTodo() error = %v", err)
+	}
+	kept := createInList(t, todoService, "kept", other)
+
+	err := todoService.DeleteList(context.TODO(), list.Id.Hex(), 2, false)
+	assert.True(t, errors.Is(err, services.ErrListVersionMismatch), "DeleteList() got %v", err)
+	assert.Nil(t, todoService.DeleteList(context.TODO(), list.Id.Hex(), 1, false))
+	_, err = todoService.GetList(context.TODO(), list.Id.Hex())
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	err = todoService.DeleteList(context.TODO(), list.Id.Hex(), 0, false)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	lists, err := todoService.ListLists(context.TODO(), "1")
+	assert.Nil(t, err)
+	assert.Len(t, lists, 2)
+
+	// Its Todos are moved to the Inbox, the ones in the trash stay there.
+	todo, err := todoService.GetTodoById(context.TODO(), pending.Id.Hex())
+	assert.Nil(t, err)
+	assert.True(t, todo.ListId.IsZero())
+	assert.Equal(t, int64(2), todo.Version)
+	assert.False(t, todo.Trashed())
+	trashedTodos := trash(t, todoService, "1")
+	if assert.Len(t, trashedTodos, 1) {
+		assert.True(t, trashedTodos[0].ListId.IsZero())
+		assert.Equal(t, int64(3), trashedTodos[0].Version)
+	}
+	todo, err = todoService.GetTodoById(context.TODO(), kept.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, kept, todo)
+}
+
+func testDeleteListCascade(t *testing.T, todoService services.TodoService) {
+	list := mustCreateList(t, todoService, "list", "1")
+	pending := createInList(t, todoService, "pending", list)
+	trashed := createInList(t, todoService, "trashed", list)
+	if err := todoService.DeleteTodo(context.TODO(), trashed.Id.Hex(), 0); err != nil {
+		t.Fatalf("DeleteTodo() error = %v", err)
+	}
+	trashedBefore := trash(t, todoService, "1")[0]
+	kept := mustCreate(t, todoService, "kept", "1")
+
+	time.Sleep(2 * time.Millisecond)
+	assert.Nil(t, todoService.DeleteList(context.TODO(), list.Id.Hex(), 0, true))
+	_, err := todoService.GetTodoById(context.TODO(), pending.Id.Hex())
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	_, err = todoService.GetTodoById(context.TODO(), kept.Id.Hex())
+	assert.Nil(t, err)
+
+	// The Todos already in the trash keep their deletion time.
+	trashedTodos := trash(t, todoService, "1")
+	if assert.Len(t, trashedTodos, 2) {
+		assert.Equal(t, pending.Id, trashedTodos[0].Id)
+		assert.True(t, trashedTodos[0].DeletedAt.After(trashedBefore.DeletedAt))
+		assert.Equal(t, int64(2), trashedTodos[0].Version)
+		assert.Equal(t, trashed.Id, trashedTodos[1].Id)
+		assert.Equal(t, trashedBefore.DeletedAt, trashedTodos[1].DeletedAt)
+		assert.Equal(t, int64(3), trashedTodos[1].Version)
+		for _, todo := range trashedTodos {
+			assert.True(t, todo.ListId.IsZero())
+		}
+	}
+
+	// Restored, they are in the Inbox.
+	restored, err := todoService.RestoreTodo(context.TODO(), pending.Id.Hex(), 0)
+	assert.Nil(t, err)
+	assert.True(t, restored.ListId.IsZero())
+}
+
+// manualOrder returns the titles of the Todos of user in the POSITION order.
+func manualOrder(t *testing.T, todoService services.TodoService, user string) []string {
+	todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL, User: user, SortBy: pb.GetItemsRequest_POSITION})
+	var titles []string
+	for _, todo := range todos {
+		titles = append(titles, todo.Title)
+	}
+	return titles
+}
+
+func mustMove(t *testing.T, todoService services.TodoService, todo *models.Todo, move *models.MoveTodo) *models.Todo {
+	moved, err := todoService.MoveTodo(context.TODO(), todo.Id.Hex(), move)
+	if err != nil {
+		t.Fatalf("MoveTodo() error = %v", err)
+	}
+	return moved
+}
+
+func testMoveTodo(t *testing.T, todoService services.TodoService) {
+	a := mustCreate(t, todoService, "a", "1")
+	b := mustCreate(t, todoService, "b", "1")
+	c := mustCreate(t, todoService, "c", "1")
+	d := mustCreate(t, todoService, "d", "1")
+	mustCreate(t, todoService, "other user", "2")
+	assert.Equal(t, a.Id.Hex(), a.Position)
+	assert.Equal(t, []string{"a", "b", "c", "d"}, manualOrder(t, todoService, "1"))
+
+	time.Sleep(2 * time.Millisecond)
+	moved := mustMove(t, todoService, d, &models.MoveTodo{BeforeId: b.Id.Hex(), ExpectedVersion: 1})
+	assert.Equal(t, int64(2), moved.Version)
+	assert.True(t, moved.UpdatedAt.After(d.UpdatedAt))
+	assert.Equal(t, d.Title, moved.Title)
+	todo, err := todoService.GetTodoById(context.TODO(), d.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, moved, todo)
+	assert.Equal(t, []string{"a", "d", "b", "c"}, manualOrder(t, todoService, "1"))
+	// Only the Todo moved changes.
+	todo, err = todoService.GetTodoById(context.TODO(), b.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, b, todo)
+
+	mustMove(t, todoService, a, &models.MoveTodo{AfterId: c.Id.Hex()})
+	assert.Equal(t, []string{"d", "b", "c", "a"}, manualOrder(t, todoService, "1"))
+	mustMove(t, todoService, c, &models.MoveTodo{BeforeId: d.Id.Hex()})
+	assert.Equal(t, []string{"c", "d", "b", "a"}, manualOrder(t, todoService, "1"))
+	mustMove(t, todoService, d, &models.MoveTodo{AfterId: a.Id.Hex()})
+	assert.Equal(t, []string{"c", "b", "a", "d"}, manualOrder(t, todoService, "1"))
+	// A Todo moved where it already is stays there.
+	mustMove(t, todoService, d, &models.MoveTodo{AfterId: a.Id.Hex()})
+	assert.Equal(t, []string{"c", "b", "a", "d"}, manualOrder(t, todoService, "1"))
+
+	// The Todos created later still go to the end, after the one moved last.
+	mustCreate(t, todoService, "e", "1")
+	assert.Equal(t, []string{"c", "b", "a", "d", "e"}, manualOrder(t, todoService, "1"))
+
+	// There is always room between two Todos.
+	for i := 0; i < 50; i++ {
+		todo := a
+		if i%2 == 1 {
+			todo = c
+		}
+		mustMove(t, todoService, todo, &models.MoveTodo{BeforeId: d.Id.Hex()})
+	}
+	assert.Equal(t, []string{"b", "a", "c", "d", "e"}, manualOrder(t, todoService, "1"))
+
+	// A trashed Todo gets its place back when restored.
+	if err := todoService.DeleteTodo(context.TODO(), a.Id.Hex(), 0); err != nil {
+		t.Fatalf("DeleteTodo() error = %v", err)
+	}
+	mustMove(t, todoService, b, &models.MoveTodo{AfterId: c.Id.Hex()})
+	assert.Equal(t, []string{"c", "b", "d", "e"}, manualOrder(t, todoService, "1"))
+	if _, err := todoService.RestoreTodo(context.TODO(), a.Id.Hex(), 0); err != nil {
+		t.Fatalf("RestoreTodo() error = %v", err)
+	}
+	assert.Equal(t, []string{"a", "c", "b", "d", "e"}, manualOrder(t, todoService, "1"))
+
+	// The next occurrence of a series takes the place of the one done, a Todo moved next to them goes before or
+	// after both.
+	recurring, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title: "standup", User: "1", DueAt: time.Now().Add(time.Hour), Recurrence: "FREQ=DAILY",
+	})
+	assert.Nil(t, err)
+	recurring = mustMove(t, todoService, recurring, &models.MoveTodo{BeforeId: a.Id.Hex()})
+	_, next := completeOccurrence(t, todoService, recurring)
+	assert.Equal(t, recurring.Position, next.Position)
+	assert.Equal(t, []string{"standup", "standup", "a", "c", "b", "d", "e"}, manualOrder(t, todoService, "1"))
+	mustMove(t, todoService, c, &models.MoveTodo{AfterId: recurring.Id.Hex()})
+	assert.Equal(t, []string{"standup", "standup", "c", "a", "b", "d", "e"}, manualOrder(t, todoService, "1"))
+	mustMove(t, todoService, b, &models.MoveTodo{BeforeId: next.Id.Hex()})
+	assert.Equal(t, []string{"b", "standup", "standup", "c", "a", "d", "e"}, manualOrder(t, todoService, "1"))
+}
+
+func testMoveTodoErrors(t *testing.T, todoService services.TodoService) {
+	a := mustCreate(t, todoService, "a", "1")
+	b := mustCreate(t, todoService, "b", "1")
+	other := mustCreate(t, todoService, "other user", "2")
+	trashed := mustCreate(t, todoService, "trashed", "1")
+	if err := todoService.DeleteTodo(context.TODO(), trashed.Id.Hex(), 0); err != nil {
+		t.Fatalf("DeleteTodo() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		id        string
+		move      models.MoveTodo
+		wantKind  services.ErrorKind
+		wantField string
+		wantErr   error
+	}{
+		{"no target", a.Id.Hex(), models.MoveTodo{}, services.KindInvalidArgument, "Before_id", services.ErrInvalidMove},
+		{"two targets", a.Id.Hex(), models.MoveTodo{BeforeId: b.Id.Hex(), AfterId: b.Id.Hex()}, services.KindInvalidArgument, "Before_id", services.ErrInvalidMove},
+		{"malformed target", a.Id.Hex(), models.MoveTodo{AfterId: "malformed id"}, services.KindInvalidArgument, "After_id", services.ErrInvalidId},
+		{"unknown target", a.Id.Hex(), models.MoveTodo{BeforeId: primitive.NewObjectID().Hex()}, services.KindInvalidArgument, "Before_id", services.ErrTodoNotFound},
+		{"trashed target", a.Id.Hex(), models.MoveTodo{AfterId: trashed.Id.Hex()}, services.KindInvalidArgument, "After_id", services.ErrTodoNotFound},
+		{"other user", a.Id.Hex(), models.MoveTodo{AfterId: other.Id.Hex()}, services.KindInvalidArgument, "After_id", services.ErrTodoNotFound},
+		{"itself", a.Id.Hex(), models.MoveTodo{BeforeId: a.Id.Hex()}, services.KindInvalidArgument, "Before_id", services.ErrMoveToSelf},
+		{"stale version", a.Id.Hex(), models.MoveTodo{AfterId: b.Id.Hex(), ExpectedVersion: 2}, services.KindVersionMismatch, "", services.ErrVersionMismatch},
+		{"trashed", trashed.Id.Hex(), models.MoveTodo{AfterId: b.Id.Hex()}, services.KindNotFound, "", services.ErrTodoNotFound},
+		{"unknown", primitive.NewObjectID().Hex(), models.MoveTodo{AfterId: b.Id.Hex()}, services.KindNotFound, "", services.ErrTodoNotFound},
+	}
+	for _, tt := range tests {
+		_, err := todoService.MoveTodo(context.TODO(), tt.id, &tt.move)
+		assert.True(t, errors.Is(err, tt.wantErr), "%s: MoveTodo() got %v", tt.name, err)
+		var typedErr *services.Error
+		if assert.True(t, errors.As(err, &typedErr), tt.name) {
+			assert.Equal(t, tt.wantKind, typedErr.Kind, tt.name)
+			assert.Equal(t, tt.wantField, typedErr.Field, tt.name)
+		}
+	}
+	assert.Equal(t, []string{"a", "b"}, manualOrder(t, todoService, "1"))
+}
+
+// listOrder returns the titles of the Todos of the List in the POSITION order, those of the Inbox of user for the
+// zero Id.
+func listOrder(t *testing.T, todoService services.TodoService, user string, listId primitive.ObjectID) []string {
+	id := ""
+	if !listId.IsZero() {
+		id = listId.Hex()
+	}
+	todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL, User: user, ListId: &id, SortBy: pb.GetItemsRequest_POSITION})
+	var titles []string
+	for _, todo := range todos {
+		titles = append(titles, todo.Title)
+	}
+	return titles
+}
+
+func testMoveTodoLists(t *testing.T, todoService services.TodoService) {
+	work := mustCreateList(t, todoService, "work", "1")
+	home := mustCreateList(t, todoService, "home", "1")
+	w1 := createInList(t, todoService, "w1", work)
+	i1 := mustCreate(t, todoService, "i1", "1")
+	h1 := createInList(t, todoService, "h1", home)
+	w2 := createInList(t, todoService, "w2", work)
+	i2 := mustCreate(t, todoService, "i2", "1")
+	h2 := createInList(t, todoService, "h2", home)
+	w3 := createInList(t, todoService, "w3", work)
+
+	mustMove(t, todoService, w3, &models.MoveTodo{AfterId: w1.Id.Hex()})
+	mustMove(t, todoService, h2, &models.MoveTodo{BeforeId: h1.Id.Hex()})
+	mustMove(t, todoService, i1, &models.MoveTodo{AfterId: i2.Id.Hex()})
+	assert.Equal(t, []string{"w1", "w3", "w2"}, listOrder(t, todoService, "1", work.Id))
+	assert.Equal(t, []string{"h2", "h1"}, listOrder(t, todoService, "1", home.Id))
+	assert.Equal(t, []string{"i2", "i1"}, listOrder(t, todoService, "1", primitive.NilObjectID))
+
+	tests := []struct {
+		name   string
+		todo   *models.Todo
+		target *models.Todo
+	}{
+		{"list to other list", w2, h1},
+		{"list to Inbox", h1, i2},
+		{"Inbox to list", i2, w1},
+	}
+	for _, tt := range tests {
+		_, err := todoService.MoveTodo(context.TODO(), tt.todo.Id.Hex(), &models.MoveTodo{BeforeId: tt.target.Id.Hex()})
+		assert.True(t, errors.Is(err, services.ErrMoveAcrossLists), "%s: MoveTodo() got %v", tt.name, err)
+		var typedErr *services.Error
+		if assert.True(t, errors.As(err, &typedErr), tt.name) {
+			assert.Equal(t, services.KindInvalidArgument, typedErr.Kind, tt.name)
+			assert.Equal(t, "Before_id", typedErr.Field, tt.name)
+		}
+	}
+	assert.Equal(t, []string{"w1", "w3", "w2"}, listOrder(t, todoService, "1", work.Id))
+
+	// Moved to another List first, the Todo can then be placed among its Todos.
+	inbox := ""
+	_, err := todoService.UpdateTodo(context.TODO(), w2.Id.Hex(), &models.UpdateTodo{ListId: &inbox})
+	assert.Nil(t, err)
+	mustMove(t, todoService, w2, &models.MoveTodo{AfterId: i2.Id.Hex()})
+	assert.Equal(t, []string{"i2", "w2", "i1"}, listOrder(t, todoService, "1", primitive.NilObjectID))
+	assert.Equal(t, []string{"w1", "w3"}, listOrder(t, todoService, "1", work.Id))
+}
+
+func testMoveTodoPages(t *testing.T, todoService services.TodoService) {
+	var created []*models.Todo
+	for i := 0; i < 5; i++ {
+		created = append(created, mustCreate(t, todoService, fmt.Sprintf("todo %d", i), "1"))
+	}
+	mustMove(t, todoService, created[4], &models.MoveTodo{BeforeId: created[0].Id.Hex()})
+	mustMove(t, todoService, created[1], &models.MoveTodo{AfterId: created[3].Id.Hex()})
+
+	tests := []struct {
+		descending bool
+		want       []string
+	}{
+		{false, []string{"todo 4", "todo 0", "todo 2", "todo 3", "todo 1"}},
+		{true, []string{"todo 1", "todo 3", "todo 2", "todo 0", "todo 4"}},
+	}
+	for _, tt := range tests {
+		query := &models.TodoQuery{Status: pb.GetItemsRequest_ALL, User: "1", PageSize: 2, SortBy: pb.GetItemsRequest_POSITION, Descending: tt.descending}
+		var titles []string
+		for pages := 0; pages < 4; pages++ {
+			todos, nextPageToken := getAll(t, todoService, query)
+			for _, todo := range todos {
+				titles = append(titles, todo.Title)
+			}
+			if len(nextPageToken) == 0 {
+				break
+			}
+			query.PageToken = nextPageToken
+		}
+		assert.Equal(t, tt.want, titles, "descending %v", tt.descending)
+	}
+}
+
+func mustComment(t *testing.T, todoService services.TodoService, todo *models.Todo, body string) *models.Comment {
+	comment, err := todoService.AddComment(context.TODO(), todo.Id.Hex(), &models.CreateCommentRequest{Author: todo.User, Body: body})
+	if err != nil {
+		t.Fatalf("AddComment() error = %v", err)
+	}
+	return comment
+}
+
+func listComments(t *testing.T, todoService services.TodoService, todo *models.Todo) []*models.Comment {
+	comments, err := todoService.ListComments(context.TODO(), todo.Id.Hex())
+	if err != nil {
+		t.Fatalf("ListComments() error = %v", err)
+	}
+	return comments
+}
+
+func commentCount(t *testing.T, todoService services.TodoService, todo *models.Todo) int64 {
+	stored, err := todoService.GetTodoById(context.TODO(), todo.Id.Hex())
+	if err != nil {
+		t.Fatalf("GetTodoById() error = %v", err)
+	}
+	assert.Equal(t, todo.Version, stored.Version, "comments do not change the version")
+	return stored.CommentCount
+}
+
+func testComments(t *testing.T, todoService services.TodoService) {
+	todo := mustCreate(t, todoService, "todo", "1")
+	other := mustCreate(t, todoService, "other", "1")
+	assert.Equal(t, []*models.Comment{}, listComments(t, todoService, todo))
+
+	first, err := todoService.AddComment(context.TODO(), todo.Id.Hex(), &models.CreateCommentRequest{Author: "2", Body: "**first**\nnote"})
+	assert.Nil(t, err)
+	assert.Equal(t, todo.Id, first.TodoId)
+	assert.Equal(t, "2", first.Author)
+	assert.Equal(t, "**first**\nnote", first.Body)
+	assert.Equal(t, int64(1), first.Version)
+	assert.False(t, first.CreatedAt.IsZero())
+	assert.Equal(t, first.CreatedAt, first.UpdatedAt)
+	time.Sleep(2 * time.Millisecond)
+	second := mustComment(t, todoService, todo, "second")
+	mustComment(t, todoService, other, "elsewhere")
+	assert.Equal(t, []*models.Comment{first, second}, listComments(t, todoService, todo))
+	assert.Equal(t, int64(2), commentCount(t, todoService, todo))
+	assert.Equal(t, int64(1), commentCount(t, todoService, other))
+
+	time.Sleep(2 * time.Millisecond)
+	edited, err := todoService.UpdateComment(context.TODO(), first.Id.Hex(), "edited", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "edited", edited.Body)
+	assert.Equal(t, int64(2), edited.Version)
+	assert.Equal(t, first.CreatedAt, edited.CreatedAt)
+	assert.True(t, edited.UpdatedAt.After(first.UpdatedAt))
+	assert.Equal(t, []*models.Comment{edited, second}, listComments(t, todoService, todo))
+
+	assert.Nil(t, todoService.DeleteComment(context.TODO(), second.Id.Hex(), 1))
+	assert.Equal(t, []*models.Comment{edited}, listComments(t, todoService, todo))
+	assert.Equal(t, int64(1), commentCount(t, todoService, todo))
+	assert.Nil(t, todoService.DeleteComment(context.TODO(), edited.Id.Hex(), 0))
+	assert.Equal(t, []*models.Comment{}, listComments(t, todoService, todo))
+	assert.Equal(t, int64(0), commentCount(t, todoService, todo))
+}
+
+func testCommentErrors(t *testing.T, todoService services.TodoService) {
+	todo := mustCreate(t, todoService, "todo", "1")
+	comment := mustComment(t, todoService, todo, "note")
+
+	_, err := todoService.AddComment(context.TODO(), todo.Id.Hex(), &models.CreateCommentRequest{Author: "1", Body: " \n"})
+	assert.True(t, errors.Is(err, services.ErrEmptyComment), "AddComment() got %v", err)
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+	_, err = todoService.AddComment(context.TODO(), "malformed id", &models.CreateCommentRequest{Author: "1", Body: "note"})
+	var typedErr *services.Error
+	if assert.True(t, errors.As(err, &typedErr)) {
+		assert.Equal(t, services.KindInvalidArgument, typedErr.Kind)
+		assert.Equal(t, "Todo_id", typedErr.Field)
+	}
+	unknownTodo := primitive.NewObjectID().Hex()
+	_, err = todoService.AddComment(context.TODO(), unknownTodo, &models.CreateCommentRequest{Author: "1", Body: "note"})
+	assert.True(t, errors.Is(err, services.ErrTodoNotFound), "AddComment() got %v", err)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	_, err = todoService.ListComments(context.TODO(), unknownTodo)
+	assert.True(t, errors.Is(err, services.ErrTodoNotFound), "ListComments() got %v", err)
+
+	_, err = todoService.UpdateComment(context.TODO(), comment.Id.Hex(), "late", 2)
+	assert.True(t, errors.Is(err, services.ErrCommentVersionMismatch), "UpdateComment() got %v", err)
+	assert.Equal(t, services.KindVersionMismatch, services.KindOf(err))
+	err = todoService.DeleteComment(context.TODO(), comment.Id.Hex(), 2)
+	assert.True(t, errors.Is(err, services.ErrCommentVersionMismatch), "DeleteComment() got %v", err)
+	_, err = todoService.UpdateComment(context.TODO(), comment.Id.Hex(), "", 0)
+	assert.True(t, errors.Is(err, services.ErrEmptyComment), "UpdateComment() got %v", err)
+
+	unknown := primitive.NewObjectID().Hex()
+	_, err = todoService.UpdateComment(context.TODO(), unknown, "note", 0)
+	assert.True(t, errors.Is(err, services.ErrCommentNotFound), "UpdateComment() got %v", err)
+	if assert.True(t, errors.As(err, &typedErr)) {
+		assert.Equal(t, services.KindNotFound, typedErr.Kind)
+		assert.Equal(t, unknown, typedErr.Id)
+		assert.Equal(t, services.CommentResource, typedErr.Resource)
+	}
+	err = todoService.DeleteComment(context.TODO(), unknown, 0)
+	assert.True(t, errors.Is(err, services.ErrCommentNotFound), "DeleteComment() got %v", err)
+	err = todoService.DeleteComment(context.TODO(), "malformed id", 0)
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+
+	assert.Equal(t, []*models.Comment{comment}, listComments(t, todoService, todo))
+	assert.Equal(t, int64(1), commentCount(t, todoService, todo))
+}
+
+func testCommentsOfTrashedTodos(t *testing.T, todoService services.TodoService) {
+	todo := mustCreate(t, todoService, "todo", "1")
+	purged := mustCreate(t, todoService, "purged", "1")
+	comment := mustComment(t, todoService, todo, "note")
+	gone := mustComment(t, todoService, purged, "gone")
+	for _, trashed := range []*models.Todo{todo, purged} {
+		if err := todoService.DeleteTodo(context.TODO(), trashed.Id.Hex(), 0); err != nil {
+			t.Fatalf("DeleteTodo() error = %v", err)
+		}
+	}
+
+	// The Comments of a Todo in the trash are out of reach, but kept.
+	_, err := todoService.AddComment(context.TODO(), todo.Id.Hex(), &models.CreateCommentRequest{Author: "1", Body: "note"})
+	assert.True(t, errors.Is(err, services.ErrTodoNotFound), "AddComment() got %v", err)
+	_, err = todoService.ListComments(context.TODO(), todo.Id.Hex())
+	assert.True(t, errors.Is(err, services.ErrTodoNotFound), "ListComments() got %v", err)
+	_, err = todoService.UpdateComment(context.TODO(), comment.Id.Hex(), "edited", 0)
+	assert.True(t, errors.Is(err, services.ErrCommentNotFound), "UpdateComment() got %v", err)
+	err = todoService.DeleteComment(context.TODO(), comment.Id.Hex(), 0)
+	assert.True(t, errors.Is(err, services.ErrCommentNotFound), "DeleteComment() got %v", err)
+
+	restored, err := todoService.RestoreTodo(context.TODO(), todo.Id.Hex(), 0)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), restored.CommentCount)
+	assert.Equal(t, []*models.Comment{comment}, listComments(t, todoService, todo))
+
+	// Purged, the Todos go with their Comments.
+	if _, err := todoService.PurgeTrash(context.TODO(), time.Now()); err != nil {
+		t.Fatalf("PurgeTrash() error = %v", err)
+	}
+	_, err = todoService.UpdateComment(context.TODO(), gone.Id.Hex(), "edited", 0)
+	assert.True(t, errors.Is(err, services.ErrCommentNotFound), "UpdateComment() got %v", err)
+	if err := todoService.DeleteTodo(context.TODO(), todo.Id.Hex(), 0); err != nil {
+		t.Fatalf("DeleteTodo() error = %v", err)
+	}
+	assert.Nil(t, todoService.PurgeTodo(context.TODO(), todo.Id.Hex(), 0))
+	_, err = todoService.UpdateComment(context.TODO(), comment.Id.Hex(), "edited", 0)
+	assert.True(t, errors.Is(err, services.ErrCommentNotFound), "UpdateComment() got %v", err)
+}
+
+func testVersions(t *testing.T, todoService services.TodoService) {
+	created := mustCreate(t, todoService, "title", "1")
+	assert.Equal(t, int64(1), created.Version)
+	id := created.Id.Hex()
+
+	updated, err := todoService.UpdateTodo(context.TODO(), id, &models.UpdateTodo{Title: utils.Pointer("new title"), ExpectedVersion: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), updated.Version)
+
+	// Writes expecting the previous version are rejected and change nothing.
+	_, err = todoService.UpdateTodo(context.TODO(), id, &models.UpdateTodo{Title: utils.Pointer("stale"), ExpectedVersion: 1})
+	assert.True(t, errors.Is(err, services.ErrVersionMismatch), "UpdateTodo() got %v", err)
+	assert.Equal(t, services.KindVersionMismatch, services.KindOf(err))
+	_, err = todoService.UpdateTodo(context.TODO(), id, &models.UpdateTodo{ExpectedVersion: 1})
+	assert.Equal(t, services.KindVersionMismatch, services.KindOf(err))
+	err = todoService.DeleteTodo(context.TODO(), id, 1)
+	assert.Equal(t, services.KindVersionMismatch, services.KindOf(err))
+
+	todo, err := todoService.GetTodoById(context.TODO(), id)
+	assert.Nil(t, err)
+	assert.Equal(t, updated, todo)
+
+	// An update without expected version always applies.
+	updated, err = todoService.UpdateTodo(context.TODO(), id, &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), updated.Version)
+
+	assert.Nil(t, todoService.DeleteTodo(context.TODO(), id, 3))
+	_, err = todoService.UpdateTodo(context.TODO(), id, &models.UpdateTodo{Title: utils.Pointer("gone"), ExpectedVersion: 3})
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	err = todoService.DeleteTodo(context.TODO(), id, 3)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+}
+
+func testConcurrentVersionedWriters(t *testing.T, todoService services.TodoService) {
+	const writers = 8
+	created := mustCreate(t, todoService, "title", "1")
+
+	var wg sync.WaitGroup
+	results := make(chan error, writers)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			_, err := todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{
+				Title:           utils.Pointer(fmt.Sprint("writer ", w)),
+				ExpectedVersion: created.Version,
+			})
+			results <- err
+		}(w)
+	}
+	wg.Wait()
+	close(results)
+
+	// Every writer read the same version, only one of them can win.
+	applied := 0
+	for err := range results {
+		if err == nil {
+			applied++
+		} else {
+			assert.Equal(t, services.KindVersionMismatch, services.KindOf(err), "UpdateTodo() got %v", err)
+		}
+	}
+	assert.Equal(t, 1, applied)
+
+	todo, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, created.Version+1, todo.Version)
+}
+
+func testIdempotentCreate(t *testing.T, todoService services.TodoService) {
+	request := &models.CreateTodoRequest{Title: "title", Description: "desc", User: "1", RequestId: "req-1"}
+	created, err := todoService.CreateTodo(context.TODO(), request)
+	assert.Nil(t, err)
+
+	replayed, err := todoService.CreateTodo(context.TODO(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, created, replayed)
+
+	// The replay returns the Todo as created, even after it changed.
+	_, err = todoService.UpdateTodo(context.TODO(), created.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	replayed, err = todoService.CreateTodo(context.TODO(), request)
+	assert.Nil(t, err)
+	assert.Equal(t, created, replayed)
+
+	_, err = todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title: "other", Description: "desc", User: "1", RequestId: "req-1",
+	})
+	assert.Equal(t, services.KindConflict, services.KindOf(err))
+	assert.True(t, errors.Is(err, services.ErrRequestIdReused))
+	_, err = todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title: "title", Description: "desc", User: "1", RequestId: "req-1", Reminders: []time.Time{time.Now()},
+	})
+	assert.True(t, errors.Is(err, services.ErrRequestIdReused), "CreateTodo() with other reminders got %v", err)
+	_, err = todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title: "title", Description: "desc", User: "1", RequestId: "req-1", DueAt: time.Now(),
+	})
+	assert.True(t, errors.Is(err, services.ErrRequestIdReused), "CreateTodo() with a due time got %v", err)
+
+	// Request ids are scoped by user.
+	other, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title: "title", Description: "desc", User: "2", RequestId: "req-1",
+	})
+	assert.Nil(t, err)
+	assert.NotEqual(t, created.Id, other.Id)
+
+	todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL})
+	assert.Len(t, todos, 2)
+
+	// A retry is answered once the parent of the Todo is gone.
+	parent := mustCreate(t, todoService, "parent", "3")
+	childRequest := &models.CreateTodoRequest{Title: "child", User: "3", ParentId: parent.Id.Hex(), RequestId: "req-child"}
+	child, err := todoService.CreateTodo(context.TODO(), childRequest)
+	assert.Nil(t, err)
+	assert.Nil(t, todoService.DeleteTodo(context.TODO(), parent.Id.Hex(), 0))
+	replayed, err = todoService.CreateTodo(context.TODO(), childRequest)
+	assert.Nil(t, err)
+	assert.Equal(t, child, replayed)
+
+	// And once its List is deleted.
+	list := mustCreateList(t, todoService, "work", "3")
+	listRequest := &models.CreateTodoRequest{Title: "in list", User: "3", ListId: list.Id.Hex(), RequestId: "req-list"}
+	inList, err := todoService.CreateTodo(context.TODO(), listRequest)
+	assert.Nil(t, err)
+	assert.Nil(t, todoService.DeleteList(context.TODO(), list.Id.Hex(), 0, false))
+	replayed, err = todoService.CreateTodo(context.TODO(), listRequest)
+	assert.Nil(t, err)
+	assert.Equal(t, inList, replayed)
+}
+
+func testIdempotentCreateExpires(t *testing.T, todoService services.TodoService) {
+	request := &models.CreateTodoRequest{Title: "title", Description: "desc", User: "1", RequestId: "req-1"}
+	created, err := todoService.CreateTodo(context.TODO(), request)
+	assert.Nil(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	recreated, err := todoService.CreateTodo(context.TODO(), request)
+	assert.Nil(t, err)
+	assert.NotEqual(t, created.Id, recreated.Id)
+}
+
+func testDelete(t *testing.T, todoService services.TodoService) {
+	created := mustCreate(t, todoService, "title", "1")
+	kept := mustCreate(t, todoService, "kept", "1")
+
+	assert.Nil(t, todoService.DeleteTodo(context.TODO(), created.Id.Hex(), 0))
+
+	_, err := todoService.GetTodoById(context.TODO(), created.Id.Hex())
+	assert.True(t, errors.Is(err, services.ErrTodoNotFound), "got %v", err)
+
+	err = todoService.DeleteTodo(context.TODO(), created.Id.Hex(), 0)
+	assert.True(t, errors.Is(err, services.ErrTodoNotFound), "got %v", err)
+
+	todo, err := todoService.GetTodoById(context.TODO(), kept.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, kept, todo)
+}
+
+// trash returns the Todos in the trash, most recently deleted first.
+func trash(t *testing.T, todoService services.TodoService, user string) []*models.Todo {
+	todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL, User: user, Trashed: true, Descending: true})
+	return todos
+}
+
+func testTrash(t *testing.T, todoService services.TodoService) {
+	a := mustCreate(t, todoService, "a", "1")
+	b := mustCreate(t, todoService, "b", "1")
+	kept := mustCreate(t, todoService, "kept", "1")
+
+	assert.Nil(t, todoService.DeleteTodo(context.TODO(), a.Id.Hex(), 0))
+	time.Sleep(2 * time.Millisecond)
+	assert.Nil(t, todoService.DeleteTodo(context.TODO(), b.Id.Hex(), 0))
+
+	todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL})
+	assert.Equal(t, []*models.Todo{kept}, todos)
+
+	trashed := trash(t, todoService, "1")
+	if assert.Len(t, trashed, 2) {
+		assert.Equal(t, b.Id, trashed[0].Id)
+		assert.Equal(t, a.Id, trashed[1].Id)
+		assert.True(t, trashed[0].Trashed())
+		assert.False(t, trashed[0].DeletedAt.Before(b.CreatedAt))
+	}
+	assert.Len(t, trash(t, todoService, "2"), 0)
+
+	// A trashed Todo is left out of every other method.
+	_, err := todoService.GetTodoById(context.TODO(), a.Id.Hex())
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	_, err = todoService.UpdateTodo(context.TODO(), a.Id.Hex(), &models.UpdateTodo{Title: utils.Pointer("x")})
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	err = todoService.DeleteTodo(context.TODO(), a.Id.Hex(), 0)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+
+	restored, err := todoService.RestoreTodo(context.TODO(), a.Id.Hex(), 0)
+	assert.Nil(t, err)
+	assert.False(t, restored.Trashed())
+	assert.Equal(t, a.Title, restored.Title)
+	todo, err := todoService.GetTodoById(context.TODO(), a.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, restored, todo)
+	assert.Len(t, trash(t, todoService, ""), 1)
+
+	_, err = todoService.RestoreTodo(context.TODO(), a.Id.Hex(), 0)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	_, err = todoService.RestoreTodo(context.TODO(), primitive.NewObjectID().Hex(), 0)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	_, err = todoService.RestoreTodo(context.TODO(), "malformed id", 0)
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+}
+
+func testTrashVersions(t *testing.T, todoService services.TodoService) {
+	todo := mustCreate(t, todoService, "title", "1")
+
+	assert.Nil(t, todoService.DeleteTodo(context.TODO(), todo.Id.Hex(), 1))
+	trashed := trash(t, todoService, "1")
+	assert.Equal(t, int64(2), trashed[0].Version)
+
+	_, err := todoService.RestoreTodo(context.TODO(), todo.Id.Hex(), 1)
+	assert.Equal(t, services.KindVersionMismatch, services.KindOf(err))
+	err = todoService.PurgeTodo(context.TODO(), todo.Id.Hex(), 1)
+	assert.Equal(t, services.KindVersionMismatch, services.KindOf(err))
+
+	restored, err := todoService.RestoreTodo(context.TODO(), todo.Id.Hex(), 2)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), restored.Version)
+}
+
+func testPurge(t *testing.T, todoService services.TodoService) {
+	todo := mustCreate(t, todoService, "title", "1")
+
+	// Only the Todos in the trash can be purged.
+	err := todoService.PurgeTodo(context.TODO(), todo.Id.Hex(), 0)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+
+	assert.Nil(t, todoService.DeleteTodo(context.TODO(), todo.Id.Hex(), 0))
+	assert.Nil(t, todoService.PurgeTodo(context.TODO(), todo.Id.Hex(), 0))
+	assert.Len(t, trash(t, todoService, ""), 0)
+
+	_, err = todoService.RestoreTodo(context.TODO(), todo.Id.Hex(), 0)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+	err = todoService.PurgeTodo(context.TODO(), todo.Id.Hex(), 0)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+}
+
+func testPurgeTrash(t *testing.T, todoService services.TodoService) {
+	old := mustCreate(t, todoService, "old", "1")
+	recent := mustCreate(t, todoService, "recent", "1")
+	kept := mustCreate(t, todoService, "kept", "1")
+
+	assert.Nil(t, todoService.DeleteTodo(context.TODO(), old.Id.Hex(), 0))
+	deletedBefore := trash(t, todoService, "")[0].DeletedAt
+	time.Sleep(2 * time.Millisecond)
+	assert.Nil(t, todoService.DeleteTodo(context.TODO(), recent.Id.Hex(), 0))
+
+	purged, err := todoService.PurgeTrash(context.TODO(), deletedBefore)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	trashed := trash(t, todoService, "")
+	if assert.Len(t, trashed, 1) {
+		assert.Equal(t, recent.Id, trashed[0].Id)
+	}
+	todo, err := todoService.GetTodoById(context.TODO(), kept.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, kept, todo)
+}
+
+func testBatchCreate(t *testing.T, todoService services.TodoService) {
+	replayed, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "a", User: "1", RequestId: "req-a"})
+	assert.Nil(t, err)
+
+	results, err := todoService.BatchCreateTodos(context.TODO(), []*models.CreateTodoRequest{
+		{Title: "a", User: "1", RequestId: "req-a"},
+		{Title: "b", User: "1"},
+		{Title: "other", User: "1", RequestId: "req-a"},
+		{Title: "c", User: "2", RequestId: "req-c"},
+	}, false)
+	assert.Nil(t, err)
+	assert.Len(t, results, 4)
+
+	assert.Nil(t, results[0].Err)
+	assert.Equal(t, replayed, results[0].Todo)
+	for _, i := range []int{1, 3} {
+		assert.Nil(t, results[i].Err)
+		todo, err := todoService.GetTodoById(context.TODO(), results[i].Todo.Id.Hex())
+		assert.Nil(t, err)
+		assert.Equal(t, results[i].Todo, todo)
+	}
+	assert.Nil(t, results[2].Todo)
+	assert.True(t, errors.Is(results[2].Err, services.ErrRequestIdReused), "got %v", results[2].Err)
+
+	todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL})
+	assert.Len(t, todos, 3)
+
+	results, err = todoService.BatchCreateTodos(context.TODO(), nil, false)
+	assert.Nil(t, err)
+	assert.Len(t, results, 0)
+}
+
+func testBatchUpdate(t *testing.T, todoService services.TodoService) {
+	a := mustCreate(t, todoService, "a", "1")
+	b := mustCreate(t, todoService, "b", "1")
+	c := mustCreate(t, todoService, "c", "1")
+	missing := primitive.NewObjectID().Hex()
+
+	results, err := todoService.BatchUpdateTodos(context.TODO(), []*models.BatchUpdateItem{
+		{Id: a.Id.Hex(), Update: &models.UpdateTodo{Done: utils.BoolPointer(true), ExpectedVersion: 1}},
+		{Id: missing, Update: &models.UpdateTodo{Done: utils.BoolPointer(true)}},
+		{Id: b.Id.Hex(), Update: &models.UpdateTodo{Done: utils.BoolPointer(true), ExpectedVersion: 2}},
+		{Id: c.Id.Hex(), Update: &models.UpdateTodo{}},
+		{Id: "malformed id", Update: &models.UpdateTodo{}},
+	}, false)
+	assert.Nil(t, err)
+	assert.Len(t, results, 5)
+
+	assert.Nil(t, results[0].Err)
+	assert.True(t, results[0].Todo.Done)
+	assert.Equal(t, int64(2), results[0].Todo.Version)
+	assert.Equal(t, services.KindNotFound, services.KindOf(results[1].Err))
+	assert.Equal(t, services.KindVersionMismatch, services.KindOf(results[2].Err))
+	assert.Nil(t, results[3].Err)
+	assert.Equal(t, c, results[3].Todo)
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(results[4].Err))
+
+	todo, err := todoService.GetTodoById(context.TODO(), a.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, results[0].Todo, todo)
+	todo, err = todoService.GetTodoById(context.TODO(), b.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, b, todo)
+}
+
+func testBatchDelete(t *testing.T, todoService services.TodoService) {
+	a := mustCreate(t, todoService, "a", "1")
+	b := mustCreate(t, todoService, "b", "1")
+	kept := mustCreate(t, todoService, "kept", "1")
+
+	results, err := todoService.BatchDeleteTodos(context.TODO(), []*models.BatchDeleteItem{
+		{Id: a.Id.Hex()},
+		{Id: b.Id.Hex(), ExpectedVersion: 2},
+		{Id: primitive.NewObjectID().Hex()},
+		{Id: kept.Id.Hex(), ExpectedVersion: 1},
+	}, false)
+	assert.Nil(t, err)
+	assert.Len(t, results, 4)
+	assert.Nil(t, results[0].Err)
+	assert.Equal(t, services.KindVersionMismatch, services.KindOf(results[1].Err))
+	assert.Equal(t, services.KindNotFound, services.KindOf(results[2].Err))
+	assert.Nil(t, results[3].Err)
+
+	todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL})
+	assert.Equal(t, []*models.Todo{b}, todos)
+}
+
+func testBatchAtomic(t *testing.T, todoService services.TodoService) {
+	a := mustCreate(t, todoService, "a", "1")
+	b := mustCreate(t, todoService, "b", "1")
+
+	results, err := todoService.BatchUpdateTodos(context.TODO(), []*models.BatchUpdateItem{
+		{Id: a.Id.Hex(), Update: &models.UpdateTodo{Done: utils.BoolPointer(true)}},
+		{Id: b.Id.Hex(), Update: &models.UpdateTodo{Done: utils.BoolPointer(true), ExpectedVersion: 2}},
+	}, true)
+	if services.KindOf(err) == services.KindUnsupported {
+		t.Skipf("the storage does not support transactions: %v", err)
+	}
+	assert.Nil(t, err)
+	assert.Len(t, results, 2)
+	assert.Equal(t, services.KindAborted, services.KindOf(results[0].Err))
+	assert.True(t, errors.Is(results[0].Err, services.ErrBatchAborted))
+	assert.Equal(t, services.KindVersionMismatch, services.KindOf(results[1].Err))
+
+	results, err = todoService.BatchCreateTodos(context.TODO(), []*models.CreateTodoRequest{
+		{Title: "c", User: "1"},
+		{Title: "d", User: "1", RequestId: "req-d"},
+	}, true)
+	assert.Nil(t, err)
+	assert.Nil(t, results[0].Err)
+	assert.Nil(t, results[1].Err)
+	created := []*models.Todo{results[0].Todo, results[1].Todo}
+
+	results, err = todoService.BatchDeleteTodos(context.TODO(), []*models.BatchDeleteItem{
+		{Id: created[0].Id.Hex()},
+		{Id: a.Id.Hex()},
+		{Id: primitive.NewObjectID().Hex()},
+	}, true)
+	assert.Nil(t, err)
+	assert.Equal(t, services.KindAborted, services.KindOf(results[0].Err))
+	assert.Equal(t, services.KindAborted, services.KindOf(results[1].Err))
+	assert.Equal(t, services.KindNotFound, services.KindOf(results[2].Err))
+
+	// Nothing was written by the failed batches.
+	todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL})
+	assert.ElementsMatch(t, []*models.Todo{a, b, created[0], created[1]}, todos)
+}
+
+func testBatchDuplicateIds(t *testing.T, todoService services.TodoService) {
+	a := mustCreate(t, todoService, "a", "1")
+
+	_, err := todoService.BatchUpdateTodos(context.TODO(), []*models.BatchUpdateItem{
+		{Id: a.Id.Hex(), Update: &models.UpdateTodo{Title: utils.Pointer("b")}},
+		{Id: a.Id.Hex(), Update: &models.UpdateTodo{Title: utils.Pointer("c")}},
+	}, false)
+	assert.True(t, errors.Is(err, services.ErrDuplicateBatchId), "got %v", err)
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+
+	_, err = todoService.BatchDeleteTodos(context.TODO(), []*models.BatchDeleteItem{{Id: a.Id.Hex()}, {Id: a.Id.Hex()}}, true)
+	assert.True(t, errors.Is(err, services.ErrDuplicateBatchId), "got %v", err)
+
+	todo, err := todoService.GetTodoById(context.TODO(), a.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, a, todo)
+}
+
+func testNotFound(t *testing.T, todoService services.TodoService) {
+	mustCreate(t, todoService, "title", "1")
+
+	id := primitive.NewObjectID().Hex()
+	_, err := todoService.GetTodoById(context.TODO(), id)
+	assert.True(t, errors.Is(err, services.ErrTodoNotFound), "GetTodoById(%q) got %v", id, err)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+
+	_, err = todoService.UpdateTodo(context.TODO(), id, &models.UpdateTodo{Title: utils.Pointer("title")})
+	assert.True(t, errors.Is(err, services.ErrTodoNotFound), "UpdateTodo(%q) got %v", id, err)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+
+	err = todoService.DeleteTodo(context.TODO(), id, 0)
+	assert.True(t, errors.Is(err, services.ErrTodoNotFound), "DeleteTodo(%q) got %v", id, err)
+	assert.Equal(t, services.KindNotFound, services.KindOf(err))
+}
+
+func testInvalidId(t *testing.T, todoService services.TodoService) {
+	mustCreate(t, todoService, "title", "1")
+
+	for _, id := range []string{"malformed id", ""} {
+		_, err := todoService.GetTodoById(context.TODO(), id)
+		assert.True(t, errors.Is(err, services.ErrInvalidId), "GetTodoById(%q) got %v", id, err)
+		assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+
+		for _, data := range []*models.UpdateTodo{{Title: utils.Pointer("title")}, {}} {
+			_, err = todoService.UpdateTodo(context.TODO(), id, data)
+			assert.True(t, errors.Is(err, services.ErrInvalidId), "UpdateTodo(%q, %+v) got %v", id, data, err)
+			assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+		}
+
+		err = todoService.DeleteTodo(context.TODO(), id, 0)
+		assert.True(t, errors.Is(err, services.ErrInvalidId), "DeleteTodo(%q) got %v", id, err)
+		assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+	}
+}
+
+func testGetAllFilters(t *testing.T, todoService services.TodoService) {
+	pending1 := mustCreate(t, todoService, "pending 1", "1")
+	done1 := mustCreate(t, todoService, "done 1", "1")
+	pending2 := mustCreate(t, todoService, "pending 2", "2")
+	done2 := mustCreate(t, todoService, "done 2", "2")
+	for _, todo := range []*models.Todo{done1, done2} {
+		updated, err := todoService.UpdateTodo(context.TODO(), todo.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+		if err != nil {
+			t.Fatalf("UpdateTodo() error = %v", err)
+		}
+		*todo = *updated
+	}
+
+	tests := []struct {
+		status pb.GetItemsRequest_TodoStatus
+		user   string
+		want   []*models.Todo
+	}{
+		{pb.GetItemsRequest_ALL, "", []*models.Todo{pending1, done1, pending2, done2}},
+		{pb.GetItemsRequest_DONE, "", []*models.Todo{done1, done2}},
+		{pb.GetItemsRequest_PENDING, "", []*models.Todo{pending1, pending2}},
+		{pb.GetItemsRequest_ALL, "1", []*models.Todo{pending1, done1}},
+		{pb.GetItemsRequest_DONE, "2", []*models.Todo{done2}},
+		{pb.GetItemsRequest_PENDING, "2", []*models.Todo{pending2}},
+		{pb.GetItemsRequest_ALL, "3", []*models.Todo{}},
+	}
+	for _, tt := range tests {
+		todos, _, err := collect(todoService, &models.TodoQuery{Status: tt.status, User: tt.user})
+		assert.Nil(t, err)
+		assert.NotNil(t, todos, "GetAllTodos(%v, %q) must not return a nil slice", tt.status, tt.user)
+		assert.ElementsMatch(t, tt.want, todos, "GetAllTodos(%v, %q)", tt.status, tt.user)
+	}
+}
+
+func testGetAllDueFilters(t *testing.T, todoService services.TodoService) {
+	// A zone far from UTC, so that its current day is often not the UTC one.
+	zone := time.FixedZone("UTC+14", 14*60*60)
+	local := time.Now().In(zone)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, zone)
+	tomorrow := today.AddDate(0, 0, 1)
+
+	create := func(title string, dueAt time.Time) *models.Todo {
+		todo, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: title, User: "1", DueAt: dueAt})
+		if err != nil {
+			t.Fatalf("CreateTodo() error = %v", err)
+		}
+		return todo
+	}
+	yesterday := create("yesterday", today.Add(-time.Hour))
+	doneYesterday := create("done yesterday", today.Add(-2*time.Hour))
+	doneYesterday, err := todoService.UpdateTodo(context.TODO(), doneYesterday.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	if err != nil {
+		t.Fatalf("UpdateTodo() error = %v", err)
+	}
+	startOfDay := create("start of day", today)
+	endOfDay := create("end of day", tomorrow.Add(-time.Millisecond))
+	startOfTomorrow := create("start of tomorrow", tomorrow)
+	create("no due time", time.Time{})
+
+	tests := []struct {
+		name  string
+		query models.TodoQuery
+		want  []*models.Todo
+	}{
+		{"due after", models.TodoQuery{DueAfter: tomorrow}, []*models.Todo{startOfTomorrow}},
+		{"due before", models.TodoQuery{DueBefore: today}, []*models.Todo{yesterday, doneYesterday}},
+		{"due between", models.TodoQuery{DueAfter: today, DueBefore: tomorrow}, []*models.Todo{startOfDay, endOfDay}},
+		{"empty range", models.TodoQuery{DueAfter: tomorrow, DueBefore: today}, []*models.Todo{}},
+		{"overdue", models.TodoQuery{Overdue: true}, []*models.Todo{yesterday, startOfDay}},
+		{"due today", models.TodoQuery{DueToday: zone}, []*models.Todo{startOfDay, endOfDay}},
+		{"overdue today", models.TodoQuery{Overdue: true, DueToday: zone}, []*models.Todo{startOfDay}},
+		{"due today before", models.TodoQuery{DueToday: zone, DueBefore: endOfDay.DueAt}, []*models.Todo{startOfDay}},
+	}
+	for _, tt := range tests {
+		tt.query.Status = pb.GetItemsRequest_ALL
+		todos, _ := getAll(t, todoService, &tt.query)
+		assert.ElementsMatch(t, tt.want, todos, tt.name)
+	}
+
+	// The overdue Todos are pending ones, whatever the status filter.
+	todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_DONE, Overdue: true})
+	assert.Len(t, todos, 0)
+}
+
+// collect returns the Todos of the page matching the query, along with the token of the next page.
+func collect(todoService services.TodoService, query *models.TodoQuery) ([]*models.Todo, string, error) {
+	todos := []*models.Todo{}
+	nextPageToken, err := todoService.GetAllTodos(context.TODO(), query, func(todo *models.Todo) error {
+		todos = append(todos, todo)
+		return nil
+	})
+	return todos, nextPageToken, err
+}
+
+func getAll(t *testing.T, todoService services.TodoService, query *models.TodoQuery) ([]*models.Todo, string) {
+	todos, nextPageToken, err := collect(todoService, query)
+	if err != nil {
+		t.Fatalf("GetAllTodos(%+v) error = %v", query, err)
+	}
+	return todos, nextPageToken
+}
+
+func testGetAllSorting(t *testing.T, todoService services.TodoService) {
+	b := mustCreate(t, todoService, "b", "1")
+	c := mustCreate(t, todoService, "c", "1")
+	a := mustCreate(t, todoService, "a", "1")
+	time.Sleep(5 * time.Millisecond)
+	b, err := todoService.UpdateTodo(context.TODO(), b.Id.Hex(), &models.UpdateTodo{Description: utils.Pointer("updated")})
+	if err != nil {
+		t.Fatalf("UpdateTodo() error = %v", err)
+	}
+
+	tests := []struct {
+		sortBy     pb.GetItemsRequest_SortBy
+		descending bool
+		want       []*models.Todo
+	}{
+		{pb.GetItemsRequest_CREATED_AT, false, []*models.Todo{b, c, a}},
+		{pb.GetItemsRequest_CREATED_AT, true, []*models.Todo{a, c, b}},
+		{pb.GetItemsRequest_TITLE, false, []*models.Todo{a, b, c}},
+		{pb.GetItemsRequest_TITLE, true, []*models.Todo{c, b, a}},
+		{pb.GetItemsRequest_UPDATED_AT, false, []*models.Todo{c, a, b}},
+		{pb.GetItemsRequest_UPDATED_AT, true, []*models.Todo{b, a, c}},
+		{pb.GetItemsRequest_POSITION, false, []*models.Todo{b, c, a}},
+		{pb.GetItemsRequest_POSITION, true, []*models.Todo{a, c, b}},
+	}
+	for _, tt := range tests {
+		query := &models.TodoQuery{Status: pb.GetItemsRequest_ALL, SortBy: tt.sortBy, Descending: tt.descending}
+		todos, _ := getAll(t, todoService, query)
+		assert.Equal(t, tt.want, todos, "sorted by %v, descending %v", tt.sortBy, tt.descending)
+	}
+}
+
+func testGetAllMinPriority(t *testing.T, todoService services.TodoService) {
+	create := func(title string, priority pb.Priority) *models.Todo {
+		todo, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: title, User: "1", Priority: priority})
+		if err != nil {
+			t.Fatalf("CreateTodo() error = %v", err)
+		}
+		return todo
+	}
+	none := create("none", pb.Priority_NONE)
+	low := create("low", pb.Priority_LOW)
+	high := create("high", pb.Priority_HIGH)
+	urgent := create("urgent", pb.Priority_URGENT)
+
+	tests := []struct {
+		minPriority pb.Priority
+		want        []*models.Todo
+	}{
+		{pb.Priority_NONE, []*models.Todo{none, low, high, urgent}},
+		{pb.Priority_LOW, []*models.Todo{low, high, urgent}},
+		{pb.Priority_MEDIUM, []*models.Todo{high, urgent}},
+		{pb.Priority_URGENT, []*models.Todo{urgent}},
+	}
+	for _, tt := range tests {
+		todos, _ := getAll(t, todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL, MinPriority: tt.minPriority})
+		assert.ElementsMatch(t, tt.want, todos, "min priority %v", tt.minPriority)
+	}
+}
+
+func testGetAllTagFilters(t *testing.T, todoService services.TodoService) {
+	work := createTagged(t, todoService, "work", "1", "work")
+	urgentWork := createTagged(t, todoService, "urgent work", "1", "work", "urgent")
+	home := createTagged(t, todoService, "home", "1", "home")
+	untagged := mustCreate(t, todoService, "untagged", "1")
+
+	tests := []struct {
+		name  string
+		query models.TodoQuery
+		want  []*models.Todo
+	}{
+		{"any", models.TodoQuery{TagsAny: []string{"urgent", "home"}}, []*models.Todo{urgentWork, home}},
+		{"all", models.TodoQuery{TagsAll: []string{"work", "urgent"}}, []*models.Todo{urgentWork}},
+		{"all with duplicates", models.TodoQuery{TagsAll: []string{"urgent", "urgent"}}, []*models.Todo{urgentWork}},
+		{"none", models.TodoQuery{TagsNone: []string{"work"}}, []*models.Todo{home, untagged}},
+		{"any and none", models.TodoQuery{TagsAny: []string{"work"}, TagsNone: []string{"urgent"}}, []*models.Todo{work}},
+		{"unknown", models.TodoQuery{TagsAny: []string{"unknown"}}, []*models.Todo{}},
+	}
+	for _, tt := range tests {
+		tt.query.Status = pb.GetItemsRequest_ALL
+		todos, _ := getAll(t, todoService, &tt.query)
+		assert.ElementsMatch(t, tt.want, todos, tt.name)
+	}
+}
+
+func testGetAllSubtree(t *testing.T, todoService services.TodoService) {
+	root := mustCreate(t, todoService, "root", "1")
+	child := createChild(t, todoService, "child", root)
+	grandchild := createChild(t, todoService, "grandchild", child)
+	doneChild := createChild(t, todoService, "done child", root)
+	doneChild, err := todoService.UpdateTodo(context.TODO(), doneChild.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	mustCreate(t, todoService, "unrelated", "1")
+	trashed := createChild(t, todoService, "trashed", root)
+	createChild(t, todoService, "under trashed", trashed)
+	if err := todoService.DeleteTodo(context.TODO(), trashed.Id.Hex(), 0); err != nil {
+		t.Fatalf("DeleteTodo() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query models.TodoQuery
+		want  []*models.Todo
+	}{
+		{"root", models.TodoQuery{Status: pb.GetItemsRequest_ALL, SubtreeOf: root.Id.Hex()}, []*models.Todo{root, child, grandchild, doneChild}},
+		{"child", models.TodoQuery{Status: pb.GetItemsRequest_ALL, SubtreeOf: child.Id.Hex()}, []*models.Todo{child, grandchild}},
+		{"done", models.TodoQuery{Status: pb.GetItemsRequest_DONE, SubtreeOf: root.Id.Hex()}, []*models.Todo{doneChild}},
+		{"trashed", models.TodoQuery{Status: pb.GetItemsRequest_ALL, SubtreeOf: trashed.Id.Hex()}, []*models.Todo{}},
+		{"unknown", models.TodoQuery{Status: pb.GetItemsRequest_ALL, SubtreeOf: primitive.NewObjectID().Hex()}, []*models.Todo{}},
+	}
+	for _, tt := range tests {
+		todos, _ := getAll(t, todoService, &tt.query)
+		assert.ElementsMatch(t, tt.want, todos, tt.name)
+	}
+
+	_, _, err = collect(todoService, &models.TodoQuery{SubtreeOf: "malformed id"})
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+}
+
+func testGetAllPriorityOrder(t *testing.T, todoService services.TodoService) {
+	dueAt := time.Now().Add(time.Hour)
+	create := func(title string, priority pb.Priority, dueAt time.Time) *models.Todo {
+		todo, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: title, User: "1", Priority: priority, DueAt: dueAt})
+		if err != nil {
+			t.Fatalf("CreateTodo() error = %v", err)
+		}
+		return todo
+	}
+	highLater := create("high later", pb.Priority_HIGH, dueAt.Add(time.Hour))
+	none := create("none", pb.Priority_NONE, time.Time{})
+	highNoDue := create("high without due time", pb.Priority_HIGH, time.Time{})
+	urgent := create("urgent", pb.Priority_URGENT, time.Time{})
+	highSoon := create("high soon", pb.Priority_HIGH, dueAt)
+	lowSoon := create("low soon", pb.Priority_LOW, dueAt)
+	want := []*models.Todo{urgent, highSoon, highLater, highNoDue, lowSoon, none}
+
+	for _, descending := range []bool{false, true} {
+		// Every page boundary falls between two Todos, one of which may lack a due time.
+		query := &models.TodoQuery{Status: pb.GetItemsRequest_ALL, SortBy: pb.GetItemsRequest_PRIORITY, Descending: descending, PageSize: 1}
+		var todos []*models.Todo
+		for i := 0; i <= len(want); i++ {
+			page, nextPageToken := getAll(t, todoService, query)
+			todos = append(todos, page...)
+			if len(nextPageToken) == 0 {
+				break
+			}
+			query.PageToken = nextPageToken
+		}
+		if descending {
+			assert.Equal(t, []*models.Todo{none, lowSoon, highNoDue, highLater, highSoon, urgent}, todos)
+		} else {
+			assert.Equal(t, want, todos)
+		}
+	}
+}
+
+func testGetAllDueOrder(t *testing.T, todoService services.TodoService) {
+	dueAt := time.Now().Add(time.Hour)
+	create := func(title string, dueAt time.Time) *models.Todo {
+		todo, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: title, User: "1", DueAt: dueAt})
+		if err != nil {
+			t.Fatalf("CreateTodo() error = %v", err)
+		}
+		return todo
+	}
+	later := create("later", dueAt.Add(time.Hour))
+	noDue := create("without due time", time.Time{})
+	soon := create("soon", dueAt)
+	otherNoDue := create("other without due time", time.Time{})
+	alsoSoon := create("also soon", dueAt)
+	// The Todos due at the same time, or without due time, are ordered by id.
+	want := []*models.Todo{soon, alsoSoon, later, noDue, otherNoDue}
+
+	for _, descending := range []bool{false, true} {
+		// Every page boundary falls between two Todos, one of which may lack a due time.
+		query := &models.TodoQuery{Status: pb.GetItemsRequest_ALL, SortBy: pb.GetItemsRequest_DUE_AT, Descending: descending, PageSize: 2}
+		var todos []*models.Todo
+		for i := 0; i <= len(want); i++ {
+			page, nextPageToken := getAll(t, todoService, query)
+			todos = append(todos, page...)
+			if len(nextPageToken) == 0 {
+				break
+			}
+			query.PageToken = nextPageToken
+		}
+		if descending {
+			assert.Equal(t, []*models.Todo{otherNoDue, noDue, later, alsoSoon, soon}, todos)
+		} else {
+			assert.Equal(t, want, todos)
+		}
+	}
+}
+
+func testGetAllPages(t *testing.T, todoService services.TodoService) {
+	var created []*models.Todo
+	for i := 0; i < 5; i++ {
+		created = append(created, mustCreate(t, todoService, fmt.Sprintf("todo %d", i), "1"))
+	}
+	mustCreate(t, todoService, "other user", "2")
+
+	query := &models.TodoQuery{Status: pb.GetItemsRequest_ALL, User: "1", PageSize: 2}
+	var pages [][]*models.Todo
+	for {
+		todos, nextPageToken := getAll(t, todoService, query)
+		pages = append(pages, todos)
+		if len(nextPageToken) == 0 || len(pages) > 3 {
+			break
+		}
+		query.PageToken = nextPageToken
+	}
+	assert.Equal(t, [][]*models.Todo{created[0:2], created[2:4], created[4:5]}, pages)
+
+	// Writes between two pages must not shift the next page.
+	query = &models.TodoQuery{Status: pb.GetItemsRequest_ALL, User: "1", PageSize: 2, SortBy: pb.GetItemsRequest_TITLE}
+	todos, nextPageToken := getAll(t, todoService, query)
+	assert.Equal(t, created[0:2], todos)
+	if err := todoService.DeleteTodo(context.TODO(), created[0].Id.Hex(), 0); err != nil {
+		t.Fatalf("DeleteTodo() error = %v", err)
+	}
+	mustCreate(t, todoService, "a todo sorted first", "1")
+	query.PageToken = nextPageToken
+	todos, _ = getAll(t, todoService, query)
+	assert.Equal(t, created[2:4], todos)
+
+	// A token is only valid for the order it was created with.
+	query.SortBy = pb.GetItemsRequest_CREATED_AT
+	_, _, err := collect(todoService, query)
+	assert.True(t, errors.Is(err, services.ErrInvalidPageToken), "got %v", err)
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+
+	query.PageToken = "not a token"
+	_, _, err = collect(todoService, query)
+	assert.True(t, errors.Is(err, services.ErrInvalidPageToken), "got %v", err)
+	assert.Equal(t, services.KindInvalidArgument, services.KindOf(err))
+}
+
+func testGetAllStopsEarly(t *testing.T, todoService services.TodoService) {
+	for i := 0; i < 5; i++ {
+		mustCreate(t, todoService, fmt.Sprintf("todo %d", i), "1")
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	_, err := todoService.GetAllTodos(context.TODO(), &models.TodoQuery{Status: pb.GetItemsRequest_ALL}, func(todo *models.Todo) error {
+		calls++
+		if calls == 2 {
+			return stop
+		}
+		return nil
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 2, calls)
+}
+
+func testGetAllCancelled(t *testing.T, todoService services.TodoService) {
+	mustCreate(t, todoService, "title", "1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	calls := 0
+	_, err := todoService.GetAllTodos(ctx, &models.TodoQuery{Status: pb.GetItemsRequest_ALL}, func(todo *models.Todo) error {
+		calls++
+		return nil
+	})
+	assert.NotNil(t, err, "GetAllTodos() with a cancelled context must fail")
+	assert.Equal(t, 0, calls)
+}
+
+func testConcurrentWriters(t *testing.T, todoService services.TodoService) {
+	const writers = 8
+	const todosPerWriter = 10
+	shared := mustCreate(t, todoService, "shared", "shared")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*todosPerWriter*2)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			user := fmt.Sprintf("writer %d", w)
+			for i := 0; i < todosPerWriter; i++ {
+				if _, err := todoService.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: fmt.Sprint(i), User: user}); err != nil {
+					errs <- err
+				}
+				if _, err := todoService.UpdateTodo(context.TODO(), shared.Id.Hex(), &models.UpdateTodo{Title: utils.Pointer(user)}); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("concurrent write failed: %v", err)
+	}
+
+	for w := 0; w < writers; w++ {
+		todos, _, err := collect(todoService, &models.TodoQuery{Status: pb.GetItemsRequest_ALL, User: fmt.Sprintf("writer %d", w)})
+		assert.Nil(t, err)
+		assert.Len(t, todos, todosPerWriter)
+	}
+
+	todo, err := todoService.GetTodoById(context.TODO(), shared.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, "shared", todo.User)
+	assert.Contains(t, todo.Title, "writer ")
+}
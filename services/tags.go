@@ -0,0 +1,69 @@
+package services
+
+import "github.com/todo-project/models"
+
+// normalizeTags drops the repeated tags, keeping the first of each. It returns nil when there are no tags, the
+// way every backend reads back a Todo without tags.
+func normalizeTags(tags []string) []string {
+	var normalized []string
+	seen := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	return normalized
+}
+
+// renameTag returns the tags with from renamed to, nil when from is not one of them. When to is already one of
+// them, from is dropped instead.
+func renameTag(tags []string, from, to string) []string {
+	found, hasTo := false, false
+	for _, tag := range tags {
+		found = found || tag == from
+		hasTo = hasTo || tag == to
+	}
+	if !found || from == to {
+		return nil
+	}
+
+	renamed := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		if tag == from {
+			if hasTo {
+				continue
+			}
+			tag = to
+		}
+		renamed = append(renamed, tag)
+	}
+	return renamed
+}
+
+// matchesTags reports whether the tags of a Todo pass the tag filters of the query.
+func matchesTags(query *models.TodoQuery, tags []string) bool {
+	has := make(map[string]bool, len(tags))
+	for _, tag := range tags {
+		has[tag] = true
+	}
+	for _, tag := range query.TagsAll {
+		if !has[tag] {
+			return false
+		}
+	}
+	for _, tag := range query.TagsNone {
+		if has[tag] {
+			return false
+		}
+	}
+	if len(query.TagsAny) == 0 {
+		return true
+	}
+	for _, tag := range query.TagsAny {
+		if has[tag] {
+			return true
+		}
+	}
+	return false
+}
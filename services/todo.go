@@ -1,14 +1,142 @@
 package services
 
 import (
+	"context"
+	"errors"
+	"time"
+
 	"github.com/todo-project/models"
-	"github.com/todo-project/pb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// ErrTodoNotFound is returned by every TodoService implementation when no Todo matches the given Id.
+var ErrTodoNotFound = errors.New("no Todo document found for given Id")
+
+// now returns the time used for the Todo timestamps. It is truncated to milliseconds, the precision mongo
+// stores, so a Todo reads back the same from every backend.
+var now = func() time.Time {
+	return time.Now().UTC().Truncate(time.Millisecond)
+}
+
+// newTodo returns the Todo to store for a create request, or the error of an invalid recurrence rule or reminder.
+func newTodo(request *models.CreateTodoRequest) (*models.Todo, error) {
+	recurrence, err := normalizeRecurrence(request.Recurrence)
+	if err != nil {
+		return nil, err
+	}
+	reminders, err := normalizeReminders(request.Reminders, nil)
+	if err != nil {
+		return nil, err
+	}
+	createdAt := now()
+	// The backends check the parent and the List before storing the Todo.
+	parentId, _ := parseParentId(request.ParentId)
+	listId, _ := parseListId(request.ListId)
+	id := primitive.NewObjectID()
+	todo := &models.Todo{
+		Id:          id,
+		Title:       request.Title,
+		Description: request.Description,
+		User:        request.User,
+		DueAt:       dueTime(request.DueAt),
+		Priority:    request.Priority,
+		Tags:        normalizeTags(request.Tags),
+		ParentId:    parentId,
+		Recurrence:  recurrence,
+		ListId:      listId,
+		Position:    id.Hex(),
+		CreatedAt:   createdAt,
+		UpdatedAt:   createdAt,
+		Version:     1,
+	}
+	setReminders(todo, reminders)
+	return todo, nil
+}
+
 type TodoService interface {
-	CreateTodo(request *models.CreateTodoRequest) (*models.Todo, error)
-	UpdateTodo(string, *models.UpdateTodo) (*models.Todo, error)
-	GetTodoById(string) (*models.Todo, error)
-	GetAllTodos(status pb.GetItemsRequest_TodoStatus, user string) ([]*models.Todo, error)
-	DeleteTodo(string) error
+	CreateTodo(ctx context.Context, request *models.CreateTodoRequest) (*models.Todo, error)
+	// UpdateTodo applies a partial update. Marking a recurring Todo done creates the next occurrence of its series,
+	// whose Id is then the NextOccurrenceId of the Todo returned. The List of the Todo must be a List of its user,
+	// so a Todo given to another user has to be moved along, to one of the Lists of that user or to the Inbox.
+	UpdateTodo(context.Context, string, *models.UpdateTodo) (*models.Todo, error)
+	GetTodoById(context.Context, string) (*models.Todo, error)
+	// GetAllTodos calls fn for every Todo of the page matching the query, as soon as it is read from the
+	// storage. An error returned by fn stops the iteration and is returned as is. The token of the next page is
+	// returned, it is empty on the last page.
+	GetAllTodos(ctx context.Context, query *models.TodoQuery, fn func(*models.Todo) error) (string, error)
+	// DeleteTodo moves the Todo to the trash, where it is left out of every method but the trash ones until it
+	// is restored or purged. It fails with a KindVersionMismatch error unless the Todo is at expectedVersion, 0
+	// skips the check. Trashing or restoring a Todo increments its version.
+	DeleteTodo(ctx context.Context, id string, expectedVersion int64) error
+	// DeleteTodoTree moves the Todo and its descendants to the trash. Only the Todo is checked against
+	// expectedVersion.
+	DeleteTodoTree(ctx context.Context, id string, expectedVersion int64) error
+	// RestoreTodo takes the Todo out of the trash, it fails with a KindNotFound error when it is not in the trash.
+	RestoreTodo(ctx context.Context, id string, expectedVersion int64) (*models.Todo, error)
+	// PurgeTodo permanently removes a Todo from the trash.
+	PurgeTodo(ctx context.Context, id string, expectedVersion int64) error
+	// PurgeTrash permanently removes the Todos trashed at or before deletedBefore and returns how many there were.
+	PurgeTrash(ctx context.Context, deletedBefore time.Time) (int64, error)
+
+	// ListTags returns the tags of the Todos of user, ordered by tag. The Todos in the trash are not counted.
+	ListTags(ctx context.Context, user string) ([]*models.TagCount, error)
+	// RenameTag renames a tag on every Todo of user, the ones in the trash included, and returns how many Todos
+	// were renamed, none when from is to. A Todo already carrying the new tag keeps it where it was and loses the
+	// old one. Renamed Todos get a new version.
+	RenameTag(ctx context.Context, user, from, to string) (int64, error)
+
+	// The checklist methods edit the checklist of a Todo and return the Todo with its new version. They fail with
+	// a KindVersionMismatch error unless the Todo is at expectedVersion, 0 skips the check, and with a KindNotFound
+	// error for an item that is not in the checklist.
+	AddChecklistItem(ctx context.Context, id, text string, expectedVersion int64) (*models.Todo, error)
+	ToggleChecklistItem(ctx context.Context, id, itemId string, done bool, expectedVersion int64) (*models.Todo, error)
+	// ReorderChecklist puts the items in the order of itemIds, which must hold every item id exactly once.
+	ReorderChecklist(ctx context.Context, id string, itemIds []string, expectedVersion int64) (*models.Todo, error)
+	RemoveChecklistItem(ctx context.Context, id, itemId string, expectedVersion int64) (*models.Todo, error)
+
+	// SkipOccurrence moves a recurring Todo to the next occurrence of its series: its due time and the rule of the
+	// occurrences left change, nothing is created. It fails with a KindFailedPrecondition error for a Todo that is
+	// not the current occurrence of a series, or the last one.
+	SkipOccurrence(ctx context.Context, id string, expectedVersion int64) (*models.Todo, error)
+
+	// MoveTodo places the Todo right before or after another Todo of its List, the Inbox of its user being one, by
+	// changing its Position alone. It fails with a KindInvalidArgument error on the Before_id or After_id field when
+	// that Todo is not one of the List, is in the trash, or is the Todo itself.
+	MoveTodo(ctx context.Context, id string, move *models.MoveTodo) (*models.Todo, error)
+
+	// ClaimReminders claims, for lease, up to limit Todos with reminders due at now and returns them with the
+	// reminders due. A Todo is not claimed again before its lease is over, so that the reminders are delivered by
+	// a single scheduler. Claims do not change the version of the Todos.
+	ClaimReminders(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.ReminderClaim, error)
+	// CompleteReminders marks the reminders of the claim at sent as sent, and releases the claim when they are all
+	// of its reminders. It does nothing once the claim was lost to another scheduler.
+	CompleteReminders(ctx context.Context, claim *models.ReminderClaim, sent []time.Time) error
+
+	// The List methods manage the Lists of Todos. CreateTodo and UpdateTodo fail with a KindInvalidArgument error
+	// on the List_id field for a List that is not one of the user of the Todo.
+	CreateList(ctx context.Context, request *models.CreateListRequest) (*models.List, error)
+	GetList(ctx context.Context, id string) (*models.List, error)
+	UpdateList(ctx context.Context, id string, data *models.UpdateList) (*models.List, error)
+	// DeleteList deletes the List, its Todos are moved to the Inbox. With cascade, those that are out of the trash
+	// are moved to the trash as well. Every Todo moved gets a new version.
+	DeleteList(ctx context.Context, id string, expectedVersion int64, cascade bool) error
+	// ListLists returns the Inbox of user, which is not stored and has the zero Id, followed by the Lists of user
+	// ordered by name.
+	ListLists(ctx context.Context, user string) ([]*models.List, error)
+
+	// The Comment methods manage the Comments on the Todos out of the trash, they fail with a KindNotFound error
+	// for a Todo in the trash. Adding and deleting a Comment changes the CommentCount of its Todo, not its version.
+	// The Comments of a Todo are kept while it is in the trash and deleted with it when it is purged.
+	AddComment(ctx context.Context, todoId string, request *models.CreateCommentRequest) (*models.Comment, error)
+	UpdateComment(ctx context.Context, id, body string, expectedVersion int64) (*models.Comment, error)
+	DeleteComment(ctx context.Context, id string, expectedVersion int64) error
+	// ListComments returns the Comments on the Todo, oldest first.
+	ListComments(ctx context.Context, todoId string) ([]*models.Comment, error)
+
+	// The batch methods return one BatchResult per item, in order. An item failing with an *Error is reported in
+	// its result, any other error fails the whole batch. With atomic either every item is applied or none: the
+	// batch stops at the first failing item and every other item is reported with a KindAborted error.
+	BatchCreateTodos(ctx context.Context, requests []*models.CreateTodoRequest, atomic bool) ([]BatchResult, error)
+	BatchUpdateTodos(ctx context.Context, items []*models.BatchUpdateItem, atomic bool) ([]BatchResult, error)
+	BatchDeleteTodos(ctx context.Context, items []*models.BatchDeleteItem, atomic bool) ([]BatchResult, error)
 }
@@ -0,0 +1,83 @@
+package services_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/todo-project/services"
+	"github.com/todo-project/services/servicetest"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestInMemoryTodoServiceConformance(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T, opts services.Options) services.TodoService {
+		return services.NewInMemoryTodoService(opts)
+	})
+}
+
+func TestSQLiteTodoServiceConformance(t *testing.T) {
+	servicetest.Run(t, func(t *testing.T, opts services.Options) services.TodoService {
+		db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "todo.db")+"?_journal_mode=WAL&_busy_timeout=5000")
+		if err != nil {
+			t.Fatalf("could not open sqlite db: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err := services.MigrateSQLite(context.TODO(), db); err != nil {
+			t.Fatalf("could not migrate sqlite db: %v", err)
+		}
+		return services.NewSQLiteTodoService(db, opts)
+	})
+}
+
+// TestPostgresTodoServiceConformance runs against the disposable database in POSTGRES_TEST_URI.
+func TestPostgresTodoServiceConformance(t *testing.T) {
+	uri := os.Getenv("POSTGRES_TEST_URI")
+	if len(uri) == 0 {
+		t.Skip("POSTGRES_TEST_URI not set")
+	}
+	servicetest.Run(t, func(t *testing.T, opts services.Options) services.TodoService {
+		db, err := sql.Open("postgres", uri)
+		if err != nil {
+			t.Fatalf("could not open postgres db: %v", err)
+		}
+		t.Cleanup(func() { db.Close() })
+		if err := services.MigratePostgres(context.TODO(), db); err != nil {
+			t.Fatalf("could not migrate postgres db: %v", err)
+		}
+		if _, err := db.Exec(`TRUNCATE todos, idempotency_keys, todo_tags, lists, comments`); err != nil {
+			t.Fatalf("could not clean postgres db: %v", err)
+		}
+		return services.NewPostgresTodoService(db, opts)
+	})
+}
+
+// TestMongoTodoServiceConformance runs against the disposable mongodb in MONGODB_TEST_URI.
+func TestMongoTodoServiceConformance(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if len(uri) == 0 {
+		t.Skip("MONGODB_TEST_URI not set")
+	}
+	ctx := context.TODO()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("could not connect to mongodb: %v", err)
+	}
+	defer client.Disconnect(ctx)
+
+	servicetest.Run(t, func(t *testing.T, opts services.Options) services.TodoService {
+		todoCollection := client.Database("todo_conformance").Collection("todos")
+		if err := todoCollection.Database().Drop(ctx); err != nil {
+			t.Fatalf("could not clean mongodb: %v", err)
+		}
+		if err := services.MigrateMongo(ctx, todoCollection); err != nil {
+			t.Fatalf("could not migrate mongodb: %v", err)
+		}
+		return services.NewTodoService(todoCollection, opts)
+	})
+}
@@ -3,6 +3,8 @@ package services
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/todo-project/models"
 	"github.com/todo-project/pb"
@@ -13,115 +15,1684 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
+// illegalOperationCode is the error code of a mongod refusing a transaction because it is not part of a replica set.
+const illegalOperationCode = 20
+
 type TodoServiceImpl struct {
 	todoCollection *mongo.Collection
-	ctx            context.Context
+	opts           Options
+}
+
+// NewTodoService expects a database already prepared with MigrateMongo.
+func NewTodoService(todoCollection *mongo.Collection, opts Options) TodoService {
+	return &TodoServiceImpl{todoCollection, opts}
+}
+
+// idempotencyCollection remembers the request ids of CreateTodo, next to the Todos.
+func (t *TodoServiceImpl) idempotencyCollection() *mongo.Collection {
+	return t.todoCollection.Database().Collection(idempotencyCollectionName)
+}
+
+// listCollection holds the Lists of Todos, next to the Todos.
+func (t *TodoServiceImpl) listCollection() *mongo.Collection {
+	return t.todoCollection.Database().Collection(listsCollectionName)
 }
 
-func NewTodoService(todoCollection *mongo.Collection, ctx context.Context) TodoService {
-	return &TodoServiceImpl{todoCollection, ctx}
+// commentCollection holds the Comments on the Todos, next to the Todos.
+func (t *TodoServiceImpl) commentCollection() *mongo.Collection {
+	return t.todoCollection.Database().Collection(commentsCollectionName)
 }
 
-func (t *TodoServiceImpl) CreateTodo(todo *models.CreateTodoRequest) (*models.Todo, error) {
-	res, err := t.todoCollection.InsertOne(t.ctx, todo)
+func (t *TodoServiceImpl) CreateTodo(ctx context.Context, todo *models.CreateTodoRequest) (*models.Todo, error) {
+	if len(todo.RequestId) != 0 {
+		// A retry is answered without writing anything, even once the parent or the List is gone.
+		if replayed, err := t.findRequest(ctx, todo); err != nil || replayed != nil {
+			return replayed, err
+		}
+	}
+	if err := t.checkNewTodo(ctx, todo); err != nil {
+		return nil, err
+	}
+
+	createdTodo, err := newTodo(todo)
 	if err != nil {
 		return nil, err
 	}
+	if _, err := t.todoCollection.InsertOne(ctx, createdTodo); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, conflict(createdTodo.Id.Hex(), ErrTodoExists)
+		}
+		return nil, err
+	}
+	if len(todo.RequestId) != 0 {
+		return t.rememberRequest(ctx, todo, createdTodo)
+	}
+
+	return createdTodo, nil
+}
+
+// mongoIdempotencyKey is stored in the idempotency collection, its _id makes a request id unique per user.
+type mongoIdempotencyKey struct {
+	Id struct {
+		User      string `bson:"user"`
+		RequestId string `bson:"request_id"`
+	} `bson:"_id"`
+	Fingerprint string       `bson:"fingerprint"`
+	Todo        *models.Todo `bson:"todo"`
+	ExpiresAt   time.Time    `bson:"expires_at"`
+}
+
+// findRequest returns the Todo remembered for the request id, nil when it is unknown or expired.
+func (t *TodoServiceImpl) findRequest(ctx context.Context, request *models.CreateTodoRequest) (*models.Todo, error) {
+	var existing mongoIdempotencyKey
+	query := bson.M{"_id": bson.D{{Key: "user", Value: request.User}, {Key: "request_id", Value: request.RequestId}}}
+	if err := t.idempotencyCollection().FindOne(ctx, query).Decode(&existing); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !existing.ExpiresAt.After(now()) {
+		return nil, nil
+	}
+	return replay(request, existing.Fingerprint, existing.Todo)
+}
 
-	createdTodo := &models.Todo{
-		Id:          res.InsertedID.(primitive.ObjectID),
-		Title:       todo.Title,
-		Description: todo.Description,
-		User:        todo.User,
+// rememberRequest stores the request id of a created Todo. When a concurrent request stored it first, the Todo
+// just created is dropped again and the remembered one is returned instead.
+func (t *TodoServiceImpl) rememberRequest(ctx context.Context, request *models.CreateTodoRequest, createdTodo *models.Todo) (*models.Todo, error) {
+	key := &mongoIdempotencyKey{
+		Fingerprint: requestFingerprint(request),
+		Todo:        createdTodo,
+		ExpiresAt:   createdTodo.CreatedAt.Add(t.opts.idempotencyWindow()),
 	}
+	key.Id.User = request.User
+	key.Id.RequestId = request.RequestId
 
+	todo, err := t.insertIdempotencyKey(ctx, request, key)
+	if err != nil || todo != nil {
+		// The Todo just created is not the one the caller gets back.
+		t.todoCollection.DeleteOne(ctx, bson.M{"_id": createdTodo.Id})
+		return todo, err
+	}
 	return createdTodo, nil
 }
 
-func (t *TodoServiceImpl) UpdateTodo(id string, data *models.UpdateTodo) (*models.Todo, error) {
-	doc, err := utils.ToMongoBson(data)
+// insertIdempotencyKey returns the remembered Todo when the request id is already known, nil once key is stored.
+func (t *TodoServiceImpl) insertIdempotencyKey(ctx context.Context, request *models.CreateTodoRequest, key *mongoIdempotencyKey) (*models.Todo, error) {
+	// The TTL monitor only runs once a minute, an expired key may still be around and is replaced at most once.
+	for attempt := 0; attempt < 2; attempt++ {
+		_, err := t.idempotencyCollection().InsertOne(ctx, key)
+		if err == nil {
+			return nil, nil
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		var existing mongoIdempotencyKey
+		err = t.idempotencyCollection().FindOne(ctx, bson.M{"_id": key.Id}).Decode(&existing)
+		if err == mongo.ErrNoDocuments {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		if existing.ExpiresAt.After(key.Todo.CreatedAt) {
+			return replay(request, existing.Fingerprint, existing.Todo)
+		}
+		_, err = t.idempotencyCollection().DeleteOne(ctx, bson.M{"_id": key.Id, "expires_at": existing.ExpiresAt})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return nil, conflict(key.Todo.Id.Hex(), ErrRequestIdReused)
+}
+
+func (t *TodoServiceImpl) UpdateTodo(ctx context.Context, id string, data *models.UpdateTodo) (*models.Todo, error) {
+	if data.Reminders == nil && data.ListId == nil {
+		return t.updateTodo(ctx, id, data, nil)
+	}
+	// The reminders already sent stay sent, and the new List is checked against the user of the Todo: the Todo is
+	// read, and the update is pinned to the version it was read at. The Todos stored before versions were tracked
+	// have no reminders to keep, nor a List.
+	for {
+		todo, err := t.GetTodoById(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkVersion(todo, data.ExpectedVersion); err != nil {
+			return nil, err
+		}
+		pinned := *data
+		pinned.ExpectedVersion = todo.Version
+		updated, err := t.updateTodo(ctx, id, &pinned, todo)
+		if data.ExpectedVersion != 0 || KindOf(err) != KindVersionMismatch {
+			return updated, err
+		}
+	}
+}
+
+// updateTodo is UpdateTodo, stored is the Todo at the expected version when it was read.
+func (t *TodoServiceImpl) updateTodo(ctx context.Context, id string, data *models.UpdateTodo, stored *models.Todo) (*models.Todo, error) {
+	obId, err := parseId(id)
 	if err != nil {
 		return nil, err
 	}
-
-	obId, _ := primitive.ObjectIDFromHex(id)
-	query := bson.D{{Key: "_id", Value: obId}}
-	update := bson.D{{Key: "$set", Value: doc}}
-	res := t.todoCollection.FindOneAndUpdate(t.ctx, query, update, options.FindOneAndUpdate().SetReturnDocument(1))
+	var previous []models.Reminder
+	if stored != nil {
+		previous = stored.Reminders
+		if movesList(data) {
+			if err := checkUpdatedList(stored, data, t.readList(ctx)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if data.ParentId != nil {
+		if err := t.checkParent(ctx, obId, *data.ParentId); err != nil {
+			return nil, err
+		}
+	}
+	var open []primitive.ObjectID
+	if t.opts.completesDescendants(data) {
+		if open, err = t.descendants(ctx, obId, true); err != nil {
+			return nil, err
+		}
+		if err := t.opts.checkCompletion(id, len(open)); err != nil {
+			return nil, err
+		}
+	}
+	update, err := mongoUpdate(data, previous)
+	if err != nil {
+		return nil, err
+	}
+	if update == nil {
+		todo, err := t.GetTodoById(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkVersion(todo, data.ExpectedVersion); err != nil {
+			return nil, err
+		}
+		return todo, nil
+	}
+	query := bson.D{{Key: "_id", Value: obId}, {Key: "deleted_at", Value: bson.M{"$exists": false}}}
+	if data.ExpectedVersion != 0 {
+		query = append(query, bson.E{Key: "version", Value: data.ExpectedVersion})
+	}
+	keepsList := data.User != nil && data.ListId == nil
+	if keepsList {
+		// A Todo given to another user cannot stay in its List, only one in the Inbox can.
+		query = append(query, bson.E{Key: "$or", Value: bson.A{
+			bson.M{"list_id": bson.M{"$exists": false}},
+			bson.M{"user": *data.User},
+		}})
+	}
+	res := t.todoCollection.FindOneAndUpdate(ctx, query, update, options.FindOneAndUpdate().SetReturnDocument(1))
 
 	var updatedPost *models.Todo
 	if err := res.Decode(&updatedPost); err != nil {
-		return nil, errors.New("no Todo document found for given Id")
+		if err == mongo.ErrNoDocuments {
+			if keepsList {
+				if todo, err := t.GetTodoById(ctx, id); err == nil && checkVersion(todo, data.ExpectedVersion) == nil {
+					if err := checkUpdatedList(todo, data, t.readList(ctx)); err != nil {
+						return nil, err
+					}
+				}
+			}
+			return nil, t.writeMissed(ctx, id, data.ExpectedVersion, false)
+		}
+		return nil, err
+	}
+	if len(open) != 0 {
+		_, err := t.todoCollection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": open}}, bson.D{
+			{Key: "$set", Value: bson.D{{Key: "done", Value: true}, {Key: "updated_at", Value: updatedPost.UpdatedAt}}},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := t.continueSeries(ctx, updatedPost, data); err != nil {
+		return nil, err
 	}
 
 	return updatedPost, nil
 }
 
-func (t *TodoServiceImpl) GetTodoById(id string) (*models.Todo, error) {
-	objectId, _ := primitive.ObjectIDFromHex(id)
+// continueSeries creates the next occurrence of a recurring Todo the update marked done. The Todo is linked to it
+// first, on the condition that it is still done and not linked yet, so that concurrent updates create it once. The
+// link is part of the update, it does not change the version.
+func (t *TodoServiceImpl) continueSeries(ctx context.Context, todo *models.Todo, data *models.UpdateTodo) error {
+	next, err := nextOccurrence(todo, data, todo.UpdatedAt)
+	if err != nil || next == nil {
+		return err
+	}
+	query := bson.D{
+		{Key: "_id", Value: todo.Id},
+		{Key: "done", Value: true},
+		{Key: "recurrence", Value: todo.Recurrence},
+		{Key: "next_occurrence_id", Value: bson.M{"$exists": false}},
+	}
+	res, err := t.todoCollection.UpdateOne(ctx, query, bson.M{"$set": bson.M{"next_occurrence_id": next.Id}})
+	if err != nil || res.MatchedCount == 0 {
+		return err
+	}
+	if _, err := t.todoCollection.InsertOne(ctx, next); err != nil {
+		// Unlinked, marking the Todo done again retries.
+		_, _ = t.todoCollection.UpdateOne(ctx, bson.M{"_id": todo.Id}, bson.M{"$unset": bson.M{"next_occurrence_id": ""}})
+		return err
+	}
+	todo.NextOccurrenceId = next.Id
+	return nil
+}
+
+// mongoUpdate returns the update applying data, nil when data has nothing to update: an empty $set is rejected
+// by mongo. previous are the reminders the update replaces.
+func mongoUpdate(data *models.UpdateTodo, previous []models.Reminder) (bson.D, error) {
+	doc, err := utils.ToMongoBson(data)
+	if err != nil {
+		return nil, err
+	}
+	var set, unset bson.D
+	if doc != nil {
+		set = *doc
+	}
+	if data.DueAt != nil {
+		// The Todos without due time have no due_at, like they had before due times existed.
+		if due := dueTime(*data.DueAt); due.IsZero() {
+			unset = append(unset, bson.E{Key: "due_at", Value: ""})
+		} else {
+			set = append(set, bson.E{Key: "due_at", Value: due})
+		}
+	}
+	if data.Tags != nil {
+		if tags := normalizeTags(data.Tags); len(tags) == 0 {
+			unset = append(unset, bson.E{Key: "tags", Value: ""})
+		} else {
+			set = append(set, bson.E{Key: "tags", Value: tags})
+		}
+	}
+	if data.ParentId != nil {
+		if parentId, err := parseParentId(*data.ParentId); err != nil {
+			return nil, err
+		} else if parentId.IsZero() {
+			unset = append(unset, bson.E{Key: "parent_id", Value: ""})
+		} else {
+			set = append(set, bson.E{Key: "parent_id", Value: parentId})
+		}
+	}
+	if data.Recurrence != nil {
+		if rule, err := normalizeRecurrence(*data.Recurrence); err != nil {
+			return nil, err
+		} else if len(rule) == 0 {
+			unset = append(unset, bson.E{Key: "recurrence", Value: ""})
+		} else {
+			set = append(set, bson.E{Key: "recurrence", Value: rule})
+		}
+	}
+	if data.ListId != nil {
+		if listId, err := parseListId(*data.ListId); err != nil {
+			return nil, err
+		} else if listId.IsZero() {
+			unset = append(unset, bson.E{Key: "list_id", Value: ""})
+		} else {
+			set = append(set, bson.E{Key: "list_id", Value: listId})
+		}
+	}
+	if data.Reminders != nil {
+		reminders, err := normalizeReminders(data.Reminders, previous)
+		if err != nil {
+			return nil, err
+		}
+		var todo models.Todo
+		setReminders(&todo, reminders)
+		set, unset = remindersUpdate(&todo, set, unset)
+	}
+	if len(set) == 0 && len(unset) == 0 {
+		return nil, nil
+	}
+
+	set = append(set, bson.E{Key: "updated_at", Value: now()})
+	update := bson.D{{Key: "$set", Value: set}, {Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}}}
+	if len(unset) != 0 {
+		update = append(update, bson.E{Key: "$unset", Value: unset})
+	}
+	return update, nil
+}
+
+// remindersUpdate appends the reminders of todo to the $set and $unset of an update.
+func remindersUpdate(todo *models.Todo, set, unset bson.D) (bson.D, bson.D) {
+	if len(todo.Reminders) == 0 {
+		unset = append(unset, bson.E{Key: "reminders", Value: ""})
+	} else {
+		set = append(set, bson.E{Key: "reminders", Value: todo.Reminders})
+	}
+	if todo.NextReminderAt.IsZero() {
+		unset = append(unset, bson.E{Key: "next_reminder_at", Value: ""})
+	} else {
+		set = append(set, bson.E{Key: "next_reminder_at", Value: todo.NextReminderAt})
+	}
+	return set, unset
+}
+
+func (t *TodoServiceImpl) GetTodoById(ctx context.Context, id string) (*models.Todo, error) {
+	return t.getTodo(ctx, id, false)
+}
+
+// getTodo reads a Todo that is in the trash or not, as told by trashed.
+func (t *TodoServiceImpl) getTodo(ctx context.Context, id string, trashed bool) (*models.Todo, error) {
+	objectId, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
 
-	query := bson.M{"_id": objectId}
+	query := bson.M{"_id": objectId, "deleted_at": bson.M{"$exists": trashed}}
 
 	var todo *models.Todo
-	if err := t.todoCollection.FindOne(t.ctx, query).Decode(&todo); err != nil {
+	if err := t.todoCollection.FindOne(ctx, query).Decode(&todo); err != nil {
 		if err == mongo.ErrNoDocuments {
-			return nil, errors.New("no Todo document found for given Id")
+			return nil, notFound(id)
 		}
 		return nil, err
 	}
 	return todo, nil
 }
 
-func (t *TodoServiceImpl) GetAllTodos(status pb.GetItemsRequest_TodoStatus, user string) ([]*models.Todo, error) {
+func (t *TodoServiceImpl) GetAllTodos(ctx context.Context, q *models.TodoQuery, fn func(*models.Todo) error) (string, error) {
+	token, err := decodePageToken(q)
+	if err != nil {
+		return "", err
+	}
 
-	query := bson.M{}
-	switch status {
+	// deleted_at is only set on the Todos in the trash
+	query := bson.M{"deleted_at": bson.M{"$exists": q.Trashed}}
+	switch q.Status {
 	case pb.GetItemsRequest_DONE:
 		query["done"] = true
 	case pb.GetItemsRequest_PENDING:
-		query["done"] = false
+		// done is omitted from the document while it is false
+		query["done"] = bson.M{"$ne": true}
 	default:
 		// do nothing, since we need all the Todos
 	}
-	if len(user) != 0 {
-		query["user"] = user
+	if len(q.User) != 0 {
+		query["user"] = q.User
+	}
+	if q.Overdue {
+		// Next to the Status filter, which may also be on done.
+		query["$and"] = bson.A{bson.M{"done": bson.M{"$ne": true}}}
+	}
+	if dueAfter, dueBefore, ok := dueRange(q); ok {
+		due := bson.M{"$exists": true}
+		if !dueAfter.IsZero() {
+			due["$gte"] = dueAfter
+		}
+		if !dueBefore.IsZero() {
+			due["$lt"] = dueBefore
+		}
+		query["due_at"] = due
+	}
+	if q.MinPriority != pb.Priority_NONE {
+		// Todos stored before priorities existed have no priority, $gte leaves them out like NONE.
+		query["priority"] = bson.M{"$gte": q.MinPriority}
+	}
+	if tags := tagsFilter(q); len(tags) != 0 {
+		query["tags"] = tags
+	}
+	if len(q.SubtreeOf) != 0 {
+		root, err := parseSubtreeOf(q.SubtreeOf)
+		if err != nil {
+			return "", err
+		}
+		subtree, err := t.descendants(ctx, root, false)
+		if err != nil {
+			return "", err
+		}
+		// The root itself is matched by the other filters, deleted_at included.
+		query["_id"] = bson.M{"$in": append(subtree, root)}
+	}
+	if q.ListId != nil {
+		listId, err := parseListId(*q.ListId)
+		if err != nil {
+			return "", err
+		}
+		// The Todos of the Inbox have no list_id.
+		if listId.IsZero() {
+			query["list_id"] = bson.M{"$exists": false}
+		} else {
+			query["list_id"] = listId
+		}
 	}
 
-	cursor, err := t.todoCollection.Find(t.ctx, query)
+	keys := mongoSortKeys(q, token)
+	sort := bson.D{}
+	for _, key := range keys {
+		direction := 1
+		if key.descending {
+			direction = -1
+		}
+		sort = append(sort, bson.E{Key: key.field, Value: direction})
+	}
+	page := newPageWriter(q, fn)
+
+	var cursor *mongo.Cursor
+	if key := sortKey(q); key == pb.GetItemsRequest_PRIORITY || key == pb.GetItemsRequest_DUE_AT {
+		// The priority and due time may be missing, their sort keys are computed with an aggregation.
+		pipeline := mongo.Pipeline{
+			{{Key: "$match", Value: query}},
+			{{Key: "$addFields", Value: bson.D{
+				{Key: "sort_priority", Value: bson.M{"$ifNull": bson.A{"$priority", pb.Priority_NONE}}},
+				{Key: "sort_due", Value: bson.M{"$ifNull": bson.A{"$due_at", noDueSortTime}}},
+			}}},
+		}
+		if token != nil {
+			pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.M{"$or": keysetFilter(keys)}}})
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$sort", Value: sort}})
+		if limit := page.limit(); limit != 0 {
+			pipeline = append(pipeline, bson.D{{Key: "$limit", Value: limit}})
+		}
+		pipeline = append(pipeline, bson.D{{Key: "$project", Value: bson.D{{Key: "sort_priority", Value: 0}, {Key: "sort_due", Value: 0}}}})
+		cursor, err = t.todoCollection.Aggregate(ctx, pipeline)
+	} else {
+		if token != nil {
+			query["$or"] = keysetFilter(keys)
+		}
+		opts := options.Find().SetSort(sort)
+		if limit := page.limit(); limit != 0 {
+			opts.SetLimit(int64(limit))
+		}
+		cursor, err = t.todoCollection.Find(ctx, query, opts)
+	}
 	if err != nil {
-		return nil, err
+		return "", err
 	}
-	defer cursor.Close(t.ctx)
+	defer cursor.Close(ctx)
 
-	var todoList []*models.Todo
-	for cursor.Next(t.ctx) {
+	for cursor.Next(ctx) {
 		todo := &models.Todo{}
 		if err = cursor.Decode(todo); err != nil {
-			return nil, err
+			return "", err
+		}
+		if err := page.write(todo); err == errPageFull {
+			break
+		} else if err != nil {
+			return "", err
 		}
-		todoList = append(todoList, todo)
 	}
 
 	if err = cursor.Err(); err != nil {
+		return "", err
+	}
+	return page.nextPageToken, nil
+}
+
+// tagsFilter returns the operators of the tag filters of the query, on the tags array.
+func tagsFilter(q *models.TodoQuery) bson.M {
+	filter := bson.M{}
+	if len(q.TagsAny) != 0 {
+		filter["$in"] = q.TagsAny
+	}
+	if len(q.TagsAll) != 0 {
+		filter["$all"] = q.TagsAll
+	}
+	if len(q.TagsNone) != 0 {
+		filter["$nin"] = q.TagsNone
+	}
+	return filter
+}
+
+// mongoSortKey is one field of the order of a query, along with its value for the last Todo of the previous page.
+type mongoSortKey struct {
+	field      string
+	descending bool
+	last       interface{}
+}
+
+// mongoSortKeys returns the order of a query, ending with the _id. The last values are only set when token is. The
+// PRIORITY and DUE_AT orders are on the fields computed by the aggregation of GetAllTodos.
+func mongoSortKeys(q *models.TodoQuery, token *pageToken) []mongoSortKey {
+	if token == nil {
+		token = &pageToken{}
+	}
+	lastTime := time.UnixMilli(token.Time).UTC()
+
+	var keys []mongoSortKey
+	switch {
+	case q.Trashed:
+		keys = []mongoSortKey{{"deleted_at", false, lastTime}}
+	case q.SortBy == pb.GetItemsRequest_UPDATED_AT:
+		keys = []mongoSortKey{{"updated_at", false, lastTime}}
+	case q.SortBy == pb.GetItemsRequest_TITLE:
+		keys = []mongoSortKey{{"title", false, token.Title}}
+	case q.SortBy == pb.GetItemsRequest_POSITION:
+		keys = []mongoSortKey{{"position", false, token.Position}}
+	case q.SortBy == pb.GetItemsRequest_PRIORITY:
+		keys = []mongoSortKey{{"sort_priority", true, token.Priority}, {"sort_due", false, lastTime}}
+	case q.SortBy == pb.GetItemsRequest_DUE_AT:
+		keys = []mongoSortKey{{"sort_due", false, lastTime}}
+	default:
+		keys = []mongoSortKey{{"created_at", false, lastTime}}
+	}
+	keys = append(keys, mongoSortKey{"_id", false, token.Id})
+	if q.Descending {
+		for i := range keys {
+			keys[i].descending = !keys[i].descending
+		}
+	}
+	return keys
+}
+
+// keysetFilter is the $or matching the documents ordered after the last values of keys.
+func keysetFilter(keys []mongoSortKey) bson.A {
+	or := bson.A{}
+	for i, key := range keys {
+		cond := bson.M{}
+		for _, equal := range keys[:i] {
+			cond[equal.field] = equal.last
+		}
+		cmp := "$gt"
+		if key.descending {
+			cmp = "$lt"
+		}
+		cond[key.field] = bson.M{cmp: key.last}
+		or = append(or, cond)
+	}
+	return or
+}
+
+func (t *TodoServiceImpl) DeleteTodo(ctx context.Context, id string, expectedVersion int64) error {
+	objectId, err := parseId(id)
+	if err != nil {
+		return err
+	}
+	query := bson.M{"_id": objectId, "deleted_at": bson.M{"$exists": false}}
+	if expectedVersion != 0 {
+		query["version"] = expectedVersion
+	}
+
+	res, err := t.todoCollection.UpdateOne(ctx, query, trashUpdate())
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return t.writeMissed(ctx, id, expectedVersion, false)
+	}
+	return nil
+}
+
+// DeleteTodoTree trashes the Todo, then its descendants with the same deleted_at.
+func (t *TodoServiceImpl) DeleteTodoTree(ctx context.Context, id string, expectedVersion int64) error {
+	objectId, err := parseId(id)
+	if err != nil {
+		return err
+	}
+	descendants, err := t.descendants(ctx, objectId, false)
+	if err != nil {
+		return err
+	}
+	query := bson.M{"_id": objectId, "deleted_at": bson.M{"$exists": false}}
+	if expectedVersion != 0 {
+		query["version"] = expectedVersion
+	}
+
+	update := trashUpdate()
+	res, err := t.todoCollection.UpdateOne(ctx, query, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return t.writeMissed(ctx, id, expectedVersion, false)
+	}
+	if len(descendants) == 0 {
+		return nil
+	}
+	_, err = t.todoCollection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": descendants}, "deleted_at": bson.M{"$exists": false}}, update)
+	return err
+}
+
+// trashUpdate moves a Todo to the trash.
+func trashUpdate() bson.D {
+	return bson.D{
+		{Key: "$set", Value: bson.D{{Key: "deleted_at", Value: now()}}},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	}
+}
+
+func (t *TodoServiceImpl) RestoreTodo(ctx context.Context, id string, expectedVersion int64) (*models.Todo, error) {
+	objectId, err := parseId(id)
+	if err != nil {
 		return nil, err
 	}
+	query := bson.M{"_id": objectId, "deleted_at": bson.M{"$exists": true}}
+	if expectedVersion != 0 {
+		query["version"] = expectedVersion
+	}
+	update := bson.D{
+		{Key: "$unset", Value: bson.D{{Key: "deleted_at", Value: ""}}},
+		{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+	}
 
-	if len(todoList) == 0 {
-		return []*models.Todo{}, nil
+	var restored *models.Todo
+	err = t.todoCollection.FindOneAndUpdate(ctx, query, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&restored)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, t.writeMissed(ctx, id, expectedVersion, true)
+		}
+		return nil, err
 	}
-	return todoList, nil
+	return restored, nil
 }
 
-func (t *TodoServiceImpl) DeleteTodo(id string) error {
-	objectId, _ := primitive.ObjectIDFromHex(id)
-	query := bson.M{"_id": objectId}
+func (t *TodoServiceImpl) PurgeTodo(ctx context.Context, id string, expectedVersion int64) error {
+	objectId, err := parseId(id)
+	if err != nil {
+		return err
+	}
+	query := bson.M{"_id": objectId, "deleted_at": bson.M{"$exists": true}}
+	if expectedVersion != 0 {
+		query["version"] = expectedVersion
+	}
 
-	res, err := t.todoCollection.DeleteOne(t.ctx, query)
+	res, err := t.todoCollection.DeleteOne(ctx, query)
 	if err != nil {
 		return err
 	}
 	if res.DeletedCount == 0 {
-		return errors.New("no Todo document found for given Id")
+		return t.writeMissed(ctx, id, expectedVersion, true)
 	}
-	return nil
+	_, err = t.commentCollection().DeleteMany(ctx, bson.M{"todo_id": objectId})
+	return err
+}
+
+// PurgeTrash deletes the Todos trashed in time, then the Comments on the Todos it read and that are gone: a Todo
+// restored in between keeps its Comments.
+func (t *TodoServiceImpl) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	query := bson.M{"deleted_at": bson.M{"$lte": deletedBefore}}
+	trashed, err := t.todoIds(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	res, err := t.todoCollection.DeleteMany(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	if len(trashed) == 0 {
+		return res.DeletedCount, nil
+	}
+
+	kept, err := t.todoIds(ctx, bson.M{"_id": bson.M{"$in": trashed}})
+	if err != nil {
+		return 0, err
+	}
+	keep := make(map[primitive.ObjectID]bool, len(kept))
+	for _, id := range kept {
+		keep[id] = true
+	}
+	var purged []primitive.ObjectID
+	for _, id := range trashed {
+		if !keep[id] {
+			purged = append(purged, id)
+		}
+	}
+	if len(purged) != 0 {
+		if _, err := t.commentCollection().DeleteMany(ctx, bson.M{"todo_id": bson.M{"$in": purged}}); err != nil {
+			return 0, err
+		}
+	}
+	return res.DeletedCount, nil
+}
+
+// todoIds returns the Ids of the Todos matching query.
+func (t *TodoServiceImpl) todoIds(ctx context.Context, query bson.M) ([]primitive.ObjectID, error) {
+	cursor, err := t.todoCollection.Find(ctx, query, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var todos []*models.Todo
+	if err := cursor.All(ctx, &todos); err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, len(todos))
+	for i, todo := range todos {
+		ids[i] = todo.Id
+	}
+	return ids, nil
+}
+
+func (t *TodoServiceImpl) ListTags(ctx context.Context, user string) ([]*models.TagCount, error) {
+	cursor, err := t.todoCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user": user, "tags": bson.M{"$exists": true}, "deleted_at": bson.M{"$exists": false}}}},
+		{{Key: "$unwind", Value: "$tags"}},
+		{{Key: "$group", Value: bson.D{{Key: "_id", Value: "$tags"}, {Key: "count", Value: bson.M{"$sum": 1}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tags := []*models.TagCount{}
+	for cursor.Next(ctx) {
+		var count struct {
+			Tag   string `bson:"_id"`
+			Count int64  `bson:"count"`
+		}
+		if err := cursor.Decode(&count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, &models.TagCount{Tag: count.Tag, Count: count.Count})
+	}
+	return tags, cursor.Err()
+}
+
+// RenameTag renames the tag in place with an array filter on the Todos not carrying the new tag yet, and pulls it
+// from the others. Each Todo is only written once.
+func (t *TodoServiceImpl) RenameTag(ctx context.Context, user, from, to string) (int64, error) {
+	if from == to {
+		return 0, nil
+	}
+	updatedAt := now()
+	inc := bson.D{{Key: "version", Value: 1}}
+
+	renamed, err := t.todoCollection.UpdateMany(ctx,
+		bson.M{"user": user, "tags": bson.M{"$eq": from, "$ne": to}},
+		bson.D{
+			{Key: "$set", Value: bson.D{{Key: "tags.$[tag]", Value: to}, {Key: "updated_at", Value: updatedAt}}},
+			{Key: "$inc", Value: inc},
+		},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: []interface{}{bson.M{"tag": from}}}))
+	if err != nil {
+		return 0, err
+	}
+	pulled, err := t.todoCollection.UpdateMany(ctx,
+		bson.M{"user": user, "tags": bson.M{"$all": bson.A{from, to}}},
+		bson.D{
+			{Key: "$pull", Value: bson.D{{Key: "tags", Value: from}}},
+			{Key: "$set", Value: bson.D{{Key: "updated_at", Value: updatedAt}}},
+			{Key: "$inc", Value: inc},
+		})
+	if err != nil {
+		return 0, err
+	}
+	return renamed.ModifiedCount + pulled.ModifiedCount, nil
+}
+
+func (t *TodoServiceImpl) AddChecklistItem(ctx context.Context, id, text string, expectedVersion int64) (*models.Todo, error) {
+	return t.editChecklist(ctx, id, expectedVersion, addChecklistItem(text))
+}
+
+func (t *TodoServiceImpl) ToggleChecklistItem(ctx context.Context, id, itemId string, done bool, expectedVersion int64) (*models.Todo, error) {
+	return t.editChecklist(ctx, id, expectedVersion, toggleChecklistItem(itemId, done))
+}
+
+func (t *TodoServiceImpl) ReorderChecklist(ctx context.Context, id string, itemIds []string, expectedVersion int64) (*models.Todo, error) {
+	return t.editChecklist(ctx, id, expectedVersion, reorderChecklist(itemIds))
+}
+
+func (t *TodoServiceImpl) RemoveChecklistItem(ctx context.Context, id, itemId string, expectedVersion int64) (*models.Todo, error) {
+	return t.editChecklist(ctx, id, expectedVersion, removeChecklistItem(itemId))
+}
+
+// editChecklist applies edit to the checklist of the Todo. A Todo the auto-completion marks done is completed like
+// UpdateTodo does: its descendants are checked before the write, then marked done, and its next occurrence created.
+func (t *TodoServiceImpl) editChecklist(ctx context.Context, id string, expectedVersion int64, edit checklistEdit) (*models.Todo, error) {
+	var open []primitive.ObjectID
+	completed := false
+	apply := t.opts.editChecklist(expectedVersion, edit, func(todo *models.Todo) error {
+		completed = true
+		if !t.opts.completesDescendants(completion()) {
+			return nil
+		}
+		var err error
+		if open, err = t.descendants(ctx, todo.Id, true); err != nil {
+			return err
+		}
+		return t.opts.checkCompletion(id, len(open))
+	})
+	// The Todo is read again when it changed in between, and may not be completed then.
+	todo, err := t.editTodo(ctx, id, expectedVersion, func(todo *models.Todo) error {
+		completed, open = false, nil
+		return apply(todo)
+	})
+	if err != nil || !completed {
+		return todo, err
+	}
+	if len(open) != 0 {
+		_, err := t.todoCollection.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": open}}, bson.D{
+			{Key: "$set", Value: bson.D{{Key: "done", Value: true}, {Key: "updated_at", Value: todo.UpdatedAt}}},
+			{Key: "$inc", Value: bson.D{{Key: "version", Value: 1}}},
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := t.continueSeries(ctx, todo, completion()); err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+func (t *TodoServiceImpl) SkipOccurrence(ctx context.Context, id string, expectedVersion int64) (*models.Todo, error) {
+	return t.editTodo(ctx, id, expectedVersion, skipOccurrence(expectedVersion))
+}
+
+func (t *TodoServiceImpl) MoveTodo(ctx context.Context, id string, move *models.MoveTodo) (*models.Todo, error) {
+	target, err := moveTarget(move, func(id string) (*models.Todo, error) {
+		return t.GetTodoById(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.editTodo(ctx, id, move.ExpectedVersion, placeTodo(move, target, func(todo *models.Todo, before bool) (string, error) {
+		cmp, direction := "$gt", 1
+		if before {
+			cmp, direction = "$lt", -1
+		}
+		query := bson.M{"user": todo.User, "_id": bson.M{"$ne": todo.Id}, "position": bson.M{cmp: target.Position}}
+		// The Todos of the Inbox have no list_id.
+		if todo.ListId.IsZero() {
+			query["list_id"] = bson.M{"$exists": false}
+		} else {
+			query["list_id"] = todo.ListId
+		}
+		opts := options.FindOne().SetSort(bson.D{{Key: "position", Value: direction}}).SetProjection(bson.M{"position": 1})
+		var next models.Todo
+		if err := t.todoCollection.FindOne(ctx, query, opts).Decode(&next); err != nil && err != mongo.ErrNoDocuments {
+			return "", err
+		}
+		return next.Position, nil
+	}))
+}
+
+// ClaimReminders claims the Todos one at a time, each with a conditional update, so that concurrent schedulers
+// never claim the same Todo.
+func (t *TodoServiceImpl) ClaimReminders(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.ReminderClaim, error) {
+	query := bson.M{
+		"next_reminder_at": bson.M{"$lte": now},
+		"done":             bson.M{"$ne": true},
+		"deleted_at":       bson.M{"$exists": false},
+		"$or": bson.A{
+			bson.M{"reminder_lease": bson.M{"$exists": false}},
+			bson.M{"reminder_lease": bson.M{"$lte": now}},
+		},
+	}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_reminder_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var claims []*models.ReminderClaim
+	for len(claims) < limit {
+		update := bson.M{"$set": bson.M{"reminder_lease": now.Add(lease), "reminder_claim": newReminderClaimId()}}
+		var todo *models.Todo
+		if err := t.todoCollection.FindOneAndUpdate(ctx, query, update, opts).Decode(&todo); err != nil {
+			if err == mongo.ErrNoDocuments {
+				break
+			}
+			return nil, err
+		}
+		claims = append(claims, newReminderClaim(todo, now))
+	}
+	return claims, nil
+}
+
+// CompleteReminders writes the reminders on the condition that the claim still holds and that the Todo is still at
+// the version read, a Todo modified in between is read again.
+func (t *TodoServiceImpl) CompleteReminders(ctx context.Context, claim *models.ReminderClaim, sent []time.Time) error {
+	for {
+		var todo *models.Todo
+		err := t.todoCollection.FindOne(ctx, bson.M{"_id": claim.Todo.Id, "reminder_claim": claim.Id}).Decode(&todo)
+		if err == mongo.ErrNoDocuments {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		completeReminders(todo, claim, sent, now())
+
+		set, unset := remindersUpdate(todo, nil, nil)
+		if len(todo.ReminderClaim) == 0 {
+			unset = append(unset, bson.E{Key: "reminder_lease", Value: ""}, bson.E{Key: "reminder_claim", Value: ""})
+		}
+		update := bson.D{}
+		if len(set) != 0 {
+			update = append(update, bson.E{Key: "$set", Value: set})
+		}
+		if len(unset) != 0 {
+			update = append(update, bson.E{Key: "$unset", Value: unset})
+		}
+		query := bson.M{"_id": todo.Id, "reminder_claim": claim.Id, "version": todo.Version}
+		if todo.Version == 0 {
+			query["version"] = bson.M{"$exists": false}
+		}
+		res, err := t.todoCollection.UpdateOne(ctx, query, update)
+		if err != nil || res.MatchedCount == 1 {
+			return err
+		}
+	}
+}
+
+// editTodo reads the Todo, edits it and writes it back on the condition that it is still at the version read.
+// A Todo modified in between is read again, unless the caller expected a version.
+func (t *TodoServiceImpl) editTodo(ctx context.Context, id string, expectedVersion int64, edit todoEdit) (*models.Todo, error) {
+	for {
+		todo, err := t.GetTodoById(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		var readVersion interface{} = todo.Version
+		if todo.Version == 0 {
+			// The Todos stored before versions were tracked have no version field.
+			readVersion = bson.M{"$exists": false}
+		}
+		if err := edit(todo); err != nil {
+			return nil, err
+		}
+
+		set := bson.D{
+			{Key: "done", Value: todo.Done},
+			{Key: "position", Value: todo.Position},
+			{Key: "updated_at", Value: todo.UpdatedAt},
+			{Key: "version", Value: todo.Version},
+		}
+		var unset bson.D
+		if len(todo.Checklist) == 0 {
+			unset = append(unset, bson.E{Key: "checklist", Value: ""})
+		} else {
+			set = append(set, bson.E{Key: "checklist", Value: todo.Checklist})
+		}
+		if todo.DueAt.IsZero() {
+			unset = append(unset, bson.E{Key: "due_at", Value: ""})
+		} else {
+			set = append(set, bson.E{Key: "due_at", Value: todo.DueAt})
+		}
+		if len(todo.Recurrence) == 0 {
+			unset = append(unset, bson.E{Key: "recurrence", Value: ""})
+		} else {
+			set = append(set, bson.E{Key: "recurrence", Value: todo.Recurrence})
+		}
+		set, unset = remindersUpdate(todo, set, unset)
+		update := bson.D{{Key: "$set", Value: set}}
+		if len(unset) != 0 {
+			update = append(update, bson.E{Key: "$unset", Value: unset})
+		}
+		query := bson.D{
+			{Key: "_id", Value: todo.Id},
+			{Key: "deleted_at", Value: bson.M{"$exists": false}},
+			{Key: "version", Value: readVersion},
+		}
+		res, err := t.todoCollection.UpdateOne(ctx, query, update)
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 1 {
+			return todo, nil
+		}
+		if expectedVersion != 0 {
+			return nil, t.writeMissed(ctx, id, expectedVersion, false)
+		}
+	}
+}
+
+func (t *TodoServiceImpl) CreateList(ctx context.Context, request *models.CreateListRequest) (*models.List, error) {
+	list, err := newList(request)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.listCollection().InsertOne(ctx, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (t *TodoServiceImpl) GetList(ctx context.Context, id string) (*models.List, error) {
+	objectId, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+	var list *models.List
+	if err := t.listCollection().FindOne(ctx, bson.M{"_id": objectId}).Decode(&list); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, listNotFound(id)
+		}
+		return nil, err
+	}
+	return list, nil
+}
+
+// UpdateList reads the List, updates it and writes it back on the condition that it is still at the version read.
+// A List modified in between is read again, unless the caller expected a version.
+func (t *TodoServiceImpl) UpdateList(ctx context.Context, id string, data *models.UpdateList) (*models.List, error) {
+	for {
+		list, err := t.GetList(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkListVersion(list, data.ExpectedVersion); err != nil {
+			return nil, err
+		}
+		readVersion := list.Version
+		if updated, err := updateList(list, data); err != nil || !updated {
+			return list, err
+		}
+
+		update := bson.M{"$set": bson.M{"name": list.Name, "updated_at": list.UpdatedAt, "version": list.Version}}
+		res, err := t.listCollection().UpdateOne(ctx, bson.M{"_id": list.Id, "version": readVersion}, update)
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 1 {
+			return list, nil
+		}
+	}
+}
+
+// DeleteList moves the Todos out of the List, then deletes it. Each write can be applied again, so a DeleteList that
+// failed half way is finished by a retry, the List being deleted last. With cascade, the Todos out of the trash are
+// moved to the trash and to the Inbox with a single write. The Todos moved to the List in the meantime are moved out
+// again once it is deleted.
+func (t *TodoServiceImpl) DeleteList(ctx context.Context, id string, expectedVersion int64, cascade bool) error {
+	list, err := t.GetList(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := checkListVersion(list, expectedVersion); err != nil {
+		return err
+	}
+	if err := t.moveListTodos(ctx, list.Id, cascade); err != nil {
+		return err
+	}
+
+	query := bson.M{"_id": list.Id}
+	if expectedVersion != 0 {
+		query["version"] = expectedVersion
+	}
+	res, err := t.listCollection().DeleteOne(ctx, query)
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		list, err := t.GetList(ctx, id)
+		if err != nil {
+			return err
+		}
+		return checkListVersion(list, expectedVersion)
+	}
+	return t.moveListTodos(ctx, list.Id, cascade)
+}
+
+// moveListTodos moves the Todos of the List to the Inbox, and those out of the trash to the trash with cascade.
+func (t *TodoServiceImpl) moveListTodos(ctx context.Context, listId primitive.ObjectID, cascade bool) error {
+	movedAt := now()
+	inc := bson.D{{Key: "version", Value: 1}}
+	unset := bson.D{{Key: "list_id", Value: ""}}
+	if cascade {
+		_, err := t.todoCollection.UpdateMany(ctx,
+			bson.M{"list_id": listId, "deleted_at": bson.M{"$exists": false}},
+			bson.D{
+				{Key: "$set", Value: bson.D{{Key: "deleted_at", Value: movedAt}, {Key: "updated_at", Value: movedAt}}},
+				{Key: "$unset", Value: unset},
+				{Key: "$inc", Value: inc},
+			})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := t.todoCollection.UpdateMany(ctx, bson.M{"list_id": listId}, bson.D{
+		{Key: "$set", Value: bson.D{{Key: "updated_at", Value: movedAt}}},
+		{Key: "$unset", Value: unset},
+		{Key: "$inc", Value: inc},
+	})
+	return err
+}
+
+func (t *TodoServiceImpl) ListLists(ctx context.Context, user string) ([]*models.List, error) {
+	cursor, err := t.listCollection().Find(ctx, bson.M{"user": user})
+	if err != nil {
+		return nil, err
+	}
+	var lists []*models.List
+	if err := cursor.All(ctx, &lists); err != nil {
+		return nil, err
+	}
+	return withInbox(user, lists), nil
+}
+
+// AddComment inserts the Comment before counting it on its Todo, so that a failed insert leaves the count alone. The
+// Comment is deleted again when its Todo is missing or in the trash.
+func (t *TodoServiceImpl) AddComment(ctx context.Context, todoId string, request *models.CreateCommentRequest) (*models.Comment, error) {
+	objectId, err := parseCommentTodoId(todoId)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := newComment(objectId, request)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.commentCollection().InsertOne(ctx, comment); err != nil {
+		return nil, err
+	}
+	if err := t.countComments(ctx, objectId, 1); err != nil {
+		if KindOf(err) == KindNotFound {
+			_, _ = t.commentCollection().DeleteOne(ctx, bson.M{"_id": comment.Id})
+		}
+		return nil, err
+	}
+	return comment, nil
+}
+
+// UpdateComment reads the Comment, updates it and writes it back on the condition that it is still at the version
+// read. A Comment modified in between is read again, unless the caller expected a version.
+func (t *TodoServiceImpl) UpdateComment(ctx context.Context, id, body string, expectedVersion int64) (*models.Comment, error) {
+	objectId, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		comment, err := t.readComment(ctx, objectId)
+		if err != nil {
+			return nil, err
+		}
+		readVersion := comment.Version
+		if err := editComment(comment, body, expectedVersion); err != nil {
+			return nil, err
+		}
+
+		update := bson.M{"$set": bson.M{"body": comment.Body, "updated_at": comment.UpdatedAt, "version": comment.Version}}
+		res, err := t.commentCollection().UpdateOne(ctx, bson.M{"_id": objectId, "version": readVersion}, update)
+		if err != nil {
+			return nil, err
+		}
+		if res.MatchedCount == 1 {
+			return comment, nil
+		}
+	}
+}
+
+// DeleteComment deletes the Comment at the version read, then uncounts it on its Todo.
+func (t *TodoServiceImpl) DeleteComment(ctx context.Context, id string, expectedVersion int64) error {
+	objectId, err := parseId(id)
+	if err != nil {
+		return err
+	}
+	comment, err := t.readComment(ctx, objectId)
+	if err != nil {
+		return err
+	}
+	if err := checkCommentVersion(comment, expectedVersion); err != nil {
+		return err
+	}
+	res, err := t.commentCollection().DeleteOne(ctx, bson.M{"_id": objectId, "version": comment.Version})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return commentNotFound(id)
+	}
+	return t.countComments(ctx, comment.TodoId, -1)
+}
+
+func (t *TodoServiceImpl) ListComments(ctx context.Context, todoId string) ([]*models.Comment, error) {
+	objectId, err := parseCommentTodoId(todoId)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.checkLiveTodo(ctx, objectId); err != nil {
+		return nil, err
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cursor, err := t.commentCollection().Find(ctx, bson.M{"todo_id": objectId}, opts)
+	if err != nil {
+		return nil, err
+	}
+	comments := []*models.Comment{}
+	if err := cursor.All(ctx, &comments); err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+// readComment reads a Comment on a Todo out of the trash.
+func (t *TodoServiceImpl) readComment(ctx context.Context, id primitive.ObjectID) (*models.Comment, error) {
+	var comment *models.Comment
+	if err := t.commentCollection().FindOne(ctx, bson.M{"_id": id}).Decode(&comment); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, commentNotFound(id.Hex())
+		}
+		return nil, err
+	}
+	if err := t.checkLiveTodo(ctx, comment.TodoId); err != nil {
+		if KindOf(err) == KindNotFound {
+			return nil, commentNotFound(id.Hex())
+		}
+		return nil, err
+	}
+	return comment, nil
+}
+
+// checkLiveTodo fails with a KindNotFound error when the Todo is not stored or is in the trash.
+func (t *TodoServiceImpl) checkLiveTodo(ctx context.Context, id primitive.ObjectID) error {
+	query := bson.M{"_id": id, "deleted_at": bson.M{"$exists": false}}
+	n, err := t.todoCollection.CountDocuments(ctx, query, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound(id.Hex())
+	}
+	return nil
+}
+
+// countComments adds delta to the comment_count of the Todo, leaving its version alone. Comments are only added
+// to the Todos out of the trash, but the Todo of a Comment deleted may have been trashed since it was read.
+func (t *TodoServiceImpl) countComments(ctx context.Context, id primitive.ObjectID, delta int64) error {
+	query := bson.M{"_id": id}
+	if delta > 0 {
+		query["deleted_at"] = bson.M{"$exists": false}
+	}
+	res, err := t.todoCollection.UpdateOne(ctx, query, bson.M{"$inc": bson.M{"comment_count": delta}})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return notFound(id.Hex())
+	}
+	return nil
+}
+
+func (t *TodoServiceImpl) BatchCreateTodos(ctx context.Context, requests []*models.CreateTodoRequest, atomic bool) ([]BatchResult, error) {
+	if atomic {
+		return t.runTransaction(ctx, createBatchIds(requests), func(ctx context.Context, i int) (*models.Todo, error) {
+			return t.CreateTodo(ctx, requests[i])
+		})
+	}
+
+	results := make([]BatchResult, len(requests))
+	var docs []interface{}
+	var indexes []int
+	for i, request := range requests {
+		if len(request.ParentId) != 0 || len(request.ListId) != 0 {
+			// The parent or List is read before writing, these requests are not part of the bulk write.
+			todo, err := t.CreateTodo(ctx, request)
+			if err != nil && KindOf(err) == KindInternal {
+				return nil, err
+			}
+			results[i] = BatchResult{Todo: todo, Err: err}
+			continue
+		}
+		if len(request.RequestId) != 0 {
+			replayed, err := t.findRequest(ctx, request)
+			if err != nil && KindOf(err) == KindInternal {
+				return nil, err
+			}
+			if err != nil || replayed != nil {
+				results[i] = BatchResult{Todo: replayed, Err: err}
+				continue
+			}
+		}
+		todo, err := newTodo(request)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		results[i].Todo = todo
+		docs = append(docs, todo)
+		indexes = append(indexes, i)
+	}
+	if len(docs) == 0 {
+		return results, nil
+	}
+
+	_, err := t.todoCollection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err := bulkWriteErrors(err, results, indexes); err != nil {
+		return nil, err
+	}
+	for _, i := range indexes {
+		if results[i].Err != nil || len(requests[i].RequestId) == 0 {
+			continue
+		}
+		todo, err := t.rememberRequest(ctx, requests[i], results[i].Todo)
+		if err != nil && KindOf(err) == KindInternal {
+			return nil, err
+		}
+		results[i] = BatchResult{Todo: todo, Err: err}
+	}
+	return results, nil
+}
+
+// BatchUpdateTodos applies the updates with a single bulk write. The Todos are read first, so that every update is
+// pinned to the version it was checked against, and read again after the write since a bulk write only counts the
+// matched documents. An update that missed because of a concurrent write is retried on its own.
+func (t *TodoServiceImpl) BatchUpdateTodos(ctx context.Context, items []*models.BatchUpdateItem, atomic bool) ([]BatchResult, error) {
+	ids, err := updateBatchIds(items)
+	if err != nil {
+		return nil, err
+	}
+	if atomic {
+		return t.runTransaction(ctx, ids, func(ctx context.Context, i int) (*models.Todo, error) {
+			return t.UpdateTodo(ctx, items[i].Id, items[i].Update)
+		})
+	}
+
+	results, current, err := t.readBatch(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	var writes []mongo.WriteModel
+	var indexes []int
+	for i, item := range items {
+		if results[i].Err != nil {
+			continue
+		}
+		todo := current[i]
+		if err := checkVersion(todo, item.Update.ExpectedVersion); err != nil {
+			results[i].Err = err
+			continue
+		}
+		completes := item.Update.Done != nil && *item.Update.Done
+		checksList := item.Update.ListId != nil || (item.Update.User != nil && !todo.ListId.IsZero())
+		if item.Update.ParentId != nil || checksList || t.opts.completesDescendants(item.Update) ||
+			(completes && (len(todo.Recurrence) != 0 || item.Update.Recurrence != nil)) {
+			// The hierarchy or List is read, or the next occurrence created, along with these items: they are not part
+			// of the bulk write.
+			todo, err := t.UpdateTodo(ctx, item.Id, item.Update)
+			if err != nil && KindOf(err) == KindInternal {
+				return nil, err
+			}
+			results[i] = BatchResult{Todo: todo, Err: err}
+			continue
+		}
+		update, err := mongoUpdate(item.Update, todo.Reminders)
+		if err != nil {
+			return nil, err
+		}
+		if update == nil {
+			results[i].Todo = todo
+			continue
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: todo.Id}, {Key: "version", Value: todo.Version}}).
+			SetUpdate(update))
+		indexes = append(indexes, i)
+	}
+	if len(writes) == 0 {
+		return results, nil
+	}
+
+	if _, err := t.todoCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+		return nil, err
+	}
+	written := make([]string, len(indexes))
+	for j, i := range indexes {
+		written[j] = ids[i]
+	}
+	_, updated, err := t.readBatch(ctx, written)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range indexes {
+		if results[i].Err != nil {
+			continue
+		}
+		if updated[j] != nil && updated[j].Version == current[i].Version+1 {
+			results[i].Todo = updated[j]
+			continue
+		}
+		todo, err := t.UpdateTodo(ctx, items[i].Id, items[i].Update)
+		if err != nil && KindOf(err) == KindInternal {
+			return nil, err
+		}
+		results[i] = BatchResult{Todo: todo, Err: err}
+	}
+	return results, nil
+}
+
+// BatchDeleteTodos moves the Todos to the trash with a single bulk write, reading them before and after it like
+// BatchUpdateTodos.
+func (t *TodoServiceImpl) BatchDeleteTodos(ctx context.Context, items []*models.BatchDeleteItem, atomic bool) ([]BatchResult, error) {
+	ids, err := deleteBatchIds(items)
+	if err != nil {
+		return nil, err
+	}
+	if atomic {
+		return t.runTransaction(ctx, ids, func(ctx context.Context, i int) (*models.Todo, error) {
+			return nil, t.DeleteTodo(ctx, items[i].Id, items[i].ExpectedVersion)
+		})
+	}
+
+	results, current, err := t.readBatch(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	var writes []mongo.WriteModel
+	var indexes []int
+	for i, item := range items {
+		if results[i].Err != nil {
+			continue
+		}
+		if err := checkVersion(current[i], item.ExpectedVersion); err != nil {
+			results[i].Err = err
+			continue
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.D{{Key: "_id", Value: current[i].Id}, {Key: "version", Value: current[i].Version}}).
+			SetUpdate(trashUpdate()))
+		indexes = append(indexes, i)
+	}
+	if len(writes) == 0 {
+		return results, nil
+	}
+
+	res, err := t.todoCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == int64(len(writes)) {
+		return results, nil
+	}
+	written := make([]string, len(indexes))
+	for j, i := range indexes {
+		written[j] = ids[i]
+	}
+	_, remaining, err := t.readBatch(ctx, written)
+	if err != nil {
+		return nil, err
+	}
+	for j, i := range indexes {
+		if remaining[j] == nil {
+			continue
+		}
+		if err := t.DeleteTodo(ctx, items[i].Id, items[i].ExpectedVersion); err != nil {
+			if KindOf(err) == KindInternal {
+				return nil, err
+			}
+			results[i].Err = err
+		}
+	}
+	return results, nil
+}
+
+// readBatch reads the Todos of a batch with a single query. The returned Todos are in the order of ids, a Todo that
+// could not be read is nil and has the error in its result.
+func (t *TodoServiceImpl) readBatch(ctx context.Context, ids []string) ([]BatchResult, []*models.Todo, error) {
+	results := make([]BatchResult, len(ids))
+	objectIds := make([]primitive.ObjectID, 0, len(ids))
+	for i, id := range ids {
+		objectId, err := parseId(id)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		objectIds = append(objectIds, objectId)
+	}
+
+	found := make(map[primitive.ObjectID]*models.Todo, len(objectIds))
+	cursor, err := t.todoCollection.Find(ctx, bson.M{"_id": bson.M{"$in": objectIds}, "deleted_at": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		todo := &models.Todo{}
+		if err := cursor.Decode(todo); err != nil {
+			return nil, nil, err
+		}
+		found[todo.Id] = todo
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	todos := make([]*models.Todo, len(ids))
+	for i, id := range ids {
+		if results[i].Err != nil {
+			continue
+		}
+		objectId, _ := primitive.ObjectIDFromHex(id)
+		if todos[i] = found[objectId]; todos[i] == nil {
+			results[i].Err = notFound(id)
+		}
+	}
+	return results, todos, nil
+}
+
+// bulkWriteErrors reports the duplicate key errors of a bulk insert in the results of their items, indexes maps the
+// writes to the items. Any other error is returned.
+func bulkWriteErrors(err error, results []BatchResult, indexes []int) error {
+	if err == nil {
+		return nil
+	}
+	var bulkErr mongo.BulkWriteException
+	if !errors.As(err, &bulkErr) || bulkErr.WriteConcernError != nil {
+		return err
+	}
+	for _, writeErr := range bulkErr.WriteErrors {
+		i := indexes[writeErr.Index]
+		if !mongo.IsDuplicateKeyError(writeErr.WriteError) {
+			return err
+		}
+		results[i] = BatchResult{Err: conflict(results[i].Todo.Id.Hex(), ErrTodoExists)}
+	}
+	return nil
+}
+
+// runTransaction runs an atomic batch in a transaction, which needs a replica set or a sharded cluster.
+func (t *TodoServiceImpl) runTransaction(ctx context.Context, ids []string, item func(ctx context.Context, i int) (*models.Todo, error)) ([]BatchResult, error) {
+	session, err := t.todoCollection.Database().Client().StartSession()
+	if err != nil {
+		return nil, err
+	}
+	defer session.EndSession(ctx)
+
+	var results []BatchResult
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		var err error
+		results, err = runBatch(sc, ids, true, func(i int) (*models.Todo, error) { return item(sc, i) })
+		if err == nil && batchFailed(results) {
+			return nil, errRollback
+		}
+		return nil, err
+	})
+	if err != nil && err != errRollback {
+		var serverErr mongo.ServerError
+		if errors.As(err, &serverErr) && serverErr.HasErrorCode(illegalOperationCode) {
+			return nil, unsupported(fmt.Errorf("%w: %v", ErrTransactionsUnsupported, err))
+		}
+		return nil, err
+	}
+	return results, nil
+}
+
+// checkParent checks that parentId can be the parent of the Todo id.
+func (t *TodoServiceImpl) checkParent(ctx context.Context, id primitive.ObjectID, parentId string) error {
+	parentObjectId, err := parseParentId(parentId)
+	if err != nil {
+		return err
+	}
+	return checkParent(id, parentObjectId, func(id primitive.ObjectID) (*todoLink, error) {
+		var todo models.Todo
+		opts := options.FindOne().SetProjection(bson.M{"parent_id": 1, "deleted_at": 1})
+		if err := t.todoCollection.FindOne(ctx, bson.M{"_id": id}, opts).Decode(&todo); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return &todoLink{parentId: todo.ParentId, trashed: todo.Trashed()}, nil
+	})
+}
+
+// checkNewTodo checks the parent and the List of a Todo to create.
+func (t *TodoServiceImpl) checkNewTodo(ctx context.Context, request *models.CreateTodoRequest) error {
+	if err := t.checkParent(ctx, primitive.NilObjectID, request.ParentId); err != nil {
+		return err
+	}
+	listId, err := parseListId(request.ListId)
+	if err != nil {
+		return err
+	}
+	return checkList(request.User, listId, t.readList(ctx))
+}
+
+// readList returns the function reading a stored List for checkList.
+func (t *TodoServiceImpl) readList(ctx context.Context) func(id primitive.ObjectID) (*models.List, error) {
+	return func(id primitive.ObjectID) (*models.List, error) {
+		var list *models.List
+		if err := t.listCollection().FindOne(ctx, bson.M{"_id": id}).Decode(&list); err != nil {
+			if err == mongo.ErrNoDocuments {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return list, nil
+	}
+}
+
+// descendants returns the Ids of the descendants of a Todo that are out of the trash, only the ones that are not
+// done when open is set. A Todo in the trash has none. The tree is walked one level per query.
+func (t *TodoServiceImpl) descendants(ctx context.Context, id primitive.ObjectID, open bool) ([]primitive.ObjectID, error) {
+	if n, err := t.todoCollection.CountDocuments(ctx, bson.M{"_id": id, "deleted_at": bson.M{"$exists": false}}); err != nil || n == 0 {
+		return nil, err
+	}
+	var descendants, openDescendants []primitive.ObjectID
+	seen := map[primitive.ObjectID]bool{id: true}
+	opts := options.Find().SetProjection(bson.M{"done": 1})
+	for level := []primitive.ObjectID{id}; len(level) != 0; {
+		cursor, err := t.todoCollection.Find(ctx, bson.M{"parent_id": bson.M{"$in": level}, "deleted_at": bson.M{"$exists": false}}, opts)
+		if err != nil {
+			return nil, err
+		}
+		var children []*models.Todo
+		if err := cursor.All(ctx, &children); err != nil {
+			return nil, err
+		}
+		level = nil
+		for _, child := range children {
+			if seen[child.Id] {
+				continue
+			}
+			seen[child.Id] = true
+			level = append(level, child.Id)
+			descendants = append(descendants, child.Id)
+			if !child.Done {
+				openDescendants = append(openDescendants, child.Id)
+			}
+		}
+	}
+	if open {
+		return openDescendants, nil
+	}
+	return descendants, nil
+}
+
+// writeMissed tells why a write matched no document, the Todo is either gone or not at the expected version.
+// trashed tells whether the write was about a Todo in the trash.
+func (t *TodoServiceImpl) writeMissed(ctx context.Context, id string, expectedVersion int64, trashed bool) error {
+	if expectedVersion == 0 {
+		return notFound(id)
+	}
+	todo, err := t.getTodo(ctx, id, trashed)
+	if err != nil {
+		return err
+	}
+	return versionMismatch(id, expectedVersion, todo.Version)
 }
@@ -2,22 +2,32 @@ package services
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/todo-project/models"
 	"github.com/todo-project/pb"
+	"github.com/todo-project/utils"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
 )
 
+// collectTodos returns every Todo of the page matching the query.
+func collectTodos(todoService TodoService, query *models.TodoQuery) ([]*models.Todo, error) {
+	todos := []*models.Todo{}
+	_, err := todoService.GetAllTodos(context.TODO(), query, func(todo *models.Todo) error {
+		todos = append(todos, todo)
+		return nil
+	})
+	return todos, err
+}
+
 func TestTodoServiceImpl_CreateTodo(t1 *testing.T) {
 	mt := mtest.New(t1, mtest.NewOptions().ClientType(mtest.Mock))
 	defer mt.Close()
-	todoImpl := &TodoServiceImpl{
-		ctx: context.TODO(),
-	}
+	todoImpl := &TodoServiceImpl{}
 	createReq := &models.CreateTodoRequest{
 		Title:       "title",
 		Description: "desc",
@@ -46,7 +56,7 @@ func TestTodoServiceImpl_CreateTodo(t1 *testing.T) {
 			}},
 		})
 
-		newTodo, err := todoImpl.CreateTodo(createReq)
+		newTodo, err := todoImpl.CreateTodo(context.TODO(), createReq)
 		assert.Nil(t1, err)
 		assert.Equal(t1, expectedTodo.Title, newTodo.Title)
 	})
@@ -55,7 +65,7 @@ func TestTodoServiceImpl_CreateTodo(t1 *testing.T) {
 		todoImpl.todoCollection = mt.Coll
 		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
 
-		newTodo, err := todoImpl.CreateTodo(&models.CreateTodoRequest{})
+		newTodo, err := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{})
 
 		assert.Nil(t1, newTodo)
 		assert.NotNil(t1, err)
@@ -65,17 +75,15 @@ func TestTodoServiceImpl_CreateTodo(t1 *testing.T) {
 func TestTodoServiceImpl_UpdateTodo(t1 *testing.T) {
 	mt := mtest.New(t1, mtest.NewOptions().ClientType(mtest.Mock))
 	defer mt.Close()
-	todoImpl := &TodoServiceImpl{
-		ctx: context.TODO(),
-	}
+	todoImpl := &TodoServiceImpl{}
 	updateReq := &models.UpdateTodo{
-		Title:       "dummy",
-		Description: "desc",
-		User:        "1",
-		Done:        true,
+		Title:       utils.Pointer("dummy"),
+		Description: utils.Pointer("desc"),
+		User:        utils.Pointer("1"),
+		Done:        utils.BoolPointer(true),
 	}
-	id := "dummy_id"
-	_id, _ := primitive.ObjectIDFromHex(id)
+	_id := primitive.NewObjectID()
+	id := _id.Hex()
 
 	mt.Run("success", func(mt *mtest.T) {
 		todoImpl.todoCollection = mt.Coll
@@ -90,21 +98,32 @@ func TestTodoServiceImpl_UpdateTodo(t1 *testing.T) {
 			}},
 		})
 
-		updatedTodo, err := todoImpl.UpdateTodo(id, updateReq)
+		updatedTodo, err := todoImpl.UpdateTodo(context.TODO(), id, updateReq)
+
+		assert.Nil(t1, err)
+		assert.Equal(t1, *updateReq.User, updatedTodo.User)
+	})
+
+	mt.Run("nothing to update", func(mt *mtest.T) {
+		todoImpl.todoCollection = mt.Coll
+		mt.AddMockResponses(mtest.CreateCursorResponse(1, "foo.bar", mtest.FirstBatch, bson.D{
+			{Key: "_id", Value: _id},
+			{Key: "title", Value: "title"},
+		}))
+
+		updatedTodo, err := todoImpl.UpdateTodo(context.TODO(), id, &models.UpdateTodo{})
 
 		assert.Nil(t1, err)
-		assert.Equal(t1, updateReq.User, updatedTodo.User)
+		assert.Equal(t1, "title", updatedTodo.Title)
 	})
 }
 
 func TestTodoServiceImpl_GetTodoById(t1 *testing.T) {
 	mt := mtest.New(t1, mtest.NewOptions().ClientType(mtest.Mock))
 	defer mt.Close()
-	todoImpl := &TodoServiceImpl{
-		ctx: context.TODO(),
-	}
-	id := "dummy_id"
-	_id, _ := primitive.ObjectIDFromHex(id)
+	todoImpl := &TodoServiceImpl{}
+	_id := primitive.NewObjectID()
+	id := _id.Hex()
 	expectedTodo := &models.Todo{
 		Id:          _id,
 		Title:       "dummy",
@@ -116,24 +135,37 @@ func TestTodoServiceImpl_GetTodoById(t1 *testing.T) {
 	mt.Run("success", func(mt *mtest.T) {
 		todoImpl.todoCollection = mt.Coll
 		mt.AddMockResponses(mtest.CreateCursorResponse(1, "foo.bar", mtest.FirstBatch, bson.D{
-			{"_id", expectedTodo.Id},
-			{"title", expectedTodo.Title},
-			{"description", expectedTodo.Description},
-			{"user", expectedTodo.User},
-			{"done", expectedTodo.Done},
+			{Key: "_id", Value: expectedTodo.Id},
+			{Key: "title", Value: expectedTodo.Title},
+			{Key: "description", Value: expectedTodo.Description},
+			{Key: "user", Value: expectedTodo.User},
+			{Key: "done", Value: expectedTodo.Done},
 		}))
-		todoResponse, err := todoImpl.GetTodoById(id)
+		todoResponse, err := todoImpl.GetTodoById(context.TODO(), id)
 		assert.Nil(t1, err)
 		assert.Equal(t1, expectedTodo, todoResponse)
 	})
+
+	mt.Run("not found", func(mt *mtest.T) {
+		todoImpl.todoCollection = mt.Coll
+		mt.AddMockResponses(mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch))
+		_, err := todoImpl.GetTodoById(context.TODO(), id)
+		assert.Equal(t1, KindNotFound, KindOf(err))
+		assert.True(t1, errors.Is(err, ErrTodoNotFound))
+	})
+
+	mt.Run("malformed id", func(mt *mtest.T) {
+		todoImpl.todoCollection = mt.Coll
+		_, err := todoImpl.GetTodoById(context.TODO(), "dummy_id")
+		assert.Equal(t1, KindInvalidArgument, KindOf(err))
+		assert.True(t1, errors.Is(err, ErrInvalidId))
+	})
 }
 
 func TestTodoServiceImpl_GetAllTodos(t1 *testing.T) {
 	mt := mtest.New(t1, mtest.NewOptions().ClientType(mtest.Mock))
 	defer mt.Close()
-	todoImpl := &TodoServiceImpl{
-		ctx: context.TODO(),
-	}
+	todoImpl := &TodoServiceImpl{}
 	id1 := "dummy_id1"
 	_id1, _ := primitive.ObjectIDFromHex(id1)
 	expectedTodo1 := &models.Todo{
@@ -166,30 +198,30 @@ func TestTodoServiceImpl_GetAllTodos(t1 *testing.T) {
 	mt.Run("success", func(mt *mtest.T) {
 		todoImpl.todoCollection = mt.Coll
 		first := mtest.CreateCursorResponse(1, "foo.bar", mtest.FirstBatch, bson.D{
-			{"_id", expectedTodo1.Id},
-			{"title", expectedTodo1.Title},
-			{"description", expectedTodo1.Description},
-			{"user", expectedTodo1.User},
-			{"done", expectedTodo1.Done},
+			{Key: "_id", Value: expectedTodo1.Id},
+			{Key: "title", Value: expectedTodo1.Title},
+			{Key: "description", Value: expectedTodo1.Description},
+			{Key: "user", Value: expectedTodo1.User},
+			{Key: "done", Value: expectedTodo1.Done},
 		})
 		second := mtest.CreateCursorResponse(1, "foo.bar", mtest.NextBatch, bson.D{
-			{"_id", expectedTodo2.Id},
-			{"title", expectedTodo2.Title},
-			{"description", expectedTodo2.Description},
-			{"user", expectedTodo2.User},
-			{"done", expectedTodo2.Done},
+			{Key: "_id", Value: expectedTodo2.Id},
+			{Key: "title", Value: expectedTodo2.Title},
+			{Key: "description", Value: expectedTodo2.Description},
+			{Key: "user", Value: expectedTodo2.User},
+			{Key: "done", Value: expectedTodo2.Done},
 		})
 		third := mtest.CreateCursorResponse(1, "foo.bar", mtest.NextBatch, bson.D{
-			{"_id", expectedTodo3.Id},
-			{"title", expectedTodo3.Title},
-			{"description", expectedTodo3.Description},
-			{"user", expectedTodo3.User},
-			{"done", expectedTodo3.Done},
+			{Key: "_id", Value: expectedTodo3.Id},
+			{Key: "title", Value: expectedTodo3.Title},
+			{Key: "description", Value: expectedTodo3.Description},
+			{Key: "user", Value: expectedTodo3.User},
+			{Key: "done", Value: expectedTodo3.Done},
 		})
 		killCursors := mtest.CreateCursorResponse(0, "foo.bar", mtest.NextBatch)
 		mt.AddMockResponses(first, second, third, killCursors)
 
-		todos, err := todoImpl.GetAllTodos(pb.GetItemsRequest_ALL, "")
+		todos, err := collectTodos(todoImpl, &models.TodoQuery{Status: pb.GetItemsRequest_ALL})
 		assert.Nil(t1, err)
 		assert.Equal(t1, []*models.Todo{
 			expectedTodo1,
@@ -202,16 +234,16 @@ func TestTodoServiceImpl_GetAllTodos(t1 *testing.T) {
 	mt.Run("success", func(mt *mtest.T) {
 		todoImpl.todoCollection = mt.Coll
 		first := mtest.CreateCursorResponse(1, "foo.bar", mtest.FirstBatch, bson.D{
-			{"_id", expectedTodo3.Id},
-			{"title", expectedTodo3.Title},
-			{"description", expectedTodo3.Description},
-			{"user", expectedTodo3.User},
-			{"done", expectedTodo3.Done},
+			{Key: "_id", Value: expectedTodo3.Id},
+			{Key: "title", Value: expectedTodo3.Title},
+			{Key: "description", Value: expectedTodo3.Description},
+			{Key: "user", Value: expectedTodo3.User},
+			{Key: "done", Value: expectedTodo3.Done},
 		})
 		killCursors := mtest.CreateCursorResponse(0, "foo.bar", mtest.NextBatch)
 		mt.AddMockResponses(first, killCursors)
 
-		todos, err := todoImpl.GetAllTodos(pb.GetItemsRequest_DONE, "2")
+		todos, err := collectTodos(todoImpl, &models.TodoQuery{Status: pb.GetItemsRequest_DONE, User: "2"})
 		assert.Nil(t1, err)
 		assert.Equal(t1, []*models.Todo{
 			expectedTodo3,
@@ -222,22 +254,95 @@ func TestTodoServiceImpl_GetAllTodos(t1 *testing.T) {
 func TestTodoServiceImpl_DeleteTodo(t1 *testing.T) {
 	mt := mtest.New(t1, mtest.NewOptions().ClientType(mtest.Mock))
 	defer mt.Close()
-	todoImpl := &TodoServiceImpl{
-		ctx: context.TODO(),
-	}
-	id := "dummy_id"
+	todoImpl := &TodoServiceImpl{}
+	id := primitive.NewObjectID().Hex()
 
 	mt.Run("success", func(mt *mtest.T) {
 		todoImpl.todoCollection = mt.Coll
-		mt.AddMockResponses(bson.D{{"ok", 1}, {"acknowledged", true}, {"n", 1}})
-		err := todoImpl.DeleteTodo(id)
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "acknowledged", Value: true}, {Key: "n", Value: 1}})
+		err := todoImpl.DeleteTodo(context.TODO(), id, 0)
 		assert.Nil(t1, err)
 	})
 
 	mt.Run("no document deleted", func(mt *mtest.T) {
 		todoImpl.todoCollection = mt.Coll
-		mt.AddMockResponses(bson.D{{"ok", 1}, {"acknowledged", true}, {"n", 0}})
-		err := todoImpl.DeleteTodo(id)
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 1}, {Key: "acknowledged", Value: true}, {Key: "n", Value: 0}})
+		err := todoImpl.DeleteTodo(context.TODO(), id, 0)
 		assert.NotNil(t1, err)
 	})
 }
+
+func TestTodoServiceImpl_BatchCreateTodos(t1 *testing.T) {
+	mt := mtest.New(t1, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	todoImpl := &TodoServiceImpl{}
+	requests := []*models.CreateTodoRequest{
+		{Title: "a", User: "1"},
+		{Title: "b", User: "1"},
+	}
+
+	mt.Run("success", func(mt *mtest.T) {
+		todoImpl.todoCollection = mt.Coll
+		mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 2}))
+
+		results, err := todoImpl.BatchCreateTodos(context.TODO(), requests, false)
+		assert.Nil(t1, err)
+		assert.Len(t1, results, 2)
+		assert.Equal(t1, "a", results[0].Todo.Title)
+		assert.Equal(t1, "b", results[1].Todo.Title)
+	})
+
+	mt.Run("duplicate key", func(mt *mtest.T) {
+		todoImpl.todoCollection = mt.Coll
+		mt.AddMockResponses(mtest.CreateWriteErrorsResponse(mtest.WriteError{
+			Index:   1,
+			Code:    11000,
+			Message: "E11000 duplicate key error",
+		}))
+
+		results, err := todoImpl.BatchCreateTodos(context.TODO(), requests, false)
+		assert.Nil(t1, err)
+		assert.Nil(t1, results[0].Err)
+		assert.Nil(t1, results[1].Todo)
+		assert.Equal(t1, KindConflict, KindOf(results[1].Err))
+	})
+
+	mt.Run("simple error", func(mt *mtest.T) {
+		todoImpl.todoCollection = mt.Coll
+		mt.AddMockResponses(bson.D{{Key: "ok", Value: 0}})
+
+		results, err := todoImpl.BatchCreateTodos(context.TODO(), requests, false)
+		assert.Nil(t1, results)
+		assert.NotNil(t1, err)
+	})
+}
+
+func TestTodoServiceImpl_BatchDeleteTodos(t1 *testing.T) {
+	mt := mtest.New(t1, mtest.NewOptions().ClientType(mtest.Mock))
+	defer mt.Close()
+	todoImpl := &TodoServiceImpl{}
+	stored, stale, missing := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	items := []*models.BatchDeleteItem{
+		{Id: stored.Hex()},
+		{Id: stale.Hex(), ExpectedVersion: 1},
+		{Id: missing.Hex()},
+	}
+
+	mt.Run("success", func(mt *mtest.T) {
+		todoImpl.todoCollection = mt.Coll
+		mt.AddMockResponses(
+			mtest.CreateCursorResponse(0, "foo.bar", mtest.FirstBatch,
+				bson.D{{Key: "_id", Value: stored}, {Key: "version", Value: 3}},
+				bson.D{{Key: "_id", Value: stale}, {Key: "version", Value: 2}},
+			),
+			mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}),
+		)
+
+		results, err := todoImpl.BatchDeleteTodos(context.TODO(), items, false)
+		assert.Nil(t1, err)
+		assert.Len(t1, results, 3)
+		assert.Nil(t1, results[0].Err)
+		assert.Equal(t1, KindVersionMismatch, KindOf(results[1].Err))
+		assert.Equal(t1, KindNotFound, KindOf(results[2].Err))
+	})
+}
@@ -0,0 +1,938 @@
+package services
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/todo-project/models"
+	"github.com/todo-project/pb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// InMemoryTodoServiceImpl keeps all the Todos in process memory. It is meant for local development and tests,
+// everything is lost once the process exits.
+type InMemoryTodoServiceImpl struct {
+	mu              sync.RWMutex
+	todos           map[primitive.ObjectID]*models.Todo
+	lists           map[primitive.ObjectID]*models.List
+	comments        map[primitive.ObjectID]*models.Comment
+	idempotencyKeys map[idempotencyKey]*memoryIdempotencyEntry
+	opts            Options
+}
+
+// idempotencyKey scopes the request ids by user.
+type idempotencyKey struct {
+	user      string
+	requestId string
+}
+
+type memoryIdempotencyEntry struct {
+	fingerprint string
+	todo        *models.Todo
+	expiresAt   time.Time
+}
+
+func NewInMemoryTodoService(opts Options) TodoService {
+	return &InMemoryTodoServiceImpl{
+		todos:           make(map[primitive.ObjectID]*models.Todo),
+		lists:           make(map[primitive.ObjectID]*models.List),
+		comments:        make(map[primitive.ObjectID]*models.Comment),
+		idempotencyKeys: make(map[idempotencyKey]*memoryIdempotencyEntry),
+		opts:            opts,
+	}
+}
+
+func (t *InMemoryTodoServiceImpl) CreateTodo(_ context.Context, todo *models.CreateTodoRequest) (*models.Todo, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.createTodo(todo)
+}
+
+// createTodo is CreateTodo, t.mu must be held.
+func (t *InMemoryTodoServiceImpl) createTodo(todo *models.CreateTodoRequest) (*models.Todo, error) {
+	key := idempotencyKey{todo.User, todo.RequestId}
+	if entry, ok := t.idempotencyKeys[key]; ok && len(todo.RequestId) != 0 && entry.expiresAt.After(now()) {
+		// A retry is answered without checking the parent and the List again, they may be gone since.
+		replayed, err := replay(todo, entry.fingerprint, entry.todo)
+		if err != nil {
+			return nil, err
+		}
+		return copyTodo(replayed), nil
+	}
+	if err := t.checkNewTodo(todo); err != nil {
+		return nil, err
+	}
+	createdTodo, err := newTodo(todo)
+	if err != nil {
+		return nil, err
+	}
+	createdAt := createdTodo.CreatedAt
+
+	if len(todo.RequestId) != 0 {
+		t.purgeIdempotencyKeys(createdAt)
+		t.idempotencyKeys[key] = &memoryIdempotencyEntry{
+			fingerprint: requestFingerprint(todo),
+			todo:        copyTodo(createdTodo),
+			expiresAt:   createdAt.Add(t.opts.idempotencyWindow()),
+		}
+	}
+	t.todos[createdTodo.Id] = createdTodo
+
+	return copyTodo(createdTodo), nil
+}
+
+// purgeIdempotencyKeys forgets the request ids whose window is over, t.mu must be held.
+func (t *InMemoryTodoServiceImpl) purgeIdempotencyKeys(now time.Time) {
+	for key, entry := range t.idempotencyKeys {
+		if !entry.expiresAt.After(now) {
+			delete(t.idempotencyKeys, key)
+		}
+	}
+}
+
+func (t *InMemoryTodoServiceImpl) UpdateTodo(_ context.Context, id string, data *models.UpdateTodo) (*models.Todo, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.updateTodo(id, data)
+}
+
+// updateTodo is UpdateTodo, t.mu must be held. The stored Todo is replaced rather than modified, so that a
+// snapshot of the map taken for an atomic batch is left untouched.
+func (t *InMemoryTodoServiceImpl) updateTodo(id string, data *models.UpdateTodo) (*models.Todo, error) {
+	obId, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, ok := t.todos[obId]
+	if !ok || stored.Trashed() {
+		return nil, notFound(id)
+	}
+	if err := checkVersion(stored, data.ExpectedVersion); err != nil {
+		return nil, err
+	}
+	if movesList(data) {
+		if err := checkUpdatedList(stored, data, t.readList); err != nil {
+			return nil, err
+		}
+	}
+
+	// Only the fields set in data are applied, mirroring the Mongo $set.
+	todo := copyTodo(stored)
+	updated := false
+	if data.Title != nil {
+		todo.Title = *data.Title
+		updated = true
+	}
+	if data.Description != nil {
+		todo.Description = *data.Description
+		updated = true
+	}
+	if data.User != nil {
+		todo.User = *data.User
+		updated = true
+	}
+	if data.Done != nil {
+		todo.Done = *data.Done
+		updated = true
+	}
+	if data.DueAt != nil {
+		todo.DueAt = dueTime(*data.DueAt)
+		updated = true
+	}
+	if data.Priority != nil {
+		todo.Priority = *data.Priority
+		updated = true
+	}
+	if data.Tags != nil {
+		todo.Tags = normalizeTags(data.Tags)
+		updated = true
+	}
+	if data.ParentId != nil {
+		if err := t.checkParent(obId, *data.ParentId); err != nil {
+			return nil, err
+		}
+		todo.ParentId, _ = parseParentId(*data.ParentId)
+		updated = true
+	}
+	if data.Recurrence != nil {
+		if todo.Recurrence, err = normalizeRecurrence(*data.Recurrence); err != nil {
+			return nil, err
+		}
+		updated = true
+	}
+	if data.Reminders != nil {
+		reminders, err := normalizeReminders(data.Reminders, todo.Reminders)
+		if err != nil {
+			return nil, err
+		}
+		setReminders(todo, reminders)
+		updated = true
+	}
+	if data.ListId != nil {
+		todo.ListId, _ = parseListId(*data.ListId)
+		updated = true
+	}
+	var open []primitive.ObjectID
+	if t.opts.completesDescendants(data) {
+		open = t.openDescendants(obId)
+		if err := t.opts.checkCompletion(id, len(open)); err != nil {
+			return nil, err
+		}
+	}
+	if updated {
+		todo.UpdatedAt = now()
+		todo.Version++
+		next, err := nextOccurrence(todo, data, todo.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		if next != nil {
+			todo.NextOccurrenceId = next.Id
+			t.todos[next.Id] = next
+		}
+		t.todos[obId] = todo
+	}
+	t.completeDescendants(open, todo.UpdatedAt)
+
+	return copyTodo(todo), nil
+}
+
+// completeDescendants marks the open descendants of a Todo completed at doneAt done. Callers hold mu.
+func (t *InMemoryTodoServiceImpl) completeDescendants(open []primitive.ObjectID, doneAt time.Time) {
+	for _, descendantId := range open {
+		descendant := copyTodo(t.todos[descendantId])
+		descendant.Done = true
+		descendant.UpdatedAt = doneAt
+		descendant.Version++
+		t.todos[descendantId] = descendant
+	}
+}
+
+func (t *InMemoryTodoServiceImpl) GetTodoById(_ context.Context, id string) (*models.Todo, error) {
+	objectId, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	todo, ok := t.todos[objectId]
+	if !ok || todo.Trashed() {
+		return nil, notFound(id)
+	}
+	return copyTodo(todo), nil
+}
+
+func (t *InMemoryTodoServiceImpl) GetAllTodos(ctx context.Context, query *models.TodoQuery, fn func(*models.Todo) error) (string, error) {
+	token, err := decodePageToken(query)
+	if err != nil {
+		return "", err
+	}
+
+	dueAfter, dueBefore, filterDue := dueRange(query)
+
+	var subtreeRoot primitive.ObjectID
+	if len(query.SubtreeOf) != 0 {
+		if subtreeRoot, err = parseSubtreeOf(query.SubtreeOf); err != nil {
+			return "", err
+		}
+	}
+
+	var listId primitive.ObjectID
+	if query.ListId != nil {
+		if listId, err = parseListId(*query.ListId); err != nil {
+			return "", err
+		}
+	}
+
+	// The matching Todos are copied so that fn runs without holding the lock, the store is in memory anyway.
+	t.mu.RLock()
+	var subtree map[primitive.ObjectID]bool
+	if !subtreeRoot.IsZero() {
+		// The root itself is matched by the other filters, Trashed included.
+		subtree = map[primitive.ObjectID]bool{subtreeRoot: true}
+		for _, id := range t.descendants(subtreeRoot) {
+			subtree[id] = true
+		}
+	}
+	todoList := []*models.Todo{}
+	for _, todo := range t.todos {
+		switch query.Status {
+		case pb.GetItemsRequest_DONE:
+			if !todo.Done {
+				continue
+			}
+		case pb.GetItemsRequest_PENDING:
+			if todo.Done {
+				continue
+			}
+		default:
+			// do nothing, since we need all the Todos
+		}
+		if todo.Trashed() != query.Trashed {
+			continue
+		}
+		if query.Overdue && todo.Done {
+			continue
+		}
+		if filterDue && !inDueRange(todo.DueAt, dueAfter, dueBefore) {
+			continue
+		}
+		if todo.Priority < query.MinPriority {
+			continue
+		}
+		if !matchesTags(query, todo.Tags) {
+			continue
+		}
+		if len(query.User) != 0 && todo.User != query.User {
+			continue
+		}
+		if subtree != nil && !subtree[todo.Id] {
+			continue
+		}
+		if query.ListId != nil && todo.ListId != listId {
+			continue
+		}
+		if token != nil && !afterToken(query, token, todo) {
+			continue
+		}
+		todoList = append(todoList, copyTodo(todo))
+	}
+	t.mu.RUnlock()
+
+	sort.Slice(todoList, func(i, j int) bool {
+		return compareTodos(query, todoList[i], todoList[j]) < 0
+	})
+
+	page := newPageWriter(query, fn)
+	for _, todo := range todoList {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if err := page.write(todo); err == errPageFull {
+			break
+		} else if err != nil {
+			return "", err
+		}
+	}
+	return page.nextPageToken, nil
+}
+
+func (t *InMemoryTodoServiceImpl) DeleteTodo(_ context.Context, id string, expectedVersion int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.deleteTodo(id, expectedVersion)
+}
+
+// deleteTodo is DeleteTodo, t.mu must be held.
+func (t *InMemoryTodoServiceImpl) deleteTodo(id string, expectedVersion int64) error {
+	_, err := t.moveTodo(id, expectedVersion, false, func(todo *models.Todo) { todo.DeletedAt = now() })
+	return err
+}
+
+func (t *InMemoryTodoServiceImpl) DeleteTodoTree(_ context.Context, id string, expectedVersion int64) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	objectId, err := parseId(id)
+	if err != nil {
+		return err
+	}
+	descendants := t.descendants(objectId)
+	deleted, err := t.moveTodo(id, expectedVersion, false, func(todo *models.Todo) { todo.DeletedAt = now() })
+	if err != nil {
+		return err
+	}
+	for _, descendantId := range descendants {
+		descendant := copyTodo(t.todos[descendantId])
+		descendant.DeletedAt = deleted.DeletedAt
+		descendant.Version++
+		t.todos[descendantId] = descendant
+	}
+	return nil
+}
+
+func (t *InMemoryTodoServiceImpl) RestoreTodo(_ context.Context, id string, expectedVersion int64) (*models.Todo, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.moveTodo(id, expectedVersion, true, func(todo *models.Todo) { todo.DeletedAt = time.Time{} })
+}
+
+// moveTodo moves a Todo in or out of the trash with move, trashed tells where the Todo has to be. t.mu must be held.
+func (t *InMemoryTodoServiceImpl) moveTodo(id string, expectedVersion int64, trashed bool, move func(todo *models.Todo)) (*models.Todo, error) {
+	objectId, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, ok := t.todos[objectId]
+	if !ok || stored.Trashed() != trashed {
+		return nil, notFound(id)
+	}
+	if err := checkVersion(stored, expectedVersion); err != nil {
+		return nil, err
+	}
+	todo := copyTodo(stored)
+	move(todo)
+	todo.Version++
+	t.todos[objectId] = todo
+	return copyTodo(todo), nil
+}
+
+func (t *InMemoryTodoServiceImpl) PurgeTodo(_ context.Context, id string, expectedVersion int64) error {
+	objectId, err := parseId(id)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	todo, ok := t.todos[objectId]
+	if !ok || !todo.Trashed() {
+		return notFound(id)
+	}
+	if err := checkVersion(todo, expectedVersion); err != nil {
+		return err
+	}
+	delete(t.todos, objectId)
+	t.deleteComments(objectId)
+	return nil
+}
+
+func (t *InMemoryTodoServiceImpl) PurgeTrash(_ context.Context, deletedBefore time.Time) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var purged int64
+	for id, todo := range t.todos {
+		if todo.Trashed() && !todo.DeletedAt.After(deletedBefore) {
+			delete(t.todos, id)
+			t.deleteComments(id)
+			purged++
+		}
+	}
+	return purged, nil
+}
+
+func (t *InMemoryTodoServiceImpl) ListTags(_ context.Context, user string) ([]*models.TagCount, error) {
+	t.mu.RLock()
+	counts := make(map[string]int64)
+	for _, todo := range t.todos {
+		if todo.User != user || todo.Trashed() {
+			continue
+		}
+		for _, tag := range todo.Tags {
+			counts[tag]++
+		}
+	}
+	t.mu.RUnlock()
+
+	tags := make([]*models.TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, &models.TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Tag < tags[j].Tag })
+	return tags, nil
+}
+
+func (t *InMemoryTodoServiceImpl) RenameTag(_ context.Context, user, from, to string) (int64, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var renamed int64
+	updatedAt := now()
+	for id, stored := range t.todos {
+		if stored.User != user {
+			continue
+		}
+		tags := renameTag(stored.Tags, from, to)
+		if tags == nil {
+			continue
+		}
+		todo := copyTodo(stored)
+		todo.Tags = tags
+		todo.UpdatedAt = updatedAt
+		todo.Version++
+		t.todos[id] = todo
+		renamed++
+	}
+	return renamed, nil
+}
+
+func (t *InMemoryTodoServiceImpl) AddChecklistItem(_ context.Context, id, text string, expectedVersion int64) (*models.Todo, error) {
+	return t.editChecklist(id, expectedVersion, addChecklistItem(text))
+}
+
+func (t *InMemoryTodoServiceImpl) ToggleChecklistItem(_ context.Context, id, itemId string, done bool, expectedVersion int64) (*models.Todo, error) {
+	return t.editChecklist(id, expectedVersion, toggleChecklistItem(itemId, done))
+}
+
+func (t *InMemoryTodoServiceImpl) ReorderChecklist(_ context.Context, id string, itemIds []string, expectedVersion int64) (*models.Todo, error) {
+	return t.editChecklist(id, expectedVersion, reorderChecklist(itemIds))
+}
+
+func (t *InMemoryTodoServiceImpl) RemoveChecklistItem(_ context.Context, id, itemId string, expectedVersion int64) (*models.Todo, error) {
+	return t.editChecklist(id, expectedVersion, removeChecklistItem(itemId))
+}
+
+// editChecklist applies edit to the checklist of the Todo. The descendants and the next occurrence of a Todo the
+// auto-completion marks done are written under the same lock, like UpdateTodo does.
+func (t *InMemoryTodoServiceImpl) editChecklist(id string, expectedVersion int64, edit checklistEdit) (*models.Todo, error) {
+	return t.editTodo(id, t.opts.editChecklist(expectedVersion, edit, func(todo *models.Todo) error {
+		data := completion()
+		var open []primitive.ObjectID
+		if t.opts.completesDescendants(data) {
+			open = t.openDescendants(todo.Id)
+			if err := t.opts.checkCompletion(id, len(open)); err != nil {
+				return err
+			}
+		}
+		next, err := nextOccurrence(todo, data, todo.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if next != nil {
+			todo.NextOccurrenceId = next.Id
+			t.todos[next.Id] = next
+		}
+		t.completeDescendants(open, todo.UpdatedAt)
+		return nil
+	}))
+}
+
+func (t *InMemoryTodoServiceImpl) SkipOccurrence(_ context.Context, id string, expectedVersion int64) (*models.Todo, error) {
+	return t.editTodo(id, skipOccurrence(expectedVersion))
+}
+
+func (t *InMemoryTodoServiceImpl) MoveTodo(ctx context.Context, id string, move *models.MoveTodo) (*models.Todo, error) {
+	target, err := moveTarget(move, func(id string) (*models.Todo, error) {
+		return t.GetTodoById(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	// editTodo holds the lock while the neighbour is looked for.
+	return t.editTodo(id, placeTodo(move, target, func(todo *models.Todo, before bool) (string, error) {
+		next := ""
+		for _, other := range t.todos {
+			if other.User != todo.User || other.ListId != todo.ListId || other.Id == todo.Id {
+				continue
+			}
+			if before && other.Position < target.Position && (len(next) == 0 || other.Position > next) {
+				next = other.Position
+			}
+			if !before && other.Position > target.Position && (len(next) == 0 || other.Position < next) {
+				next = other.Position
+			}
+		}
+		return next, nil
+	}))
+}
+
+func (t *InMemoryTodoServiceImpl) ClaimReminders(_ context.Context, now time.Time, lease time.Duration, limit int) ([]*models.ReminderClaim, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var due []*models.Todo
+	for _, todo := range t.todos {
+		if reminderClaimable(todo, now) {
+			due = append(due, todo)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextReminderAt.Before(due[j].NextReminderAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claims := make([]*models.ReminderClaim, 0, len(due))
+	for _, stored := range due {
+		todo := copyTodo(stored)
+		todo.ReminderLease = now.Add(lease)
+		todo.ReminderClaim = newReminderClaimId()
+		t.todos[todo.Id] = todo
+		claims = append(claims, newReminderClaim(copyTodo(todo), now))
+	}
+	return claims, nil
+}
+
+func (t *InMemoryTodoServiceImpl) CompleteReminders(_ context.Context, claim *models.ReminderClaim, sent []time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stored, ok := t.todos[claim.Todo.Id]
+	if !ok || stored.ReminderClaim != claim.Id {
+		return nil
+	}
+	todo := copyTodo(stored)
+	completeReminders(todo, claim, sent, now())
+	t.todos[todo.Id] = todo
+	return nil
+}
+
+func (t *InMemoryTodoServiceImpl) CreateList(_ context.Context, request *models.CreateListRequest) (*models.List, error) {
+	list, err := newList(request)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.lists[list.Id] = list
+	c := *list
+	return &c, nil
+}
+
+func (t *InMemoryTodoServiceImpl) GetList(_ context.Context, id string) (*models.List, error) {
+	objectId, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	list, ok := t.lists[objectId]
+	if !ok {
+		return nil, listNotFound(id)
+	}
+	c := *list
+	return &c, nil
+}
+
+func (t *InMemoryTodoServiceImpl) UpdateList(_ context.Context, id string, data *models.UpdateList) (*models.List, error) {
+	objectId, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stored, ok := t.lists[objectId]
+	if !ok {
+		return nil, listNotFound(id)
+	}
+	if err := checkListVersion(stored, data.ExpectedVersion); err != nil {
+		return nil, err
+	}
+	list := *stored
+	if _, err := updateList(&list, data); err != nil {
+		return nil, err
+	}
+	t.lists[objectId] = &list
+	c := list
+	return &c, nil
+}
+
+func (t *InMemoryTodoServiceImpl) DeleteList(_ context.Context, id string, expectedVersion int64, cascade bool) error {
+	objectId, err := parseId(id)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	list, ok := t.lists[objectId]
+	if !ok {
+		return listNotFound(id)
+	}
+	if err := checkListVersion(list, expectedVersion); err != nil {
+		return err
+	}
+	delete(t.lists, objectId)
+
+	movedAt := now()
+	for todoId, stored := range t.todos {
+		if stored.ListId != objectId {
+			continue
+		}
+		todo := copyTodo(stored)
+		todo.ListId = primitive.NilObjectID
+		todo.UpdatedAt = movedAt
+		if cascade && !todo.Trashed() {
+			todo.DeletedAt = movedAt
+		}
+		todo.Version++
+		t.todos[todoId] = todo
+	}
+	return nil
+}
+
+func (t *InMemoryTodoServiceImpl) ListLists(_ context.Context, user string) ([]*models.List, error) {
+	t.mu.RLock()
+	var lists []*models.List
+	for _, list := range t.lists {
+		if list.User == user {
+			c := *list
+			lists = append(lists, &c)
+		}
+	}
+	t.mu.RUnlock()
+	return withInbox(user, lists), nil
+}
+
+func (t *InMemoryTodoServiceImpl) AddComment(_ context.Context, todoId string, request *models.CreateCommentRequest) (*models.Comment, error) {
+	objectId, err := parseCommentTodoId(todoId)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := newComment(objectId, request)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.countComments(objectId, 1); err != nil {
+		return nil, err
+	}
+	t.comments[comment.Id] = comment
+	c := *comment
+	return &c, nil
+}
+
+func (t *InMemoryTodoServiceImpl) UpdateComment(_ context.Context, id, body string, expectedVersion int64) (*models.Comment, error) {
+	objectId, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stored, ok := t.liveComment(objectId)
+	if !ok {
+		return nil, commentNotFound(id)
+	}
+	comment := *stored
+	if err := editComment(&comment, body, expectedVersion); err != nil {
+		return nil, err
+	}
+	t.comments[objectId] = &comment
+	c := comment
+	return &c, nil
+}
+
+func (t *InMemoryTodoServiceImpl) DeleteComment(_ context.Context, id string, expectedVersion int64) error {
+	objectId, err := parseId(id)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	comment, ok := t.liveComment(objectId)
+	if !ok {
+		return commentNotFound(id)
+	}
+	if err := checkCommentVersion(comment, expectedVersion); err != nil {
+		return err
+	}
+	delete(t.comments, objectId)
+	return t.countComments(comment.TodoId, -1)
+}
+
+func (t *InMemoryTodoServiceImpl) ListComments(_ context.Context, todoId string) ([]*models.Comment, error) {
+	objectId, err := parseCommentTodoId(todoId)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if todo, ok := t.todos[objectId]; !ok || todo.Trashed() {
+		return nil, notFound(todoId)
+	}
+	comments := []*models.Comment{}
+	for _, comment := range t.comments {
+		if comment.TodoId == objectId {
+			c := *comment
+			comments = append(comments, &c)
+		}
+	}
+	return sortComments(comments), nil
+}
+
+// liveComment returns the Comment when its Todo is out of the trash. Callers hold mu.
+func (t *InMemoryTodoServiceImpl) liveComment(id primitive.ObjectID) (*models.Comment, bool) {
+	comment, ok := t.comments[id]
+	if !ok {
+		return nil, false
+	}
+	if todo, ok := t.todos[comment.TodoId]; !ok || todo.Trashed() {
+		return nil, false
+	}
+	return comment, true
+}
+
+// countComments adds delta to the CommentCount of the Todo out of the trash, leaving its version alone. Callers
+// hold mu.
+func (t *InMemoryTodoServiceImpl) countComments(id primitive.ObjectID, delta int64) error {
+	stored, ok := t.todos[id]
+	if !ok || stored.Trashed() {
+		return notFound(id.Hex())
+	}
+	todo := copyTodo(stored)
+	todo.CommentCount += delta
+	t.todos[id] = todo
+	return nil
+}
+
+// deleteComments deletes the Comments on the Todo. Callers hold mu.
+func (t *InMemoryTodoServiceImpl) deleteComments(todoId primitive.ObjectID) {
+	for id, comment := range t.comments {
+		if comment.TodoId == todoId {
+			delete(t.comments, id)
+		}
+	}
+}
+
+func (t *InMemoryTodoServiceImpl) editTodo(id string, edit todoEdit) (*models.Todo, error) {
+	objectId, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	stored, ok := t.todos[objectId]
+	if !ok || stored.Trashed() {
+		return nil, notFound(id)
+	}
+	todo := copyTodo(stored)
+	if err := edit(todo); err != nil {
+		return nil, err
+	}
+	t.todos[objectId] = todo
+	return copyTodo(todo), nil
+}
+
+func (t *InMemoryTodoServiceImpl) BatchCreateTodos(ctx context.Context, requests []*models.CreateTodoRequest, atomic bool) ([]BatchResult, error) {
+	return t.runBatch(ctx, createBatchIds(requests), atomic, func(i int) (*models.Todo, error) {
+		return t.createTodo(requests[i])
+	})
+}
+
+func (t *InMemoryTodoServiceImpl) BatchUpdateTodos(ctx context.Context, items []*models.BatchUpdateItem, atomic bool) ([]BatchResult, error) {
+	ids, err := updateBatchIds(items)
+	if err != nil {
+		return nil, err
+	}
+	return t.runBatch(ctx, ids, atomic, func(i int) (*models.Todo, error) {
+		return t.updateTodo(items[i].Id, items[i].Update)
+	})
+}
+
+func (t *InMemoryTodoServiceImpl) BatchDeleteTodos(ctx context.Context, items []*models.BatchDeleteItem, atomic bool) ([]BatchResult, error) {
+	ids, err := deleteBatchIds(items)
+	if err != nil {
+		return nil, err
+	}
+	return t.runBatch(ctx, ids, atomic, func(i int) (*models.Todo, error) {
+		return nil, t.deleteTodo(items[i].Id, items[i].ExpectedVersion)
+	})
+}
+
+// runBatch runs the whole batch under the lock. An atomic batch works on a copy of the maps, which only replaces
+// the stored ones when every item succeeded.
+func (t *InMemoryTodoServiceImpl) runBatch(ctx context.Context, ids []string, atomic bool, item func(i int) (*models.Todo, error)) ([]BatchResult, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !atomic {
+		return runBatch(ctx, ids, false, item)
+	}
+
+	todos, idempotencyKeys := t.todos, t.idempotencyKeys
+	t.todos = make(map[primitive.ObjectID]*models.Todo, len(todos))
+	for id, todo := range todos {
+		t.todos[id] = todo
+	}
+	t.idempotencyKeys = make(map[idempotencyKey]*memoryIdempotencyEntry, len(idempotencyKeys))
+	for key, entry := range idempotencyKeys {
+		t.idempotencyKeys[key] = entry
+	}
+
+	results, err := runBatch(ctx, ids, true, item)
+	if err != nil || batchFailed(results) {
+		t.todos, t.idempotencyKeys = todos, idempotencyKeys
+	}
+	return results, err
+}
+
+// checkParent checks that parentId can be the parent of the Todo id, t.mu must be held.
+func (t *InMemoryTodoServiceImpl) checkParent(id primitive.ObjectID, parentId string) error {
+	parentObjectId, err := parseParentId(parentId)
+	if err != nil {
+		return err
+	}
+	return checkParent(id, parentObjectId, func(id primitive.ObjectID) (*todoLink, error) {
+		todo, ok := t.todos[id]
+		if !ok {
+			return nil, nil
+		}
+		return &todoLink{parentId: todo.ParentId, trashed: todo.Trashed()}, nil
+	})
+}
+
+// checkNewTodo checks the parent and the List of a Todo to create, t.mu must be held.
+func (t *InMemoryTodoServiceImpl) checkNewTodo(request *models.CreateTodoRequest) error {
+	if err := t.checkParent(primitive.NilObjectID, request.ParentId); err != nil {
+		return err
+	}
+	listId, err := parseListId(request.ListId)
+	if err != nil {
+		return err
+	}
+	return checkList(request.User, listId, t.readList)
+}
+
+// readList reads a stored List for checkList, t.mu must be held.
+func (t *InMemoryTodoServiceImpl) readList(id primitive.ObjectID) (*models.List, error) {
+	return t.lists[id], nil
+}
+
+// descendants returns the Ids of the descendants of a Todo that are out of the trash, a Todo in the trash has none.
+// t.mu must be held.
+func (t *InMemoryTodoServiceImpl) descendants(id primitive.ObjectID) []primitive.ObjectID {
+	if root, ok := t.todos[id]; !ok || root.Trashed() {
+		return nil
+	}
+	children := make(map[primitive.ObjectID][]primitive.ObjectID)
+	for _, todo := range t.todos {
+		if !todo.ParentId.IsZero() && !todo.Trashed() {
+			children[todo.ParentId] = append(children[todo.ParentId], todo.Id)
+		}
+	}
+	var descendants []primitive.ObjectID
+	seen := map[primitive.ObjectID]bool{id: true}
+	for queue := children[id]; len(queue) != 0; queue = queue[1:] {
+		if child := queue[0]; !seen[child] {
+			seen[child] = true
+			descendants = append(descendants, child)
+			queue = append(queue, children[child]...)
+		}
+	}
+	return descendants
+}
+
+// openDescendants returns the Ids of the descendants of a Todo that are neither done nor in the trash, t.mu must be
+// held.
+func (t *InMemoryTodoServiceImpl) openDescendants(id primitive.ObjectID) []primitive.ObjectID {
+	var open []primitive.ObjectID
+	for _, descendantId := range t.descendants(id) {
+		if !t.todos[descendantId].Done {
+			open = append(open, descendantId)
+		}
+	}
+	return open
+}
+
+// copyTodo makes sure callers never hold a pointer into the store.
+func copyTodo(todo *models.Todo) *models.Todo {
+	c := *todo
+	if todo.Tags != nil {
+		c.Tags = append([]string{}, todo.Tags...)
+	}
+	if todo.Checklist != nil {
+		c.Checklist = append([]models.ChecklistItem{}, todo.Checklist...)
+	}
+	if todo.Reminders != nil {
+		c.Reminders = append([]models.Reminder{}, todo.Reminders...)
+	}
+	return &c
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/todo-project/models"
+	"github.com/todo-project/pb"
+	"github.com/todo-project/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestInMemoryTodoServiceImpl_CreateAndGetTodo(t *testing.T) {
+	todoImpl := NewInMemoryTodoService(Options{})
+
+	newTodo, err := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title:       "title",
+		Description: "desc",
+		User:        "1",
+	})
+	assert.Nil(t, err)
+	assert.False(t, newTodo.Id.IsZero())
+
+	todo, err := todoImpl.GetTodoById(context.TODO(), newTodo.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, newTodo, todo)
+
+	todo, err = todoImpl.GetTodoById(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Nil(t, todo)
+	assert.Equal(t, KindNotFound, KindOf(err))
+
+	_, err = todoImpl.GetTodoById(context.TODO(), "dummy_id")
+	assert.Equal(t, KindInvalidArgument, KindOf(err))
+}
+
+func TestInMemoryTodoServiceImpl_UpdateTodo(t *testing.T) {
+	todoImpl := NewInMemoryTodoService(Options{})
+	newTodo, _ := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "title", Description: "desc", User: "1"})
+
+	updatedTodo, err := todoImpl.UpdateTodo(context.TODO(), newTodo.Id.Hex(), &models.UpdateTodo{Title: utils.Pointer("new title"), Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	assert.Equal(t, &models.Todo{
+		Id:          newTodo.Id,
+		Title:       "new title",
+		Description: "desc",
+		User:        "1",
+		Done:        true,
+		CreatedAt:   newTodo.CreatedAt,
+		UpdatedAt:   updatedTodo.UpdatedAt,
+		Version:     2,
+		Position:    newTodo.Position,
+	}, updatedTodo)
+
+	// Returned todos must not alias the stored ones.
+	updatedTodo.Title = "changed outside"
+	todo, _ := todoImpl.GetTodoById(context.TODO(), newTodo.Id.Hex())
+	assert.Equal(t, "new title", todo.Title)
+
+	_, err = todoImpl.UpdateTodo(context.TODO(), primitive.NewObjectID().Hex(), &models.UpdateTodo{Title: utils.Pointer("title")})
+	assert.Equal(t, KindNotFound, KindOf(err))
+}
+
+func TestInMemoryTodoServiceImpl_GetAllTodos(t *testing.T) {
+	todoImpl := NewInMemoryTodoService(Options{})
+	todo1, _ := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "one", User: "1"})
+	todo2, _ := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "two", User: "2"})
+	todo3, _ := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "three", User: "2"})
+	todo3, _ = todoImpl.UpdateTodo(context.TODO(), todo3.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+
+	todos, err := collectTodos(todoImpl, &models.TodoQuery{Status: pb.GetItemsRequest_ALL})
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.Todo{todo1, todo2, todo3}, todos)
+
+	todos, err = collectTodos(todoImpl, &models.TodoQuery{Status: pb.GetItemsRequest_DONE, User: "2"})
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.Todo{todo3}, todos)
+
+	todos, err = collectTodos(todoImpl, &models.TodoQuery{Status: pb.GetItemsRequest_PENDING, User: "2"})
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.Todo{todo2}, todos)
+
+	todos, err = collectTodos(todoImpl, &models.TodoQuery{Status: pb.GetItemsRequest_ALL, User: "3"})
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.Todo{}, todos)
+}
+
+func TestInMemoryTodoServiceImpl_DeleteTodo(t *testing.T) {
+	todoImpl := NewInMemoryTodoService(Options{})
+	newTodo, _ := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "title", User: "1"})
+
+	err := todoImpl.DeleteTodo(context.TODO(), newTodo.Id.Hex(), 0)
+	assert.Nil(t, err)
+
+	err = todoImpl.DeleteTodo(context.TODO(), newTodo.Id.Hex(), 0)
+	assert.Equal(t, KindNotFound, KindOf(err))
+}
@@ -0,0 +1,1649 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+	"github.com/todo-project/models"
+	"github.com/todo-project/pb"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const todoColumns = `id, title, description, user_id, done, created_at, updated_at, version, deleted_at, due_at, priority, parent_id, recurrence, next_occurrence_id, next_reminder_at, reminder_lease, reminder_claim, list_id, position, comment_count`
+
+const listColumns = `id, user_id, name, created_at, updated_at, version`
+
+const commentColumns = `id, todo_id, author, body, created_at, updated_at, version`
+
+// tagSeparator joins the tags of a Todo when they are read along with it. Tags cannot contain control characters.
+const tagSeparator = "\x1f"
+
+// sqlDialect holds what differs between the SQL databases we support. Queries are always written
+// with '?' placeholders and rebound for the database they run against.
+type sqlDialect struct {
+	migrations []migration
+	rebind     func(query string) string
+	// timeArg converts a time into the representation stored in the timestamp columns.
+	timeArg func(t time.Time) interface{}
+	// isUniqueViolation reports whether err is the driver error of a violated primary key or unique index.
+	isUniqueViolation func(err error) bool
+	// abortsTxOnError is set when a failed statement leaves the transaction unusable until it is rolled back.
+	abortsTxOnError bool
+	// noDueSortTime is the noDueSortTime literal, for the ORDER BY clauses.
+	noDueSortTime string
+	// tagsColumn selects the tags of a Todo in order, joined by tagSeparator.
+	tagsColumn string
+}
+
+var sqliteDialect = sqlDialect{
+	migrations:    sqliteMigrations,
+	rebind:        func(query string) string { return query },
+	timeArg:       func(t time.Time) interface{} { return t.UnixMilli() },
+	noDueSortTime: strconv.FormatInt(noDueSortTime.UnixMilli(), 10),
+	// SQLite has no ordered aggregates, the rows are ordered by a subquery instead.
+	tagsColumn: `(SELECT group_concat(tag, char(31)) FROM
+		(SELECT tag FROM todo_tags WHERE todo_id = todos.id ORDER BY position))`,
+	isUniqueViolation: func(err error) bool {
+		var sqliteErr sqlite3.Error
+		return errors.As(err, &sqliteErr) && sqliteErr.Code == sqlite3.ErrConstraint &&
+			(sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey || sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique)
+	},
+}
+
+var postgresDialect = sqlDialect{
+	migrations: postgresMigrations,
+	rebind:     rebindDollar,
+	timeArg:    func(t time.Time) interface{} { return t },
+	isUniqueViolation: func(err error) bool {
+		var pqErr *pq.Error
+		return errors.As(err, &pqErr) && pqErr.Code == "23505"
+	},
+	abortsTxOnError: true,
+	noDueSortTime:   `'` + noDueSortTime.Format("2006-01-02 15:04:05.000Z07:00") + `'::timestamptz`,
+	tagsColumn:      `(SELECT string_agg(tag, chr(31) ORDER BY position) FROM todo_tags WHERE todo_id = todos.id)`,
+}
+
+// SQLTodoServiceImpl stores the Todos in a relational database through database/sql.
+// Ids are still ObjectIds, stored as their hex representation, so they look the same for every backend.
+type SQLTodoServiceImpl struct {
+	db *sql.DB
+	// tx is set on the copies of the service made by inTx, every statement then runs in that transaction.
+	tx      *sql.Tx
+	dialect sqlDialect
+	opts    Options
+}
+
+// NewSQLiteTodoService expects a database already migrated with MigrateSQLite.
+func NewSQLiteTodoService(db *sql.DB, opts Options) TodoService {
+	return &SQLTodoServiceImpl{db: db, dialect: sqliteDialect, opts: opts}
+}
+
+// NewPostgresTodoService expects a database already migrated with MigratePostgres.
+func NewPostgresTodoService(db *sql.DB, opts Options) TodoService {
+	return &SQLTodoServiceImpl{db: db, dialect: postgresDialect, opts: opts}
+}
+
+// inTx runs fn with a copy of the service bound to a transaction, which is committed when fn succeeds. When t is
+// already bound to one, fn joins it.
+func (t *SQLTodoServiceImpl) inTx(ctx context.Context, fn func(t *SQLTodoServiceImpl) error) error {
+	if t.tx != nil {
+		return fn(t)
+	}
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	inTx := *t
+	inTx.tx = tx
+	if err := fn(&inTx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (t *SQLTodoServiceImpl) CreateTodo(ctx context.Context, todo *models.CreateTodoRequest) (*models.Todo, error) {
+	createdTodo, err := newTodo(todo)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(todo.RequestId) != 0 {
+		return t.createIdempotent(ctx, todo, createdTodo)
+	}
+	if err := t.checkNewTodo(ctx, todo); err != nil {
+		return nil, err
+	}
+	if err := t.insertTodo(ctx, createdTodo); err != nil {
+		return nil, err
+	}
+
+	return createdTodo, nil
+}
+
+// createIdempotent inserts the Todo along with its request id, in one transaction. When the request id is already
+// known the remembered Todo is returned instead, without checking the parent and the List again.
+func (t *SQLTodoServiceImpl) createIdempotent(ctx context.Context, request *models.CreateTodoRequest, createdTodo *models.Todo) (*models.Todo, error) {
+	todoJSON, err := json.Marshal(createdTodo)
+	if err != nil {
+		return nil, err
+	}
+
+	var todo *models.Todo
+	err = t.inTx(ctx, func(t *SQLTodoServiceImpl) error {
+		// Expired request ids are dropped first, so that they can be used again.
+		_, err := t.exec(ctx, `DELETE FROM idempotency_keys WHERE expires_at <= ?`, t.dialect.timeArg(createdTodo.CreatedAt))
+		if err != nil {
+			return err
+		}
+		// The key goes first: a conflict would abort a Postgres transaction, DO NOTHING leaves it usable.
+		res, err := t.exec(ctx, `INSERT INTO idempotency_keys (user_id, request_id, fingerprint, todo, expires_at)
+			VALUES (?, ?, ?, ?, ?) ON CONFLICT DO NOTHING`, request.User, request.RequestId, requestFingerprint(request),
+			string(todoJSON), t.dialect.timeArg(createdTodo.CreatedAt.Add(t.opts.idempotencyWindow())))
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			todo, err = t.replay(ctx, request)
+			return err
+		}
+		if err := t.checkNewTodo(ctx, request); err != nil {
+			return err
+		}
+		todo = createdTodo
+		return t.insertTodo(ctx, createdTodo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return todo, nil
+}
+
+func (t *SQLTodoServiceImpl) replay(ctx context.Context, request *models.CreateTodoRequest) (*models.Todo, error) {
+	var fingerprint, todoJSON string
+	err := t.queryRow(ctx, `SELECT fingerprint, todo FROM idempotency_keys WHERE user_id = ? AND request_id = ?`,
+		request.User, request.RequestId).Scan(&fingerprint, &todoJSON)
+	if err != nil {
+		return nil, err
+	}
+	todo := &models.Todo{}
+	if err := json.Unmarshal([]byte(todoJSON), todo); err != nil {
+		return nil, err
+	}
+	return replay(request, fingerprint, todo)
+}
+
+// insertTodo inserts the Todo and its tags, in a transaction when there are tags.
+func (t *SQLTodoServiceImpl) insertTodo(ctx context.Context, todo *models.Todo) error {
+	if len(todo.Tags) != 0 && t.tx == nil {
+		return t.inTx(ctx, func(t *SQLTodoServiceImpl) error { return t.insertTodo(ctx, todo) })
+	}
+	checklist, err := checklistArg(todo.Checklist)
+	if err != nil {
+		return err
+	}
+	reminders, err := remindersArg(todo.Reminders)
+	if err != nil {
+		return err
+	}
+	_, err = t.exec(ctx, `INSERT INTO todos (`+todoColumns+`, checklist, reminders) VALUES (`+placeholders(22)+`)`,
+		todo.Id.Hex(), todo.Title, todo.Description, todo.User, todo.Done,
+		t.dialect.timeArg(todo.CreatedAt), t.dialect.timeArg(todo.UpdatedAt), todo.Version, t.nullTimeArg(todo.DeletedAt),
+		t.nullTimeArg(todo.DueAt), int32(todo.Priority), objectIdArg(todo.ParentId), todo.Recurrence,
+		objectIdArg(todo.NextOccurrenceId), t.nullTimeArg(todo.NextReminderAt), t.nullTimeArg(todo.ReminderLease),
+		todo.ReminderClaim, objectIdArg(todo.ListId), todo.Position, todo.CommentCount, checklist, reminders)
+	if err != nil {
+		if t.dialect.isUniqueViolation(err) {
+			return conflict(todo.Id.Hex(), ErrTodoExists)
+		}
+		return err
+	}
+	return t.insertTags(ctx, todo.Id.Hex(), todo.Tags)
+}
+
+// continueSeries creates the next occurrence of a recurring Todo the update marked done at doneAt, and links the
+// Todo to it.
+func (t *SQLTodoServiceImpl) continueSeries(ctx context.Context, id string, data *models.UpdateTodo, doneAt time.Time) error {
+	todo, err := t.GetTodoById(ctx, id)
+	if err != nil {
+		return err
+	}
+	next, err := nextOccurrence(todo, data, doneAt)
+	if err != nil || next == nil {
+		return err
+	}
+	if err := t.insertTodo(ctx, next); err != nil {
+		return err
+	}
+	_, err = t.exec(ctx, `UPDATE todos SET next_occurrence_id = ? WHERE id = ?`, next.Id.Hex(), id)
+	return err
+}
+
+// insertTags stores the tags of a Todo, which must have none yet.
+func (t *SQLTodoServiceImpl) insertTags(ctx context.Context, id string, tags []string) error {
+	for position, tag := range tags {
+		_, err := t.exec(ctx, `INSERT INTO todo_tags (todo_id, tag, position) VALUES (?, ?, ?)`, id, tag, position)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *SQLTodoServiceImpl) UpdateTodo(ctx context.Context, id string, data *models.UpdateTodo) (*models.Todo, error) {
+	obId, err := parseId(id)
+	if err != nil {
+		return nil, err
+	}
+	// Only the fields set in data are applied, like the Mongo $set.
+	var sets []string
+	var args []interface{}
+	if data.Title != nil {
+		sets = append(sets, "title = ?")
+		args = append(args, *data.Title)
+	}
+	if data.Description != nil {
+		sets = append(sets, "description = ?")
+		args = append(args, *data.Description)
+	}
+	if data.User != nil {
+		sets = append(sets, "user_id = ?")
+		args = append(args, *data.User)
+	}
+	if data.Done != nil {
+		sets = append(sets, "done = ?")
+		args = append(args, *data.Done)
+	}
+	if data.DueAt != nil {
+		sets = append(sets, "due_at = ?")
+		args = append(args, t.nullTimeArg(dueTime(*data.DueAt)))
+	}
+	if data.Priority != nil {
+		sets = append(sets, "priority = ?")
+		args = append(args, int32(*data.Priority))
+	}
+	if data.ParentId != nil {
+		parentId, err := parseParentId(*data.ParentId)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, "parent_id = ?")
+		args = append(args, objectIdArg(parentId))
+	}
+	if data.Recurrence != nil {
+		rule, err := normalizeRecurrence(*data.Recurrence)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, "recurrence = ?")
+		args = append(args, rule)
+	}
+	if data.ListId != nil {
+		listId, err := parseListId(*data.ListId)
+		if err != nil {
+			return nil, err
+		}
+		sets = append(sets, "list_id = ?")
+		args = append(args, objectIdArg(listId))
+	}
+	if data.Reminders != nil {
+		// Checked before the update, they are only written once the ones already sent are read in its transaction.
+		if _, err := normalizeReminders(data.Reminders, nil); err != nil {
+			return nil, err
+		}
+	}
+	if len(sets) == 0 && data.Tags == nil && data.Reminders == nil {
+		todo, err := t.GetTodoById(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkVersion(todo, data.ExpectedVersion); err != nil {
+			return nil, err
+		}
+		return todo, nil
+	}
+	updatedAt := now()
+	sets = append(sets, "updated_at = ?", "version = version + 1")
+	args = append(args, t.dialect.timeArg(updatedAt))
+
+	stmt := `UPDATE todos SET ` + strings.Join(sets, ", ") + ` WHERE id = ? AND deleted_at IS NULL`
+	args = append(args, id)
+	if data.ExpectedVersion != 0 {
+		stmt += ` AND version = ?`
+		args = append(args, data.ExpectedVersion)
+	}
+	update := func(t *SQLTodoServiceImpl) error {
+		if movesList(data) {
+			stored, err := t.GetTodoById(ctx, id)
+			if err != nil {
+				return err
+			}
+			if err := checkVersion(stored, data.ExpectedVersion); err != nil {
+				return err
+			}
+			if err := checkUpdatedList(stored, data, t.readList(ctx)); err != nil {
+				return err
+			}
+		}
+		if data.ParentId != nil {
+			if err := t.checkParent(ctx, obId, *data.ParentId); err != nil {
+				return err
+			}
+		}
+		var open []string
+		if t.opts.completesDescendants(data) {
+			var err error
+			if open, err = t.descendants(ctx, id, true); err != nil {
+				return err
+			}
+			if err := t.opts.checkCompletion(id, len(open)); err != nil {
+				return err
+			}
+		}
+
+		res, err := t.exec(ctx, stmt, args...)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return t.writeMissed(ctx, id, data.ExpectedVersion, false)
+		}
+		if len(open) != 0 {
+			_, err := t.exec(ctx, `UPDATE todos SET done = ?, updated_at = ?, version = version + 1 WHERE id IN (`+placeholders(len(open))+`)`,
+				append([]interface{}{true, t.dialect.timeArg(updatedAt)}, stringArgs(open)...)...)
+			if err != nil {
+				return err
+			}
+		}
+		if data.Tags != nil {
+			if _, err := t.exec(ctx, `DELETE FROM todo_tags WHERE todo_id = ?`, id); err != nil {
+				return err
+			}
+			if err := t.insertTags(ctx, id, normalizeTags(data.Tags)); err != nil {
+				return err
+			}
+		}
+		if data.Reminders != nil {
+			if err := t.replaceReminders(ctx, id, data.Reminders); err != nil {
+				return err
+			}
+		}
+		if data.Done == nil || !*data.Done {
+			return nil
+		}
+		return t.continueSeries(ctx, id, data, updatedAt)
+	}
+	if data.Tags != nil || data.ParentId != nil || movesList(data) || data.Reminders != nil || (data.Done != nil && *data.Done) {
+		// The tags and reminders are replaced, the hierarchy and List read and the next occurrence created in the
+		// transaction of the update.
+		err = t.inTx(ctx, update)
+	} else {
+		err = update(t)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return t.GetTodoById(ctx, id)
+}
+
+// replaceReminders replaces the reminders of a Todo, keeping the ones already sent.
+func (t *SQLTodoServiceImpl) replaceReminders(ctx context.Context, id string, times []time.Time) error {
+	todo, err := t.GetTodoById(ctx, id)
+	if err != nil {
+		return err
+	}
+	normalized, err := normalizeReminders(times, todo.Reminders)
+	if err != nil {
+		return err
+	}
+	setReminders(todo, normalized)
+	reminders, err := remindersArg(todo.Reminders)
+	if err != nil {
+		return err
+	}
+	_, err = t.exec(ctx, `UPDATE todos SET reminders = ?, next_reminder_at = ? WHERE id = ?`,
+		reminders, t.nullTimeArg(todo.NextReminderAt), id)
+	return err
+}
+
+func (t *SQLTodoServiceImpl) GetTodoById(ctx context.Context, id string) (*models.Todo, error) {
+	return t.getTodo(ctx, id, false)
+}
+
+// getTodo reads a Todo that is in the trash or not, as told by trashed.
+func (t *SQLTodoServiceImpl) getTodo(ctx context.Context, id string, trashed bool) (*models.Todo, error) {
+	if _, err := parseId(id); err != nil {
+		return nil, err
+	}
+	row := t.queryRow(ctx, t.selectTodos()+` WHERE id = ? AND deleted_at IS `+nullCheck(trashed), id)
+	todo, err := scanTodo(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, notFound(id)
+		}
+		return nil, err
+	}
+	return todo, nil
+}
+
+func (t *SQLTodoServiceImpl) GetAllTodos(ctx context.Context, query *models.TodoQuery, fn func(*models.Todo) error) (string, error) {
+	token, err := decodePageToken(query)
+	if err != nil {
+		return "", err
+	}
+
+	where := []string{"deleted_at IS " + nullCheck(query.Trashed)}
+	var args []interface{}
+	switch query.Status {
+	case pb.GetItemsRequest_DONE:
+		where = append(where, "done = ?")
+		args = append(args, true)
+	case pb.GetItemsRequest_PENDING:
+		where = append(where, "done = ?")
+		args = append(args, false)
+	default:
+		// do nothing, since we need all the Todos
+	}
+	if len(query.User) != 0 {
+		where = append(where, "user_id = ?")
+		args = append(args, query.User)
+	}
+	if query.Overdue {
+		where = append(where, "done = ?")
+		args = append(args, false)
+	}
+	// A NULL due_at fails every comparison, the Todos without due time are left out.
+	if dueAfter, dueBefore, ok := dueRange(query); ok {
+		where = append(where, "due_at IS NOT NULL")
+		if !dueAfter.IsZero() {
+			where = append(where, "due_at >= ?")
+			args = append(args, t.dialect.timeArg(dueAfter))
+		}
+		if !dueBefore.IsZero() {
+			where = append(where, "due_at < ?")
+			args = append(args, t.dialect.timeArg(dueBefore))
+		}
+	}
+
+	if query.MinPriority != pb.Priority_NONE {
+		where = append(where, "priority >= ?")
+		args = append(args, int32(query.MinPriority))
+	}
+	if len(query.SubtreeOf) != 0 {
+		if _, err := parseSubtreeOf(query.SubtreeOf); err != nil {
+			return "", err
+		}
+		where = append(where, "id IN ("+subtreeQuery+" SELECT id FROM subtree)")
+		args = append(args, query.SubtreeOf)
+	}
+	if query.ListId != nil {
+		listId, err := parseListId(*query.ListId)
+		if err != nil {
+			return "", err
+		}
+		if listId.IsZero() {
+			where = append(where, "list_id IS NULL")
+		} else {
+			where = append(where, "list_id = ?")
+			args = append(args, listId.Hex())
+		}
+	}
+	if tags := normalizeTags(query.TagsAny); len(tags) != 0 {
+		where = append(where, "id IN (SELECT todo_id FROM todo_tags WHERE tag IN ("+placeholders(len(tags))+"))")
+		args = append(args, stringArgs(tags)...)
+	}
+	if tags := normalizeTags(query.TagsAll); len(tags) != 0 {
+		where = append(where, "id IN (SELECT todo_id FROM todo_tags WHERE tag IN ("+placeholders(len(tags))+
+			") GROUP BY todo_id HAVING COUNT(*) = ?)")
+		args = append(append(args, stringArgs(tags)...), len(tags))
+	}
+	if tags := normalizeTags(query.TagsNone); len(tags) != 0 {
+		where = append(where, "id NOT IN (SELECT todo_id FROM todo_tags WHERE tag IN ("+placeholders(len(tags))+"))")
+		args = append(args, stringArgs(tags)...)
+	}
+
+	keys := t.sortKeys(query, token)
+	if token != nil {
+		cond, keyArgs := keysetCondition(keys)
+		where = append(where, cond)
+		args = append(args, keyArgs...)
+	}
+	order := make([]string, len(keys))
+	for i, key := range keys {
+		order[i] = key.expr + " ASC"
+		if key.descending {
+			order[i] = key.expr + " DESC"
+		}
+	}
+
+	stmt := t.selectTodos() + ` WHERE ` + strings.Join(where, " AND ")
+	stmt += ` ORDER BY ` + strings.Join(order, ", ")
+	page := newPageWriter(query, fn)
+	if limit := page.limit(); limit != 0 {
+		stmt += ` LIMIT ` + strconv.Itoa(limit)
+	}
+
+	rows, err := t.query(ctx, stmt, args...)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		todo, err := scanTodo(rows)
+		if err != nil {
+			return "", err
+		}
+		if err := page.write(todo); err == errPageFull {
+			break
+		} else if err != nil {
+			return "", err
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		return "", err
+	}
+	return page.nextPageToken, nil
+}
+
+// sqlSortKey is one expression of the order of a query, along with its value for the last Todo of the previous page.
+type sqlSortKey struct {
+	expr       string
+	descending bool
+	last       interface{}
+}
+
+// sortKeys returns the order of a query, ending with the id. The last values are only set when token is.
+func (t *SQLTodoServiceImpl) sortKeys(query *models.TodoQuery, token *pageToken) []sqlSortKey {
+	if token == nil {
+		token = &pageToken{}
+	}
+	lastTime := t.dialect.timeArg(time.UnixMilli(token.Time).UTC())
+
+	var keys []sqlSortKey
+	switch {
+	case query.Trashed:
+		keys = []sqlSortKey{{"deleted_at", false, lastTime}}
+	case query.SortBy == pb.GetItemsRequest_UPDATED_AT:
+		keys = []sqlSortKey{{"updated_at", false, lastTime}}
+	case query.SortBy == pb.GetItemsRequest_TITLE:
+		keys = []sqlSortKey{{"title", false, token.Title}}
+	case query.SortBy == pb.GetItemsRequest_POSITION:
+		keys = []sqlSortKey{{"position", false, token.Position}}
+	case query.SortBy == pb.GetItemsRequest_PRIORITY:
+		keys = []sqlSortKey{
+			{"priority", true, int32(token.Priority)},
+			{"COALESCE(due_at, " + t.dialect.noDueSortTime + ")", false, lastTime},
+		}
+	case query.SortBy == pb.GetItemsRequest_DUE_AT:
+		keys = []sqlSortKey{{"COALESCE(due_at, " + t.dialect.noDueSortTime + ")", false, lastTime}}
+	default:
+		keys = []sqlSortKey{{"created_at", false, lastTime}}
+	}
+	keys = append(keys, sqlSortKey{"id", false, token.Id.Hex()})
+	if query.Descending {
+		for i := range keys {
+			keys[i].descending = !keys[i].descending
+		}
+	}
+	return keys
+}
+
+// keysetCondition matches the rows ordered after the last values of keys.
+func keysetCondition(keys []sqlSortKey) (string, []interface{}) {
+	var or []string
+	var args []interface{}
+	for i, key := range keys {
+		var and []string
+		for _, equal := range keys[:i] {
+			and = append(and, equal.expr+" = ?")
+			args = append(args, equal.last)
+		}
+		if key.descending {
+			and = append(and, key.expr+" < ?")
+		} else {
+			and = append(and, key.expr+" > ?")
+		}
+		args = append(args, key.last)
+		or = append(or, "("+strings.Join(and, " AND ")+")")
+	}
+	return "(" + strings.Join(or, " OR ") + ")", args
+}
+
+func (t *SQLTodoServiceImpl) DeleteTodo(ctx context.Context, id string, expectedVersion int64) error {
+	return t.moveTodo(ctx, id, expectedVersion, false, t.nullTimeArg(now()))
+}
+
+// DeleteTodoTree trashes the Todo and its descendants with the same deleted_at, in a transaction.
+func (t *SQLTodoServiceImpl) DeleteTodoTree(ctx context.Context, id string, expectedVersion int64) error {
+	deletedAt := t.nullTimeArg(now())
+	return t.inTx(ctx, func(t *SQLTodoServiceImpl) error {
+		descendants, err := t.descendants(ctx, id, false)
+		if err != nil {
+			return err
+		}
+		if err := t.moveTodo(ctx, id, expectedVersion, false, deletedAt); err != nil || len(descendants) == 0 {
+			return err
+		}
+		_, err = t.exec(ctx, `UPDATE todos SET deleted_at = ?, version = version + 1 WHERE id IN (`+placeholders(len(descendants))+`)`,
+			append([]interface{}{deletedAt}, stringArgs(descendants)...)...)
+		return err
+	})
+}
+
+func (t *SQLTodoServiceImpl) RestoreTodo(ctx context.Context, id string, expectedVersion int64) (*models.Todo, error) {
+	if err := t.moveTodo(ctx, id, expectedVersion, true, nil); err != nil {
+		return nil, err
+	}
+	return t.GetTodoById(ctx, id)
+}
+
+// moveTodo sets the deletion time of a Todo, moving it in or out of the trash. trashed tells where the Todo has to be.
+func (t *SQLTodoServiceImpl) moveTodo(ctx context.Context, id string, expectedVersion int64, trashed bool, deletedAt interface{}) error {
+	if _, err := parseId(id); err != nil {
+		return err
+	}
+	stmt := `UPDATE todos SET deleted_at = ?, version = version + 1 WHERE id = ? AND deleted_at IS ` + nullCheck(trashed)
+	args := []interface{}{deletedAt, id}
+	if expectedVersion != 0 {
+		stmt += ` AND version = ?`
+		args = append(args, expectedVersion)
+	}
+	res, err := t.exec(ctx, stmt, args...)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return t.writeMissed(ctx, id, expectedVersion, trashed)
+	}
+	return nil
+}
+
+func (t *SQLTodoServiceImpl) PurgeTodo(ctx context.Context, id string, expectedVersion int64) error {
+	if _, err := parseId(id); err != nil {
+		return err
+	}
+	stmt := `DELETE FROM todos WHERE id = ? AND deleted_at IS NOT NULL`
+	args := []interface{}{id}
+	if expectedVersion != 0 {
+		stmt += ` AND version = ?`
+		args = append(args, expectedVersion)
+	}
+	return t.inTx(ctx, func(t *SQLTodoServiceImpl) error {
+		res, err := t.exec(ctx, stmt, args...)
+		if err != nil {
+			return err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return t.writeMissed(ctx, id, expectedVersion, true)
+		}
+		if _, err := t.exec(ctx, `DELETE FROM todo_tags WHERE todo_id = ?`, id); err != nil {
+			return err
+		}
+		_, err = t.exec(ctx, `DELETE FROM comments WHERE todo_id = ?`, id)
+		return err
+	})
+}
+
+func (t *SQLTodoServiceImpl) PurgeTrash(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	var purged int64
+	err := t.inTx(ctx, func(t *SQLTodoServiceImpl) error {
+		_, err := t.exec(ctx, `DELETE FROM todo_tags WHERE todo_id IN (SELECT id FROM todos WHERE deleted_at <= ?)`,
+			t.dialect.timeArg(deletedBefore))
+		if err != nil {
+			return err
+		}
+		_, err = t.exec(ctx, `DELETE FROM comments WHERE todo_id IN (SELECT id FROM todos WHERE deleted_at <= ?)`,
+			t.dialect.timeArg(deletedBefore))
+		if err != nil {
+			return err
+		}
+		res, err := t.exec(ctx, `DELETE FROM todos WHERE deleted_at <= ?`, t.dialect.timeArg(deletedBefore))
+		if err != nil {
+			return err
+		}
+		purged, err = res.RowsAffected()
+		return err
+	})
+	return purged, err
+}
+
+func (t *SQLTodoServiceImpl) ListTags(ctx context.Context, user string) ([]*models.TagCount, error) {
+	rows, err := t.query(ctx, `SELECT tag, COUNT(*) FROM todo_tags JOIN todos ON todos.id = todo_tags.todo_id
+		WHERE todos.user_id = ? AND todos.deleted_at IS NULL GROUP BY tag ORDER BY tag`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []*models.TagCount{}
+	for rows.Next() {
+		count := &models.TagCount{}
+		if err := rows.Scan(&count.Tag, &count.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, count)
+	}
+	return tags, rows.Err()
+}
+
+// RenameTag bumps the version of the Todos carrying the tag, drops it from those already carrying the new tag and
+// renames it on the others, keeping its position.
+func (t *SQLTodoServiceImpl) RenameTag(ctx context.Context, user, from, to string) (int64, error) {
+	if from == to {
+		return 0, nil
+	}
+	var renamed int64
+	err := t.inTx(ctx, func(t *SQLTodoServiceImpl) error {
+		res, err := t.exec(ctx, `UPDATE todos SET updated_at = ?, version = version + 1
+			WHERE user_id = ? AND id IN (SELECT todo_id FROM todo_tags WHERE tag = ?)`, t.dialect.timeArg(now()), user, from)
+		if err != nil {
+			return err
+		}
+		if renamed, err = res.RowsAffected(); err != nil || renamed == 0 {
+			return err
+		}
+		_, err = t.exec(ctx, `DELETE FROM todo_tags WHERE tag = ?
+			AND todo_id IN (SELECT id FROM todos WHERE user_id = ?)
+			AND todo_id IN (SELECT todo_id FROM todo_tags WHERE tag = ?)`, from, user, to)
+		if err != nil {
+			return err
+		}
+		_, err = t.exec(ctx, `UPDATE todo_tags SET tag = ? WHERE tag = ? AND todo_id IN (SELECT id FROM todos WHERE user_id = ?)`,
+			to, from, user)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return renamed, nil
+}
+
+func (t *SQLTodoServiceImpl) AddChecklistItem(ctx context.Context, id, text string, expectedVersion int64) (*models.Todo, error) {
+	return t.editChecklist(ctx, id, expectedVersion, addChecklistItem(text))
+}
+
+func (t *SQLTodoServiceImpl) ToggleChecklistItem(ctx context.Context, id, itemId string, done bool, expectedVersion int64) (*models.Todo, error) {
+	return t.editChecklist(ctx, id, expectedVersion, toggleChecklistItem(itemId, done))
+}
+
+func (t *SQLTodoServiceImpl) ReorderChecklist(ctx context.Context, id string, itemIds []string, expectedVersion int64) (*models.Todo, error) {
+	return t.editChecklist(ctx, id, expectedVersion, reorderChecklist(itemIds))
+}
+
+// editChecklist applies edit to the checklist of the Todo. A Todo the auto-completion marks done is completed like
+// UpdateTodo does, with its descendants and next occurrence, in the transaction of the edit.
+func (t *SQLTodoServiceImpl) editChecklist(ctx context.Context, id string, expectedVersion int64, edit checklistEdit) (*models.Todo, error) {
+	var edited *models.Todo
+	err := t.inTx(ctx, func(t *SQLTodoServiceImpl) error {
+		var open []string
+		completed := false
+		apply := t.opts.editChecklist(expectedVersion, edit, func(todo *models.Todo) error {
+			completed = true
+			if !t.opts.completesDescendants(completion()) {
+				return nil
+			}
+			var err error
+			if open, err = t.descendants(ctx, id, true); err != nil {
+				return err
+			}
+			return t.opts.checkCompletion(id, len(open))
+		})
+		// The Todo is read again when it changed in between, and may not be completed then.
+		todo, err := t.editTodo(ctx, id, expectedVersion, func(todo *models.Todo) error {
+			completed, open = false, nil
+			return apply(todo)
+		})
+		if err != nil || !completed {
+			edited = todo
+			return err
+		}
+		if len(open) != 0 {
+			_, err := t.exec(ctx, `UPDATE todos SET done = ?, updated_at = ?, version = version + 1 WHERE id IN (`+placeholders(len(open))+`)`,
+				append([]interface{}{true, t.dialect.timeArg(todo.UpdatedAt)}, stringArgs(open)...)...)
+			if err != nil {
+				return err
+			}
+		}
+		if err := t.continueSeries(ctx, id, completion(), todo.UpdatedAt); err != nil {
+			return err
+		}
+		edited, err = t.GetTodoById(ctx, id)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return edited, nil
+}
+
+func (t *SQLTodoServiceImpl) RemoveChecklistItem(ctx context.Context, id, itemId string, expectedVersion int64) (*models.Todo, error) {
+	return t.editChecklist(ctx, id, expectedVersion, removeChecklistItem(itemId))
+}
+
+func (t *SQLTodoServiceImpl) SkipOccurrence(ctx context.Context, id string, expectedVersion int64) (*models.Todo, error) {
+	return t.editTodo(ctx, id, expectedVersion, skipOccurrence(expectedVersion))
+}
+
+func (t *SQLTodoServiceImpl) MoveTodo(ctx context.Context, id string, move *models.MoveTodo) (*models.Todo, error) {
+	target, err := moveTarget(move, func(id string) (*models.Todo, error) {
+		return t.GetTodoById(ctx, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return t.editTodo(ctx, id, move.ExpectedVersion, placeTodo(move, target, func(todo *models.Todo, before bool) (string, error) {
+		stmt := `SELECT MIN(position) FROM todos WHERE user_id = ? AND id <> ? AND position > ?`
+		if before {
+			stmt = `SELECT MAX(position) FROM todos WHERE user_id = ? AND id <> ? AND position < ?`
+		}
+		args := []interface{}{todo.User, todo.Id.Hex(), target.Position}
+		if todo.ListId.IsZero() {
+			stmt += ` AND list_id IS NULL`
+		} else {
+			stmt += ` AND list_id = ?`
+			args = append(args, todo.ListId.Hex())
+		}
+		var next sql.NullString
+		if err := t.queryRow(ctx, stmt, args...).Scan(&next); err != nil {
+			return "", err
+		}
+		return next.String, nil
+	}))
+}
+
+// reminderClaimCondition matches the Todos with reminders due at its parameter, which no scheduler is delivering
+// at its second one.
+const reminderClaimCondition = `next_reminder_at <= ? AND done = ? AND deleted_at IS NULL
+	AND (reminder_lease IS NULL OR reminder_lease <= ?)`
+
+// ClaimReminders selects the Todos with reminders due, then claims them one at a time with a conditional update so
+// that concurrent schedulers never claim the same Todo.
+func (t *SQLTodoServiceImpl) ClaimReminders(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*models.ReminderClaim, error) {
+	conditionArgs := []interface{}{t.dialect.timeArg(now), false, t.dialect.timeArg(now)}
+	rows, err := t.query(ctx, `SELECT id FROM todos WHERE `+reminderClaimCondition+` ORDER BY next_reminder_at LIMIT `+
+		strconv.Itoa(limit), conditionArgs...)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var claims []*models.ReminderClaim
+	for _, id := range ids {
+		claimId := newReminderClaimId()
+		res, err := t.exec(ctx, `UPDATE todos SET reminder_lease = ?, reminder_claim = ? WHERE id = ? AND `+reminderClaimCondition,
+			append([]interface{}{t.dialect.timeArg(now.Add(lease)), claimId, id}, conditionArgs...)...)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 0 {
+			// Claimed by another scheduler, or changed, since it was selected.
+			continue
+		}
+		todo, err := scanTodo(t.queryRow(ctx, t.selectTodos()+` WHERE id = ? AND reminder_claim = ?`, id, claimId))
+		if err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		claims = append(claims, newReminderClaim(todo, now))
+	}
+	return claims, nil
+}
+
+// CompleteReminders writes the reminders on the condition that the claim still holds and that the Todo is still at
+// the version read, a Todo modified in between is read again.
+func (t *SQLTodoServiceImpl) CompleteReminders(ctx context.Context, claim *models.ReminderClaim, sent []time.Time) error {
+	for {
+		todo, err := scanTodo(t.queryRow(ctx, t.selectTodos()+` WHERE id = ? AND reminder_claim = ?`, claim.Todo.Id.Hex(), claim.Id))
+		if err == sql.ErrNoRows {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		completeReminders(todo, claim, sent, now())
+		reminders, err := remindersArg(todo.Reminders)
+		if err != nil {
+			return err
+		}
+
+		res, err := t.exec(ctx, `UPDATE todos SET reminders = ?, next_reminder_at = ?, reminder_lease = ?, reminder_claim = ?
+			WHERE id = ? AND reminder_claim = ? AND version = ?`,
+			reminders, t.nullTimeArg(todo.NextReminderAt), t.nullTimeArg(todo.ReminderLease), todo.ReminderClaim,
+			todo.Id.Hex(), claim.Id, todo.Version)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 1 {
+			return err
+		}
+	}
+}
+
+// editTodo reads the Todo, edits it and writes it back on the condition that it is still at the version read.
+// A Todo modified in between is read again, unless the caller expected a version.
+func (t *SQLTodoServiceImpl) editTodo(ctx context.Context, id string, expectedVersion int64, edit todoEdit) (*models.Todo, error) {
+	for {
+		todo, err := t.GetTodoById(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		readVersion := todo.Version
+		if err := edit(todo); err != nil {
+			return nil, err
+		}
+		checklist, err := checklistArg(todo.Checklist)
+		if err != nil {
+			return nil, err
+		}
+		reminders, err := remindersArg(todo.Reminders)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := t.exec(ctx, `UPDATE todos SET checklist = ?, done = ?, due_at = ?, recurrence = ?, reminders = ?,
+			next_reminder_at = ?, position = ?, updated_at = ?, version = ? WHERE id = ? AND deleted_at IS NULL AND version = ?`,
+			checklist, todo.Done, t.nullTimeArg(todo.DueAt), todo.Recurrence, reminders, t.nullTimeArg(todo.NextReminderAt),
+			todo.Position, t.dialect.timeArg(todo.UpdatedAt), todo.Version, id, readVersion)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return nil, err
+		} else if n == 1 {
+			return todo, nil
+		}
+		if expectedVersion != 0 {
+			return nil, t.writeMissed(ctx, id, expectedVersion, false)
+		}
+	}
+}
+
+func (t *SQLTodoServiceImpl) CreateList(ctx context.Context, request *models.CreateListRequest) (*models.List, error) {
+	list, err := newList(request)
+	if err != nil {
+		return nil, err
+	}
+	_, err = t.exec(ctx, `INSERT INTO lists (id, user_id, name, created_at, updated_at, version) VALUES (?, ?, ?, ?, ?, ?)`,
+		list.Id.Hex(), list.User, list.Name, t.dialect.timeArg(list.CreatedAt), t.dialect.timeArg(list.UpdatedAt), list.Version)
+	if err != nil {
+		return nil, err
+	}
+	return list, nil
+}
+
+func (t *SQLTodoServiceImpl) GetList(ctx context.Context, id string) (*models.List, error) {
+	if _, err := parseId(id); err != nil {
+		return nil, err
+	}
+	list, err := scanList(t.queryRow(ctx, `SELECT `+listColumns+` FROM lists WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return nil, listNotFound(id)
+	}
+	return list, err
+}
+
+// UpdateList reads the List, updates it and writes it back on the condition that it is still at the version read.
+// A List modified in between is read again, unless the caller expected a version.
+func (t *SQLTodoServiceImpl) UpdateList(ctx context.Context, id string, data *models.UpdateList) (*models.List, error) {
+	for {
+		list, err := t.GetList(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkListVersion(list, data.ExpectedVersion); err != nil {
+			return nil, err
+		}
+		readVersion := list.Version
+		if updated, err := updateList(list, data); err != nil || !updated {
+			return list, err
+		}
+
+		res, err := t.exec(ctx, `UPDATE lists SET name = ?, updated_at = ?, version = ? WHERE id = ? AND version = ?`,
+			list.Name, t.dialect.timeArg(list.UpdatedAt), list.Version, id, readVersion)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 1 {
+			return list, err
+		}
+	}
+}
+
+// DeleteList deletes the List and moves its Todos out of it in a transaction, with a single write for the Todos.
+func (t *SQLTodoServiceImpl) DeleteList(ctx context.Context, id string, expectedVersion int64, cascade bool) error {
+	if _, err := parseId(id); err != nil {
+		return err
+	}
+	stmt := `DELETE FROM lists WHERE id = ?`
+	args := []interface{}{id}
+	if expectedVersion != 0 {
+		stmt += ` AND version = ?`
+		args = append(args, expectedVersion)
+	}
+	movedAt := t.dialect.timeArg(now())
+	return t.inTx(ctx, func(t *SQLTodoServiceImpl) error {
+		res, err := t.exec(ctx, stmt, args...)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			list, err := t.GetList(ctx, id)
+			if err != nil {
+				return err
+			}
+			return checkListVersion(list, expectedVersion)
+		}
+
+		move := `UPDATE todos SET list_id = NULL, updated_at = ?, version = version + 1`
+		moveArgs := []interface{}{movedAt}
+		if cascade {
+			move += `, deleted_at = COALESCE(deleted_at, ?)`
+			moveArgs = append(moveArgs, movedAt)
+		}
+		_, err = t.exec(ctx, move+` WHERE list_id = ?`, append(moveArgs, id)...)
+		return err
+	})
+}
+
+func (t *SQLTodoServiceImpl) ListLists(ctx context.Context, user string) ([]*models.List, error) {
+	rows, err := t.query(ctx, `SELECT `+listColumns+` FROM lists WHERE user_id = ?`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lists []*models.List
+	for rows.Next() {
+		list, err := scanList(rows)
+		if err != nil {
+			return nil, err
+		}
+		lists = append(lists, list)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return withInbox(user, lists), nil
+}
+
+// AddComment counts the Comment on its Todo and inserts it in a transaction, the count fails for a Todo in the
+// trash.
+func (t *SQLTodoServiceImpl) AddComment(ctx context.Context, todoId string, request *models.CreateCommentRequest) (*models.Comment, error) {
+	objectId, err := parseCommentTodoId(todoId)
+	if err != nil {
+		return nil, err
+	}
+	comment, err := newComment(objectId, request)
+	if err != nil {
+		return nil, err
+	}
+	err = t.inTx(ctx, func(t *SQLTodoServiceImpl) error {
+		if err := t.countComments(ctx, todoId, 1); err != nil {
+			return err
+		}
+		_, err := t.exec(ctx, `INSERT INTO comments (`+commentColumns+`) VALUES (`+placeholders(7)+`)`,
+			comment.Id.Hex(), todoId, comment.Author, comment.Body, t.dialect.timeArg(comment.CreatedAt),
+			t.dialect.timeArg(comment.UpdatedAt), comment.Version)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+// UpdateComment reads the Comment, updates it and writes it back on the condition that it is still at the version
+// read. A Comment modified in between is read again, unless the caller expected a version.
+func (t *SQLTodoServiceImpl) UpdateComment(ctx context.Context, id, body string, expectedVersion int64) (*models.Comment, error) {
+	if _, err := parseId(id); err != nil {
+		return nil, err
+	}
+	for {
+		comment, err := t.readComment(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		readVersion := comment.Version
+		if err := editComment(comment, body, expectedVersion); err != nil {
+			return nil, err
+		}
+
+		res, err := t.exec(ctx, `UPDATE comments SET body = ?, updated_at = ?, version = ? WHERE id = ? AND version = ?`,
+			comment.Body, t.dialect.timeArg(comment.UpdatedAt), comment.Version, id, readVersion)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 1 {
+			return comment, err
+		}
+	}
+}
+
+// DeleteComment deletes the Comment and uncounts it on its Todo in a transaction.
+func (t *SQLTodoServiceImpl) DeleteComment(ctx context.Context, id string, expectedVersion int64) error {
+	if _, err := parseId(id); err != nil {
+		return err
+	}
+	return t.inTx(ctx, func(t *SQLTodoServiceImpl) error {
+		comment, err := t.readComment(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := checkCommentVersion(comment, expectedVersion); err != nil {
+			return err
+		}
+		res, err := t.exec(ctx, `DELETE FROM comments WHERE id = ? AND version = ?`, id, comment.Version)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return commentNotFound(id)
+		}
+		return t.countComments(ctx, comment.TodoId.Hex(), -1)
+	})
+}
+
+func (t *SQLTodoServiceImpl) ListComments(ctx context.Context, todoId string) ([]*models.Comment, error) {
+	if _, err := parseCommentTodoId(todoId); err != nil {
+		return nil, err
+	}
+	var trashed bool
+	err := t.queryRow(ctx, `SELECT deleted_at IS NOT NULL FROM todos WHERE id = ?`, todoId).Scan(&trashed)
+	if err == sql.ErrNoRows || trashed {
+		return nil, notFound(todoId)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := t.query(ctx, `SELECT `+commentColumns+` FROM comments WHERE todo_id = ? ORDER BY created_at, id`, todoId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments := []*models.Comment{}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return nil, err
+		}
+		comments = append(comments, comment)
+	}
+	return comments, rows.Err()
+}
+
+// readComment reads a Comment on a Todo out of the trash.
+func (t *SQLTodoServiceImpl) readComment(ctx context.Context, id string) (*models.Comment, error) {
+	comment, err := scanComment(t.queryRow(ctx, `SELECT `+commentColumns+` FROM comments
+		WHERE id = ? AND todo_id IN (SELECT id FROM todos WHERE deleted_at IS NULL)`, id))
+	if err == sql.ErrNoRows {
+		return nil, commentNotFound(id)
+	}
+	return comment, err
+}
+
+// countComments adds delta to the comment_count of the Todo, leaving its version alone. Comments are only added
+// to the Todos out of the trash, but the Todo of a Comment deleted may have been trashed since it was read.
+func (t *SQLTodoServiceImpl) countComments(ctx context.Context, todoId string, delta int64) error {
+	stmt := `UPDATE todos SET comment_count = comment_count + ? WHERE id = ?`
+	if delta > 0 {
+		stmt += ` AND deleted_at IS NULL`
+	}
+	res, err := t.exec(ctx, stmt, delta, todoId)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return notFound(todoId)
+	}
+	return nil
+}
+
+func (t *SQLTodoServiceImpl) BatchCreateTodos(ctx context.Context, requests []*models.CreateTodoRequest, atomic bool) ([]BatchResult, error) {
+	return t.runBatch(ctx, createBatchIds(requests), atomic, func(t *SQLTodoServiceImpl, i int) (*models.Todo, error) {
+		return t.CreateTodo(ctx, requests[i])
+	})
+}
+
+func (t *SQLTodoServiceImpl) BatchUpdateTodos(ctx context.Context, items []*models.BatchUpdateItem, atomic bool) ([]BatchResult, error) {
+	ids, err := updateBatchIds(items)
+	if err != nil {
+		return nil, err
+	}
+	return t.runBatch(ctx, ids, atomic, func(t *SQLTodoServiceImpl, i int) (*models.Todo, error) {
+		return t.UpdateTodo(ctx, items[i].Id, items[i].Update)
+	})
+}
+
+func (t *SQLTodoServiceImpl) BatchDeleteTodos(ctx context.Context, items []*models.BatchDeleteItem, atomic bool) ([]BatchResult, error) {
+	ids, err := deleteBatchIds(items)
+	if err != nil {
+		return nil, err
+	}
+	return t.runBatch(ctx, ids, atomic, func(t *SQLTodoServiceImpl, i int) (*models.Todo, error) {
+		return nil, t.DeleteTodo(ctx, items[i].Id, items[i].ExpectedVersion)
+	})
+}
+
+// runBatch runs the whole batch in one transaction, so that the statements are not synced one by one. The items
+// that succeeded are committed even when others failed, unless the batch is atomic.
+func (t *SQLTodoServiceImpl) runBatch(ctx context.Context, ids []string, atomic bool, item func(t *SQLTodoServiceImpl, i int) (*models.Todo, error)) ([]BatchResult, error) {
+	if !atomic && t.dialect.abortsTxOnError {
+		// A failed statement would abort the transaction along with the items that follow it.
+		return runBatch(ctx, ids, false, func(i int) (*models.Todo, error) { return item(t, i) })
+	}
+
+	var results []BatchResult
+	err := t.inTx(ctx, func(tx *SQLTodoServiceImpl) error {
+		var err error
+		results, err = runBatch(ctx, ids, atomic, func(i int) (*models.Todo, error) { return item(tx, i) })
+		if err == nil && atomic && batchFailed(results) {
+			return errRollback
+		}
+		return err
+	})
+	if err != nil && err != errRollback {
+		return nil, err
+	}
+	return results, nil
+}
+
+// writeMissed tells why a write matched no row, the Todo is either gone or not at the expected version. trashed
+// tells whether the write was about a Todo in the trash.
+func (t *SQLTodoServiceImpl) writeMissed(ctx context.Context, id string, expectedVersion int64, trashed bool) error {
+	if expectedVersion == 0 {
+		return notFound(id)
+	}
+	todo, err := t.getTodo(ctx, id, trashed)
+	if err != nil {
+		return err
+	}
+	return versionMismatch(id, expectedVersion, todo.Version)
+}
+
+func (t *SQLTodoServiceImpl) exec(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if t.tx != nil {
+		return t.tx.ExecContext(ctx, t.dialect.rebind(query), args...)
+	}
+	return t.db.ExecContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *SQLTodoServiceImpl) query(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if t.tx != nil {
+		return t.tx.QueryContext(ctx, t.dialect.rebind(query), args...)
+	}
+	return t.db.QueryContext(ctx, t.dialect.rebind(query), args...)
+}
+
+func (t *SQLTodoServiceImpl) queryRow(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if t.tx != nil {
+		return t.tx.QueryRowContext(ctx, t.dialect.rebind(query), args...)
+	}
+	return t.db.QueryRowContext(ctx, t.dialect.rebind(query), args...)
+}
+
+// nullTimeArg is timeArg for a nullable timestamp column, the zero time is stored as NULL.
+func (t *SQLTodoServiceImpl) nullTimeArg(tm time.Time) interface{} {
+	if tm.IsZero() {
+		return nil
+	}
+	return t.dialect.timeArg(tm)
+}
+
+// subtreeQuery selects into subtree the Todo whose Id is its parameter and its descendants, as long as they are out
+// of the trash. It is followed by the SELECT reading them. UNION stops at the Todos already walked.
+const subtreeQuery = `WITH RECURSIVE subtree(id) AS (
+	SELECT id FROM todos WHERE id = ? AND deleted_at IS NULL
+	UNION
+	SELECT todos.id FROM todos JOIN subtree ON todos.parent_id = subtree.id WHERE todos.deleted_at IS NULL
+)`
+
+// descendants returns the Ids of the descendants of a Todo that are out of the trash, only the ones that are not
+// done when open is set. A Todo in the trash has none.
+func (t *SQLTodoServiceImpl) descendants(ctx context.Context, id string, open bool) ([]string, error) {
+	stmt := subtreeQuery + ` SELECT id FROM subtree WHERE id <> ?`
+	args := []interface{}{id, id}
+	if open {
+		stmt = subtreeQuery + ` SELECT todos.id FROM todos JOIN subtree ON todos.id = subtree.id WHERE todos.id <> ? AND todos.done = ?`
+		args = append(args, false)
+	}
+	rows, err := t.query(ctx, stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// checkParent checks that parentId can be the parent of the Todo id.
+func (t *SQLTodoServiceImpl) checkParent(ctx context.Context, id primitive.ObjectID, parentId string) error {
+	parentObjectId, err := parseParentId(parentId)
+	if err != nil {
+		return err
+	}
+	return checkParent(id, parentObjectId, func(id primitive.ObjectID) (*todoLink, error) {
+		var trashed bool
+		var link todoLink
+		err := t.queryRow(ctx, `SELECT parent_id, deleted_at IS NOT NULL FROM todos WHERE id = ?`, id.Hex()).
+			Scan(sqlObjectId{&link.parentId}, &trashed)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		link.trashed = trashed
+		return &link, nil
+	})
+}
+
+// checkNewTodo checks the parent and the List of a Todo to create.
+func (t *SQLTodoServiceImpl) checkNewTodo(ctx context.Context, request *models.CreateTodoRequest) error {
+	if err := t.checkParent(ctx, primitive.NilObjectID, request.ParentId); err != nil {
+		return err
+	}
+	listId, err := parseListId(request.ListId)
+	if err != nil {
+		return err
+	}
+	return checkList(request.User, listId, t.readList(ctx))
+}
+
+// readList returns the function reading a stored List for checkList.
+func (t *SQLTodoServiceImpl) readList(ctx context.Context) func(id primitive.ObjectID) (*models.List, error) {
+	return func(id primitive.ObjectID) (*models.List, error) {
+		list, err := scanList(t.queryRow(ctx, `SELECT `+listColumns+` FROM lists WHERE id = ?`, id.Hex()))
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return list, err
+	}
+}
+
+// selectTodos is the SELECT reading the Todos along with their tags, for scanTodo.
+func (t *SQLTodoServiceImpl) selectTodos() string {
+	return `SELECT ` + todoColumns + `, checklist, reminders, ` + t.dialect.tagsColumn + ` FROM todos`
+}
+
+// placeholders returns n comma separated '?' placeholders, for an IN list.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return args
+}
+
+// nullCheck completes a "column IS" condition, matching the rows where the column is set or not.
+func nullCheck(set bool) string {
+	if set {
+		return "NOT NULL"
+	}
+	return "NULL"
+}
+
+// rebindDollar turns the '?' placeholders into the $1, $2, ... form used by Postgres.
+func rebindDollar(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// sqlTime scans a timestamp column, stored either as unix milliseconds (SQLite) or natively (Postgres). NULL is
+// scanned as the zero time.
+type sqlTime struct {
+	t *time.Time
+}
+
+func (s sqlTime) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*s.t = time.Time{}
+	case int64:
+		*s.t = time.UnixMilli(v).UTC()
+	case time.Time:
+		*s.t = v.UTC()
+	default:
+		return fmt.Errorf("cannot scan %T into a timestamp", src)
+	}
+	return nil
+}
+
+// sqlTags scans the tags column of selectTodos, NULL when the Todo has no tags.
+type sqlTags struct {
+	tags *[]string
+}
+
+func (s sqlTags) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*s.tags = nil
+	case string:
+		*s.tags = strings.Split(v, tagSeparator)
+	case []byte:
+		*s.tags = strings.Split(string(v), tagSeparator)
+	default:
+		return fmt.Errorf("cannot scan %T into tags", src)
+	}
+	return nil
+}
+
+// sqlObjectId scans a nullable Id column, NULL is scanned as the zero ObjectID.
+type sqlObjectId struct {
+	id *primitive.ObjectID
+}
+
+func (s sqlObjectId) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*s.id = primitive.NilObjectID
+		return nil
+	case string:
+		return s.parse(v)
+	case []byte:
+		return s.parse(string(v))
+	default:
+		return fmt.Errorf("cannot scan %T into an Id", src)
+	}
+}
+
+func (s sqlObjectId) parse(hex string) error {
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return err
+	}
+	*s.id = id
+	return nil
+}
+
+// objectIdArg is the nullable Id column value of an Id, NULL for the zero ObjectID.
+func objectIdArg(id primitive.ObjectID) interface{} {
+	if id.IsZero() {
+		return nil
+	}
+	return id.Hex()
+}
+
+// sqlChecklist scans the checklist column, the JSON array of the items. NULL when the Todo has no checklist.
+type sqlChecklist struct {
+	checklist *[]models.ChecklistItem
+}
+
+func (s sqlChecklist) Scan(src interface{}) error {
+	*s.checklist = nil
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), s.checklist)
+	case []byte:
+		return json.Unmarshal(v, s.checklist)
+	default:
+		return fmt.Errorf("cannot scan %T into a checklist", src)
+	}
+}
+
+// checklistArg is the checklist column value of a checklist.
+func checklistArg(checklist []models.ChecklistItem) (interface{}, error) {
+	if len(checklist) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(checklist)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// sqlReminders scans the reminders column, the JSON array of the reminders. NULL when the Todo has no reminders.
+type sqlReminders struct {
+	reminders *[]models.Reminder
+}
+
+func (s sqlReminders) Scan(src interface{}) error {
+	*s.reminders = nil
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), s.reminders)
+	case []byte:
+		return json.Unmarshal(v, s.reminders)
+	default:
+		return fmt.Errorf("cannot scan %T into reminders", src)
+	}
+}
+
+// remindersArg is the reminders column value of reminders.
+func remindersArg(reminders []models.Reminder) (interface{}, error) {
+	if len(reminders) == 0 {
+		return nil, nil
+	}
+	b, err := json.Marshal(reminders)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func scanTodo(row rowScanner) (*models.Todo, error) {
+	var id string
+	todo := &models.Todo{}
+	err := row.Scan(&id, &todo.Title, &todo.Description, &todo.User, &todo.Done,
+		sqlTime{&todo.CreatedAt}, sqlTime{&todo.UpdatedAt}, &todo.Version, sqlTime{&todo.DeletedAt},
+		sqlTime{&todo.DueAt}, &todo.Priority, sqlObjectId{&todo.ParentId}, &todo.Recurrence,
+		sqlObjectId{&todo.NextOccurrenceId}, sqlTime{&todo.NextReminderAt}, sqlTime{&todo.ReminderLease}, &todo.ReminderClaim,
+		sqlObjectId{&todo.ListId}, &todo.Position, &todo.CommentCount, sqlChecklist{&todo.Checklist}, sqlReminders{&todo.Reminders}, sqlTags{&todo.Tags})
+	if err != nil {
+		return nil, err
+	}
+
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	todo.Id = objectId
+	return todo, nil
+}
+
+func scanComment(row rowScanner) (*models.Comment, error) {
+	var id, todoId string
+	comment := &models.Comment{}
+	err := row.Scan(&id, &todoId, &comment.Author, &comment.Body, sqlTime{&comment.CreatedAt}, sqlTime{&comment.UpdatedAt},
+		&comment.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.Id, err = primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	if comment.TodoId, err = primitive.ObjectIDFromHex(todoId); err != nil {
+		return nil, err
+	}
+	return comment, nil
+}
+
+func scanList(row rowScanner) (*models.List, error) {
+	var id string
+	list := &models.List{}
+	err := row.Scan(&id, &list.User, &list.Name, sqlTime{&list.CreatedAt}, sqlTime{&list.UpdatedAt}, &list.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	objectId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	list.Id = objectId
+	return list, nil
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/todo-project/models"
+	"github.com/todo-project/pb"
+	"github.com/todo-project/utils"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func newSQLiteTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "todo.db"))
+	if err != nil {
+		t.Fatalf("could not open sqlite db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := MigrateSQLite(context.TODO(), db); err != nil {
+		t.Fatalf("could not migrate sqlite db: %v", err)
+	}
+	return db
+}
+
+// newPostgresTestDB connects to the disposable database in POSTGRES_TEST_URI, the test is skipped when it is not set.
+func newPostgresTestDB(t *testing.T) *sql.DB {
+	uri := os.Getenv("POSTGRES_TEST_URI")
+	if len(uri) == 0 {
+		t.Skip("POSTGRES_TEST_URI not set")
+	}
+	db, err := sql.Open("postgres", uri)
+	if err != nil {
+		t.Fatalf("could not open postgres db: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := MigratePostgres(context.TODO(), db); err != nil {
+		t.Fatalf("could not migrate postgres db: %v", err)
+	}
+	if _, err := db.Exec(`TRUNCATE todos, idempotency_keys, todo_tags, lists, comments`); err != nil {
+		t.Fatalf("could not clean postgres db: %v", err)
+	}
+	return db
+}
+
+func TestRebindDollar(t *testing.T) {
+	assert.Equal(t, "SELECT 1", rebindDollar("SELECT 1"))
+	assert.Equal(t, "UPDATE todos SET title = $1, done = $2 WHERE id = $3",
+		rebindDollar("UPDATE todos SET title = ?, done = ? WHERE id = ?"))
+}
+
+func TestMigratePostgres(t *testing.T) {
+	db := newPostgresTestDB(t)
+
+	assert.Nil(t, MigratePostgres(context.TODO(), db))
+	assert.Nil(t, CheckPostgresSchema(context.TODO(), db))
+}
+
+func TestPostgresTodoServiceImpl(t *testing.T) {
+	todoImpl := NewPostgresTodoService(newPostgresTestDB(t), Options{})
+
+	newTodo, err := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "title", Description: "desc", User: "1"})
+	assert.Nil(t, err)
+
+	updatedTodo, err := todoImpl.UpdateTodo(context.TODO(), newTodo.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	assert.True(t, updatedTodo.Done)
+
+	todos, err := collectTodos(todoImpl, &models.TodoQuery{Status: pb.GetItemsRequest_DONE, User: "1"})
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.Todo{updatedTodo}, todos)
+
+	assert.Nil(t, todoImpl.DeleteTodo(context.TODO(), newTodo.Id.Hex(), 0))
+	_, err = todoImpl.GetTodoById(context.TODO(), newTodo.Id.Hex())
+	assert.Equal(t, KindNotFound, KindOf(err))
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	db := newSQLiteTestDB(t)
+
+	// Running the migrations again must be a no-op.
+	assert.Nil(t, MigrateSQLite(context.TODO(), db))
+
+	var version int
+	err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version)
+	assert.Nil(t, err)
+	assert.Equal(t, len(sqliteMigrations), version)
+}
+
+func TestSQLiteIsUniqueViolation(t *testing.T) {
+	db := newSQLiteTestDB(t)
+	id := primitive.NewObjectID().Hex()
+
+	// Every other column has a default.
+	insert := `INSERT INTO todos (id) VALUES (?)`
+	_, err := db.Exec(insert, id)
+	assert.Nil(t, err)
+	assert.False(t, sqliteDialect.isUniqueViolation(err))
+
+	_, err = db.Exec(insert, id)
+	assert.NotNil(t, err)
+	assert.True(t, sqliteDialect.isUniqueViolation(err))
+}
+
+func TestSQLTodoServiceImpl_CreateAndGetTodo(t *testing.T) {
+	todoImpl := NewSQLiteTodoService(newSQLiteTestDB(t), Options{})
+
+	newTodo, err := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{
+		Title:       "title",
+		Description: "desc",
+		User:        "1",
+	})
+	assert.Nil(t, err)
+	assert.False(t, newTodo.Id.IsZero())
+
+	todo, err := todoImpl.GetTodoById(context.TODO(), newTodo.Id.Hex())
+	assert.Nil(t, err)
+	assert.Equal(t, newTodo, todo)
+
+	todo, err = todoImpl.GetTodoById(context.TODO(), primitive.NewObjectID().Hex())
+	assert.Nil(t, todo)
+	assert.Equal(t, KindNotFound, KindOf(err))
+}
+
+func TestSQLTodoServiceImpl_UpdateTodo(t *testing.T) {
+	todoImpl := NewSQLiteTodoService(newSQLiteTestDB(t), Options{})
+	newTodo, _ := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "title", Description: "desc", User: "1"})
+
+	updatedTodo, err := todoImpl.UpdateTodo(context.TODO(), newTodo.Id.Hex(), &models.UpdateTodo{User: utils.Pointer("2"), Done: utils.BoolPointer(true)})
+	assert.Nil(t, err)
+	assert.Equal(t, &models.Todo{
+		Id:          newTodo.Id,
+		Title:       "title",
+		Description: "desc",
+		User:        "2",
+		Done:        true,
+		CreatedAt:   newTodo.CreatedAt,
+		UpdatedAt:   updatedTodo.UpdatedAt,
+		Version:     2,
+		Position:    newTodo.Position,
+	}, updatedTodo)
+
+	_, err = todoImpl.UpdateTodo(context.TODO(), primitive.NewObjectID().Hex(), &models.UpdateTodo{Title: utils.Pointer("title")})
+	assert.Equal(t, KindNotFound, KindOf(err))
+
+	_, err = todoImpl.UpdateTodo(context.TODO(), primitive.NewObjectID().Hex(), &models.UpdateTodo{})
+	assert.Equal(t, KindNotFound, KindOf(err))
+}
+
+func TestSQLTodoServiceImpl_GetAllTodos(t *testing.T) {
+	todoImpl := NewSQLiteTodoService(newSQLiteTestDB(t), Options{})
+	todo1, _ := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "one", User: "1"})
+	todo2, _ := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "two", User: "2"})
+	todo3, _ := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "three", User: "2"})
+	todo3, _ = todoImpl.UpdateTodo(context.TODO(), todo3.Id.Hex(), &models.UpdateTodo{Done: utils.BoolPointer(true)})
+
+	todos, err := collectTodos(todoImpl, &models.TodoQuery{Status: pb.GetItemsRequest_ALL})
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.Todo{todo1, todo2, todo3}, todos)
+
+	todos, err = collectTodos(todoImpl, &models.TodoQuery{Status: pb.GetItemsRequest_DONE, User: "2"})
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.Todo{todo3}, todos)
+
+	todos, err = collectTodos(todoImpl, &models.TodoQuery{Status: pb.GetItemsRequest_PENDING, User: ""})
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.Todo{todo1, todo2}, todos)
+
+	todos, err = collectTodos(todoImpl, &models.TodoQuery{Status: pb.GetItemsRequest_ALL, User: "3"})
+	assert.Nil(t, err)
+	assert.Equal(t, []*models.Todo{}, todos)
+}
+
+func TestSQLTodoServiceImpl_DeleteTodo(t *testing.T) {
+	todoImpl := NewSQLiteTodoService(newSQLiteTestDB(t), Options{})
+	newTodo, _ := todoImpl.CreateTodo(context.TODO(), &models.CreateTodoRequest{Title: "title", User: "1"})
+
+	err := todoImpl.DeleteTodo(context.TODO(), newTodo.Id.Hex(), 0)
+	assert.Nil(t, err)
+
+	err = todoImpl.DeleteTodo(context.TODO(), newTodo.Id.Hex(), 0)
+	assert.Equal(t, KindNotFound, KindOf(err))
+}
@@ -15,3 +15,7 @@ func ToMongoBson(v interface{}) (bsonD *bson.D, err error) {
 func Pointer(str string) *string {
 	return &str
 }
+
+func BoolPointer(b bool) *bool {
+	return &b
+}